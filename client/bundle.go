@@ -0,0 +1,218 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"golang.org/x/net/context"
+)
+
+// ChangelistBundle is a portable copy of the pending changes for a repository,
+// so that changes staged on one machine can be imported on another, such as
+// one holding the keys needed to publish them
+type ChangelistBundle struct {
+	GUN     data.GUN                `json:"gun"`
+	Changes []*changelist.TUFChange `json:"changes"`
+	// Role is the root, targets role or delegation whose key signed the
+	// bundle.  The changes must all be to that role or the delegations below
+	// it, unless it is the root.
+	Role data.RoleName `json:"role"`
+	// Signatures are over the canonical JSON encoding of the GUN, the changes
+	// and the role, so that the changes can't be altered without the key
+	Signatures []data.Signature `json:"signatures"`
+}
+
+// ErrInvalidChangelistBundle is returned when a changelist bundle cannot be
+// read, is not signed by a key trusted for its role, has changes that its role
+// cannot make, or is for a different repository
+type ErrInvalidChangelistBundle struct {
+	msg string
+}
+
+func (err ErrInvalidChangelistBundle) Error() string {
+	return fmt.Sprintf("invalid changelist bundle: %s", err.msg)
+}
+
+// toSigned returns the bundle's GUN, changes and role as signed content,
+// along with its signatures
+func (b *ChangelistBundle) toSigned() (*data.Signed, error) {
+	content, err := canonicaljson.MarshalCanonical(struct {
+		GUN     data.GUN                `json:"gun"`
+		Changes []*changelist.TUFChange `json:"changes"`
+		Role    data.RoleName           `json:"role"`
+	}{GUN: b.GUN, Changes: b.Changes, Role: b.Role})
+	if err != nil {
+		return nil, err
+	}
+	raw := canonicaljson.RawMessage(content)
+	sigs := make([]data.Signature, len(b.Signatures))
+	copy(sigs, b.Signatures)
+	return &data.Signed{Signed: &raw, Signatures: sigs}, nil
+}
+
+// ReadChangelistBundle reads a changelist bundle.  Its signatures can only be
+// checked against the keys a repository trusts, which ImportChangelist does.
+func ReadChangelistBundle(rd io.Reader) (*ChangelistBundle, error) {
+	bundle := &ChangelistBundle{}
+	if err := json.NewDecoder(rd).Decode(bundle); err != nil {
+		return nil, ErrInvalidChangelistBundle{msg: err.Error()}
+	}
+	if bundle.GUN == "" {
+		return nil, ErrInvalidChangelistBundle{msg: "no GUN"}
+	}
+	for _, c := range bundle.Changes {
+		if c == nil {
+			return nil, ErrInvalidChangelistBundle{msg: "empty change"}
+		}
+	}
+	if bundle.Role == "" || len(bundle.Signatures) == 0 {
+		return nil, ErrInvalidChangelistBundle{msg: "the changes are not signed"}
+	}
+	return bundle, nil
+}
+
+// ExportChangelist writes the repository's pending changes to a changelist
+// bundle, signed with a key of the given root, targets role or delegation,
+// which can be imported using ImportChangelist.  All of the changes must be
+// ones that the role can make.  The changelist is not cleared.
+func (r *repository) ExportChangelist(w io.Writer, role data.RoleName) error {
+	return r.ExportChangelistContext(context.Background(), w, role)
+}
+
+// ExportChangelistContext is ExportChangelist with a context for updating the
+// repository
+func (r *repository) ExportChangelistContext(ctx context.Context, w io.Writer, role data.RoleName) error {
+	if _, err := r.updateForSigning(ctx, false); err != nil {
+		return err
+	}
+	signers, err := r.bundleSigners(role)
+	if err != nil {
+		return err
+	}
+
+	bundle := &ChangelistBundle{GUN: r.gun, Changes: []*changelist.TUFChange{}, Role: role}
+	for _, c := range r.changelist.List() {
+		bundle.Changes = append(bundle.Changes, changelist.NewTUFChange(
+			c.Action(), c.Scope(), c.Type(), c.Path(), c.Content()))
+	}
+	if err := bundle.checkScopes(); err != nil {
+		return err
+	}
+	s, err := bundle.toSigned()
+	if err != nil {
+		return err
+	}
+	if err := signed.Sign(r.GetCryptoService(), s, signers.ListKeys(), 1, nil); err != nil {
+		return err
+	}
+	bundle.Signatures = s.Signatures
+
+	bundleJSON, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bundleJSON, '\n'))
+	return err
+}
+
+// ImportChangelist reads a changelist bundle written by ExportChangelist for
+// this repository, checks that it is signed by a key that the repository
+// trusts for the bundle's role and that the role can make all of its changes,
+// and adds its changes to the end of the
+// changelist, so that they are applied at publish time.  Either all of the
+// changes are added or, if the bundle is invalid or its changes contradict
+// each other, none are.
+func (r *repository) ImportChangelist(rd io.Reader) error {
+	return r.ImportChangelistContext(context.Background(), rd)
+}
+
+// ImportChangelistContext is ImportChangelist with a context for updating the
+// repository
+func (r *repository) ImportChangelistContext(ctx context.Context, rd io.Reader) error {
+	bundle, err := ReadChangelistBundle(rd)
+	if err != nil {
+		return err
+	}
+	if bundle.GUN != r.gun {
+		return ErrInvalidChangelistBundle{
+			msg: fmt.Sprintf("the changes are for %s, not %s", bundle.GUN, r.gun),
+		}
+	}
+
+	if _, err := r.updateForSigning(ctx, false); err != nil {
+		return err
+	}
+	signers, err := r.bundleSigners(bundle.Role)
+	if err != nil {
+		return ErrInvalidChangelistBundle{msg: err.Error()}
+	}
+	s, err := bundle.toSigned()
+	if err != nil {
+		return err
+	}
+	// one of the role's keys is enough to show who staged the changes
+	signers.Threshold = 1
+	if err := signed.VerifySignatures(s, signers); err != nil {
+		return ErrInvalidChangelistBundle{
+			msg: fmt.Sprintf("the changes are not signed by a key trusted for %s: %s", bundle.Role, err),
+		}
+	}
+	if err := bundle.checkScopes(); err != nil {
+		return err
+	}
+
+	changes := make([]changelist.Change, 0, len(bundle.Changes))
+	for _, c := range bundle.Changes {
+		changes = append(changes, c)
+	}
+	if _, err := changelist.SquashedIndices(changes); err != nil {
+		return err
+	}
+	return changelist.AddBatch(r.changelist, changes)
+}
+
+// checkScopes checks that the role that signed the bundle can make each of its
+// changes, so that a key of one delegation can't be used to slip changes to
+// other roles past whoever imports the bundle.  Targets can be changed in the
+// role itself or the delegations below it, but a delegation is changed in the
+// metadata of its delegating role, so only the delegations below the role can
+// be.  Changes to the root can only be signed for by the root, which can sign
+// for any change.
+func (b *ChangelistBundle) checkScopes() error {
+	if b.Role == data.CanonicalRootRole {
+		return nil
+	}
+	for _, c := range b.Changes {
+		below := strings.HasPrefix(c.Scope().String(), b.Role.String()+"/")
+		if below || (c.Scope() == b.Role && c.Type() != changelist.TypeTargetsDelegation) {
+			continue
+		}
+		return ErrInvalidChangelistBundle{
+			msg: fmt.Sprintf("%s cannot sign for a %s change to %s", b.Role, c.Type(), c.Scope()),
+		}
+	}
+	return nil
+}
+
+// bundleSigners returns the keys that the repository trusts for the root,
+// targets role or delegation that signs a changelist bundle
+func (r *repository) bundleSigners(role data.RoleName) (data.BaseRole, error) {
+	switch {
+	case role == data.CanonicalRootRole || role == data.CanonicalTargetsRole:
+		return r.tufRepo.GetBaseRole(role)
+	case data.IsDelegation(role):
+		delgRole, err := r.tufRepo.GetDelegationRole(role)
+		if err != nil {
+			return data.BaseRole{}, err
+		}
+		return delgRole.BaseRole, nil
+	default:
+		return data.BaseRole{}, data.ErrInvalidRole{Role: role, Reason: "changelist bundles are signed by the root, the targets role or a delegation"}
+	}
+}
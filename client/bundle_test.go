@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/cryptoservice"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+)
+
+// Changes staged in one copy of a repository can be imported into another
+// copy, which can then publish them
+func TestExportImportChangelist(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	// a developer with a key of a delegation, which the release manager also
+	// has a key of, stages changes to the delegation in their own copy
+	devRepo, _, devDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(devDir)
+	devKey, err := devRepo.GetCryptoService().Create("targets/dev", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	releaseKey, err := repo.GetCryptoService().Create("targets/dev", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddDelegation("targets/dev", []data.PublicKey{devKey, releaseKey}, []string{"dev/"}))
+	require.NoError(t, repo.Publish())
+	addTarget(t, devRepo, "dev/latest", "../fixtures/intermediate-ca.crt", "targets/dev")
+	addTarget(t, devRepo, "dev/current", "../fixtures/root-ca.crt", "targets/dev")
+	require.NoError(t, devRepo.RemoveTarget("dev/old", "targets/dev"))
+
+	var buf bytes.Buffer
+	err = devRepo.ExportChangelist(&buf, data.CanonicalTargetsRole)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+	require.NoError(t, devRepo.ExportChangelist(&buf, "targets/dev"))
+	require.Len(t, getChanges(t, devRepo), 3, "exporting does not clear the changelist")
+
+	bundle, err := ReadChangelistBundle(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, repo.gun, bundle.GUN)
+	require.Equal(t, data.RoleName("targets/dev"), bundle.Role)
+	require.Len(t, bundle.Changes, 3)
+	require.Len(t, bundle.Signatures, 1)
+	require.Equal(t, devKey.ID(), bundle.Signatures[0].KeyID)
+
+	require.NoError(t, repo.ImportChangelist(bytes.NewReader(buf.Bytes())))
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 3)
+	for i, c := range getChanges(t, devRepo) {
+		require.Equal(t, c.Action(), changes[i].Action())
+		require.Equal(t, c.Scope(), changes[i].Scope())
+		require.Equal(t, c.Type(), changes[i].Type())
+		require.Equal(t, c.Path(), changes[i].Path())
+		require.Equal(t, c.Content(), changes[i].Content())
+	}
+
+	// the release manager can sign the changes with their own key
+	plan, err := repo.PublishDryRun()
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{"targets/dev", data.CanonicalSnapshotRole}, planRoles(plan))
+	require.Len(t, plan.Roles[0].Targets, 2)
+	require.Contains(t, plan.Roles[0].Keys, RoleKey{ID: releaseKey.ID(), Local: true})
+
+	// changes outside the delegation can't be exported with its key
+	addTarget(t, devRepo, "latest", "../fixtures/intermediate-ca.crt")
+	err = devRepo.ExportChangelist(&bytes.Buffer{}, "targets/dev")
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+}
+
+func TestImportChangelistInvalidBundle(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	otherRepo, _, otherDir := initializeRepo(t, data.ECDSAKey, "docker.com/other", ts.URL, false)
+	defer os.RemoveAll(otherDir)
+
+	addTarget(t, otherRepo, "latest", "../fixtures/intermediate-ca.crt")
+	var buf bytes.Buffer
+	require.NoError(t, otherRepo.ExportChangelist(&buf, data.CanonicalTargetsRole))
+	bundle := &ChangelistBundle{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), bundle))
+
+	marshal := func(b *ChangelistBundle) []byte {
+		bundleJSON, err := json.Marshal(b)
+		require.NoError(t, err)
+		return bundleJSON
+	}
+	// signs the bundle with a key that is not trusted for its role
+	signWithNewKey := func(b *ChangelistBundle) {
+		cs := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("")))
+		key, err := cs.Create(b.Role, otherRepo.gun, data.ECDSAKey)
+		require.NoError(t, err)
+		b.Signatures = nil
+		s, err := b.toSigned()
+		require.NoError(t, err)
+		require.NoError(t, signed.Sign(cs, s, []data.PublicKey{key}, 1, nil))
+		b.Signatures = s.Signatures
+	}
+
+	// a bundle for a different repository
+	err := repo.ImportChangelist(bytes.NewReader(buf.Bytes()))
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+	require.Contains(t, err.Error(), "docker.com/other")
+
+	// changes that don't match the signature
+	tampered := *bundle
+	tampered.Changes = append(tampered.Changes, changelist.NewTUFChange(
+		changelist.ActionDelete, data.CanonicalTargetsRole, changelist.TypeTargetsTarget, "other", nil))
+	err = otherRepo.ImportChangelist(bytes.NewReader(marshal(&tampered)))
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+
+	// changes re-signed by a key the repository does not trust
+	signWithNewKey(&tampered)
+	err = otherRepo.ImportChangelist(bytes.NewReader(marshal(&tampered)))
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+	require.Contains(t, err.Error(), "not signed by a key trusted for targets")
+
+	// a bundle signed for a role that is not delegated, or is not a targets role
+	for _, role := range []data.RoleName{"targets/missing", data.CanonicalRootRole} {
+		wrongRole := *bundle
+		wrongRole.Role = role
+		signWithNewKey(&wrongRole)
+		err = otherRepo.ImportChangelist(bytes.NewReader(marshal(&wrongRole)))
+		require.IsType(t, ErrInvalidChangelistBundle{}, err)
+	}
+
+	// changes that the role that signed the bundle cannot make
+	targetsRole, err := otherRepo.tufRepo.GetBaseRole(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	signWith := func(b *ChangelistBundle, keys []data.PublicKey) []byte {
+		s, err := b.toSigned()
+		require.NoError(t, err)
+		require.NoError(t, signed.Sign(otherRepo.GetCryptoService(), s, keys, 1, nil))
+		b.Signatures = s.Signatures
+		return marshal(b)
+	}
+	for _, c := range []*changelist.TUFChange{
+		changelist.NewTUFChange(changelist.ActionCreate, changelist.ScopeRoot, changelist.TypeBaseRole, data.CanonicalTargetsRole.String(), []byte("{}")),
+		changelist.NewTUFChange(changelist.ActionCreate, data.CanonicalTargetsRole, changelist.TypeTargetsDelegation, "", []byte("{}")),
+	} {
+		outOfScope := &ChangelistBundle{GUN: otherRepo.gun, Role: data.CanonicalTargetsRole, Changes: []*changelist.TUFChange{c}}
+		err = otherRepo.ImportChangelist(bytes.NewReader(signWith(outOfScope, targetsRole.ListKeys())))
+		require.IsType(t, ErrInvalidChangelistBundle{}, err)
+		require.Contains(t, err.Error(), "targets cannot sign for")
+	}
+
+	// an unsigned bundle
+	unsigned := *bundle
+	unsigned.Signatures = nil
+	err = otherRepo.ImportChangelist(bytes.NewReader(marshal(&unsigned)))
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+
+	// a truncated bundle
+	err = otherRepo.ImportChangelist(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	require.IsType(t, ErrInvalidChangelistBundle{}, err)
+
+	// contradictory changes
+	conflicting := &ChangelistBundle{GUN: otherRepo.gun, Role: data.CanonicalTargetsRole, Changes: []*changelist.TUFChange{
+		changelist.NewTUFChange(changelist.ActionDelete, "targets/a", changelist.TypeTargetsDelegation, "", nil),
+		changelist.NewTUFChange(changelist.ActionDelete, "targets/a", changelist.TypeTargetsTarget, "latest", nil),
+	}}
+	err = otherRepo.ImportChangelist(bytes.NewReader(signWith(conflicting, targetsRole.ListKeys())))
+	require.IsType(t, changelist.ErrConflictingChanges{}, err)
+
+	// nothing was imported
+	require.Len(t, getChanges(t, repo), 0)
+	require.Len(t, getChanges(t, otherRepo), 1)
+
+	// the root can sign for changes to itself
+	rootRole, err := otherRepo.tufRepo.GetBaseRole(data.CanonicalRootRole)
+	require.NoError(t, err)
+	rootChange := &ChangelistBundle{GUN: otherRepo.gun, Role: data.CanonicalRootRole, Changes: []*changelist.TUFChange{
+		changelist.NewTUFChange(changelist.ActionCreate, changelist.ScopeRoot, changelist.TypeBaseRole, data.CanonicalTargetsRole.String(), []byte("{}")),
+	}}
+	require.NoError(t, otherRepo.ImportChangelist(bytes.NewReader(signWith(rootChange, rootRole.ListKeys()))))
+	require.Len(t, getChanges(t, otherRepo), 2)
+}
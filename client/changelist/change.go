@@ -35,10 +35,12 @@ type TUFChange struct {
 }
 
 // TUFRootData represents a modification of the keys associated
-// with a role that appears in the root.json
+// with a role that appears in the root.json.  A zero Threshold leaves
+// the role's current threshold unchanged.
 type TUFRootData struct {
-	Keys     data.KeyList  `json:"keys"`
-	RoleName data.RoleName `json:"role"`
+	Keys      data.KeyList  `json:"keys"`
+	RoleName  data.RoleName `json:"role"`
+	Threshold int           `json:"threshold,omitempty"`
 }
 
 // NewTUFChange initializes a TUFChange object
@@ -81,13 +83,16 @@ func (c TUFChange) Content() []byte {
 // this includes creating a delegations. This format is used to avoid
 // unexpected race conditions between humans modifying the same delegation
 type TUFDelegation struct {
-	NewName       data.RoleName `json:"new_name,omitempty"`
-	NewThreshold  int           `json:"threshold,omitempty"`
-	AddKeys       data.KeyList  `json:"add_keys,omitempty"`
-	RemoveKeys    []string      `json:"remove_keys,omitempty"`
-	AddPaths      []string      `json:"add_paths,omitempty"`
-	RemovePaths   []string      `json:"remove_paths,omitempty"`
-	ClearAllPaths bool          `json:"clear_paths,omitempty"`
+	NewName             data.RoleName `json:"new_name,omitempty"`
+	NewThreshold        int           `json:"threshold,omitempty"`
+	AddKeys             data.KeyList  `json:"add_keys,omitempty"`
+	RemoveKeys          []string      `json:"remove_keys,omitempty"`
+	AddPaths            []string      `json:"add_paths,omitempty"`
+	RemovePaths         []string      `json:"remove_paths,omitempty"`
+	ClearAllPaths       bool          `json:"clear_paths,omitempty"`
+	PathType            data.PathType `json:"path_type,omitempty"`
+	AddPathHashPrefixes []string      `json:"add_path_hash_prefixes,omitempty"`
+	Terminating         *bool         `json:"terminating,omitempty"`
 }
 
 // ToNewRole creates a fresh role object from the TUFDelegation data
@@ -96,5 +101,20 @@ func (td TUFDelegation) ToNewRole(scope data.RoleName) (*data.Role, error) {
 	if td.NewName != "" {
 		name = td.NewName
 	}
-	return data.NewRole(name, td.NewThreshold, td.AddKeys.IDs(), td.AddPaths)
+	r, err := data.NewRole(name, td.NewThreshold, td.AddKeys.IDs(), td.AddPaths)
+	if err != nil {
+		return nil, err
+	}
+	if td.PathType != "" {
+		if err := r.SetPathType(td.PathType); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.AddPathHashPrefixes(td.AddPathHashPrefixes); err != nil {
+		return nil, err
+	}
+	if td.Terminating != nil {
+		r.Terminating = *td.Terminating
+	}
+	return r, nil
 }
@@ -21,6 +21,12 @@ func (cl *memChangelist) Add(c Change) error {
 	return nil
 }
 
+// AddBatch adds all of the changes to the in-memory change list
+func (cl *memChangelist) AddBatch(changes []Change) error {
+	cl.changes = append(cl.changes, changes...)
+	return nil
+}
+
 // Location returns the string "memory"
 func (cl memChangelist) Location() string {
 	return "memory"
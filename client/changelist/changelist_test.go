@@ -87,3 +87,40 @@ func TestMemChangelistRemove(t *testing.T) {
 	require.Len(t, chs, 1)
 	require.EqualValues(t, "t3", chs[0].Scope())
 }
+
+func TestMemChangelistAddBatch(t *testing.T) {
+	cl := memChangelist{}
+	require.NoError(t, cl.Add(NewTUFChange(ActionCreate, "targets", "target", "first", []byte{1})))
+	require.NoError(t, cl.AddBatch([]Change{
+		NewTUFChange(ActionCreate, "targets", "target", "b", []byte{2}),
+		NewTUFChange(ActionDelete, "targets", "target", "a", nil),
+	}))
+
+	cs := cl.List()
+	require.Len(t, cs, 3)
+	require.Equal(t, "first", cs[0].Path())
+	require.Equal(t, "b", cs[1].Path())
+	require.Equal(t, "a", cs[2].Path())
+	require.Equal(t, ActionDelete, cs[2].Action())
+}
+
+// addOnlyChangelist hides the AddBatch method of the changelist it wraps
+type addOnlyChangelist struct {
+	Changelist
+}
+
+func TestAddBatchFallsBackToAdd(t *testing.T) {
+	mem := &memChangelist{}
+	cl := addOnlyChangelist{Changelist: mem}
+	_, ok := Changelist(cl).(BatchChangelist)
+	require.False(t, ok)
+
+	require.NoError(t, AddBatch(cl, []Change{
+		NewTUFChange(ActionCreate, "targets", "target", "b", []byte{2}),
+		NewTUFChange(ActionDelete, "targets", "target", "a", nil),
+	}))
+	cs := mem.List()
+	require.Len(t, cs, 2)
+	require.Equal(t, "b", cs[0].Path())
+	require.Equal(t, "a", cs[1].Path())
+}
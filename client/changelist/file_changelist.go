@@ -92,6 +92,43 @@ func (cl FileChangelist) Add(c Change) error {
 	return ioutil.WriteFile(filepath.Join(cl.dir, filename), cJSON, 0644)
 }
 
+// AddBatch adds all of the changes to the file change list.  They are first
+// written to a staging directory, which is ignored when reading the changes,
+// and are only moved into the change list once all of them have been written.
+func (cl FileChangelist) AddBatch(changes []Change) error {
+	staging, err := ioutil.TempDir(cl.dir, ".batch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	// consecutive timestamps keep the changes in order
+	start := time.Now().UnixNano()
+	batchID := uuid.Generate()
+	filenames := make([]string, 0, len(changes))
+	for i, c := range changes {
+		cJSON, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		filename := fmt.Sprintf("%020d_%s.change", start+int64(i), batchID)
+		if err := ioutil.WriteFile(filepath.Join(staging, filename), cJSON, 0644); err != nil {
+			return err
+		}
+		filenames = append(filenames, filename)
+	}
+	for i, filename := range filenames {
+		if err := os.Rename(filepath.Join(staging, filename), filepath.Join(cl.dir, filename)); err != nil {
+			// take back the changes that were already moved
+			for _, moved := range filenames[:i] {
+				os.Remove(filepath.Join(cl.dir, moved))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 // Remove deletes the changes found at the given indices
 func (cl FileChangelist) Remove(idxs []int) error {
 	fileInfos, err := getFileNames(cl.dir)
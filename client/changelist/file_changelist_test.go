@@ -1,6 +1,7 @@
 package changelist
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -167,3 +168,62 @@ func TestFileChangeIterator(t *testing.T) {
 	it, err = cl.NewIterator()
 	require.Error(t, err, "Initializing iterator without underlying file store")
 }
+
+func TestAddBatch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cl, err := NewFileChangelist(tmpDir)
+	require.NoError(t, err)
+
+	require.NoError(t, cl.Add(NewTUFChange(ActionCreate, "targets", "target", "first", []byte{1})))
+	var batch []Change
+	for _, name := range []string{"b", "a", "c"} {
+		batch = append(batch, NewTUFChange(ActionCreate, "targets", "target", name, []byte{2}))
+	}
+	require.NoError(t, cl.AddBatch(batch))
+	require.NoError(t, cl.Add(NewTUFChange(ActionCreate, "targets", "target", "last", []byte{3})))
+
+	cs := cl.List()
+	require.Len(t, cs, 5)
+	for i, name := range []string{"first", "b", "a", "c", "last"} {
+		require.Equal(t, name, cs[i].Path())
+	}
+
+	// the staging directory is removed once the batch has been added
+	files, err := ioutil.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+	for _, f := range files {
+		require.False(t, f.IsDir())
+	}
+}
+
+type unserializableChange struct {
+	*TUFChange
+}
+
+func (c unserializableChange) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("cannot be serialized")
+}
+
+func TestAddBatchFailureAddsNothing(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cl, err := NewFileChangelist(tmpDir)
+	require.NoError(t, err)
+
+	// a change that can't be serialized fails the whole batch
+	batch := []Change{
+		NewTUFChange(ActionCreate, "targets", "target", "a", []byte{1}),
+		unserializableChange{NewTUFChange(ActionCreate, "targets", "target", "b", []byte{2})},
+	}
+	require.Error(t, cl.AddBatch(batch))
+	require.Len(t, cl.List(), 0)
+	files, err := ioutil.ReadDir(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, files, 0)
+}
@@ -32,6 +32,31 @@ type Changelist interface {
 	Location() string
 }
 
+// BatchChangelist is implemented by a Changelist that can add several
+// changes at once
+type BatchChangelist interface {
+	// AddBatch appends the provided changes, in order, to
+	// the list of changes. Either all of them are added or,
+	// if there is an error, none of them are
+	AddBatch([]Change) error
+}
+
+// AddBatch appends the changes, in order, to the changelist.  If the
+// changelist is a BatchChangelist either all of them are added or none of
+// them are; otherwise they are added one at a time, and an error can leave
+// the changes before it added.
+func AddBatch(cl Changelist, changes []Change) error {
+	if bcl, ok := cl.(BatchChangelist); ok {
+		return bcl.AddBatch(changes)
+	}
+	for _, c := range changes {
+		if err := cl.Add(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 const (
 	// ActionCreate represents a Create action
 	ActionCreate = "create"
@@ -0,0 +1,176 @@
+package changelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+// ErrConflictingChanges is returned when a change contradicts itself or the
+// changes before it, so that the changelist cannot be applied
+type ErrConflictingChanges struct {
+	// Index is the index of the contradictory change in the changelist
+	Index  int
+	Reason string
+}
+
+func (e ErrConflictingChanges) Error() string {
+	return fmt.Sprintf("change #%d cannot be applied: %s", e.Index, e.Reason)
+}
+
+// changeKey identifies the entry in the repository that a change affects
+type changeKey struct {
+	scope      data.RoleName
+	changeType string
+	path       string
+}
+
+// Squash returns the changes that are left once redundant ones have been
+// removed, in their original order, so that applying them has the same result
+// as applying all of the changes.  Only the last change to each target or
+// root role and the first witness of each role are kept, repeats of the same
+// delegation change are removed, and no change to a delegated role that is
+// deleted afterwards is kept, other than the deletion itself.  An
+// ErrConflictingChanges is returned if any of the changes contradict each other.
+func Squash(changes []Change) ([]Change, error) {
+	indices, err := SquashedIndices(changes)
+	if err != nil {
+		return nil, err
+	}
+	squashed := make([]Change, 0, len(indices))
+	for _, i := range indices {
+		squashed = append(squashed, changes[i])
+	}
+	return squashed, nil
+}
+
+// SquashedIndices is like Squash, but returns the indices of the changes
+// that are left instead of the changes themselves
+func SquashedIndices(changes []Change) ([]int, error) {
+	dropped := make([]bool, len(changes))
+	// the last change to each target or root role, which replaces the others
+	last := make(map[changeKey]int)
+	// the changes kept so far for each role, which a deletion of the role replaces
+	byRole := make(map[data.RoleName][]int)
+	// roles deleted by the changes so far, and not created again since
+	deleted := make(map[data.RoleName]bool)
+	// roles witnessed since they were last deleted
+	witnessed := make(map[data.RoleName]bool)
+
+	for i, c := range changes {
+		key := changeKey{scope: c.Scope(), changeType: c.Type(), path: c.Path()}
+		switch {
+		case c.Type() == TypeTargetsTarget:
+			if deleted[c.Scope()] {
+				return nil, ErrConflictingChanges{
+					Index:  i,
+					Reason: fmt.Sprintf("target %s is changed in %s after it is deleted", c.Path(), c.Scope()),
+				}
+			}
+			if prev, ok := last[key]; ok {
+				dropped[prev] = true
+			}
+			last[key] = i
+
+		case c.Type() == TypeWitness:
+			if deleted[c.Scope()] {
+				return nil, ErrConflictingChanges{
+					Index:  i,
+					Reason: fmt.Sprintf("%s is witnessed after it is deleted", c.Scope()),
+				}
+			}
+			// the first witness may be needed for the changes after it, and the
+			// role is already marked for re-signing by it
+			if witnessed[c.Scope()] {
+				dropped[i] = true
+				continue
+			}
+			witnessed[c.Scope()] = true
+
+		case c.Scope() == ScopeRoot && c.Type() == TypeBaseRole && c.Action() == ActionCreate:
+			// each of these replaces all of the keys of the root role
+			if prev, ok := last[key]; ok {
+				dropped[prev] = true
+			}
+			last[key] = i
+
+		case c.Type() == TypeTargetsDelegation:
+			switch c.Action() {
+			case ActionDelete:
+				// deleting the role undoes everything done to it before
+				for _, prev := range byRole[c.Scope()] {
+					dropped[prev] = true
+				}
+				byRole[c.Scope()] = nil
+				deleted[c.Scope()] = true
+				witnessed[c.Scope()] = false
+			case ActionUpdate, ActionCreate:
+				if c.Action() == ActionUpdate && deleted[c.Scope()] {
+					return nil, ErrConflictingChanges{
+						Index:  i,
+						Reason: fmt.Sprintf("delegation %s is updated after it is deleted", c.Scope()),
+					}
+				}
+				if err := checkDelegationChange(c); err != nil {
+					return nil, ErrConflictingChanges{Index: i, Reason: err.Error()}
+				}
+				deleted[c.Scope()] = false
+				// repeating the same change to the role has no further effect
+				if kept := byRole[c.Scope()]; len(kept) > 0 && sameChange(changes[kept[len(kept)-1]], c) {
+					dropped[i] = true
+					continue
+				}
+			}
+		}
+		byRole[c.Scope()] = append(byRole[c.Scope()], i)
+	}
+
+	var indices []int
+	for i := range changes {
+		if !dropped[i] {
+			indices = append(indices, i)
+		}
+	}
+	return indices, nil
+}
+
+// checkDelegationChange makes sure that a delegation change does not both add
+// and remove the same key or path
+func checkDelegationChange(c Change) error {
+	td := TUFDelegation{}
+	if err := json.Unmarshal(c.Content(), &td); err != nil {
+		return fmt.Errorf("invalid delegation change for %s: %v", c.Scope(), err)
+	}
+	removedKeys := make(map[string]bool)
+	for _, keyID := range td.RemoveKeys {
+		removedKeys[keyID] = true
+	}
+	for _, key := range td.AddKeys {
+		canonicalID, err := utils.CanonicalKeyID(key)
+		if err != nil {
+			return err
+		}
+		if removedKeys[key.ID()] || removedKeys[canonicalID] {
+			return fmt.Errorf("key %s is both added to and removed from delegation %s", canonicalID, c.Scope())
+		}
+	}
+	removedPaths := make(map[string]bool)
+	for _, path := range td.RemovePaths {
+		removedPaths[path] = true
+	}
+	for _, path := range td.AddPaths {
+		if removedPaths[path] {
+			return fmt.Errorf("path %q is both added to and removed from delegation %s", path, c.Scope())
+		}
+	}
+	return nil
+}
+
+// sameChange is whether two changes do exactly the same thing
+func sameChange(a, b Change) bool {
+	return a.Action() == b.Action() && a.Scope() == b.Scope() && a.Type() == b.Type() &&
+		a.Path() == b.Path() && bytes.Equal(a.Content(), b.Content())
+}
@@ -0,0 +1,125 @@
+package changelist
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+func delegationChange(t *testing.T, action string, role data.RoleName, td TUFDelegation) Change {
+	tdJSON, err := json.Marshal(td)
+	require.NoError(t, err)
+	return NewTUFChange(action, role, TypeTargetsDelegation, "", tdJSON)
+}
+
+func requireSquashed(t *testing.T, changes []Change, expected ...int) {
+	indices, err := SquashedIndices(changes)
+	require.NoError(t, err)
+	require.Equal(t, expected, indices)
+
+	squashed, err := Squash(changes)
+	require.NoError(t, err)
+	require.Len(t, squashed, len(expected))
+	for i, idx := range expected {
+		require.Equal(t, changes[idx], squashed[i])
+	}
+}
+
+func TestSquashTargets(t *testing.T) {
+	changes := []Change{
+		NewTUFChange(ActionCreate, "targets", TypeTargetsTarget, "a", []byte("1")),
+		NewTUFChange(ActionCreate, "targets", TypeTargetsTarget, "b", []byte("1")),
+		NewTUFChange(ActionDelete, "targets", TypeTargetsTarget, "a", nil),
+		NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("1")),
+		NewTUFChange(ActionCreate, "targets", TypeTargetsTarget, "a", []byte("2")),
+		NewTUFChange(ActionDelete, "targets", TypeTargetsTarget, "b", nil),
+	}
+	// only the last change to each target in each role is left, in order
+	requireSquashed(t, changes, 3, 4, 5)
+
+	requireSquashed(t, nil)
+	requireSquashed(t, changes[:1], 0)
+}
+
+func TestSquashRootAndWitness(t *testing.T) {
+	changes := []Change{
+		NewTUFChange(ActionUpdate, "targets/role", TypeWitness, "", nil),
+		NewTUFChange(ActionCreate, ScopeRoot, TypeBaseRole, "targets", []byte("1")),
+		NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("1")),
+		NewTUFChange(ActionUpdate, "targets/role", TypeWitness, "", nil),
+		NewTUFChange(ActionCreate, ScopeRoot, TypeBaseRole, "snapshot", []byte("1")),
+		NewTUFChange(ActionCreate, ScopeRoot, TypeBaseRole, "targets", []byte("2")),
+	}
+	// the first witness is kept, and the last key change for each root role
+	requireSquashed(t, changes, 0, 2, 4, 5)
+}
+
+func TestSquashDelegations(t *testing.T) {
+	cs := signed.NewEd25519()
+	key, err := cs.Create("targets/role", "gun", data.ED25519Key)
+	require.NoError(t, err)
+	create := delegationChange(t, ActionCreate, "targets/role",
+		TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{key}, AddPaths: []string{"a"}})
+	addPath := delegationChange(t, ActionUpdate, "targets/role", TUFDelegation{AddPaths: []string{"b"}})
+	remove := NewTUFChange(ActionDelete, "targets/role", TypeTargetsDelegation, "", nil)
+
+	// repeats of a change are removed
+	requireSquashed(t, []Change{create, addPath, addPath, create, create}, 0, 1, 3)
+
+	// deleting the role removes everything done to it before
+	changes := []Change{
+		create,
+		NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("1")),
+		NewTUFChange(ActionUpdate, "targets/role", TypeWitness, "", nil),
+		delegationChange(t, ActionCreate, "targets/other", TUFDelegation{AddPaths: []string{"a"}}),
+		addPath,
+		remove,
+		remove,
+		create,
+		NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("2")),
+		NewTUFChange(ActionUpdate, "targets/role", TypeWitness, "", nil),
+	}
+	requireSquashed(t, changes, 3, 6, 7, 8, 9)
+}
+
+func TestSquashConflictingChanges(t *testing.T) {
+	cs := signed.NewEd25519()
+	key, err := cs.Create("targets/role", "gun", data.ED25519Key)
+	require.NoError(t, err)
+	canonicalID, err := utils.CanonicalKeyID(key)
+	require.NoError(t, err)
+	create := delegationChange(t, ActionCreate, "targets/role", TUFDelegation{NewThreshold: 1, AddKeys: data.KeyList{key}})
+	remove := NewTUFChange(ActionDelete, "targets/role", TypeTargetsDelegation, "", nil)
+
+	for _, changes := range [][]Change{
+		// changes to a role after deleting it, without creating it again
+		{remove, NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("1"))},
+		{remove, NewTUFChange(ActionDelete, "targets/role", TypeTargetsTarget, "a", nil)},
+		{remove, NewTUFChange(ActionUpdate, "targets/role", TypeWitness, "", nil)},
+		{remove, delegationChange(t, ActionUpdate, "targets/role", TUFDelegation{AddPaths: []string{"a"}})},
+		// changes that add and remove the same thing
+		{create, delegationChange(t, ActionUpdate, "targets/role",
+			TUFDelegation{AddKeys: data.KeyList{key}, RemoveKeys: []string{canonicalID}})},
+		{create, delegationChange(t, ActionUpdate, "targets/role",
+			TUFDelegation{AddPaths: []string{"a", "b"}, RemovePaths: []string{"b"}})},
+		{create, NewTUFChange(ActionUpdate, "targets/role", TypeTargetsDelegation, "", []byte("{"))},
+	} {
+		_, err := Squash(changes)
+		require.Error(t, err)
+		conflict, ok := err.(ErrConflictingChanges)
+		require.True(t, ok, "unexpected error: %v", err)
+		require.Equal(t, 1, conflict.Index)
+	}
+
+	// creating the role again makes it possible to change it
+	_, err = Squash([]Change{
+		remove,
+		create,
+		NewTUFChange(ActionCreate, "targets/role", TypeTargetsTarget, "a", []byte("1")),
+	})
+	require.NoError(t, err)
+}
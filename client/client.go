@@ -2,15 +2,15 @@
 package client
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
 
 	canonicaljson "github.com/docker/go/canonical/json"
@@ -24,6 +24,8 @@ import (
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
 	"github.com/theupdateframework/notary/tuf/utils"
+	"github.com/theupdateframework/notary/tuf/validation"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -39,17 +41,21 @@ func init() {
 
 // repository stores all the information needed to operate on a notary repository.
 type repository struct {
-	gun            data.GUN
-	baseURL        string
-	changelist     changelist.Changelist
-	cache          store.MetadataStore
-	remoteStore    store.RemoteStore
-	cryptoService  signed.CryptoService
-	tufRepo        *tuf.Repo
-	invalid        *tuf.Repo // known data that was parsable but deemed invalid
-	roundTrip      http.RoundTripper
-	trustPinning   trustpinning.TrustPinConfig
-	LegacyVersions int // number of versions back to fetch roots to sign with
+	gun             data.GUN
+	baseURL         string
+	changelist      changelist.Changelist
+	cache           store.MetadataStore
+	remoteStore     store.RemoteStore
+	cryptoService   signed.CryptoService
+	tufRepo         *tuf.Repo
+	invalid         *tuf.Repo // known data that was parsable but deemed invalid
+	roundTrip       http.RoundTripper
+	trustPinning    trustpinning.TrustPinConfig
+	LegacyVersions  int // number of versions back to fetch roots to sign with
+	downloadWorkers int // number of delegations to download concurrently
+	publishRetries  int // number of times to retry a conflicting publish
+	publishBackoff  time.Duration
+	expiries        roleExpiries // expiry durations set for each role
 }
 
 // NewFileCachedRepository is a wrapper for NewRepository that initializes
@@ -109,14 +115,17 @@ func NewRepository(gun data.GUN, baseURL string, remoteStore store.RemoteStore,
 	}
 
 	nRepo := &repository{
-		gun:            gun,
-		baseURL:        baseURL,
-		changelist:     cl,
-		cache:          cache,
-		remoteStore:    remoteStore,
-		cryptoService:  cryptoService,
-		trustPinning:   trustPinning,
-		LegacyVersions: 0, // By default, don't sign with legacy roles
+		gun:             gun,
+		baseURL:         baseURL,
+		changelist:      cl,
+		cache:           cache,
+		remoteStore:     remoteStore,
+		cryptoService:   cryptoService,
+		trustPinning:    trustPinning,
+		LegacyVersions:  0, // By default, don't sign with legacy roles
+		downloadWorkers: notary.DefaultDownloadWorkers,
+		publishRetries:  notary.DefaultPublishRetries,
+		publishBackoff:  notary.DefaultPublishRetryBackoff,
 	}
 
 	return nRepo, nil
@@ -145,12 +154,13 @@ type TargetWithRole struct {
 
 // NewTarget is a helper method that returns a Target
 func NewTarget(targetName, targetPath string, targetCustom *canonicaljson.RawMessage) (*Target, error) {
-	b, err := ioutil.ReadFile(targetPath)
+	f, err := os.Open(targetPath)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	meta, err := data.NewFileMeta(bytes.NewBuffer(b), data.NotaryDefaultHashes...)
+	meta, err := data.NewFileMeta(f, data.NotaryDefaultHashes...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,6 +168,51 @@ func NewTarget(targetName, targetPath string, targetCustom *canonicaljson.RawMes
 	return &Target{Name: targetName, Hashes: meta.Hashes, Length: meta.Length, Custom: targetCustom}, nil
 }
 
+// TargetFile is the name of a target and the path of the file containing its content
+type TargetFile struct {
+	Name string
+	Path string
+}
+
+// NewTargets is a helper method that returns a Target for each of the files,
+// in the same order, hashing up to the given number of files concurrently.
+// The same custom data is used for all of the targets.
+func NewTargets(files []TargetFile, targetCustom *canonicaljson.RawMessage, workers int) ([]*Target, error) {
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	targets := make([]*Target, len(files))
+	errs := make([]error, len(files))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				targets[i], errs[i] = NewTarget(files[i].Name, files[i].Path, targetCustom)
+			}
+		}()
+	}
+	for i := range files {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	// report the error for the first file that failed, whichever finished first
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
 // rootCertKey generates the corresponding certificate for the private key given the privKey and repo's GUN
 func rootCertKey(gun data.GUN, privKey data.PrivateKey) (data.PublicKey, error) {
 	// Hard-coded policy: the generated certificate expires in 10 years.
@@ -181,8 +236,38 @@ func (r *repository) GetCryptoService() signed.CryptoService {
 	return r.cryptoService
 }
 
+// BaseRoleSpec describes the signing keys and signature threshold that a
+// locally managed base role (root, targets or snapshot) should be created with.
+// The keys are identified by their IDs and must be available from the
+// repository's CryptoService.  A zero Threshold means notary.MinThreshold.
+type BaseRoleSpec struct {
+	KeyIDs    []string
+	Threshold int
+}
+
+// baseRole builds the base role described by this spec out of the given keys,
+// ensuring that the keys are able to satisfy the threshold
+func (s BaseRoleSpec) baseRole(role data.RoleName, keys []data.PublicKey) (data.BaseRole, error) {
+	threshold := s.Threshold
+	if threshold == 0 {
+		threshold = notary.MinThreshold
+	}
+	baseRole := data.NewBaseRole(role, threshold, keys...)
+	if threshold < notary.MinThreshold || threshold > len(baseRole.Keys) {
+		return data.BaseRole{}, ErrInvalidThreshold{Role: role, Threshold: threshold, NumKeys: len(baseRole.Keys)}
+	}
+	return baseRole, nil
+}
+
 // initialize initializes the notary repository with a set of rootkeys, root certificates and roles.
 func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey, serverManagedRoles ...data.RoleName) error {
+	return r.initializeWithSpecs(rootKeyIDs, rootCerts, nil, serverManagedRoles...)
+}
+
+// initializeWithSpecs initializes the notary repository with a set of rootkeys, root certificates
+// and roles, creating the locally managed roles according to roleSpecs.
+func (r *repository) initializeWithSpecs(rootKeyIDs []string, rootCerts []data.PublicKey,
+	roleSpecs map[data.RoleName]BaseRoleSpec, serverManagedRoles ...data.RoleName) error {
 
 	// currently we only support server managing timestamps and snapshots, and
 	// nothing else - timestamps are always managed by the server, and implicit
@@ -211,6 +296,10 @@ func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey,
 		}
 	}
 
+	if err := checkRoleSpecs(roleSpecs, remotelyManagedKeys); err != nil {
+		return err
+	}
+
 	// gets valid public keys corresponding to the rootKeyIDs or generate if necessary
 	var publicKeys []data.PublicKey
 	var err error
@@ -226,6 +315,7 @@ func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey,
 	//initialize repo with public keys
 	rootRole, targetsRole, snapshotRole, timestampRole, err := r.initializeRoles(
 		publicKeys,
+		roleSpecs,
 		locallyManagedKeys,
 		remotelyManagedKeys,
 	)
@@ -257,6 +347,27 @@ func (r *repository) initialize(rootKeyIDs []string, rootCerts []data.PublicKey,
 	return r.saveMetadata(serverManagesSnapshot)
 }
 
+// checkRoleSpecs ensures that keys and thresholds are only requested for roles
+// that the client is going to manage
+func checkRoleSpecs(roleSpecs map[data.RoleName]BaseRoleSpec, remoteRoles []data.RoleName) error {
+	for role, spec := range roleSpecs {
+		switch role {
+		case data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole:
+		default:
+			return ErrInvalidLocalRole{Role: role}
+		}
+		for _, remoteRole := range remoteRoles {
+			if role == remoteRole {
+				return ErrInvalidLocalRole{Role: role}
+			}
+		}
+		if spec.Threshold < 0 {
+			return ErrInvalidThreshold{Role: role, Threshold: spec.Threshold, NumKeys: len(spec.KeyIDs)}
+		}
+	}
+	return nil
+}
+
 // createNewPublicKeyFromKeyIDs generates a set of public keys corresponding to the given list of
 // key IDs existing in the repository's CryptoService.
 // the public keys returned are ordered to correspond to the keyIDs
@@ -343,6 +454,20 @@ func keyExistsInList(cert data.PublicKey, ids map[string]bool) error {
 func (r *repository) InitializeWithCertificate(rootKeyIDs []string, rootCerts []data.PublicKey,
 	serverManagedRoles ...data.RoleName) error {
 
+	roleSpecs := map[data.RoleName]BaseRoleSpec{
+		data.CanonicalRootRole: {KeyIDs: rootKeyIDs},
+	}
+	return r.InitializeWithRoleSpecs(rootCerts, roleSpecs, serverManagedRoles...)
+}
+
+// InitializeWithRoleSpecs initializes the repository like InitializeWithCertificate, but
+// allows the root, targets and snapshot roles to be created with several signing keys and a
+// signature threshold greater than 1.  The root keys are the ones given in the root role's
+// spec.  Locally managed roles whose spec has no key IDs get a single newly generated key.
+func (r *repository) InitializeWithRoleSpecs(rootCerts []data.PublicKey, roleSpecs map[data.RoleName]BaseRoleSpec,
+	serverManagedRoles ...data.RoleName) error {
+
+	rootKeyIDs := roleSpecs[data.CanonicalRootRole].KeyIDs
 	// If we explicitly pass in certificate(s) but not key, then look keys up using certificate
 	if len(rootKeyIDs) == 0 && len(rootCerts) != 0 {
 		rootKeyIDs = []string{}
@@ -359,39 +484,35 @@ func (r *repository) InitializeWithCertificate(rootKeyIDs []string, rootCerts []
 			rootKeyIDs = append(rootKeyIDs, keyID)
 		}
 	}
-	return r.initialize(rootKeyIDs, rootCerts, serverManagedRoles...)
+	return r.initializeWithSpecs(rootKeyIDs, rootCerts, roleSpecs, serverManagedRoles...)
 }
 
-func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remoteRoles []data.RoleName) (
-	root, targets, snapshot, timestamp data.BaseRole, err error) {
-	root = data.NewBaseRole(
-		data.CanonicalRootRole,
-		notary.MinThreshold,
-		rootKeys...,
-	)
+func (r *repository) initializeRoles(rootKeys []data.PublicKey, roleSpecs map[data.RoleName]BaseRoleSpec,
+	localRoles, remoteRoles []data.RoleName) (root, targets, snapshot, timestamp data.BaseRole, err error) {
+
+	root, err = roleSpecs[data.CanonicalRootRole].baseRole(data.CanonicalRootRole, rootKeys)
+	if err != nil {
+		return
+	}
 
 	// we want to create all the local keys first so we don't have to
 	// make unnecessary network calls
 	for _, role := range localRoles {
-		// This is currently hardcoding the keys to ECDSA.
-		var key data.PublicKey
-		key, err = r.GetCryptoService().Create(role, r.gun, data.ECDSAKey)
+		var keys []data.PublicKey
+		keys, err = r.localRoleKeys(role, roleSpecs[role].KeyIDs)
+		if err != nil {
+			return
+		}
+		var baseRole data.BaseRole
+		baseRole, err = roleSpecs[role].baseRole(role, keys)
 		if err != nil {
 			return
 		}
 		switch role {
 		case data.CanonicalSnapshotRole:
-			snapshot = data.NewBaseRole(
-				role,
-				notary.MinThreshold,
-				key,
-			)
+			snapshot = baseRole
 		case data.CanonicalTargetsRole:
-			targets = data.NewBaseRole(
-				role,
-				notary.MinThreshold,
-				key,
-			)
+			targets = baseRole
 		}
 	}
 
@@ -424,6 +545,28 @@ func (r *repository) initializeRoles(rootKeys []data.PublicKey, localRoles, remo
 	return root, targets, snapshot, timestamp, nil
 }
 
+// localRoleKeys returns the public keys for the given key IDs, or generates a
+// single new key for the role if no key IDs are given
+func (r *repository) localRoleKeys(role data.RoleName, keyIDs []string) ([]data.PublicKey, error) {
+	if len(keyIDs) == 0 {
+		// This is currently hardcoding the keys to ECDSA.
+		key, err := r.GetCryptoService().Create(role, r.gun, data.ECDSAKey)
+		if err != nil {
+			return nil, err
+		}
+		return []data.PublicKey{key}, nil
+	}
+	keys := make([]data.PublicKey, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		key := r.GetCryptoService().GetKey(keyID)
+		if key == nil {
+			return nil, fmt.Errorf("unable to find key: %s", keyID)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
 // adds a TUF Change template to the given roles
 func addChange(cl changelist.Changelist, c changelist.Change, roles ...data.RoleName) error {
 	if len(roles) == 0 {
@@ -450,33 +593,43 @@ func addChange(cl changelist.Changelist, c changelist.Change, roles ...data.Role
 		))
 	}
 
-	for _, c := range changes {
-		if err := cl.Add(c); err != nil {
-			return err
-		}
-	}
-	return nil
+	return changelist.AddBatch(cl, changes)
 }
 
 // AddTarget creates new changelist entries to add a target to the given roles
 // in the repository when the changelist gets applied at publish time.
 // If roles are unspecified, the default role is "targets"
 func (r *repository) AddTarget(target *Target, roles ...data.RoleName) error {
-	if len(target.Hashes) == 0 {
-		return fmt.Errorf("no hashes specified for target \"%s\"", target.Name)
-	}
-	logrus.Debugf("Adding target \"%s\" with sha256 \"%x\" and size %d bytes.\n", target.Name, target.Hashes["sha256"], target.Length)
+	return r.AddTargets([]*Target{target}, roles...)
+}
 
-	meta := data.FileMeta{Length: target.Length, Hashes: target.Hashes, Custom: target.Custom}
-	metaJSON, err := json.Marshal(meta)
-	if err != nil {
-		return err
-	}
+// AddTargets creates new changelist entries to add the targets to the given
+// roles in the repository when the changelist gets applied at publish time.
+// The entries for all of the targets are added to the changelist as a single
+// batch, so either all of them are added or none of them are.
+// If roles are unspecified, the default role is "targets"
+func (r *repository) AddTargets(targets []*Target, roles ...data.RoleName) error {
+	batch := changelist.NewMemChangelist()
+	for _, target := range targets {
+		if len(target.Hashes) == 0 {
+			return fmt.Errorf("no hashes specified for target \"%s\"", target.Name)
+		}
+		logrus.Debugf("Adding target \"%s\" with sha256 \"%x\" and size %d bytes.\n", target.Name, target.Hashes["sha256"], target.Length)
 
-	template := changelist.NewTUFChange(
-		changelist.ActionCreate, "", changelist.TypeTargetsTarget,
-		target.Name, metaJSON)
-	return addChange(r.changelist, template, roles...)
+		meta := data.FileMeta{Length: target.Length, Hashes: target.Hashes, Custom: target.Custom}
+		metaJSON, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+
+		template := changelist.NewTUFChange(
+			changelist.ActionCreate, "", changelist.TypeTargetsTarget,
+			target.Name, metaJSON)
+		if err := addChange(batch, template, roles...); err != nil {
+			return err
+		}
+	}
+	return changelist.AddBatch(r.changelist, batch.List())
 }
 
 // RemoveTarget creates new changelist entries to remove a target from the given
@@ -498,7 +651,12 @@ func (r *repository) RemoveTarget(targetName string, roles ...data.RoleName) err
 // subtree and also the "targets/x" subtree, as we will defer parsing it until
 // we explicitly reach it in our iteration of the provided list of roles.
 func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, error) {
-	if err := r.Update(false); err != nil {
+	return r.ListTargetsContext(context.Background(), roles...)
+}
+
+// ListTargetsContext is ListTargets with a context for updating the repository
+func (r *repository) ListTargetsContext(ctx context.Context, roles ...data.RoleName) ([]*TargetWithRole, error) {
+	if err := r.UpdateContext(ctx, false); err != nil {
 		return nil, err
 	}
 
@@ -510,8 +668,19 @@ func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, err
 		// Define an array of roles to skip for this walk (see IMPORTANT comment above)
 		skipRoles := utils.RoleNameSliceRemove(roles, role)
 
+		// Terminating delegations of the roles visited on this walk.  They are
+		// recorded from their parents, since they end the search for the targets
+		// they match whether or not their own metadata was downloaded and verified.
+		var terminating []data.DelegationRole
+		var added []string
+
 		// Define a visitor function to populate the targets map in priority order
 		listVisitorFunc := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+			for _, child := range tgt.GetValidDelegations(validRole) {
+				if child.Terminating {
+					terminating = append(terminating, child)
+				}
+			}
 			// We found targets so we should try to add them to our targets map
 			for targetName, targetMeta := range tgt.Signed.Targets {
 				// Follow the priority by not overriding previously set targets
@@ -528,11 +697,26 @@ func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, err
 					},
 					Role: validRole.Name,
 				}
+				added = append(added, targetName)
 			}
 			return nil
 		}
 
 		r.tufRepo.WalkTargets("", role, listVisitorFunc, skipRoles...)
+
+		// The search for a target that a terminating delegation matches may end
+		// before reaching the role it was listed from, so look it up the way
+		// GetTargetByName does
+		for _, targetName := range added {
+			if !terminates(terminating, targetName) {
+				continue
+			}
+			if target := r.walkToTarget(targetName, role, skipRoles); target != nil {
+				targets[targetName] = target
+			} else {
+				delete(targets, targetName)
+			}
+		}
 	}
 
 	var targetList []*TargetWithRole
@@ -543,6 +727,40 @@ func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, err
 	return targetList, nil
 }
 
+// terminates returns whether any of the terminating delegations ends the search
+// for the target path
+func terminates(terminating []data.DelegationRole, targetPath string) bool {
+	for _, t := range terminating {
+		if t.Terminates(targetPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkToTarget returns the named target from the first role it is found in by
+// walking the given role's subtree, or nil if it is not found
+func (r *repository) walkToTarget(name string, role data.RoleName, skipRoles []data.RoleName) *TargetWithRole {
+	var result *TargetWithRole
+	// Define a visitor function to find the specified target
+	getTargetVisitorFunc := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		if tgt == nil {
+			return nil
+		}
+		// We found the target and validated path compatibility in our walk,
+		// so we should stop our walk and set the result
+		if meta, ok := tgt.Signed.Targets[name]; ok {
+			result = &TargetWithRole{Target: Target{Name: name, Hashes: meta.Hashes, Length: meta.Length, Custom: meta.Custom}, Role: validRole.Name}
+			return tuf.StopWalk{}
+		}
+		return nil
+	}
+	if err := r.tufRepo.WalkTargets(name, role, getTargetVisitorFunc, skipRoles...); err != nil {
+		return nil
+	}
+	return result
+}
+
 // GetTargetByName returns a target by the given name. If no roles are passed
 // it uses the targets role and does a search of the entire delegation
 // graph, finding the first entry in a breadth first search of the delegations.
@@ -550,37 +768,25 @@ func (r *repository) ListTargets(roles ...data.RoleName) ([]*TargetWithRole, err
 // the target entry found in the subtree of the highest priority role
 // will be returned.
 // See the IMPORTANT section on ListTargets above. Those roles also apply here.
+// Only the delegations whose paths can contain the name are downloaded.
 func (r *repository) GetTargetByName(name string, roles ...data.RoleName) (*TargetWithRole, error) {
-	if err := r.Update(false); err != nil {
+	return r.GetTargetByNameContext(context.Background(), name, roles...)
+}
+
+// GetTargetByNameContext is GetTargetByName with a context for updating the repository
+func (r *repository) GetTargetByNameContext(ctx context.Context, name string, roles ...data.RoleName) (*TargetWithRole, error) {
+	if err := r.updateForLookup(ctx, name); err != nil {
 		return nil, err
 	}
 
 	if len(roles) == 0 {
 		roles = append(roles, data.CanonicalTargetsRole)
 	}
-	var resultMeta data.FileMeta
-	var resultRoleName data.RoleName
-	var foundTarget bool
 	for _, role := range roles {
 		// Define an array of roles to skip for this walk (see IMPORTANT comment above)
 		skipRoles := utils.RoleNameSliceRemove(roles, role)
-
-		// Define a visitor function to find the specified target
-		getTargetVisitorFunc := func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
-			if tgt == nil {
-				return nil
-			}
-			// We found the target and validated path compatibility in our walk,
-			// so we should stop our walk and set the resultMeta and resultRoleName variables
-			if resultMeta, foundTarget = tgt.Signed.Targets[name]; foundTarget {
-				resultRoleName = validRole.Name
-				return tuf.StopWalk{}
-			}
-			return nil
-		}
-		// Check that we didn't error, and that we assigned to our target
-		if err := r.tufRepo.WalkTargets(name, role, getTargetVisitorFunc, skipRoles...); err == nil && foundTarget {
-			return &TargetWithRole{Target: Target{Name: name, Hashes: resultMeta.Hashes, Length: resultMeta.Length, Custom: resultMeta.Custom}, Role: resultRoleName}, nil
+		if target := r.walkToTarget(name, role, skipRoles); target != nil {
+			return target, nil
 		}
 	}
 	return nil, ErrNoSuchTarget(name)
@@ -604,8 +810,14 @@ func (f ErrNoSuchTarget) Error() string {
 // GetAllTargetMetadataByName searches the entire delegation role tree to find the specified target by name for all
 // roles, and returns a list of TargetSignedStructs for each time it finds the specified target.
 // If given an empty string for a target name, it will return back all targets signed into the repository in every role
+// Otherwise, only the delegations whose paths can contain the name are downloaded.
 func (r *repository) GetAllTargetMetadataByName(name string) ([]TargetSignedStruct, error) {
-	if err := r.Update(false); err != nil {
+	return r.GetAllTargetMetadataByNameContext(context.Background(), name)
+}
+
+// GetAllTargetMetadataByNameContext is GetAllTargetMetadataByName with a context for updating the repository
+func (r *repository) GetAllTargetMetadataByNameContext(ctx context.Context, name string) ([]TargetSignedStruct, error) {
+	if err := r.updateForLookup(ctx, name); err != nil {
 		return nil, err
 	}
 
@@ -676,8 +888,13 @@ type RoleWithSignatures struct {
 // ListRoles returns a list of RoleWithSignatures objects for this repo
 // This represents the latest metadata for each role in this repo
 func (r *repository) ListRoles() ([]RoleWithSignatures, error) {
+	return r.ListRolesContext(context.Background())
+}
+
+// ListRolesContext is ListRoles with a context for updating the repository
+func (r *repository) ListRolesContext(ctx context.Context) ([]RoleWithSignatures, error) {
 	// Update to latest repo state
-	if err := r.Update(false); err != nil {
+	if err := r.UpdateContext(ctx, false); err != nil {
 		return nil, err
 	}
 
@@ -715,7 +932,22 @@ func (r *repository) ListRoles() ([]RoleWithSignatures, error) {
 // Publish pushes the local changes in signed material to the remote notary-server
 // Conceptually it performs an operation similar to a `git rebase`
 func (r *repository) Publish() error {
-	if err := r.publish(r.changelist); err != nil {
+	return r.PublishContext(context.Background())
+}
+
+// PublishContext is Publish with a context for updating the repository and
+// uploading the changes.  If the context is done before the upload completes,
+// the context's error is returned and the changelist is kept, so the changes
+// can be published again.  The server may still have accepted the changes,
+// in which case publishing them again re-applies them on top of themselves.
+//
+// If the server rejects the changes because another client has published
+// since the repository was updated, the repository is updated again and the
+// changes are re-applied on top of what the other client published, with a
+// backoff between each retry.  If any of the changes can no longer be applied,
+// nothing is published and an ErrChangesNoLongerApply lists them.
+func (r *repository) PublishContext(ctx context.Context) error {
+	if err := r.publishWithRetries(ctx, r.changelist); err != nil {
 		return err
 	}
 	if err := r.changelist.Clear(""); err != nil {
@@ -727,12 +959,12 @@ func (r *repository) Publish() error {
 	return nil
 }
 
-// publish pushes the changes in the given changelist to the remote notary-server
-// Conceptually it performs an operation similar to a `git rebase`
-func (r *repository) publish(cl changelist.Changelist) error {
-	var initialPublish bool
+// updateForPublish brings r.tufRepo up to date with the remote notary-server
+// before changes are published.  If the remote is not aware of the repo, the
+// repo is loaded from the local cache, or initialized, and initialPublish is true.
+func (r *repository) updateForPublish(ctx context.Context) (initialPublish bool, err error) {
 	// update first before publishing
-	if err := r.Update(true); err != nil {
+	if err := r.UpdateContext(ctx, true); err != nil {
 		// If the remote is not aware of the repo, then this is being published
 		// for the first time.  Try to initialize the repository before publishing.
 		if _, ok := err.(ErrRepositoryNotExist); ok {
@@ -744,24 +976,130 @@ func (r *repository) publish(cl changelist.Changelist) error {
 
 			if err != nil {
 				logrus.WithError(err).Debugf("Unable to load or initialize repository during first publish: %s", err.Error())
-				return err
+				return false, err
 			}
 
 			// Ensure we will push the initial root and targets file.  Either or
 			// both of the root and targets may not be marked as Dirty, since
 			// there may not be any changes that update them, so use a
 			// different boolean.
-			initialPublish = true
-		} else {
-			// We could not update, so we cannot publish.
-			logrus.Error("Could not publish Repository since we could not update: ", err.Error())
+			return true, nil
+		}
+		// We could not update, so we cannot publish.
+		logrus.Error("Could not publish Repository since we could not update: ", err.Error())
+		return false, err
+	}
+	return false, nil
+}
+
+// publishWithRetries publishes the changes in the given changelist, and
+// retries up to r.publishRetries times if the server rejects them because they
+// conflict with metadata published by another client in the meantime
+func (r *repository) publishWithRetries(ctx context.Context, cl changelist.Changelist) error {
+	return r.retryOnConflict(ctx, func(retry bool) error {
+		if retry {
+			return r.rebase(ctx, cl)
+		}
+		return r.publish(ctx, cl)
+	})
+}
+
+// retryOnConflict makes an attempt at publishing, and retries it up to
+// r.publishRetries times, with a backoff, if the server rejects it because it
+// conflicts with metadata published by another client in the meantime
+func (r *repository) retryOnConflict(ctx context.Context, attempt func(retry bool) error) error {
+	err := attempt(false)
+	for retry := 0; retry < r.publishRetries && isPublishConflict(err); retry++ {
+		delay := publishRetryDelay(r.publishBackoff, retry)
+		logrus.Infof("publishing %s conflicted with another publish (%s), retrying in %s", r.gun, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		err = attempt(true)
+	}
+	return err
+}
+
+// isPublishConflict is whether the server rejected a publish because the
+// metadata it was based on is no longer the newest
+func isPublishConflict(err error) bool {
+	switch err := err.(type) {
+	case store.ErrVersionConflict, validation.ErrBadRoot:
+		return true
+	case store.ErrInvalidOperation:
+		// servers that don't check the expected versions reject the update
+		// as an old version instead
+		return err.OldVersion()
+	}
+	return false
+}
+
+// publishRetryDelay doubles the backoff for each retry, and adds up to half as
+// much again at random, so that clients that conflicted don't retry in lockstep
+func publishRetryDelay(backoff time.Duration, retry int) time.Duration {
+	delay := backoff << uint(retry)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// publish pushes the changes in the given changelist to the remote notary-server
+// Conceptually it performs an operation similar to a `git rebase`
+func (r *repository) publish(ctx context.Context, cl changelist.Changelist) error {
+	return r.publishChanges(ctx, cl, applyChangelist)
+}
+
+// rebase is publish for a retry, which applies all of the changes that can
+// still be applied on top of the newly published metadata in order to report
+// all of the ones that cannot, rather than stopping at the first
+func (r *repository) rebase(ctx context.Context, cl changelist.Changelist) error {
+	return r.publishChanges(ctx, cl, replayChangelist)
+}
+
+func (r *repository) publishChanges(ctx context.Context, cl changelist.Changelist,
+	apply func(*tuf.Repo, *tuf.Repo, changelist.Changelist) error) error {
+
+	initialPublish, err := r.updateForPublish(ctx)
+	if err != nil {
+		return err
+	}
+	expected := publishedVersions(r.tufRepo, initialPublish)
+
+	updatedFiles, err := r.signChanges(ctx, cl, apply, initialPublish)
+	if err != nil {
+		return err
+	}
+	return r.publishSigned(ctx, updatedFiles, expected)
+}
+
+// publishSigned publishes the metadata of the roles that have been signed on
+// top of the downloaded repository, along with the snapshot, which is signed
+// if it is not among them and the client has its key.  expected holds the
+// versions that publishedVersions returned for the downloaded repository, so
+// that the server rejects the update if another client has published since.
+func (r *repository) publishSigned(ctx context.Context, updatedFiles map[data.RoleName][]byte, expected map[data.RoleName]int) error {
+	if _, ok := updatedFiles[data.CanonicalSnapshotRole]; !ok {
+		if err := signSnapshotIfPossible(updatedFiles, r.tufRepo, r.expiries); err != nil {
 			return err
 		}
 	}
+	remote := r.getRemoteStore()
+	return store.SetMultiExpecting(ctx, remote, data.MetadataRoleMapToStringMap(updatedFiles), expected)
+}
+
+// signChanges applies the changes in the given changelist to the updated
+// repo, and returns the metadata that needs to be published for them, apart
+// from the snapshot
+func (r *repository) signChanges(ctx context.Context, cl changelist.Changelist,
+	apply func(*tuf.Repo, *tuf.Repo, changelist.Changelist) error, initialPublish bool) (map[data.RoleName][]byte, error) {
+
 	// apply the changelist to the repo
-	if err := applyChangelist(r.tufRepo, r.invalid, cl); err != nil {
+	if err := apply(r.tufRepo, r.invalid, cl); err != nil {
 		logrus.Debug("Error applying changelist")
-		return err
+		return nil, err
 	}
 
 	// these are the TUF files we will need to update, serialized as JSON before
@@ -769,57 +1107,51 @@ func (r *repository) publish(cl changelist.Changelist) error {
 	updatedFiles := make(map[data.RoleName][]byte)
 
 	// Fetch old keys to support old clients
-	legacyKeys, err := r.oldKeysForLegacyClientSupport(r.LegacyVersions, initialPublish)
+	legacyKeys, err := r.oldKeysForLegacyClientSupport(ctx, r.LegacyVersions, initialPublish)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// check if our root file is nearing expiry or dirty. Resign if it is.  If
 	// root is not dirty but we are publishing for the first time, then just
 	// publish the existing root we have.
-	if err := signRootIfNecessary(updatedFiles, r.tufRepo, legacyKeys, initialPublish); err != nil {
-		return err
+	if err := signRootIfNecessary(updatedFiles, r.tufRepo, legacyKeys, initialPublish, r.expiries); err != nil {
+		return nil, err
 	}
 
-	if err := signTargets(updatedFiles, r.tufRepo, initialPublish); err != nil {
-		return err
+	if err := signTargets(updatedFiles, r.tufRepo, initialPublish, r.expiries); err != nil {
+		return nil, err
 	}
+	return updatedFiles, nil
+}
 
-	// if we initialized the repo while designating the server as the snapshot
-	// signer, then there won't be a snapshots file.  However, we might now
-	// have a local key (if there was a rotation), so initialize one.
-	if r.tufRepo.Snapshot == nil {
-		if err := r.tufRepo.InitSnapshot(); err != nil {
-			return err
-		}
+// publishedVersions returns the versions of the root, snapshot and targets
+// roles in the repo as it was downloaded, before any changes are applied to
+// it.  The timestamp is left out, since the server can re-sign it at any time.
+// If the repo has not been published, no root is expected to exist.
+func publishedVersions(repo *tuf.Repo, initialPublish bool) map[data.RoleName]int {
+	if initialPublish {
+		return map[data.RoleName]int{data.CanonicalRootRole: 0}
 	}
-
-	if snapshotJSON, err := serializeCanonicalRole(
-		r.tufRepo, data.CanonicalSnapshotRole, nil); err == nil {
-		// Only update the snapshot if we've successfully signed it.
-		updatedFiles[data.CanonicalSnapshotRole] = snapshotJSON
-	} else if signErr, ok := err.(signed.ErrInsufficientSignatures); ok && signErr.FoundKeys == 0 {
-		// If signing fails due to us not having the snapshot key, then
-		// assume the server is going to sign, and do not include any snapshot
-		// data.
-		logrus.Debugf("Client does not have the key to sign snapshot. " +
-			"Assuming that server should sign the snapshot.")
-	} else {
-		logrus.Debugf("Client was unable to sign the snapshot: %s", err.Error())
-		return err
+	versions := make(map[data.RoleName]int)
+	if repo.Root != nil {
+		versions[data.CanonicalRootRole] = repo.Root.Signed.Version
 	}
-
-	remote := r.getRemoteStore()
-
-	return remote.SetMulti(data.MetadataRoleMapToStringMap(updatedFiles))
+	if repo.Snapshot != nil {
+		versions[data.CanonicalSnapshotRole] = repo.Snapshot.Signed.Version
+	}
+	for role, targets := range repo.Targets {
+		versions[role] = targets.Signed.Version
+	}
+	return versions
 }
 
-func signRootIfNecessary(updates map[data.RoleName][]byte, repo *tuf.Repo, extraSigningKeys data.KeyList, initialPublish bool) error {
+func signRootIfNecessary(updates map[data.RoleName][]byte, repo *tuf.Repo, extraSigningKeys data.KeyList, initialPublish bool, expiries roleExpiries) error {
 	if len(extraSigningKeys) > 0 {
 		repo.Root.Dirty = true
 	}
 	if nearExpiry(repo.Root.Signed.SignedCommon) || repo.Root.Dirty {
-		rootJSON, err := serializeCanonicalRole(repo, data.CanonicalRootRole, extraSigningKeys)
+		rootJSON, err := serializeCanonicalRole(repo, data.CanonicalRootRole, extraSigningKeys, expiries)
 		if err != nil {
 			return err
 		}
@@ -836,7 +1168,7 @@ func signRootIfNecessary(updates map[data.RoleName][]byte, repo *tuf.Repo, extra
 
 // Fetch back a `legacyVersions` number of roots files, collect the root public keys
 // This includes old `root` roles as well as legacy versioned root roles, e.g. `1.root`
-func (r *repository) oldKeysForLegacyClientSupport(legacyVersions int, initialPublish bool) (data.KeyList, error) {
+func (r *repository) oldKeysForLegacyClientSupport(ctx context.Context, legacyVersions int, initialPublish bool) (data.KeyList, error) {
 	if initialPublish {
 		return nil, nil
 	}
@@ -859,7 +1191,7 @@ func (r *repository) oldKeysForLegacyClientSupport(legacyVersions int, initialPu
 	}
 	oldKeys := make(map[string]data.PublicKey)
 
-	c, err := r.bootstrapClient(true)
+	c, err := r.bootstrapClient(ctx, true)
 	// require a server connection to fetch old roots
 	if err != nil {
 		return nil, err
@@ -870,8 +1202,11 @@ func (r *repository) oldKeysForLegacyClientSupport(legacyVersions int, initialPu
 		// fetch old root version
 		versionedRole := fmt.Sprintf("%d.%s", v, data.CanonicalRootRole.String())
 
-		raw, err := c.remote.GetSized(versionedRole, -1)
+		raw, err := store.GetSizedContext(ctx, c.remote, versionedRole, -1)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
 			logrus.Debugf("error downloading %s: %s", versionedRole, err)
 			continue
 		}
@@ -907,11 +1242,11 @@ func getOldRootPublicKeys(root *data.SignedRoot) data.KeyList {
 	return rootRole.ListKeys()
 }
 
-func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublish bool) error {
+func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublish bool, expiries roleExpiries) error {
 	// iterate through all the targets files - if they are dirty, sign and update
 	for roleName, roleObj := range repo.Targets {
 		if roleObj.Dirty || (roleName == data.CanonicalTargetsRole && initialPublish) {
-			targetsJSON, err := serializeCanonicalRole(repo, roleName, nil)
+			targetsJSON, err := serializeCanonicalRole(repo, roleName, nil, expiries)
 			if err != nil {
 				return err
 			}
@@ -921,6 +1256,36 @@ func signTargets(updates map[data.RoleName][]byte, repo *tuf.Repo, initialPublis
 	return nil
 }
 
+// signSnapshotIfPossible signs the snapshot if the client has the snapshot
+// key.  If it does not, the server is assumed to sign the snapshot, and no
+// snapshot data is added to updates.
+func signSnapshotIfPossible(updates map[data.RoleName][]byte, repo *tuf.Repo, expiries roleExpiries) error {
+	// if we initialized the repo while designating the server as the snapshot
+	// signer, then there won't be a snapshots file.  However, we might now
+	// have a local key (if there was a rotation), so initialize one.
+	if repo.Snapshot == nil {
+		if err := repo.InitSnapshot(); err != nil {
+			return err
+		}
+	}
+
+	if snapshotJSON, err := serializeCanonicalRole(
+		repo, data.CanonicalSnapshotRole, nil, expiries); err == nil {
+		// Only update the snapshot if we've successfully signed it.
+		updates[data.CanonicalSnapshotRole] = snapshotJSON
+	} else if signErr, ok := err.(signed.ErrInsufficientSignatures); ok && signErr.FoundKeys == 0 {
+		// If signing fails due to us not having the snapshot key, then
+		// assume the server is going to sign, and do not include any snapshot
+		// data.
+		logrus.Debugf("Client does not have the key to sign snapshot. " +
+			"Assuming that server should sign the snapshot.")
+	} else {
+		logrus.Debugf("Client was unable to sign the snapshot: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
 // bootstrapRepo loads the repository from the local file system (i.e.
 // a not yet published repo or a possibly obsolete local copy) into
 // r.tufRepo.  This attempts to load metadata for all roles.  Since server
@@ -960,7 +1325,7 @@ func (r *repository) bootstrapRepo() error {
 func (r *repository) saveMetadata(ignoreSnapshot bool) error {
 	logrus.Debugf("Saving changes to Trusted Collection.")
 
-	rootJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalRootRole, nil)
+	rootJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalRootRole, nil, r.expiries)
 	if err != nil {
 		return err
 	}
@@ -971,7 +1336,7 @@ func (r *repository) saveMetadata(ignoreSnapshot bool) error {
 
 	targetsToSave := make(map[data.RoleName][]byte)
 	for t := range r.tufRepo.Targets {
-		signedTargets, err := r.tufRepo.SignTargets(t, data.DefaultExpires(data.CanonicalTargetsRole))
+		signedTargets, err := r.tufRepo.SignTargets(t, r.expiries.expires(t))
 		if err != nil {
 			return err
 		}
@@ -991,7 +1356,7 @@ func (r *repository) saveMetadata(ignoreSnapshot bool) error {
 		return nil
 	}
 
-	snapshotJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalSnapshotRole, nil)
+	snapshotJSON, err := serializeCanonicalRole(r.tufRepo, data.CanonicalSnapshotRole, nil, r.expiries)
 	if err != nil {
 		return err
 	}
@@ -1013,22 +1378,23 @@ func (r *repository) errRepositoryNotExist() error {
 // Update bootstraps a trust anchor (root.json) before updating all the
 // metadata from the repo.
 func (r *repository) Update(forWrite bool) error {
-	c, err := r.bootstrapClient(forWrite)
+	return r.UpdateContext(context.Background(), forWrite)
+}
+
+// UpdateContext is Update with a context for downloading the metadata.  If the
+// context is done, the context's error is returned and the repository's
+// metadata is left as it was before the update, while the cache only ever
+// holds metadata that has been verified.
+func (r *repository) UpdateContext(ctx context.Context, forWrite bool) error {
+	c, err := r.bootstrapClient(ctx, forWrite)
 	if err != nil {
 		if _, ok := err.(store.ErrMetaNotFound); ok {
 			return r.errRepositoryNotExist()
 		}
 		return err
 	}
-	repo, invalid, err := c.Update()
+	repo, invalid, err := r.runUpdate(ctx, c)
 	if err != nil {
-		// notFound.Resource may include a version or checksum so when the role is root,
-		// it will be root, <version>.root or root.<checksum>.
-		notFound, ok := err.(store.ErrMetaNotFound)
-		isRoot, _ := regexp.MatchString(`\.?`+data.CanonicalRootRole.String()+`\.?`, notFound.Resource)
-		if ok && isRoot {
-			return r.errRepositoryNotExist()
-		}
 		return err
 	}
 	// we can be assured if we are at this stage that the repo we built is good
@@ -1039,6 +1405,47 @@ func (r *repository) Update(forWrite bool) error {
 	return nil
 }
 
+// updateForLookup updates only the metadata needed to look up the given target
+// name: the top level roles, and the delegations whose paths can contain the
+// name.  Everything that is downloaded is verified and cached as in a full
+// update, so later lookups only download what has changed.  The repository's
+// metadata is missing the other delegations until the next full update.
+func (r *repository) updateForLookup(ctx context.Context, name string) error {
+	c, err := r.bootstrapClient(ctx, false)
+	if err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			return r.errRepositoryNotExist()
+		}
+		return err
+	}
+	c.limitToTarget(name)
+	repo, invalid, err := r.runUpdate(ctx, c)
+	if err != nil {
+		return err
+	}
+	r.tufRepo = repo
+	r.invalid = invalid
+	warnRolesNearExpiry(repo)
+	return nil
+}
+
+// runUpdate updates the TUF metadata with the given client, returning an
+// ErrRepositoryNotExist if the server has no root for the repository
+func (r *repository) runUpdate(ctx context.Context, c *tufClient) (*tuf.Repo, *tuf.Repo, error) {
+	repo, invalid, err := c.Update(ctx)
+	if err != nil {
+		// notFound.Resource may include a version or checksum so when the role is root,
+		// it will be root, <version>.root or root.<checksum>.
+		notFound, ok := err.(store.ErrMetaNotFound)
+		isRoot, _ := regexp.MatchString(`\.?`+data.CanonicalRootRole.String()+`\.?`, notFound.Resource)
+		if ok && isRoot {
+			return nil, nil, r.errRepositoryNotExist()
+		}
+		return nil, nil, err
+	}
+	return repo, invalid, nil
+}
+
 // bootstrapClient attempts to bootstrap a root.json to be used as the trust
 // anchor for a repository. The checkInitialized argument indicates whether
 // we should always attempt to contact the server to determine if the repository
@@ -1058,7 +1465,7 @@ func (r *repository) Update(forWrite bool) error {
 //
 // Returns a TUFClient for the remote server, which may not be actually
 // operational (if the URL is invalid but a root.json is cached).
-func (r *repository) bootstrapClient(checkInitialized bool) (*tufClient, error) {
+func (r *repository) bootstrapClient(ctx context.Context, checkInitialized bool) (*tufClient, error) {
 	minVersion := 1
 	// the old root on disk should not be validated against any trust pinning configuration
 	// because if we have an old root, it itself is the thing that pins trust
@@ -1098,7 +1505,7 @@ func (r *repository) bootstrapClient(checkInitialized bool) (*tufClient, error)
 
 		// if remote store successfully set up, try and get root from remote
 		// We don't have any local data to determine the size of root, so try the maximum (though it is restricted at 100MB)
-		tmpJSON, err := remote.GetSized(data.CanonicalRootRole.String(), store.NoSizeLimit)
+		tmpJSON, err := store.GetSizedContext(ctx, remote, data.CanonicalRootRole.String(), store.NoSizeLimit)
 		if err != nil {
 			// we didn't have a root in cache and were unable to load one from
 			// the server. Nothing we can do but error.
@@ -1125,7 +1532,7 @@ func (r *repository) bootstrapClient(checkInitialized bool) (*tufClient, error)
 		return nil, ErrRepoNotInitialized{}
 	}
 
-	return newTufClient(oldBuilder, newBuilder, remote, r.cache), nil
+	return newTufClient(oldBuilder, newBuilder, remote, r.cache, r.downloadWorkers), nil
 }
 
 // RotateKey removes all existing keys associated with the role. If no keys are
@@ -1134,20 +1541,37 @@ func (r *repository) bootstrapClient(checkInitialized bool) (*tufClient, error)
 // used for signing the role.
 // These changes are staged in a changelist until publish is called.
 func (r *repository) RotateKey(role data.RoleName, serverManagesKey bool, keyList []string) error {
+	return r.RotateKeyWithThreshold(role, serverManagesKey, keyList, 0)
+}
+
+// RotateKeyWithThreshold rotates the keys of the role like RotateKey, and also
+// sets the number of signatures required for the role.  A threshold of 0 keeps
+// the role's current threshold, which must then be satisfiable by the new keys.
+// Server managed keys only support a threshold of 1.
+func (r *repository) RotateKeyWithThreshold(role data.RoleName, serverManagesKey bool, keyList []string, threshold int) error {
 	if err := checkRotationInput(role, serverManagesKey); err != nil {
 		return err
 	}
+	if threshold < 0 {
+		return ErrInvalidThreshold{Role: role, Threshold: threshold, NumKeys: len(keyList)}
+	}
+	if serverManagesKey && threshold > notary.MinThreshold {
+		return ErrInvalidThreshold{Role: role, Threshold: threshold, NumKeys: 1}
+	}
 
 	pubKeyList, err := r.pubKeyListForRotation(role, serverManagesKey, keyList)
 	if err != nil {
 		return err
 	}
+	if threshold > len(pubKeyList) {
+		return ErrInvalidThreshold{Role: role, Threshold: threshold, NumKeys: len(pubKeyList)}
+	}
 
 	cl := changelist.NewMemChangelist()
-	if err := r.rootFileKeyChange(cl, role, changelist.ActionCreate, pubKeyList); err != nil {
+	if err := r.rootFileKeyChange(cl, role, changelist.ActionCreate, pubKeyList, threshold); err != nil {
 		return err
 	}
-	return r.publish(cl)
+	return r.publish(context.Background(), cl)
 }
 
 // Given a set of new keys to rotate to and a set of keys to drop, returns the list of current keys to use
@@ -1237,10 +1661,11 @@ func checkRotationInput(role data.RoleName, serverManaged bool) error {
 	return nil
 }
 
-func (r *repository) rootFileKeyChange(cl changelist.Changelist, role data.RoleName, action string, keyList []data.PublicKey) error {
+func (r *repository) rootFileKeyChange(cl changelist.Changelist, role data.RoleName, action string, keyList []data.PublicKey, threshold int) error {
 	meta := changelist.TUFRootData{
-		RoleName: role,
-		Keys:     keyList,
+		RoleName:  role,
+		Keys:      keyList,
+		Threshold: threshold,
 	}
 	metaJSON, err := json.Marshal(meta)
 	if err != nil {
@@ -1284,3 +1709,41 @@ func DeleteTrustData(baseDir string, gun data.GUN, URL string, rt http.RoundTrip
 func (r *repository) SetLegacyVersions(n int) {
 	r.LegacyVersions = n
 }
+
+// SetDownloadWorkers sets the number of delegated targets metadata files that
+// are downloaded concurrently when updating.  A value of 1 or less downloads
+// them one at a time.
+func (r *repository) SetDownloadWorkers(n int) {
+	r.downloadWorkers = n
+}
+
+// SetExpiry sets how long the metadata for a role is valid for after it is
+// signed, instead of the default for the role.  It can be set for the root,
+// targets and snapshot roles and for delegations, which otherwise expire
+// along with the targets role.  The duration must be between notary.MinExpiry
+// (notary.MinRootExpiry for root) and notary.MaxExpiry.
+func (r *repository) SetExpiry(role data.RoleName, expiry time.Duration) error {
+	minExpiry := notary.MinExpiry
+	if role == data.CanonicalRootRole {
+		minExpiry = notary.MinRootExpiry
+	} else if role != data.CanonicalTargetsRole && role != data.CanonicalSnapshotRole && !data.IsDelegation(role) {
+		return ErrInvalidExpiry{Role: role, Expiry: expiry, msg: "the client does not sign metadata for the role"}
+	}
+	if expiry < minExpiry || expiry > notary.MaxExpiry {
+		return ErrInvalidExpiry{Role: role, Expiry: expiry,
+			msg: fmt.Sprintf("must be between %s and %s", minExpiry, notary.MaxExpiry)}
+	}
+	if r.expiries == nil {
+		r.expiries = make(roleExpiries)
+	}
+	r.expiries[role] = expiry
+	return nil
+}
+
+// SetPublishRetries sets how many times a publish is retried when it conflicts
+// with one by another client, and the delay before the first retry, which
+// doubles with each further retry.  A value of 0 disables retries.
+func (r *repository) SetPublishRetries(retries int, backoff time.Duration) {
+	r.publishRetries = retries
+	r.publishBackoff = backoff
+}
@@ -404,6 +404,101 @@ func TestInitRepositoryWithCerts(t *testing.T) {
 	}
 }
 
+// Initializing a repo with several root and targets keys and thresholds greater
+// than 1 produces metadata that requires all those signatures, and publishing
+// fails once there are not enough keys left to meet the threshold.
+func TestInitRepositoryWithThresholds(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+	rootKey2, err := repo.GetCryptoService().Create(data.CanonicalRootRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	targetsKey1, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	targetsKey2, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+
+	roleSpecs := map[data.RoleName]BaseRoleSpec{
+		data.CanonicalRootRole:    {KeyIDs: []string{rootKeyID, rootKey2.ID()}, Threshold: 2},
+		data.CanonicalTargetsRole: {KeyIDs: []string{targetsKey1.ID(), targetsKey2.ID()}, Threshold: 2},
+	}
+	require.NoError(t, repo.InitializeWithRoleSpecs(nil, roleSpecs))
+
+	for role, spec := range roleSpecs {
+		baseRole, err := repo.tufRepo.GetBaseRole(role)
+		require.NoError(t, err)
+		require.Equal(t, 2, baseRole.Threshold)
+		require.Len(t, baseRole.Keys, len(spec.KeyIDs))
+	}
+	require.Len(t, repo.tufRepo.Root.Signatures, 2)
+	require.Len(t, repo.tufRepo.Targets[data.CanonicalTargetsRole].Signatures, 2)
+
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.Publish())
+
+	// a fresh client validates the thresholded metadata
+	userRepo, _, userDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(userDir)
+	_, err = userRepo.GetTargetByName("current")
+	require.NoError(t, err)
+	targetsRole, err := userRepo.tufRepo.GetBaseRole(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, targetsRole.Threshold)
+
+	// with only one of the targets keys left, the targets role can no longer be published
+	require.NoError(t, repo.GetCryptoService().RemoveKey(targetsKey2.ID()))
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	err = repo.Publish()
+	require.Error(t, err)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+}
+
+// Thresholds that can't be met by the keys given, and keys or thresholds for
+// roles the client doesn't manage, are rejected before anything is created.
+func TestInitRepositoryWithInvalidThresholds(t *testing.T) {
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempBaseDir)
+
+	repo, _, rootKeyID := createRepoAndKey(t, data.ECDSAKey, tempBaseDir, "docker.com/notary", ts.URL)
+
+	err = repo.InitializeWithRoleSpecs(nil, map[data.RoleName]BaseRoleSpec{
+		data.CanonicalRootRole: {KeyIDs: []string{rootKeyID}, Threshold: 2},
+	})
+	require.Error(t, err)
+	require.Equal(t, ErrInvalidThreshold{Role: data.CanonicalRootRole, Threshold: 2, NumKeys: 1}, err)
+
+	err = repo.InitializeWithRoleSpecs(nil, map[data.RoleName]BaseRoleSpec{
+		data.CanonicalRootRole:    {KeyIDs: []string{rootKeyID}},
+		data.CanonicalTargetsRole: {Threshold: -1},
+	})
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidThreshold{}, err)
+
+	err = repo.InitializeWithRoleSpecs(nil, map[data.RoleName]BaseRoleSpec{
+		data.CanonicalTimestampRole: {Threshold: 2},
+	})
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidLocalRole{}, err)
+
+	err = repo.InitializeWithRoleSpecs(nil, map[data.RoleName]BaseRoleSpec{
+		data.CanonicalSnapshotRole: {Threshold: 1},
+	}, data.CanonicalSnapshotRole)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidLocalRole{}, err)
+
+	// nothing was initialized
+	require.Nil(t, repo.tufRepo)
+}
+
 func TestMatchKeyIDsWithPublicKeys(t *testing.T) {
 	// Temporary directory where test files will be created
 	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
@@ -1021,6 +1116,60 @@ func TestAddTargetWithInvalidTarget(t *testing.T) {
 	require.Error(t, repo.AddTarget(target, data.CanonicalTargetsRole))
 }
 
+// NewTargets returns the targets in the order of the files, and fails if any
+// of the files can't be read
+func TestNewTargets(t *testing.T) {
+	var files []TargetFile
+	for _, name := range []string{"intermediate-ca.crt", "root-ca.crt", "notary-server.crt", "notary-signer.crt"} {
+		files = append(files, TargetFile{Name: "certs/" + name, Path: filepath.Join("../fixtures", name)})
+	}
+
+	targets, err := NewTargets(files, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, targets, len(files))
+	for i, file := range files {
+		expected, err := NewTarget(file.Name, file.Path, nil)
+		require.NoError(t, err)
+		require.Equal(t, expected, targets[i])
+	}
+
+	files = append(files, TargetFile{Name: "missing", Path: "../fixtures/does-not-exist"})
+	_, err = NewTargets(files, nil, 2)
+	require.True(t, os.IsNotExist(err))
+}
+
+// AddTargets stages all of the targets, for each of the roles, or none of them
+// if any of the targets is invalid
+func TestAddTargets(t *testing.T) {
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	targets, err := NewTargets([]TargetFile{
+		{Name: "a", Path: "../fixtures/intermediate-ca.crt"},
+		{Name: "b", Path: "../fixtures/root-ca.crt"},
+	}, nil, 2)
+	require.NoError(t, err)
+
+	invalid := &Target{Name: "c"}
+	require.Error(t, repo.AddTargets(append(targets, invalid)))
+	require.Len(t, getChanges(t, repo), 0)
+
+	require.NoError(t, repo.AddTargets(targets, data.CanonicalTargetsRole, "targets/a"))
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 4)
+	for i, name := range []string{"a", "b"} {
+		for j, role := range []data.RoleName{data.CanonicalTargetsRole, "targets/a"} {
+			c := changes[2*i+j]
+			require.Equal(t, changelist.ActionCreate, c.Action())
+			require.Equal(t, role, c.Scope())
+			require.Equal(t, name, c.Path())
+		}
+	}
+}
+
 // TestAddTargetErrorWritingChanges expects errors writing a change to file
 // to be propagated.
 func TestAddTargetErrorWritingChanges(t *testing.T) {
@@ -1643,6 +1792,77 @@ func TestListTargetRestrictsDelegationPaths(t *testing.T) {
 	require.Nil(t, tgt)
 }
 
+// Targets whose paths match a terminating delegation are only listed and looked
+// up in that delegation and its own delegations
+func TestListTargetTerminatingDelegation(t *testing.T) {
+	ts, mux, keys := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	// tests need to manually bootstrap timestamp as client doesn't generate it
+	err := repo.tufRepo.InitTimestamp()
+	require.NoError(t, err, "error creating repository: %s", err)
+
+	k, err := repo.GetCryptoService().Create("targets/level1", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddDelegation("targets/level1", []data.PublicKey{k}, []string{"shared"}))
+	require.NoError(t, repo.SetDelegationTerminating("targets/level1", true))
+	require.NoError(t, repo.AddDelegation("targets/level2", []data.PublicKey{k}, []string{""}))
+	require.NoError(t, repo.AddDelegation("targets/level1/level2", []data.PublicKey{k}, []string{"shared"}))
+
+	addTarget(t, repo, "shared-level1", "../fixtures/root-ca.crt", "targets/level1")
+	addTarget(t, repo, "shared-level2", "../fixtures/root-ca.crt", "targets/level2")
+	addTarget(t, repo, "other", "../fixtures/root-ca.crt", "targets/level2")
+	addTarget(t, repo, "shared-nested", "../fixtures/root-ca.crt", "targets/level1/level2")
+
+	// Apply the changelist. Normally, this would be done by Publish
+
+	// load the changelist for this repo
+	cl, err := changelist.NewFileChangelist(
+		filepath.Join(baseDir, "tuf", filepath.FromSlash(repo.gun.String()), "changelist"))
+	require.NoError(t, err, "could not open changelist")
+
+	// apply the changelist to the repo
+	err = applyChangelist(repo.tufRepo, nil, cl)
+	require.NoError(t, err, "could not apply changelist")
+
+	delgRole, err := repo.tufRepo.GetDelegationRole("targets/level1")
+	require.NoError(t, err)
+	require.True(t, delgRole.Terminating)
+
+	fakeServerData(t, repo, mux, keys, baseDir)
+
+	targets, err := repo.ListTargets()
+	require.NoError(t, err)
+	found := make(map[string]data.RoleName)
+	for _, tgt := range targets {
+		found[tgt.Name] = tgt.Role
+	}
+	require.Equal(t, map[string]data.RoleName{
+		"shared-level1": "targets/level1",
+		"shared-nested": "targets/level1/level2",
+		"other":         "targets/level2",
+	}, found)
+
+	tgt, err := repo.GetTargetByName("shared-nested")
+	require.NoError(t, err)
+	require.EqualValues(t, "targets/level1/level2", tgt.Role)
+	tgt, err = repo.GetTargetByName("other")
+	require.NoError(t, err)
+	require.EqualValues(t, "targets/level2", tgt.Role)
+
+	_, err = repo.GetTargetByName("shared-level2")
+	require.Error(t, err)
+	require.IsType(t, ErrNoSuchTarget(""), err)
+
+	// looking in targets/level2 specifically still finds it
+	tgt, err = repo.GetTargetByName("shared-level2", "targets/level2")
+	require.NoError(t, err)
+	require.EqualValues(t, "targets/level2", tgt.Role)
+}
+
 // TestValidateRootKey verifies that the public data in root.json for the root
 // key is a valid x509 certificate.
 func TestValidateRootKey(t *testing.T) {
@@ -1817,6 +2037,98 @@ func TestPublishUninitializedRepo(t *testing.T) {
 	requireRepoHasExpectedMetadata(t, repo, data.CanonicalTargetsRole, true, tempBaseDir)
 }
 
+// A publish whose context is cancelled fails with the context's error and keeps
+// the changelist, so that it can be published again later
+func TestPublishContextCancelled(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, repo.PublishContext(ctx))
+	require.Len(t, getChanges(t, repo), 1)
+
+	_, err := repo.ListTargetsContext(ctx)
+	require.Equal(t, context.Canceled, err)
+	_, err = repo.GetTargetByNameContext(ctx, "latest")
+	require.Equal(t, context.Canceled, err)
+
+	require.NoError(t, repo.PublishContext(context.Background()))
+	require.Len(t, getChanges(t, repo), 0)
+	target, err := repo.GetTargetByNameContext(context.Background(), "latest")
+	require.NoError(t, err)
+	require.Equal(t, "latest", target.Name)
+}
+
+// Metadata is published with the expiry set for its role, or the default
+// expiry for the role if none is set
+func TestPublishWithExpiries(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, 30*notary.Day))
+	require.NoError(t, repo.SetExpiry(data.CanonicalSnapshotRole, 2*notary.Day))
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+
+	before := time.Now()
+	require.NoError(t, repo.Publish())
+	after := time.Now()
+
+	// read back what was published
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.NoError(t, otherRepo.Update(false))
+	requireExpiresIn := func(expires time.Time, expiry time.Duration) {
+		require.False(t, expires.Before(before.Add(expiry).Truncate(time.Second)), "expires at %s", expires)
+		require.False(t, expires.After(after.Add(expiry)), "expires at %s", expires)
+	}
+	requireExpiresIn(otherRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Expires, 30*notary.Day)
+	requireExpiresIn(otherRepo.tufRepo.Snapshot.Signed.Expires, 2*notary.Day)
+	require.True(t, otherRepo.tufRepo.Root.Signed.Expires.After(before.Add(notary.NotaryRootExpiry-notary.Day)))
+}
+
+// Expiries must be within bounds, and can only be set for roles that the
+// client signs metadata for
+func TestSetExpiry(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	for _, invalid := range []struct {
+		role   data.RoleName
+		expiry time.Duration
+	}{
+		{data.CanonicalTargetsRole, time.Hour},
+		{data.CanonicalSnapshotRole, notary.MaxExpiry + time.Second},
+		{"targets/releases", -notary.Day},
+		{data.CanonicalRootRole, 6 * 30 * notary.Day},
+		{data.CanonicalTimestampRole, notary.Day},
+		{"releases", notary.Day},
+	} {
+		err := repo.SetExpiry(invalid.role, invalid.expiry)
+		require.IsType(t, ErrInvalidExpiry{}, err, "%s: %s", invalid.role, invalid.expiry)
+	}
+	require.Empty(t, repo.expiries)
+
+	require.NoError(t, repo.SetExpiry(data.CanonicalRootRole, notary.MinRootExpiry))
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, notary.MinExpiry))
+	require.NoError(t, repo.SetExpiry("targets/archive", notary.MaxExpiry))
+
+	// delegations without an expiry of their own expire along with targets
+	now := time.Now()
+	require.WithinDuration(t, now.Add(notary.MinExpiry), repo.expiries.expires("targets/releases"), time.Minute)
+	require.WithinDuration(t, now.Add(notary.MaxExpiry), repo.expiries.expires("targets/archive"), time.Minute)
+	require.WithinDuration(t, now.Add(notary.NotarySnapshotExpiry), repo.expiries.expires(data.CanonicalSnapshotRole), time.Minute)
+}
+
 // Create a repo, instantiate a notary server, and publish the repo with
 // some targets to the server, signing all the non-timestamp metadata.
 // We test this with both an RSA and ECDSA root key
@@ -3199,6 +3511,55 @@ func TestRotateRootKeyProvided(t *testing.T) {
 	require.Equal(t, newRootCertID, rootRoleCertID(t, userRepo))
 }
 
+// Rotating with a threshold sets the threshold on the new keys, and a threshold
+// of 0 keeps the current one as long as the new keys can still meet it.
+func TestRotateKeyWithThreshold(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	var keyIDs []string
+	for i := 0; i < 3; i++ {
+		key, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+		require.NoError(t, err)
+		keyIDs = append(keyIDs, key.ID())
+	}
+
+	// the threshold can't exceed the number of keys, and server managed keys can't be thresholded
+	err := repo.RotateKeyWithThreshold(data.CanonicalTargetsRole, false, keyIDs[:1], 2)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidThreshold{}, err)
+	err = repo.RotateKeyWithThreshold(data.CanonicalSnapshotRole, true, nil, 2)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidThreshold{}, err)
+
+	require.NoError(t, repo.RotateKeyWithThreshold(data.CanonicalTargetsRole, false, keyIDs, 2))
+
+	userRepo, _, userDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(userDir)
+	require.NoError(t, userRepo.Update(false))
+	targetsRole, err := userRepo.tufRepo.GetBaseRole(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, targetsRole.Threshold)
+	require.Len(t, targetsRole.Keys, 3)
+	require.Len(t, userRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signatures, 3)
+
+	// keeping the current threshold of 2 with a single key is not possible
+	err = repo.RotateKey(data.CanonicalTargetsRole, false, keyIDs[:1])
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	require.NoError(t, repo.RotateKey(data.CanonicalTargetsRole, false, keyIDs[:2]))
+	require.NoError(t, userRepo.Update(false))
+	targetsRole, err = userRepo.tufRepo.GetBaseRole(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, targetsRole.Threshold)
+	require.Len(t, targetsRole.Keys, 2)
+}
+
 func TestRotateRootKeyLegacySupport(t *testing.T) {
 	ts := fullTestServer(t)
 	defer ts.Close()
@@ -3387,6 +3748,204 @@ func TestAddDelegationChangefileApplicable(t *testing.T) {
 	require.EqualValues(t, "targets/a", newDelegationRole.Name)
 }
 
+// The changefile produced by AddDelegationWithThreshold records the threshold,
+// and applying it gives the delegation that threshold.
+func TestAddDelegationWithThresholdChangefileApplicable(t *testing.T) {
+	gun := "docker.com/notary"
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, gun, ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	key1, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	key2, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+
+	err = repo.AddDelegationWithThreshold("targets/a", []data.PublicKey{key1, key2}, []string{""}, -1)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidThreshold{}, err)
+	require.Empty(t, getChanges(t, repo))
+
+	err = repo.AddDelegationWithThreshold("targets/a", []data.PublicKey{key1, key2}, []string{""}, 2)
+	require.NoError(t, err)
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 2)
+
+	td := changelist.TUFDelegation{}
+	require.NoError(t, json.Unmarshal(changes[0].Content(), &td))
+	require.Equal(t, 2, td.NewThreshold)
+
+	for _, c := range changes {
+		require.NoError(t, applyTargetsChange(repo.tufRepo, nil, c))
+	}
+	delgRole, err := repo.tufRepo.GetDelegationRole("targets/a")
+	require.NoError(t, err)
+	require.Equal(t, 2, delgRole.Threshold)
+	require.Len(t, delgRole.Keys, 2)
+
+	// a threshold by itself is enough to update an existing delegation
+	err = repo.AddDelegationWithThreshold("targets/a", nil, nil, 1)
+	require.NoError(t, err)
+	changes = getChanges(t, repo)
+	require.Len(t, changes, 3)
+	require.NoError(t, applyTargetsChange(repo.tufRepo, nil, changes[2]))
+	delgRole, err = repo.tufRepo.GetDelegationRole("targets/a")
+	require.NoError(t, err)
+	require.Equal(t, 1, delgRole.Threshold)
+	require.Len(t, delgRole.Keys, 2)
+}
+
+func TestHashedBins(t *testing.T) {
+	for _, numBins := range []int{-2, 0, 1, 3, 24, 8192} {
+		_, err := hashedBins(numBins)
+		require.Error(t, err)
+	}
+
+	bins, err := hashedBins(2)
+	require.NoError(t, err)
+	require.Equal(t, []hashedBin{
+		{name: "0-7", prefixes: []string{"0", "1", "2", "3", "4", "5", "6", "7"}},
+		{name: "8-f", prefixes: []string{"8", "9", "a", "b", "c", "d", "e", "f"}},
+	}, bins)
+
+	bins, err = hashedBins(16)
+	require.NoError(t, err)
+	require.Len(t, bins, 16)
+	require.Equal(t, hashedBin{name: "a", prefixes: []string{"a"}}, bins[10])
+
+	bins, err = hashedBins(32)
+	require.NoError(t, err)
+	require.Len(t, bins, 32)
+	require.Equal(t, "00-07", bins[0].name)
+	require.Equal(t, "f8-ff", bins[31].name)
+	require.Len(t, bins[31].prefixes, 8)
+
+	bins, err = hashedBins(256)
+	require.NoError(t, err)
+	require.Len(t, bins, 256)
+	require.Equal(t, hashedBin{name: "00", prefixes: []string{"00"}}, bins[0])
+	require.Equal(t, hashedBin{name: "ff", prefixes: []string{"ff"}}, bins[255])
+}
+
+func TestAddDelegationHashedBinsChangefileApplicable(t *testing.T) {
+	gun := "docker.com/notary"
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, gun, ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	key, err := repo.GetCryptoService().Create("targets/bins", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+
+	_, err = repo.AddDelegationHashedBins(data.CanonicalRootRole, 2, []data.PublicKey{key}, 1)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	_, err = repo.AddDelegationHashedBins(data.CanonicalTargetsRole, 3, []data.PublicKey{key}, 1)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidHashedBins{}, err)
+	_, err = repo.AddDelegationHashedBins(data.CanonicalTargetsRole, 2, []data.PublicKey{key}, -1)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidThreshold{}, err)
+	require.Empty(t, getChanges(t, repo))
+
+	binNames, err := repo.AddDelegationHashedBins(data.CanonicalTargetsRole, 2, []data.PublicKey{key}, 1)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{"targets/0-7", "targets/8-f"}, binNames)
+
+	// a target already in the targets role is moved into the bin it belongs in
+	existingPath := "existing"
+	_, err = repo.tufRepo.AddTargets(data.CanonicalTargetsRole, data.Files{
+		existingPath: data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}})
+	require.NoError(t, err)
+
+	// a target added to the targets role afterwards goes in the bin it belongs in
+	targetPath := "current"
+	addTarget(t, repo, targetPath, "../fixtures/intermediate-ca.crt")
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 3)
+	for _, c := range changes {
+		require.NoError(t, applyTargetsChange(repo.tufRepo, nil, c))
+	}
+	existingBin, err := repo.tufRepo.HashedBinFor(data.CanonicalTargetsRole, existingPath)
+	require.NoError(t, err)
+	_, ok := repo.tufRepo.Targets[existingBin].Signed.Targets[existingPath]
+	require.True(t, ok)
+
+	expectedBin, otherBin := binNames[0], binNames[1]
+	if data.PathHash(targetPath)[0] >= '8' {
+		expectedBin, otherBin = otherBin, expectedBin
+	}
+	require.Empty(t, repo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Targets)
+	_, ok = repo.tufRepo.Targets[expectedBin].Signed.Targets[targetPath]
+	require.True(t, ok)
+	if otherTargets, ok := repo.tufRepo.Targets[otherBin]; ok {
+		_, ok = otherTargets.Signed.Targets[targetPath]
+		require.False(t, ok)
+	}
+
+	delgRole, err := repo.tufRepo.GetDelegationRole(expectedBin)
+	require.NoError(t, err)
+	require.True(t, delgRole.CheckPaths(targetPath))
+	require.Len(t, delgRole.PathHashPrefixes, 8)
+}
+
+func TestSetDelegationPathTypeChangefileApplicable(t *testing.T) {
+	gun := "docker.com/notary"
+	ts, _, _ := simpleTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, gun, ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	key, err := repo.GetCryptoService().Create("targets/a", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+
+	err = repo.SetDelegationPathType(data.CanonicalTargetsRole, data.PathTypeGlob)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	err = repo.SetDelegationPathType("targets/a", "regexp")
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.Empty(t, getChanges(t, repo))
+
+	// the path type is set before the patterns are added
+	require.NoError(t, repo.AddDelegationRoleAndKeys("targets/a", []data.PublicKey{key}))
+	require.NoError(t, repo.SetDelegationPathType("targets/a", data.PathTypeGlob))
+	require.NoError(t, repo.AddDelegationPaths("targets/a", []string{"*/linux-amd64/*"}))
+	changes := getChanges(t, repo)
+	require.Len(t, changes, 3)
+	for _, c := range changes {
+		require.NoError(t, applyTargetsChange(repo.tufRepo, nil, c))
+	}
+	delgRole, err := repo.tufRepo.GetDelegationRole("targets/a")
+	require.NoError(t, err)
+	require.Equal(t, data.PathTypeGlob, delgRole.PathType)
+	require.True(t, delgRole.CheckPaths("app/linux-amd64/app"))
+	require.False(t, delgRole.CheckPaths("app/linux-amd64/app/v1"))
+
+	// paths removed in the same change as switching the path type don't need to be valid for
+	// the new path type
+	require.NoError(t, repo.AddDelegationPaths("targets/a", []string{"releases/[a"}))
+	changes = getChanges(t, repo)
+	require.Error(t, applyTargetsChange(repo.tufRepo, nil, changes[3]))
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		PathType:      data.PathTypePrefix,
+		ClearAllPaths: true,
+		AddPaths:      []string{"releases/[a"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, applyTargetsChange(repo.tufRepo, nil, newUpdateDelegationChange("targets/a", tdJSON)))
+	delgRole, err = repo.tufRepo.GetDelegationRole("targets/a")
+	require.NoError(t, err)
+	require.Equal(t, data.PathType(""), delgRole.PathType)
+	require.Equal(t, []string{"releases/[a"}, delgRole.Paths)
+	require.True(t, delgRole.CheckPaths("releases/[a/b"))
+}
+
 // TestAddDelegationErrorWritingChanges expects errors writing a change to file
 // to be propagated.
 func TestAddDelegationErrorWritingChanges(t *testing.T) {
@@ -3617,11 +4176,11 @@ func TestBootstrapClientBadURL(t *testing.T) {
 	require.NoError(t, err, "error creating repo: %s", err)
 	repo := r.(*repository)
 
-	c, err := repo.bootstrapClient(false)
+	c, err := repo.bootstrapClient(context.Background(), false)
 	require.Nil(t, c)
 	require.Error(t, err)
 
-	c, err2 := repo.bootstrapClient(true)
+	c, err2 := repo.bootstrapClient(context.Background(), true)
 	require.Nil(t, c)
 	require.Error(t, err2)
 
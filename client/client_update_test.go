@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,8 +20,11 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
 	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustmanager"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
@@ -134,6 +139,34 @@ func TestUpdateSucceedsEvenIfCannotWriteNewRepo(t *testing.T) {
 	}
 }
 
+// An update whose context is cancelled fails with the context's error, without
+// falling back to or writing to the cache
+func TestUpdateContextCancelled(t *testing.T) {
+	serverMeta, _, err := testutils.NewRepoMetadata("docker.com/notary", metadataDelegations...)
+	require.NoError(t, err)
+
+	ts := readOnlyServer(t, store.NewMemoryStore(serverMeta), http.StatusNotFound, "docker.com/notary")
+	defer ts.Close()
+
+	repo, baseDir := newBlankRepo(t, ts.URL)
+	defer os.RemoveAll(baseDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, repo.UpdateContext(ctx, false))
+	for role := range serverMeta {
+		_, err := repo.cache.GetSized(role.String(), store.NoSizeLimit)
+		require.IsType(t, store.ErrMetaNotFound{}, err)
+	}
+
+	require.NoError(t, repo.UpdateContext(context.Background(), false))
+	for role, expected := range serverMeta {
+		actual, err := repo.cache.GetSized(role.String(), store.NoSizeLimit)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(expected, actual))
+	}
+}
+
 // Update can succeed even if we cannot write any metadata to the repo (assuming
 // existing data in the repo)
 func TestUpdateSucceedsEvenIfCannotWriteExistingRepo(t *testing.T) {
@@ -1972,3 +2005,229 @@ func TestRootOnDiskTrustPinning(t *testing.T) {
 
 	require.NoError(t, repo.Update(false))
 }
+
+// slowRemoteStore delays every download, keeping track of how many are in
+// flight at once, and fails downloads of the roles in errs
+type slowRemoteStore struct {
+	store.OfflineStore
+	meta store.MetadataStore
+	errs map[data.RoleName]error
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	downloaded  []string
+}
+
+func (s *slowRemoteStore) GetSized(name string, size int64) ([]byte, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.downloaded = append(s.downloaded, name)
+	s.mu.Unlock()
+
+	for role, err := range s.errs {
+		if strings.HasPrefix(name, role.String()+".") {
+			return nil, err
+		}
+	}
+	return s.meta.GetSized(name, size)
+}
+
+func newRepoWithSlowRemote(t *testing.T, remote *slowRemoteStore) *repository {
+	cs := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("pass")))
+	r, err := NewRepository("docker.com/notary", "", remote, store.NewMemoryStore(nil),
+		trustpinning.TrustPinConfig{}, cs, changelist.NewMemChangelist())
+	require.NoError(t, err)
+	return r.(*repository)
+}
+
+var siblingDelegations = []data.RoleName{
+	"targets/a", "targets/b", "targets/c", "targets/d", "targets/e",
+	"targets/f", "targets/g", "targets/h", "targets/i", "targets/j",
+}
+
+// creates server metadata in which all the sibling delegations have metadata
+func siblingDelegationsMetadata(t *testing.T) map[data.RoleName][]byte {
+	tufRepo, _, err := testutils.EmptyRepo("docker.com/notary", siblingDelegations...)
+	require.NoError(t, err)
+	for _, role := range siblingDelegations {
+		_, err := tufRepo.InitTargets(role)
+		require.NoError(t, err)
+	}
+	serverMeta, err := testutils.SignAndSerialize(tufRepo)
+	require.NoError(t, err)
+	return serverMeta
+}
+
+// Sibling delegations are downloaded concurrently, up to the configured number
+// of workers, and all of them are verified and cached
+func TestUpdateDownloadsDelegationsConcurrently(t *testing.T) {
+	serverMeta := siblingDelegationsMetadata(t)
+
+	for _, workers := range []int{1, 4} {
+		remote := &slowRemoteStore{meta: store.NewMemoryStore(serverMeta)}
+		repo := newRepoWithSlowRemote(t, remote)
+		repo.SetDownloadWorkers(workers)
+		require.NoError(t, repo.Update(false))
+
+		if workers == 1 {
+			require.Equal(t, 1, remote.maxInFlight)
+		} else {
+			require.True(t, remote.maxInFlight > 1, "delegations were downloaded one at a time")
+			require.True(t, remote.maxInFlight <= workers, "too many concurrent downloads: %d", remote.maxInFlight)
+		}
+		for role, expected := range serverMeta {
+			actual, err := repo.cache.GetSized(role.String(), store.NoSizeLimit)
+			require.NoError(t, err, "%s was not cached", role)
+			require.True(t, bytes.Equal(expected, actual))
+		}
+		for _, role := range siblingDelegations {
+			_, ok := repo.tufRepo.Targets[role]
+			require.True(t, ok, "%s was not loaded", role)
+		}
+	}
+}
+
+// When several sibling delegations fail to download, the error for the first of
+// them in traversal order is the one reported, no matter which finished first
+func TestUpdateConcurrentDelegationErrorsAreDeterministic(t *testing.T) {
+	serverMeta := siblingDelegationsMetadata(t)
+
+	for i := 0; i < 5; i++ {
+		remote := &slowRemoteStore{
+			meta: store.NewMemoryStore(serverMeta),
+			errs: map[data.RoleName]error{
+				"targets/c": store.ErrMetaNotFound{Resource: "targets/c"},
+				"targets/h": store.ErrMetaNotFound{Resource: "targets/h"},
+			},
+		}
+		repo := newRepoWithSlowRemote(t, remote)
+		err := repo.Update(false)
+		require.Equal(t, store.ErrMetaNotFound{Resource: "targets/c"}, err)
+
+		// nothing after the failed role is cached
+		_, err = repo.cache.GetSized("targets/b", store.NoSizeLimit)
+		require.NoError(t, err)
+		_, err = repo.cache.GetSized("targets/d", store.NoSizeLimit)
+		require.IsType(t, store.ErrMetaNotFound{}, err)
+	}
+}
+
+// requires that the store did or did not download metadata for the role
+func requireDownloaded(t *testing.T, s *slowRemoteStore, role data.RoleName, expected bool) {
+	found := false
+	for _, name := range s.downloaded {
+		if strings.HasPrefix(name, role.String()+".") {
+			found = true
+		}
+	}
+	require.Equal(t, expected, found, "expected %s to be downloaded: %v", role, expected)
+}
+
+// Looking up a single target only downloads the delegations whose paths can
+// contain it, caching them without replacing the repository's full metadata
+func TestGetTargetByNameOnlyDownloadsMatchingDelegations(t *testing.T) {
+	tufRepo, _, err := testutils.EmptyRepo("docker.com/notary", "targets/a", "targets/a/x", "targets/b")
+	require.NoError(t, err)
+	for role, paths := range map[data.RoleName]string{"targets/a": "a/", "targets/a/x": "a/x/", "targets/b": "b/"} {
+		require.NoError(t, tufRepo.UpdateDelegationPaths(role, []string{paths}, []string{""}, false))
+	}
+	for _, role := range []data.RoleName{"targets/a/x", "targets/b"} {
+		_, err := tufRepo.InitTargets(role)
+		require.NoError(t, err)
+	}
+	_, err = tufRepo.AddTargets("targets/a/x", data.Files{"a/x/image": data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}})
+	require.NoError(t, err)
+	serverMeta, err := testutils.SignAndSerialize(tufRepo)
+	require.NoError(t, err)
+
+	remote := &slowRemoteStore{meta: store.NewMemoryStore(serverMeta)}
+	repo := newRepoWithSlowRemote(t, remote)
+
+	target, err := repo.GetTargetByName("a/x/image")
+	require.NoError(t, err)
+	require.Equal(t, data.RoleName("targets/a/x"), target.Role)
+	requireDownloaded(t, remote, "targets/a", true)
+	requireDownloaded(t, remote, "targets/a/x", true)
+	requireDownloaded(t, remote, "targets/b", false)
+	_, err = repo.cache.GetSized("targets/b", store.NoSizeLimit)
+	require.IsType(t, store.ErrMetaNotFound{}, err)
+	_, ok := repo.tufRepo.Targets["targets/b"]
+	require.False(t, ok)
+
+	// a second lookup uses the cached delegations
+	remote.downloaded = nil
+	targets, err := repo.GetAllTargetMetadataByName("a/x/image")
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	requireDownloaded(t, remote, "targets/a", false)
+	requireDownloaded(t, remote, "targets/a/x", false)
+
+	_, err = repo.GetTargetByName("b/image")
+	require.IsType(t, ErrNoSuchTarget(""), err)
+	requireDownloaded(t, remote, "targets/a", false)
+	requireDownloaded(t, remote, "targets/b", true)
+
+	// a full update downloads the remaining delegations
+	require.NoError(t, repo.Update(false))
+	for role := range serverMeta {
+		_, err := repo.cache.GetSized(role.String(), store.NoSizeLimit)
+		require.NoError(t, err)
+		_, ok := repo.tufRepo.Targets[role]
+		require.Equal(t, role != data.CanonicalRootRole && role != data.CanonicalSnapshotRole && role != data.CanonicalTimestampRole, ok)
+	}
+}
+
+// A terminating delegation whose metadata fails verification still ends the
+// search for the targets it matches, both when looking up and listing targets
+func TestTerminatingDelegationFailingVerificationEndsSearch(t *testing.T) {
+	tufRepo, cs, err := testutils.EmptyRepo("docker.com/notary", "targets/a", "targets/b")
+	require.NoError(t, err)
+	require.NoError(t, tufRepo.UpdateDelegationPaths("targets/a", []string{"shared/"}, []string{""}, false))
+	require.NoError(t, tufRepo.UpdateDelegationTerminating("targets/a", true))
+	for _, role := range []data.RoleName{"targets/a", "targets/b"} {
+		_, err := tufRepo.InitTargets(role)
+		require.NoError(t, err)
+	}
+	meta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = tufRepo.AddTargets("targets/b", data.Files{"shared/image": meta, "other": meta})
+	require.NoError(t, err)
+	serverMeta, err := testutils.SignAndSerialize(tufRepo)
+	require.NoError(t, err)
+
+	swizzler := testutils.NewMetadataSwizzler("docker.com/notary", serverMeta, cs)
+	require.NoError(t, swizzler.ExpireMetadata("targets/a"))
+	require.NoError(t, swizzler.UpdateSnapshotHashes())
+	require.NoError(t, swizzler.UpdateTimestampHash())
+
+	for _, listFirst := range []bool{true, false} {
+		repo := newRepoWithSlowRemote(t, &slowRemoteStore{meta: swizzler.MetadataCache})
+		if listFirst {
+			targets, err := repo.ListTargets()
+			require.NoError(t, err)
+			require.Len(t, targets, 1)
+			require.Equal(t, "other", targets[0].Name)
+		}
+		_, err = repo.GetTargetByName("shared/image")
+		require.IsType(t, ErrNoSuchTarget(""), err)
+		_, ok := repo.tufRepo.Targets["targets/a"]
+		require.False(t, ok)
+		target, err := repo.GetTargetByName("other")
+		require.NoError(t, err)
+		require.Equal(t, data.RoleName("targets/b"), target.Role)
+
+		// looking in targets/b specifically still finds it
+		target, err = repo.GetTargetByName("shared/image", "targets/b")
+		require.NoError(t, err)
+		require.Equal(t, data.RoleName("targets/b"), target.Role)
+	}
+}
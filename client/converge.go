@@ -0,0 +1,210 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/net/context"
+)
+
+// DelegationSpec is the desired state of a delegation role.  Keys are the
+// public keys trusted to sign for the role, and Threshold is how many of them
+// must sign, where 0 is taken as 1.  An empty PathType is taken as path
+// prefixes.
+type DelegationSpec struct {
+	Name        data.RoleName
+	Keys        []data.PublicKey
+	Threshold   int
+	Paths       []string
+	PathType    data.PathType
+	Terminating bool
+}
+
+// ConvergeDelegations stages the changes that bring the delegations of the
+// repository to the desired state in the given changelist, which is either the
+// repository's own, to publish them, or one in memory, to plan them with
+// PlanChangelist, and returns the delegations that the
+// changes add, remove or change.  Delegations that are not in the desired
+// state are removed, except for hashed bin delegations and the delegations
+// below them, which cannot be declared and are left as they are.  The changes
+// are worked out from the published metadata, or from the local metadata if
+// the repository has not been published yet, so any changes that are already
+// staged are not taken into account.
+func (r *repository) ConvergeDelegations(specs []DelegationSpec, cl changelist.Changelist) ([]RoleDiff, error) {
+	return r.ConvergeDelegationsContext(context.Background(), specs, cl)
+}
+
+// ConvergeDelegationsContext is ConvergeDelegations with a context for updating
+// the repository
+func (r *repository) ConvergeDelegationsContext(ctx context.Context, specs []DelegationSpec, cl changelist.Changelist) ([]RoleDiff, error) {
+	if err := r.UpdateContext(ctx, false); err != nil {
+		if _, ok := err.(ErrRepositoryNotExist); !ok {
+			return nil, err
+		}
+		if err := r.bootstrapRepo(); err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				return nil, ErrRepoNotInitialized{}
+			}
+			return nil, err
+		}
+	}
+	current, err := listDelegationRoles(r.tufRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	from := make(map[data.RoleName]data.Role, len(current))
+	var bins []data.RoleName
+	for _, role := range current {
+		from[role.Name] = role
+		if len(role.PathHashPrefixes) > 0 {
+			bins = append(bins, role.Name)
+		}
+	}
+	// hashed bin delegations and their descendants are left out of both sides,
+	// so that they are neither changed nor removed
+	underBin := func(name data.RoleName) bool {
+		for _, bin := range bins {
+			if name == bin || strings.HasPrefix(name.String(), bin.String()+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	for name := range from {
+		if underBin(name) {
+			delete(from, name)
+		}
+	}
+
+	to := make(map[data.RoleName]data.Role, len(specs))
+	keys := make(map[data.RoleName]map[string]data.PublicKey, len(specs))
+	for _, spec := range specs {
+		role, roleKeys, err := desiredDelegation(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := to[spec.Name]; ok {
+			return nil, data.ErrInvalidRole{Role: spec.Name, Reason: "the delegation is declared more than once"}
+		}
+		if underBin(spec.Name) {
+			return nil, data.ErrInvalidRole{Role: spec.Name, Reason: "hashed bin delegations and the delegations below them cannot be declared"}
+		}
+		to[spec.Name], keys[spec.Name] = role, roleKeys
+	}
+	for name := range to {
+		parent := name.Parent()
+		if _, ok := to[parent]; !ok && parent != data.CanonicalTargetsRole && !underBin(parent) {
+			return nil, data.ErrInvalidRole{Role: name, Reason: fmt.Sprintf("its delegating role %s is not declared", parent)}
+		}
+	}
+
+	diffs := diffRoles(from, to)
+	changes, err := delegationChanges(diffs, from, to, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		if err := changelist.AddBatch(cl, changes); err != nil {
+			return nil, err
+		}
+	}
+	return diffs, nil
+}
+
+// desiredDelegation returns the delegation role that a spec declares, with
+// canonical key IDs as listDelegationRoles returns, and its keys by those IDs
+func desiredDelegation(spec DelegationSpec) (data.Role, map[string]data.PublicKey, error) {
+	if !data.IsDelegation(spec.Name) {
+		return data.Role{}, nil, data.ErrInvalidRole{Role: spec.Name, Reason: "invalid delegation role name"}
+	}
+	threshold := spec.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	if len(spec.Keys) == 0 || threshold < 0 || threshold > len(spec.Keys) {
+		return data.Role{}, nil, ErrInvalidThreshold{Role: spec.Name, Threshold: threshold, NumKeys: len(spec.Keys)}
+	}
+	keys := make(map[string]data.PublicKey, len(spec.Keys))
+	for _, key := range spec.Keys {
+		id, err := utils.CanonicalKeyID(key)
+		if err != nil {
+			return data.Role{}, nil, err
+		}
+		keys[id] = key
+	}
+	keyIDs := make([]string, 0, len(keys))
+	for id := range keys {
+		keyIDs = append(keyIDs, id)
+	}
+	sort.Strings(keyIDs)
+
+	role, err := data.NewRole(spec.Name, threshold, keyIDs, spec.Paths)
+	if err != nil {
+		return data.Role{}, nil, err
+	}
+	// path prefixes are stored without a path type
+	if spec.PathType != data.PathTypePrefix {
+		if err := role.SetPathType(spec.PathType); err != nil {
+			return data.Role{}, nil, err
+		}
+	}
+	role.Terminating = spec.Terminating
+	return *role, keys, nil
+}
+
+// delegationChanges returns the changes that make the differences between the
+// delegations: the removals first, each delegation before the one that
+// delegates to it, and then the additions and changes, each delegation after
+// the one that delegates to it
+func delegationChanges(diffs []RoleDiff, from, to map[data.RoleName]data.Role, keys map[data.RoleName]map[string]data.PublicKey) ([]changelist.Change, error) {
+	var removals, changes []changelist.Change
+	for i := len(diffs) - 1; i >= 0; i-- {
+		if diffs[i].Change == DiffRemoved {
+			removals = append(removals, newDeleteDelegationChange(diffs[i].Role, nil))
+		}
+	}
+	for _, diff := range diffs {
+		if diff.Change == DiffRemoved {
+			continue
+		}
+		fromRole, toRole := from[diff.Role], to[diff.Role]
+		td := changelist.TUFDelegation{
+			RemoveKeys:  diff.RemovedKeys,
+			AddPaths:    diff.AddedPaths,
+			RemovePaths: diff.RemovedPaths,
+		}
+		for _, id := range diff.AddedKeys {
+			td.AddKeys = append(td.AddKeys, keys[diff.Role][id])
+		}
+		if diff.FromThreshold != diff.ToThreshold {
+			td.NewThreshold = diff.ToThreshold
+		}
+		if fromRole.PathType != toRole.PathType {
+			td.PathType = toRole.PathType
+			if td.PathType == "" {
+				td.PathType = data.PathTypePrefix
+			}
+		}
+		if fromRole.Terminating != toRole.Terminating {
+			terminating := toRole.Terminating
+			td.Terminating = &terminating
+		}
+		tdJSON, err := json.Marshal(&td)
+		if err != nil {
+			return nil, err
+		}
+		if diff.Change == DiffAdded {
+			changes = append(changes, newCreateDelegationChange(diff.Role, tdJSON))
+		} else {
+			changes = append(changes, newUpdateDelegationChange(diff.Role, tdJSON))
+		}
+	}
+	return append(removals, changes...), nil
+}
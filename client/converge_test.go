@@ -0,0 +1,147 @@
+package client
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+func delegationsByName(t *testing.T, repo *repository) map[data.RoleName]data.Role {
+	roles, err := repo.GetDelegationRoles()
+	require.NoError(t, err)
+	byName := make(map[data.RoleName]data.Role, len(roles))
+	for _, role := range roles {
+		sort.Strings(role.KeyIDs)
+		sort.Strings(role.Paths)
+		byName[role.Name] = role
+	}
+	return byName
+}
+
+func canonicalIDs(t *testing.T, keys ...data.PublicKey) []string {
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		id, err := utils.CanonicalKeyID(key)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Converging stages the changes that add, change and remove delegations to
+// match the desired state, and nothing once they match
+func TestConvergeDelegations(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	var keys []data.PublicKey
+	for i := 0; i < 3; i++ {
+		key, err := repo.GetCryptoService().Create("targets/releases", repo.gun, data.ECDSAKey)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	// the repository has not been published yet
+	specs := []DelegationSpec{
+		{Name: "targets/releases", Keys: keys[:1], Paths: []string{"releases/"}},
+		{Name: "targets/nightly", Keys: keys[1:], Threshold: 2, Paths: []string{"*/nightly"}, PathType: data.PathTypeGlob, Terminating: true},
+	}
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+
+	// changes staged in memory are left out of the repository's changelist
+	planned := changelist.NewMemChangelist()
+	diffs, err := repo.ConvergeDelegations(specs, planned)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+	require.Len(t, planned.List(), 2)
+	require.Empty(t, cl.List())
+
+	diffs, err = repo.ConvergeDelegations(specs, cl)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+	for _, diff := range diffs {
+		require.Equal(t, DiffAdded, diff.Change)
+	}
+	require.NoError(t, repo.Publish())
+
+	roles := delegationsByName(t, repo)
+	require.Len(t, roles, 2)
+	require.Equal(t, canonicalIDs(t, keys[0]), roles["targets/releases"].KeyIDs)
+	require.Equal(t, []string{"releases/"}, roles["targets/releases"].Paths)
+	require.Equal(t, 1, roles["targets/releases"].Threshold)
+	require.Equal(t, canonicalIDs(t, keys[1:]...), roles["targets/nightly"].KeyIDs)
+	require.Equal(t, 2, roles["targets/nightly"].Threshold)
+	require.Equal(t, data.PathTypeGlob, roles["targets/nightly"].PathType)
+	require.True(t, roles["targets/nightly"].Terminating)
+
+	// nothing is staged once the delegations match
+	diffs, err = repo.ConvergeDelegations(specs, cl)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+	require.Empty(t, cl.List())
+
+	diffs, err = repo.ConvergeDelegations([]DelegationSpec{
+		{Name: "targets/releases", Keys: keys[1:], Threshold: 2, Paths: []string{"releases/", "beta/"}, Terminating: true},
+	}, cl)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+	require.Equal(t, RoleDiff{Role: "targets/nightly", Change: DiffRemoved, RemovedKeys: canonicalIDs(t, keys[1:]...), RemovedPaths: []string{"*/nightly"}, FromThreshold: 2}, diffs[0])
+	require.Equal(t, RoleDiff{
+		Role:          "targets/releases",
+		Change:        DiffChanged,
+		AddedKeys:     canonicalIDs(t, keys[1:]...),
+		RemovedKeys:   canonicalIDs(t, keys[0]),
+		AddedPaths:    []string{"beta/"},
+		FromThreshold: 1,
+		ToThreshold:   2,
+	}, diffs[1])
+	require.NoError(t, repo.Publish())
+
+	roles = delegationsByName(t, repo)
+	require.Len(t, roles, 1)
+	require.Equal(t, canonicalIDs(t, keys[1:]...), roles["targets/releases"].KeyIDs)
+	require.Equal(t, []string{"beta/", "releases/"}, roles["targets/releases"].Paths)
+	require.Equal(t, 2, roles["targets/releases"].Threshold)
+	require.True(t, roles["targets/releases"].Terminating)
+}
+
+// Desired states that cannot be converged on are rejected without staging
+// anything
+func TestConvergeDelegationsInvalid(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	blank, blankDir := newBlankRepo(t, ts.URL)
+	defer os.RemoveAll(blankDir)
+	_, err := blank.ConvergeDelegations(nil, changelist.NewMemChangelist())
+	require.IsType(t, ErrRepoNotInitialized{}, err)
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	key, err := repo.GetCryptoService().Create("targets/releases", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+
+	for _, specs := range [][]DelegationSpec{
+		{{Name: "targets/releases", Keys: []data.PublicKey{key}, Threshold: 2}},
+		{{Name: "targets/releases"}},
+		{{Name: "targets/releases/beta", Keys: []data.PublicKey{key}}},
+		{{Name: "releases", Keys: []data.PublicKey{key}}},
+		{{Name: "targets/releases", Keys: []data.PublicKey{key}, PathType: "regexp"}},
+		{{Name: "targets/releases", Keys: []data.PublicKey{key}}, {Name: "targets/releases", Keys: []data.PublicKey{key}}},
+	} {
+		_, err := repo.ConvergeDelegations(specs, cl)
+		require.Error(t, err)
+	}
+	require.Empty(t, cl.List())
+}
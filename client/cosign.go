@@ -0,0 +1,476 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/net/context"
+)
+
+// PendingMetadata is the metadata for a single role that has been signed
+// with the keys available locally, but that may still need signatures from
+// keys held by other people before it can be published.  It carries the keys
+// that are allowed to sign it, so that it can be co-signed without access to
+// the rest of the repository.
+type PendingMetadata struct {
+	GUN     data.GUN        `json:"gun"`
+	Role    data.RoleName   `json:"role"`
+	Signers []PendingSigner `json:"signers"`
+	Signed  *data.Signed    `json:"signed"`
+	// Changes are the staged changes that the metadata was signed from, so
+	// that they can be removed from the changelist once it is published
+	Changes []*changelist.TUFChange `json:"changes,omitempty"`
+}
+
+// PendingSigner is a role whose threshold the signatures on pending metadata
+// must meet.  Root metadata that changes the root keys or threshold has to be
+// signed by both the previous and the new root role.
+type PendingSigner struct {
+	Role      data.RoleName `json:"role"`
+	Keys      data.KeyList  `json:"keys"`
+	Threshold int           `json:"threshold"`
+}
+
+func newPendingSigner(role data.BaseRole) PendingSigner {
+	return PendingSigner{
+		Role:      role.Name,
+		Keys:      role.ListKeys(),
+		Threshold: role.Threshold,
+	}
+}
+
+func (s PendingSigner) baseRole() data.BaseRole {
+	return data.NewBaseRole(s.Role, s.Threshold, s.Keys...)
+}
+
+// Verify checks that the pending metadata is signed by enough keys to meet
+// the threshold of every role that has to sign it.  It only checks against the
+// Signers that the metadata carries, which anyone can change, so it is up to
+// the repository to check that they are the ones it trusts, as
+// SignPendingMetadata and PushPendingMetadata do.
+func (p *PendingMetadata) Verify() error {
+	if p.Signed == nil || p.Signed.Signed == nil || len(p.Signers) == 0 {
+		return ErrInvalidPendingMetadata{Role: p.Role, msg: "no metadata or signing roles"}
+	}
+	for _, signer := range p.Signers {
+		if err := signed.VerifySignatures(p.Signed, signer.baseRole()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPendingMetadata applies the changelist to the repository, and returns
+// the metadata for every role that would be published, signed with whichever
+// of the necessary keys are available locally.  Unlike Publish, it does not
+// fail if there are too few keys to meet a role's threshold, so that the
+// metadata can be co-signed using SignPendingMetadata and then published using
+// PushPendingMetadata.  The snapshot is not exported, since it depends on the
+// final signatures of the other roles; it is signed when the metadata is pushed.
+// The changelist is not cleared, but each role's metadata records the changes
+// to it, which are removed from the changelist when it is published.
+func (r *repository) ExportPendingMetadata() ([]*PendingMetadata, error) {
+	initialPublish, err := r.updateForPublish(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	prevRoot, err := r.tufRepo.GetBaseRole(data.CanonicalRootRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyChangelist(r.tufRepo, r.invalid, r.changelist); err != nil {
+		logrus.Debug("Error applying changelist")
+		return nil, err
+	}
+
+	legacyKeys, err := r.oldKeysForLegacyClientSupport(context.Background(), r.LegacyVersions, initialPublish)
+	if err != nil {
+		return nil, err
+	}
+	if len(legacyKeys) > 0 {
+		r.tufRepo.Root.Dirty = true
+	}
+
+	var pending []*PendingMetadata
+
+	if nearExpiry(r.tufRepo.Root.Signed.SignedCommon) || r.tufRepo.Root.Dirty || initialPublish {
+		currRoot, err := r.tufRepo.GetBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, err
+		}
+		signers := []PendingSigner{newPendingSigner(currRoot)}
+		if !prevRoot.Equals(currRoot) {
+			signers = append([]PendingSigner{newPendingSigner(prevRoot)}, signers...)
+		}
+
+		var s *data.Signed
+		if r.tufRepo.Root.Dirty || nearExpiry(r.tufRepo.Root.Signed.SignedCommon) {
+			s, err = r.tufRepo.SignRootPartially(r.expiries.expires(data.CanonicalRootRole), legacyKeys)
+		} else {
+			// publishing for the first time, so the root that was signed when
+			// the repository was initialized is published as it is
+			s, err = r.tufRepo.Root.ToSigned()
+		}
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, &PendingMetadata{
+			GUN:     r.gun,
+			Role:    data.CanonicalRootRole,
+			Signers: signers,
+			Signed:  s,
+		})
+	}
+
+	// export parents before their delegations, so the order is deterministic
+	targetsRoles := make(utils.RoleList, 0, len(r.tufRepo.Targets))
+	for roleName, roleObj := range r.tufRepo.Targets {
+		if roleObj.Dirty || (roleName == data.CanonicalTargetsRole && initialPublish) {
+			targetsRoles = append(targetsRoles, roleName.String())
+		}
+	}
+	sort.Sort(targetsRoles)
+
+	for _, name := range targetsRoles {
+		roleName := data.RoleName(name)
+		var role data.BaseRole
+		if roleName == data.CanonicalTargetsRole {
+			role, err = r.tufRepo.GetBaseRole(roleName)
+		} else {
+			var delgRole data.DelegationRole
+			delgRole, err = r.tufRepo.GetDelegationRole(roleName)
+			role = delgRole.BaseRole
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.tufRepo.SignTargetsPartially(roleName, r.expiries.expires(roleName))
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, &PendingMetadata{
+			GUN:     r.gun,
+			Role:    roleName,
+			Signers: []PendingSigner{newPendingSigner(role)},
+			Signed:  s,
+		})
+	}
+
+	for _, c := range r.changelist.List() {
+		for _, p := range pending {
+			if p.Role == changedRole(c) {
+				p.Changes = append(p.Changes, changelist.NewTUFChange(
+					c.Action(), c.Scope(), c.Type(), c.Path(), c.Content()))
+				break
+			}
+		}
+	}
+	return pending, nil
+}
+
+// changedRole returns the role whose metadata a change is made in.  A change
+// to a delegation is made in the metadata of its delegating role.
+func changedRole(c changelist.Change) data.RoleName {
+	if c.Type() == changelist.TypeTargetsDelegation {
+		return c.Scope().Parent()
+	}
+	return c.Scope()
+}
+
+// removePublishedChanges removes the changes that pending metadata that has
+// been published was signed from.  The metadata is published already, so a
+// failure only leaves the changes staged.
+func (r *repository) removePublishedChanges(pending []*PendingMetadata) {
+	var published []*changelist.TUFChange
+	for _, p := range pending {
+		published = append(published, p.Changes...)
+	}
+	if err := r.removeChanges(published); err != nil {
+		logrus.Warnf("Unable to remove the published changes from the changelist, you may want to clear them with `notary reset`: %v", err)
+	}
+}
+
+// SignPendingMetadata adds signatures to the pending metadata using any of
+// its signing keys that are available to this repository's CryptoService.
+// The repository is updated first, and the signing keys and thresholds that
+// the metadata carries must be the ones that the repository trusts for the
+// role, so a delegation can only be co-signed once it has been published.
+// Existing valid signatures are kept.  It is an error if none of the signing
+// keys are available.
+func (r *repository) SignPendingMetadata(pending *PendingMetadata) error {
+	return r.SignPendingMetadataContext(context.Background(), pending)
+}
+
+// SignPendingMetadataContext is SignPendingMetadata with a context for
+// updating the repository
+func (r *repository) SignPendingMetadataContext(ctx context.Context, pending *PendingMetadata) error {
+	if err := r.checkPendingMetadata(pending); err != nil {
+		return err
+	}
+	if _, err := r.updateForSigning(ctx, false); err != nil {
+		return err
+	}
+	signers, err := r.trustedSigners(pending)
+	if err != nil {
+		return err
+	}
+	var keys data.KeyList
+	for _, signer := range signers {
+		keys = append(keys, signer.Keys...)
+	}
+	return signed.Sign(r.GetCryptoService(), pending.Signed, keys, 1, keys)
+}
+
+// PushPendingMetadata publishes pending metadata once it has been signed by
+// enough keys.  The repository is updated first, and each role is checked
+// against it as it would be when downloaded: the root with the trust pinning
+// configuration and the current root keys, and each targets and delegation
+// role with the keys that the root or its delegating role trusts for it, which
+// may be in the pending metadata too.  The snapshot is signed too if the
+// snapshot key is available, otherwise the server is assumed to sign it.  All
+// the metadata is published in a single update, which the server rejects if
+// another client has published in the meantime.
+func (r *repository) PushPendingMetadata(pending ...*PendingMetadata) error {
+	return r.PushPendingMetadataContext(context.Background(), pending...)
+}
+
+// PushPendingMetadataContext is PushPendingMetadata with a context for
+// updating the repository and uploading the metadata
+func (r *repository) PushPendingMetadataContext(ctx context.Context, pending ...*PendingMetadata) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	byRole := make(map[data.RoleName]*PendingMetadata, len(pending))
+	roles := make([]data.RoleName, 0, len(pending))
+	for _, p := range pending {
+		if err := r.checkPendingMetadata(p); err != nil {
+			return err
+		}
+		if _, ok := byRole[p.Role]; ok {
+			return ErrInvalidPendingMetadata{Role: p.Role, msg: "the role is pending more than once"}
+		}
+		byRole[p.Role] = p
+		roles = append(roles, p.Role)
+	}
+	// the root comes first, and each delegating role before its delegations,
+	// so that the keys for each role are known before it is checked
+	sortRoles(roles)
+
+	initialPublish, err := r.updateForSigning(ctx, true)
+	if err != nil {
+		return err
+	}
+	expected := publishedVersions(r.tufRepo, initialPublish)
+
+	updatedFiles := make(map[data.RoleName][]byte)
+	for _, role := range roles {
+		p := byRole[role]
+		if _, err := r.trustedSigners(p); err != nil {
+			return err
+		}
+		if err := p.Verify(); err != nil {
+			return ErrInvalidPendingMetadata{Role: p.Role, msg: err.Error()}
+		}
+		var s *data.Signed
+		if role == data.CanonicalRootRole {
+			var root *data.SignedRoot
+			if root, err = trustpinning.ValidateRoot(r.tufRepo.Root, p.Signed, r.gun, r.trustPinning); err != nil {
+				return ErrInvalidPendingMetadata{Role: role, msg: err.Error()}
+			}
+			r.tufRepo.Root = root
+			s, err = root.ToSigned()
+		} else {
+			var targets *data.SignedTargets
+			if targets, err = data.TargetsFromSigned(p.Signed, role); err == nil {
+				r.tufRepo.Targets[role] = targets
+				s, err = targets.ToSigned()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if updatedFiles[role], err = json.Marshal(s); err != nil {
+			return err
+		}
+	}
+
+	if err := r.publishSigned(ctx, updatedFiles, expected); err != nil {
+		return err
+	}
+	r.removePublishedChanges(pending)
+	return nil
+}
+
+// updateForSigning brings the repository up to date, or loads it from the
+// cache if it has never been published, without initializing it as
+// updateForPublish would, so that metadata or changes can be signed and
+// checked against the keys it trusts
+func (r *repository) updateForSigning(ctx context.Context, forWrite bool) (initialPublish bool, err error) {
+	if err := r.UpdateContext(ctx, forWrite); err != nil {
+		if _, ok := err.(ErrRepositoryNotExist); !ok {
+			return false, err
+		}
+		if err := r.bootstrapRepo(); err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				return false, ErrRepoNotInitialized{}
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// trustedSigners returns the roles that the repository trusts to sign the
+// pending metadata, and checks that they are the Signers the metadata carries.
+// A root that changes the root keys or threshold must be signed by the
+// current root role as well as the one it declares.
+func (r *repository) trustedSigners(pending *PendingMetadata) ([]PendingSigner, error) {
+	var signers []PendingSigner
+	switch {
+	case pending.Role == data.CanonicalRootRole:
+		prevRoot, err := r.tufRepo.GetBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, err
+		}
+		root, err := data.RootFromSigned(pending.Signed)
+		if err != nil {
+			return nil, ErrInvalidPendingMetadata{Role: pending.Role, msg: err.Error()}
+		}
+		currRoot, err := root.BuildBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, ErrInvalidPendingMetadata{Role: pending.Role, msg: err.Error()}
+		}
+		signers = append(signers, newPendingSigner(currRoot))
+		if !prevRoot.Equals(currRoot) {
+			signers = append([]PendingSigner{newPendingSigner(prevRoot)}, signers...)
+		}
+	case pending.Role == data.CanonicalTargetsRole:
+		role, err := r.tufRepo.GetBaseRole(pending.Role)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, newPendingSigner(role))
+	case data.IsDelegation(pending.Role):
+		delgRole, err := r.tufRepo.GetDelegationRole(pending.Role)
+		if err != nil {
+			return nil, ErrInvalidPendingMetadata{
+				Role: pending.Role,
+				msg:  fmt.Sprintf("the role is not delegated in the metadata of %s: %v", r.gun, err),
+			}
+		}
+		signers = append(signers, newPendingSigner(delgRole.BaseRole))
+	default:
+		return nil, ErrInvalidPendingMetadata{Role: pending.Role, msg: "this role cannot be co-signed"}
+	}
+	if !signersEqual(signers, pending.Signers) {
+		return nil, ErrInvalidPendingMetadata{
+			Role: pending.Role,
+			msg:  fmt.Sprintf("its signing keys or threshold are not the ones trusted by %s", r.gun),
+		}
+	}
+	return signers, nil
+}
+
+// signersEqual is whether two lists of signing roles have the same roles, in
+// the same order, with the same keys and thresholds
+func signersEqual(a, b []PendingSigner) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].baseRole().Equals(b[i].baseRole()) {
+			return false
+		}
+	}
+	return true
+}
+
+// StagePendingMetadata uploads pending metadata, which may not yet be signed by
+// enough keys, to the server.  The server keeps it, merging in the signatures
+// from any later uploads of the same metadata, until every role's thresholds
+// are met, at which point it publishes all of it in a single update.  This
+// requires the server to manage the snapshot key.  It returns true if the
+// metadata has been published, in which case the changes it records are
+// removed from the changelist.  The server does not keep the changes, so
+// whoever exported the metadata has to clear them if someone else's upload
+// publishes it.
+func (r *repository) StagePendingMetadata(pending ...*PendingMetadata) (bool, error) {
+	if len(pending) == 0 {
+		return false, nil
+	}
+	metas := make(map[string][]byte)
+	for _, p := range pending {
+		if err := r.checkPendingMetadata(p); err != nil {
+			return false, err
+		}
+		if p.Role != data.CanonicalRootRole && p.Role != data.CanonicalTargetsRole && !data.IsDelegation(p.Role) {
+			return false, ErrInvalidPendingMetadata{Role: p.Role, msg: "this role cannot be co-signed"}
+		}
+		raw, err := json.Marshal(p.Signed)
+		if err != nil {
+			return false, err
+		}
+		metas[p.Role.String()] = raw
+	}
+	published, err := store.SetPending(context.Background(), r.getRemoteStore(), metas)
+	if err != nil || !published {
+		return published, err
+	}
+	r.removePublishedChanges(pending)
+	return true, nil
+}
+
+// GetStagedMetadata returns the pending metadata that has been staged on the
+// server, so that it can be co-signed using SignPendingMetadata and uploaded
+// again using StagePendingMetadata.
+func (r *repository) GetStagedMetadata() ([]*PendingMetadata, error) {
+	raw, err := store.GetPending(context.Background(), r.getRemoteStore())
+	if err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var pending []*PendingMetadata
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		if p.GUN != r.gun {
+			return nil, ErrInvalidPendingMetadata{
+				Role: p.Role,
+				msg:  fmt.Sprintf("metadata is for %s, not %s", p.GUN, r.gun),
+			}
+		}
+	}
+	return pending, nil
+}
+
+// DiscardStagedMetadata removes the pending metadata that has been staged on
+// the server
+func (r *repository) DiscardStagedMetadata() error {
+	return store.RemovePending(context.Background(), r.getRemoteStore())
+}
+
+func (r *repository) checkPendingMetadata(pending *PendingMetadata) error {
+	if pending.GUN != r.gun {
+		return ErrInvalidPendingMetadata{
+			Role: pending.Role,
+			msg:  fmt.Sprintf("metadata is for %s, not %s", pending.GUN, r.gun),
+		}
+	}
+	if pending.Signed == nil || pending.Signed.Signed == nil || len(pending.Signers) == 0 {
+		return ErrInvalidPendingMetadata{Role: pending.Role, msg: "no metadata or signing roles"}
+	}
+	return nil
+}
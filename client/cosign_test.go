@@ -0,0 +1,269 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+)
+
+// moveKey moves a private key from one repository's crypto service to another's
+func moveKey(t *testing.T, from, to *repository, keyID string, role data.RoleName) {
+	privKey, _, err := from.GetCryptoService().GetPrivateKey(keyID)
+	require.NoError(t, err)
+	require.NoError(t, to.GetCryptoService().AddKey(role, to.gun, privKey))
+	require.NoError(t, from.GetCryptoService().RemoveKey(keyID))
+}
+
+// Targets metadata that needs signatures from keys held by two different people can be
+// exported by one of them, co-signed by the other, and then pushed.
+func TestCoSignTargetsWithThreshold(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	// rotate to two targets keys with a threshold of 2, then give one of them to a co-signer
+	targetsKeyIDs := repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole)
+	require.Len(t, targetsKeyIDs, 1)
+	newKey, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.RotateKeyWithThreshold(
+		data.CanonicalTargetsRole, false, []string{targetsKeyIDs[0], newKey.ID()}, 2))
+
+	coSigner, _, coSignerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(coSignerDir)
+	moveKey(t, repo, coSigner, newKey.ID(), data.CanonicalTargetsRole)
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	err = repo.Publish()
+	require.Error(t, err)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+
+	pending, err := repo.ExportPendingMetadata()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, data.CanonicalTargetsRole, pending[0].Role)
+	require.Len(t, pending[0].Signed.Signatures, 1)
+	require.Error(t, pending[0].Verify())
+	require.Len(t, pending[0].Changes, 1)
+	require.Equal(t, "latest", pending[0].Changes[0].Path())
+
+	// under-signed metadata can't be pushed
+	err = repo.PushPendingMetadata(pending...)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+
+	// the co-signer only sees the exported file
+	exported, err := json.Marshal(pending[0])
+	require.NoError(t, err)
+	var toSign PendingMetadata
+	require.NoError(t, json.Unmarshal(exported, &toSign))
+	require.NoError(t, coSigner.SignPendingMetadata(&toSign))
+	require.Len(t, toSign.Signed.Signatures, 2)
+	require.NoError(t, toSign.Verify())
+
+	// signing again with the same key does not add another signature
+	require.NoError(t, coSigner.SignPendingMetadata(&toSign))
+	require.Len(t, toSign.Signed.Signatures, 2)
+
+	// the co-signer does not have the snapshot key, and the server does not manage the snapshot
+	err = coSigner.PushPendingMetadata(&toSign)
+	require.Error(t, err)
+
+	// only the change that the metadata was signed from is unstaged
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, repo.PushPendingMetadata(&toSign))
+	changes := repo.changelist.List()
+	require.Len(t, changes, 1)
+	require.Equal(t, "current", changes[0].Path())
+
+	userRepo, _, userDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(userDir)
+	targets, err := userRepo.ListTargets()
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	require.Equal(t, "latest", targets[0].Name)
+	require.Len(t, userRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signatures, 2)
+}
+
+// Pending metadata can only be signed by a repository for the same GUN that has
+// at least one of its signing keys, and only valid roles can be pushed.
+func TestSignPendingMetadataErrors(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+
+	pending, err := repo.ExportPendingMetadata()
+	require.NoError(t, err)
+	// publishing for the first time exports both the root and the targets
+	require.Len(t, pending, 2)
+	require.Equal(t, data.CanonicalRootRole, pending[0].Role)
+	require.Equal(t, data.CanonicalTargetsRole, pending[1].Role)
+	for _, p := range pending {
+		require.NoError(t, p.Verify())
+	}
+
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+
+	// the repository has not been published, so there is nothing to check the
+	// signing keys against
+	err = otherRepo.SignPendingMetadata(pending[1])
+	require.Error(t, err)
+	require.IsType(t, ErrRepoNotInitialized{}, err)
+
+	wrongGUN := *pending[1]
+	wrongGUN.GUN = "docker.com/other"
+	err = repo.SignPendingMetadata(&wrongGUN)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+
+	snapshot := *pending[1]
+	snapshot.Role = data.CanonicalSnapshotRole
+	snapshot.Signers = []PendingSigner{{Role: data.CanonicalSnapshotRole, Keys: pending[1].Signers[0].Keys, Threshold: 1}}
+	err = repo.PushPendingMetadata(&snapshot)
+	require.Error(t, err)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+
+	// the fully signed initial metadata can be pushed as it is
+	require.NoError(t, repo.PushPendingMetadata(pending...))
+	_, err = otherRepo.ListTargets()
+	require.NoError(t, err)
+
+	// no keys for this role
+	err = otherRepo.SignPendingMetadata(pending[1])
+	require.Error(t, err)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+}
+
+// Pending metadata that carries signing keys or thresholds other than the ones
+// the repository trusts is neither co-signed nor pushed, even if it is signed
+// by the keys it carries.
+func TestPendingMetadataSignersMustBeTrusted(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	targetsKeyIDs := repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole)
+	require.Len(t, targetsKeyIDs, 1)
+	newKey, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.RotateKeyWithThreshold(
+		data.CanonicalTargetsRole, false, []string{targetsKeyIDs[0], newKey.ID()}, 2))
+	coSigner, _, coSignerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(coSignerDir)
+	moveKey(t, repo, coSigner, newKey.ID(), data.CanonicalTargetsRole)
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	pending, err := repo.ExportPendingMetadata()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	// an attacker lowers the threshold to one key of their own and signs with it
+	attacker, _, attackerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(attackerDir)
+	attackerKey, err := attacker.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	tampered := *pending[0]
+	tampered.Signers = []PendingSigner{{Role: data.CanonicalTargetsRole, Keys: data.KeyList{attackerKey}, Threshold: 1}}
+	require.NoError(t, signed.Sign(attacker.GetCryptoService(), tampered.Signed, data.KeyList{attackerKey}, 1, nil))
+	require.NoError(t, tampered.Verify())
+
+	err = attacker.SignPendingMetadata(&tampered)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+	err = repo.PushPendingMetadata(&tampered)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+
+	// nor can a trusted key be tricked into signing by lowering the threshold
+	tampered.Signers = []PendingSigner{{Role: data.CanonicalTargetsRole, Keys: data.KeyList{newKey}, Threshold: 1}}
+	numSignatures := len(tampered.Signed.Signatures)
+	err = coSigner.SignPendingMetadata(&tampered)
+	require.IsType(t, ErrInvalidPendingMetadata{}, err)
+	require.Len(t, tampered.Signed.Signatures, numSignatures)
+
+	userRepo, _, userDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(userDir)
+	_, err = userRepo.GetTargetByName("latest")
+	require.Error(t, err)
+}
+
+// Targets metadata that needs signatures from keys held by two different people
+// can be staged on the server by one of them, and is published by the server
+// once the other has fetched it, signed it and staged it again.
+func TestStagePendingMetadataWithThreshold(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	staged, err := repo.GetStagedMetadata()
+	require.NoError(t, err)
+	require.Len(t, staged, 0)
+
+	targetsKeyIDs := repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole)
+	require.Len(t, targetsKeyIDs, 1)
+	newKey, err := repo.GetCryptoService().Create(data.CanonicalTargetsRole, repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.RotateKeyWithThreshold(
+		data.CanonicalTargetsRole, false, []string{targetsKeyIDs[0], newKey.ID()}, 2))
+
+	coSigner, _, coSignerDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(coSignerDir)
+	moveKey(t, repo, coSigner, newKey.ID(), data.CanonicalTargetsRole)
+
+	addTarget(t, repo, "latest", "../fixtures/intermediate-ca.crt")
+	pending, err := repo.ExportPendingMetadata()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	published, err := repo.StagePendingMetadata(pending...)
+	require.NoError(t, err)
+	require.False(t, published)
+
+	userRepo, _, userDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(userDir)
+	_, err = userRepo.GetTargetByName("latest")
+	require.Error(t, err)
+
+	staged, err = coSigner.GetStagedMetadata()
+	require.NoError(t, err)
+	require.Len(t, staged, 1)
+	require.Equal(t, data.CanonicalTargetsRole, staged[0].Role)
+	require.Len(t, staged[0].Signed.Signatures, 1)
+	require.NoError(t, coSigner.SignPendingMetadata(staged[0]))
+	published, err = coSigner.StagePendingMetadata(staged[0])
+	require.NoError(t, err)
+	require.True(t, published)
+
+	target, err := userRepo.GetTargetByName("latest")
+	require.NoError(t, err)
+	require.Equal(t, "latest", target.Name)
+	staged, err = repo.GetStagedMetadata()
+	require.NoError(t, err)
+	require.Len(t, staged, 0)
+
+	// staged metadata can be discarded
+	addTarget(t, repo, "current", "../fixtures/intermediate-ca.crt")
+	pending, err = repo.ExportPendingMetadata()
+	require.NoError(t, err)
+	published, err = repo.StagePendingMetadata(pending...)
+	require.NoError(t, err)
+	require.False(t, published)
+	require.NoError(t, repo.DiscardStagedMetadata())
+	staged, err = repo.GetStagedMetadata()
+	require.NoError(t, err)
+	require.Len(t, staged, 0)
+}
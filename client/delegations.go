@@ -3,20 +3,30 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"path"
 
 	"github.com/sirupsen/logrus"
-	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/client/changelist"
 	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/net/context"
 )
 
 // AddDelegation creates changelist entries to add provided delegation public keys and paths.
 // This method composes AddDelegationRoleAndKeys and AddDelegationPaths (each creates one changelist if called).
 func (r *repository) AddDelegation(name data.RoleName, delegationKeys []data.PublicKey, paths []string) error {
-	if len(delegationKeys) > 0 {
-		err := r.AddDelegationRoleAndKeys(name, delegationKeys)
+	return r.AddDelegationWithThreshold(name, delegationKeys, paths, 0)
+}
+
+// AddDelegationWithThreshold creates changelist entries to add provided delegation public keys and paths,
+// and to set the number of signatures the delegation requires.  A threshold of 0 keeps the threshold of an
+// existing delegation, and gives a new delegation a threshold of 1.
+// This method composes AddDelegationRoleAndKeysWithThreshold and AddDelegationPaths (each creates one changelist if called).
+func (r *repository) AddDelegationWithThreshold(name data.RoleName, delegationKeys []data.PublicKey, paths []string, threshold int) error {
+	if len(delegationKeys) > 0 || threshold != 0 {
+		err := r.AddDelegationRoleAndKeysWithThreshold(name, delegationKeys, threshold)
 		if err != nil {
 			return err
 		}
@@ -33,18 +43,28 @@ func (r *repository) AddDelegation(name data.RoleName, delegationKeys []data.Pub
 // AddDelegationRoleAndKeys creates a changelist entry to add provided delegation public keys.
 // This method is the simplest way to create a new delegation, because the delegation must have at least
 // one key upon creation to be valid since we will reject the changelist while validating the threshold.
+// A new delegation is given a threshold of 1, and the threshold of an existing delegation is left unchanged.
 func (r *repository) AddDelegationRoleAndKeys(name data.RoleName, delegationKeys []data.PublicKey) error {
+	return r.AddDelegationRoleAndKeysWithThreshold(name, delegationKeys, 0)
+}
+
+// AddDelegationRoleAndKeysWithThreshold creates a changelist entry to add provided delegation public keys
+// and to set the number of signatures, from distinct delegation keys, that the delegation requires.  A
+// threshold of 0 keeps the threshold of an existing delegation, and gives a new delegation a threshold of 1.
+func (r *repository) AddDelegationRoleAndKeysWithThreshold(name data.RoleName, delegationKeys []data.PublicKey, threshold int) error {
 
 	if !data.IsDelegation(name) {
 		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
 	}
+	if threshold < 0 {
+		return ErrInvalidThreshold{Role: name, Threshold: threshold, NumKeys: len(delegationKeys)}
+	}
 
 	logrus.Debugf(`Adding delegation "%s" with threshold %d, and %d keys\n`,
-		name, notary.MinThreshold, len(delegationKeys))
+		name, threshold, len(delegationKeys))
 
-	// Defaulting to threshold of 1, since we don't allow for larger thresholds at the moment.
 	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
-		NewThreshold: notary.MinThreshold,
+		NewThreshold: threshold,
 		AddKeys:      data.KeyList(delegationKeys),
 	})
 	if err != nil {
@@ -76,6 +96,88 @@ func (r *repository) AddDelegationPaths(name data.RoleName, paths []string) erro
 	return addChange(r.changelist, template, name)
 }
 
+// maxHashedBins is the largest number of hashed bins a role can be divided into
+const maxHashedBins = 4096
+
+// AddDelegationHashedBins creates changelist entries to divide the target paths of a role between
+// numBins new hashed bin delegations of that role, each of which signs for the target paths whose
+// hashes have one of the bin's path hash prefixes.  Every bin has the provided public keys and
+// threshold.  When the changes are applied, the targets already in the role are moved into the
+// right bins, and once the bins exist, targets added to the role are added to the right bin instead.
+// The number of bins must be a power of 2.  The names of the bins are returned.
+func (r *repository) AddDelegationHashedBins(name data.RoleName, numBins int, delegationKeys []data.PublicKey, threshold int) ([]data.RoleName, error) {
+
+	if name != data.CanonicalTargetsRole && !data.IsDelegation(name) {
+		return nil, data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+	if threshold < 0 {
+		return nil, ErrInvalidThreshold{Role: name, Threshold: threshold, NumKeys: len(delegationKeys)}
+	}
+	bins, err := hashedBins(numBins)
+	if err != nil {
+		return nil, ErrInvalidHashedBins{Role: name, NumBins: numBins}
+	}
+
+	logrus.Debugf(`Adding %d hashed bin delegations to "%s" with threshold %d, and %d keys\n`,
+		numBins, name, threshold, len(delegationKeys))
+
+	var binNames []data.RoleName
+	for _, bin := range bins {
+		binName := data.RoleName(path.Join(name.String(), bin.name))
+		tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+			NewThreshold:        threshold,
+			AddKeys:             data.KeyList(delegationKeys),
+			AddPathHashPrefixes: bin.prefixes,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		template := newCreateDelegationChange(binName, tdJSON)
+		if err := addChange(r.changelist, template, binName); err != nil {
+			return nil, err
+		}
+		binNames = append(binNames, binName)
+	}
+	return binNames, nil
+}
+
+// hashedBin is a hashed bin delegation's name, relative to the role it is a
+// bin of, and its path hash prefixes
+type hashedBin struct {
+	name     string
+	prefixes []string
+}
+
+// hashedBins divides the path hash prefixes of the shortest length that allows
+// numBins bins evenly between the bins, in order.  A bin is named after the
+// range of prefixes it has, for instance "00-0f", or after its only prefix.
+func hashedBins(numBins int) ([]hashedBin, error) {
+	if numBins < 2 || numBins > maxHashedBins || numBins&(numBins-1) != 0 {
+		return nil, fmt.Errorf("invalid number of hashed bins: %d", numBins)
+	}
+	prefixLen, numPrefixes := 1, 16
+	for numPrefixes < numBins {
+		prefixLen++
+		numPrefixes *= 16
+	}
+	perBin := numPrefixes / numBins
+
+	bins := make([]hashedBin, 0, numBins)
+	for first := 0; first < numPrefixes; first += perBin {
+		bin := hashedBin{prefixes: make([]string, 0, perBin)}
+		for p := first; p < first+perBin; p++ {
+			bin.prefixes = append(bin.prefixes, fmt.Sprintf("%0*x", prefixLen, p))
+		}
+		bin.name = bin.prefixes[0]
+		if perBin > 1 {
+			bin.name = bin.prefixes[0] + "-" + bin.prefixes[perBin-1]
+		}
+		bins = append(bins, bin)
+	}
+	return bins, nil
+}
+
 // RemoveDelegationKeysAndPaths creates changelist entries to remove provided delegation key IDs and paths.
 // This method composes RemoveDelegationPaths and RemoveDelegationKeys (each creates one changelist if called).
 func (r *repository) RemoveDelegationKeysAndPaths(name data.RoleName, keyIDs, paths []string) error {
@@ -171,6 +273,53 @@ func (r *repository) ClearDelegationPaths(name data.RoleName) error {
 	return addChange(r.changelist, template, name)
 }
 
+// SetDelegationTerminating creates a changelist entry to set whether an existing delegation is terminating.
+// Once a terminating delegation has been searched for a target path it matches, no other delegations
+// are searched for that path.
+func (r *repository) SetDelegationTerminating(name data.RoleName, terminating bool) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+
+	logrus.Debugf(`Setting delegation "%s" terminating to %t\n`, name, terminating)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		Terminating: &terminating,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newUpdateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
+// SetDelegationPathType creates a changelist entry to change how the paths of an existing delegation are
+// matched against target paths, either as path prefixes or as glob patterns.  Paths added to the delegation
+// afterwards are of the new path type.
+func (r *repository) SetDelegationPathType(name data.RoleName, pathType data.PathType) error {
+
+	if !data.IsDelegation(name) {
+		return data.ErrInvalidRole{Role: name, Reason: "invalid delegation role name"}
+	}
+	if pathType == "" || !data.IsValidPathType(pathType) {
+		return data.ErrInvalidRole{Role: name, Reason: fmt.Sprintf("invalid path type %q", pathType)}
+	}
+
+	logrus.Debugf(`Setting delegation "%s" path type to %s\n`, name, pathType)
+
+	tdJSON, err := json.Marshal(&changelist.TUFDelegation{
+		PathType: pathType,
+	})
+	if err != nil {
+		return err
+	}
+
+	template := newUpdateDelegationChange(name, tdJSON)
+	return addChange(r.changelist, template, name)
+}
+
 func newUpdateDelegationChange(name data.RoleName, content []byte) *changelist.TUFChange {
 	return changelist.NewTUFChange(
 		changelist.ActionUpdate,
@@ -204,13 +353,23 @@ func newDeleteDelegationChange(name data.RoleName, content []byte) *changelist.T
 // GetDelegationRoles returns the keys and roles of the repository's delegations
 // Also converts key IDs to canonical key IDs to keep consistent with signing prompts
 func (r *repository) GetDelegationRoles() ([]data.Role, error) {
+	return r.GetDelegationRolesContext(context.Background())
+}
+
+// GetDelegationRolesContext is GetDelegationRoles with a context for updating the repository
+func (r *repository) GetDelegationRolesContext(ctx context.Context) ([]data.Role, error) {
 	// Update state of the repo to latest
-	if err := r.Update(false); err != nil {
+	if err := r.UpdateContext(ctx, false); err != nil {
 		return nil, err
 	}
 
+	return listDelegationRoles(r.tufRepo)
+}
+
+// listDelegationRoles returns every delegation of the repo, with canonical key IDs
+func listDelegationRoles(repo *tuf.Repo) ([]data.Role, error) {
 	// All top level delegations (ex: targets/level1) are stored exclusively in targets.json
-	_, ok := r.tufRepo.Targets[data.CanonicalTargetsRole]
+	_, ok := repo.Targets[data.CanonicalTargetsRole]
 	if !ok {
 		return nil, store.ErrMetaNotFound{Resource: data.CanonicalTargetsRole.String()}
 	}
@@ -229,7 +388,7 @@ func (r *repository) GetDelegationRoles() ([]data.Role, error) {
 		allDelegations = append(allDelegations, canonicalDelegations...)
 		return nil
 	}
-	err := r.tufRepo.WalkTargets("", "", delegationCanonicalListVisitor)
+	err := repo.WalkTargets("", "", delegationCanonicalListVisitor)
 	if err != nil {
 		return nil, err
 	}
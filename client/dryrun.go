@@ -0,0 +1,267 @@
+package client
+
+import (
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// PublishPlan is what publishing the changelist would do: the roles whose
+// metadata would be published, in the order root, targets, delegations and
+// snapshot
+type PublishPlan struct {
+	// InitialPublish is whether the repository has not been published before
+	InitialPublish bool
+	Roles          []RolePlan
+}
+
+// RolePlan is a role whose metadata would be published.  FromVersion is 0 if
+// the role has not been published before.  Targets has the targets that would
+// be added, removed or changed in a targets or delegation role, and Roles the
+// delegations, or for the root the base roles, whose keys, paths or threshold
+// would change.  Keys are the keys that can sign the new version, noting which
+// are available locally, and Threshold is how many of them are needed.  No
+// keys are needed for a role signed by the server, or for a root that is
+// published for the first time as it was signed when it was initialized.
+type RolePlan struct {
+	Role           data.RoleName
+	FromVersion    int
+	ToVersion      int
+	SignedByServer bool
+	Targets        []TargetDiff
+	Roles          []RoleDiff
+	Threshold      int
+	Keys           []RoleKey
+}
+
+// PublishDryRun reports what publishing the changelist would do, without
+// signing anything.  The changelist is applied to a copy of the repository
+// brought up to date with the server, and the server, the cache and the
+// changelist are left as they are.
+func (r *repository) PublishDryRun() (*PublishPlan, error) {
+	return r.PublishDryRunContext(context.Background())
+}
+
+// PublishDryRunContext is PublishDryRun with a context for the requests to the
+// server
+func (r *repository) PublishDryRunContext(ctx context.Context) (*PublishPlan, error) {
+	return r.PlanChangelistContext(ctx, r.changelist)
+}
+
+// PlanChangelist reports what publishing the changes in the given changelist
+// would do, as PublishDryRun does for the repository's own changelist, so that
+// changes can be planned without staging them
+func (r *repository) PlanChangelist(cl changelist.Changelist) (*PublishPlan, error) {
+	return r.PlanChangelistContext(context.Background(), cl)
+}
+
+// PlanChangelistContext is PlanChangelist with a context for the requests to
+// the server
+func (r *repository) PlanChangelistContext(ctx context.Context, cl changelist.Changelist) (*PublishPlan, error) {
+	// the copy keeps whatever is downloaded for it in memory
+	dry := *r
+	dry.cache = newDryRunCache(r.cache)
+
+	plan := &PublishPlan{}
+	if err := dry.UpdateContext(ctx, true); err != nil {
+		if _, ok := err.(ErrRepositoryNotExist); !ok {
+			return nil, err
+		}
+		// unlike a publish, a dry run does not initialize the repository
+		if err := dry.bootstrapRepo(); err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				return nil, ErrRepoNotInitialized{}
+			}
+			return nil, err
+		}
+		plan.InitialPublish = true
+	}
+
+	before, err := copyMetadata(dry.tufRepo)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyChangelist(dry.tufRepo, dry.invalid, cl); err != nil {
+		return nil, err
+	}
+	after := dry.tufRepo
+
+	legacyKeys, err := dry.oldKeysForLegacyClientSupport(ctx, r.LegacyVersions, plan.InitialPublish)
+	if err != nil {
+		return nil, err
+	}
+	available := r.cryptoService.ListAllKeys()
+	newPlan := func(role data.RoleName, version int, resigned bool) (RolePlan, error) {
+		rp := RolePlan{Role: role, ToVersion: version}
+		if !plan.InitialPublish {
+			rp.FromVersion = before.versions[role]
+		}
+		if !resigned {
+			return rp, nil
+		}
+		rp.ToVersion++
+		keys, threshold, err := roleKeys(after, role, available)
+		if err != nil {
+			return rp, err
+		}
+		rp.Keys, rp.Threshold = keys, threshold
+		return rp, nil
+	}
+
+	// the same roles are signed as by publishChanges
+	resignRoot := len(legacyKeys) > 0 || nearExpiry(after.Root.Signed.SignedCommon) || after.Root.Dirty
+	if resignRoot || plan.InitialPublish {
+		rp, err := newPlan(data.CanonicalRootRole, after.Root.Signed.Version, resignRoot)
+		if err != nil {
+			return nil, err
+		}
+		rp.Roles = diffBaseRoles(before.root.Signed.Roles, after.Root.Signed.Roles)
+		plan.Roles = append(plan.Roles, rp)
+	}
+	for _, expiry := range listRoleExpiries(after) {
+		targets, ok := after.Targets[expiry.Role]
+		if !ok || !(targets.Dirty || (expiry.Role == data.CanonicalTargetsRole && plan.InitialPublish)) {
+			continue
+		}
+		rp, err := newPlan(expiry.Role, targets.Signed.Version, true)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			fromTargets     data.Files
+			fromDelegations []*data.Role
+		)
+		if old, ok := before.targets[expiry.Role]; ok {
+			fromTargets, fromDelegations = old.Signed.Targets, old.Signed.Delegations.Roles
+		}
+		rp.Targets = diffTargets(fromTargets, targets.Signed.Targets)
+		rp.Roles = diffDelegations(fromDelegations, targets.Signed.Delegations.Roles)
+		plan.Roles = append(plan.Roles, rp)
+	}
+
+	// as for signSnapshotIfPossible, the server signs the snapshot if the
+	// client has none of its keys
+	snapshotVersion := 0
+	if after.Snapshot != nil {
+		snapshotVersion = after.Snapshot.Signed.Version
+	}
+	rp, err := newPlan(data.CanonicalSnapshotRole, snapshotVersion, true)
+	if err != nil {
+		return nil, err
+	}
+	local := 0
+	for _, key := range rp.Keys {
+		if key.Local {
+			local++
+		}
+	}
+	if local == 0 {
+		rp.SignedByServer, rp.Keys, rp.Threshold = true, nil, 0
+	}
+	plan.Roles = append(plan.Roles, rp)
+	return plan, nil
+}
+
+// publishedMetadata is the metadata that a dry run changes, as it was before
+// the changes were applied
+type publishedMetadata struct {
+	root     *data.SignedRoot
+	targets  map[data.RoleName]*data.SignedTargets
+	versions map[data.RoleName]int
+}
+
+// copyMetadata copies the root and targets metadata of the repo, by
+// converting it to its signed form and back
+func copyMetadata(repo *tuf.Repo) (*publishedMetadata, error) {
+	s, err := repo.Root.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return nil, err
+	}
+	copied := &publishedMetadata{
+		root:     root,
+		targets:  make(map[data.RoleName]*data.SignedTargets, len(repo.Targets)),
+		versions: publishedVersions(repo, false),
+	}
+	for role, targets := range repo.Targets {
+		s, err := targets.ToSigned()
+		if err != nil {
+			return nil, err
+		}
+		if copied.targets[role], err = data.TargetsFromSigned(s, role); err != nil {
+			return nil, err
+		}
+	}
+	return copied, nil
+}
+
+// dryRunCache reads through to another cache, but keeps what is written to it
+// in memory, so that a dry run leaves the other cache as it was
+type dryRunCache struct {
+	cache   store.MetadataStore
+	written map[string][]byte
+	removed map[string]bool
+	cleared bool
+}
+
+func newDryRunCache(cache store.MetadataStore) *dryRunCache {
+	return &dryRunCache{
+		cache:   cache,
+		written: make(map[string][]byte),
+		removed: make(map[string]bool),
+	}
+}
+
+// GetSized returns what was written for the name, or else what the other
+// cache has for it, unless it has been removed since
+func (c *dryRunCache) GetSized(name string, size int64) ([]byte, error) {
+	meta, ok := c.written[name]
+	if !ok {
+		if c.cleared || c.removed[name] {
+			return nil, store.ErrMetaNotFound{Resource: name}
+		}
+		return c.cache.GetSized(name, size)
+	}
+	if size == store.NoSizeLimit {
+		size = notary.MaxDownloadSize
+	}
+	if int64(len(meta)) > size {
+		return nil, store.ErrMaliciousServer{}
+	}
+	return meta, nil
+}
+
+// Set keeps the metadata in memory
+func (c *dryRunCache) Set(name string, blob []byte) error {
+	c.written[name] = blob
+	delete(c.removed, name)
+	return nil
+}
+
+// SetMulti keeps all of the metadata in memory
+func (c *dryRunCache) SetMulti(metas map[string][]byte) error {
+	for name, blob := range metas {
+		c.Set(name, blob)
+	}
+	return nil
+}
+
+// Remove hides the metadata for the name
+func (c *dryRunCache) Remove(name string) error {
+	delete(c.written, name)
+	c.removed[name] = true
+	return nil
+}
+
+// RemoveAll hides all of the metadata
+func (c *dryRunCache) RemoveAll() error {
+	c.written = make(map[string][]byte)
+	c.cleared = true
+	return nil
+}
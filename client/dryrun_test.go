@@ -0,0 +1,185 @@
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func planRoles(plan *PublishPlan) []data.RoleName {
+	roles := make([]data.RoleName, 0, len(plan.Roles))
+	for _, rp := range plan.Roles {
+		roles = append(roles, rp.Role)
+	}
+	return roles
+}
+
+// A dry run of the first publish reports the root that will be uploaded as it
+// is, and the targets and snapshot that will be signed, without publishing
+func TestPublishDryRunInitialPublish(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	cachedTargets, err := repo.cache.GetSized(data.CanonicalTargetsRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+
+	plan, err := repo.PublishDryRun()
+	require.NoError(t, err)
+	require.True(t, plan.InitialPublish)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, planRoles(plan))
+
+	root := plan.Roles[0]
+	require.Equal(t, 0, root.FromVersion)
+	require.Equal(t, 1, root.ToVersion)
+	require.Empty(t, root.Keys)
+	require.Empty(t, root.Roles)
+
+	targets := plan.Roles[1]
+	require.Equal(t, 0, targets.FromVersion)
+	require.Equal(t, 2, targets.ToVersion)
+	require.Len(t, targets.Targets, 1)
+	require.Equal(t, "a", targets.Targets[0].Name)
+	require.Equal(t, DiffAdded, targets.Targets[0].Change)
+	require.Equal(t, 1, targets.Threshold)
+	require.Len(t, targets.Keys, 1)
+	require.True(t, targets.Keys[0].Local)
+
+	snapshot := plan.Roles[2]
+	require.False(t, snapshot.SignedByServer)
+	require.Len(t, snapshot.Keys, 1)
+
+	// nothing was published, cached or cleared
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.IsType(t, ErrRepositoryNotExist{}, otherRepo.Update(false))
+	cached, err := repo.cache.GetSized(data.CanonicalTargetsRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, cachedTargets, cached)
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+
+	// the changes are then published as planned
+	require.NoError(t, repo.Publish())
+	require.NoError(t, otherRepo.Update(false))
+	require.Equal(t, 2, otherRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Version)
+}
+
+// A dry run against a published repository reports the changes to the targets
+// and delegations, and the versions they would be published as
+func TestPublishDryRunChanges(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.Update(false))
+	snapshotVersion := repo.tufRepo.Snapshot.Signed.Version
+	cachedSnapshot, err := repo.cache.GetSized(data.CanonicalSnapshotRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+
+	// nothing to publish still has the server sign a new snapshot
+	plan, err := repo.PublishDryRun()
+	require.NoError(t, err)
+	require.False(t, plan.InitialPublish)
+	require.Equal(t, []data.RoleName{data.CanonicalSnapshotRole}, planRoles(plan))
+
+	key, err := repo.GetCryptoService().Create("targets/releases", repo.gun, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddDelegation("targets/releases", []data.PublicKey{key}, []string{"releases/"}))
+	require.NoError(t, repo.RemoveTarget("a", data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "second"), data.CanonicalTargetsRole))
+
+	plan, err = repo.PublishDryRun()
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, planRoles(plan))
+
+	targets := plan.Roles[0]
+	require.Equal(t, 2, targets.FromVersion)
+	require.Equal(t, 3, targets.ToVersion)
+	require.Len(t, targets.Targets, 2)
+	require.Equal(t, DiffRemoved, targets.Targets[0].Change)
+	require.Equal(t, DiffChanged, targets.Targets[1].Change)
+	require.Equal(t, []RoleDiff{{
+		Role:        "targets/releases",
+		Change:      DiffAdded,
+		AddedKeys:   []string{key.ID()},
+		AddedPaths:  []string{"releases/"},
+		ToThreshold: 1,
+	}}, targets.Roles)
+
+	snapshot := plan.Roles[1]
+	require.True(t, snapshot.SignedByServer)
+	require.Empty(t, snapshot.Keys)
+	require.Equal(t, snapshotVersion, snapshot.FromVersion)
+	require.Equal(t, snapshotVersion+1, snapshot.ToVersion)
+
+	// the repository and its cache are as they were
+	require.Equal(t, 2, repo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Version)
+	require.Empty(t, repo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Delegations.Roles)
+	cached, err := repo.cache.GetSized(data.CanonicalSnapshotRole.String(), store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, cachedSnapshot, cached)
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	// adding the delegation is two changes: its keys and its paths
+	require.Len(t, cl.List(), 4)
+}
+
+// Changes can be planned from a changelist other than the repository's own,
+// which is left as it is
+func TestPlanChangelist(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+
+	planned := changelist.NewMemChangelist()
+	require.NoError(t, planned.Add(changelist.NewTUFChange(changelist.ActionUpdate, data.CanonicalTargetsRole, changelist.TypeWitness, "", nil)))
+	plan, err := repo.PlanChangelist(planned)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, planRoles(plan))
+	require.Empty(t, plan.Roles[0].Targets)
+
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+	require.Len(t, planned.List(), 1)
+}
+
+func TestDryRunCache(t *testing.T) {
+	underlying := store.NewMemoryStore(map[data.RoleName][]byte{"root": []byte("root"), "targets": []byte("targets")})
+	cache := newDryRunCache(underlying)
+
+	require.NoError(t, cache.Set("root", []byte("new root")))
+	require.NoError(t, cache.Remove("targets"))
+	meta, err := cache.GetSized("root", store.NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new root"), meta)
+	_, err = cache.GetSized("targets", store.NoSizeLimit)
+	require.IsType(t, store.ErrMetaNotFound{}, err)
+
+	require.NoError(t, cache.RemoveAll())
+	_, err = cache.GetSized("root", store.NoSizeLimit)
+	require.IsType(t, store.ErrMetaNotFound{}, err)
+
+	// the underlying cache is left alone
+	for name, expected := range map[string]string{"root": "root", "targets": "targets"} {
+		meta, err := underlying.GetSized(name, store.NoSizeLimit)
+		require.NoError(t, err)
+		require.Equal(t, []byte(expected), meta)
+	}
+}
@@ -2,7 +2,10 @@ package client
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
@@ -46,3 +49,105 @@ type ErrRepositoryNotExist struct {
 func (err ErrRepositoryNotExist) Error() string {
 	return fmt.Sprintf("%s does not have trust data for %s", err.remote, err.gun.String())
 }
+
+// ErrInvalidExpiry is returned when a role is given an expiry duration that is
+// out of bounds, or a role that the client does not sign metadata for
+type ErrInvalidExpiry struct {
+	Role   data.RoleName
+	Expiry time.Duration
+	msg    string
+}
+
+func (err ErrInvalidExpiry) Error() string {
+	return fmt.Sprintf("invalid expiry %s for %s: %s", err.Expiry, err.Role, err.msg)
+}
+
+// ErrInvalidThreshold is returned when a role is given a signature threshold
+// that is less than 1 or that its signing keys cannot satisfy
+type ErrInvalidThreshold struct {
+	Role      data.RoleName
+	Threshold int
+	NumKeys   int
+}
+
+func (err ErrInvalidThreshold) Error() string {
+	return fmt.Sprintf(
+		"invalid threshold of %d for the %s role, which has %d signing key(s)",
+		err.Threshold, err.Role.String(), err.NumKeys)
+}
+
+// ErrInvalidPendingMetadata is returned when metadata exported for co-signing
+// cannot be signed or published
+type ErrInvalidPendingMetadata struct {
+	Role data.RoleName
+	msg  string
+}
+
+func (err ErrInvalidPendingMetadata) Error() string {
+	return fmt.Sprintf("pending %s metadata: %s", err.Role.String(), err.msg)
+}
+
+// ErrInvalidHashedBins is returned when a role cannot be divided into the
+// requested number of hashed bin delegations
+type ErrInvalidHashedBins struct {
+	Role    data.RoleName
+	NumBins int
+}
+
+func (err ErrInvalidHashedBins) Error() string {
+	return fmt.Sprintf(
+		"cannot divide the %s role into %d hashed bins: the number of bins must be a power of 2 from 2 to %d",
+		err.Role.String(), err.NumBins, maxHashedBins)
+}
+
+// ErrInvalidRoleVersion is returned when asking for a version of a role's
+// metadata that has not been published, or when the server returns something
+// other than the version that was asked for
+type ErrInvalidRoleVersion struct {
+	Role    data.RoleName
+	Version int
+	msg     string
+}
+
+func (err ErrInvalidRoleVersion) Error() string {
+	return fmt.Sprintf("invalid version %d of the %s role: %s", err.Version, err.Role.String(), err.msg)
+}
+
+// FailedChange is a pending change that could not be applied, and its index
+// in the changelist
+type FailedChange struct {
+	Index  int
+	Change changelist.Change
+	Err    error
+}
+
+// ErrChangesNoLongerApply is returned when a publish is retried after another
+// client has published, and some of the pending changes can no longer be
+// applied on top of what it published.  Nothing is published, and the
+// changelist is kept so that the changes can be reviewed and reset.
+type ErrChangesNoLongerApply struct {
+	Changes []FailedChange
+}
+
+func (err ErrChangesNoLongerApply) Error() string {
+	failed := make([]string, 0, len(err.Changes))
+	for _, fc := range err.Changes {
+		failed = append(failed, fmt.Sprintf("#%d (%s %s %s in %s): %v",
+			fc.Index, fc.Change.Action(), fc.Change.Type(), fc.Change.Path(), fc.Change.Scope(), fc.Err))
+	}
+	return fmt.Sprintf(
+		"another client published first, and %d pending change(s) no longer apply on top of it: %s",
+		len(err.Changes), strings.Join(failed, "; "))
+}
+
+// ErrInvalidSignedMetadata is returned when metadata that was signed elsewhere
+// cannot be pushed to the server, because it is not trusted by or not newer
+// than what has been published
+type ErrInvalidSignedMetadata struct {
+	Role data.RoleName
+	msg  string
+}
+
+func (err ErrInvalidSignedMetadata) Error() string {
+	return fmt.Sprintf("cannot push the %s metadata: %s", err.Role.String(), err.msg)
+}
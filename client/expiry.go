@@ -0,0 +1,135 @@
+package client
+
+import (
+	"sort"
+	"time"
+
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/net/context"
+)
+
+// RoleExpiry is the version of the metadata for a role, and when it expires
+type RoleExpiry struct {
+	Role    data.RoleName
+	Version int
+	Expires time.Time
+}
+
+// RoleKey is one of the keys that can sign for a role, and whether its private
+// key is available locally
+type RoleKey struct {
+	ID    string
+	Local bool
+}
+
+// RoleExpiryStatus is the expiry of the metadata for a role, along with the
+// keys that can re-sign it and how many of them are needed
+type RoleExpiryStatus struct {
+	RoleExpiry
+	Threshold int
+	Keys      []RoleKey
+}
+
+// GetRoleExpiries updates the repository, and returns the version and expiry
+// of the root, targets, delegation and snapshot metadata, in that order,
+// along with the keys that can sign for each of those roles
+func (r *repository) GetRoleExpiries() ([]RoleExpiryStatus, error) {
+	return r.GetRoleExpiriesContext(context.Background())
+}
+
+// GetRoleExpiriesContext is GetRoleExpiries with a context for updating the
+// repository
+func (r *repository) GetRoleExpiriesContext(ctx context.Context) ([]RoleExpiryStatus, error) {
+	if err := r.UpdateContext(ctx, false); err != nil {
+		return nil, err
+	}
+	available := r.cryptoService.ListAllKeys()
+	var statuses []RoleExpiryStatus
+	for _, expiry := range listRoleExpiries(r.tufRepo) {
+		keys, threshold, err := roleKeys(r.tufRepo, expiry.Role, available)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, RoleExpiryStatus{
+			RoleExpiry: expiry,
+			Threshold:  threshold,
+			Keys:       keys,
+		})
+	}
+	return statuses, nil
+}
+
+// listRoleExpiries lists the version and expiry of the root, targets, delegation
+// and snapshot metadata in the repo, in that order.  The timestamp is left
+// out, since the server always signs it.
+func listRoleExpiries(repo *tuf.Repo) []RoleExpiry {
+	var expiries []RoleExpiry
+	if repo.Root != nil {
+		expiries = append(expiries, RoleExpiry{
+			Role:    data.CanonicalRootRole,
+			Version: repo.Root.Signed.Version,
+			Expires: repo.Root.Signed.Expires,
+		})
+	}
+	if targets, ok := repo.Targets[data.CanonicalTargetsRole]; ok {
+		expiries = append(expiries, RoleExpiry{
+			Role:    data.CanonicalTargetsRole,
+			Version: targets.Signed.Version,
+			Expires: targets.Signed.Expires,
+		})
+	}
+	delegations := make([]RoleExpiry, 0, len(repo.Targets))
+	for role, targets := range repo.Targets {
+		if role == data.CanonicalTargetsRole {
+			continue
+		}
+		delegations = append(delegations, RoleExpiry{
+			Role:    role,
+			Version: targets.Signed.Version,
+			Expires: targets.Signed.Expires,
+		})
+	}
+	sort.Slice(delegations, func(i, j int) bool { return delegations[i].Role < delegations[j].Role })
+	expiries = append(expiries, delegations...)
+	if repo.Snapshot != nil {
+		expiries = append(expiries, RoleExpiry{
+			Role:    data.CanonicalSnapshotRole,
+			Version: repo.Snapshot.Signed.Version,
+			Expires: repo.Snapshot.Signed.Expires,
+		})
+	}
+	return expiries
+}
+
+// roleKeys returns the keys for a role, sorted by ID, noting which of them are
+// among the available keys, which are keyed by canonical ID, and the role's
+// threshold
+func roleKeys(repo *tuf.Repo, role data.RoleName, available map[string]data.RoleName) ([]RoleKey, int, error) {
+	var (
+		baseRole data.BaseRole
+		err      error
+	)
+	if data.IsDelegation(role) {
+		var delgRole data.DelegationRole
+		delgRole, err = repo.GetDelegationRole(role)
+		baseRole = delgRole.BaseRole
+	} else {
+		baseRole, err = repo.GetBaseRole(role)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := make([]RoleKey, 0, len(baseRole.Keys))
+	for _, key := range baseRole.ListKeys() {
+		canonicalID, err := utils.CanonicalKeyID(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		_, local := available[canonicalID]
+		keys = append(keys, RoleKey{ID: key.ID(), Local: local})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, baseRole.Threshold, nil
+}
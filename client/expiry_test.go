@@ -0,0 +1,49 @@
+package client
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// The expiries of the client-signed roles are listed with their keys, which
+// are only local to the client that has them
+func TestGetRoleExpiries(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, 10*notary.Day))
+	require.NoError(t, repo.Publish())
+
+	statuses, err := repo.GetRoleExpiries()
+	require.NoError(t, err)
+	roles := make([]data.RoleName, 0, len(statuses))
+	for _, status := range statuses {
+		roles = append(roles, status.Role)
+		require.Equal(t, 1, status.Threshold, "%s", status.Role)
+		require.Len(t, status.Keys, 1, "%s", status.Role)
+		require.True(t, status.Keys[0].Local, "%s", status.Role)
+	}
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, roles)
+	require.Equal(t, repo.tufRepo.Root.Signed.Version, statuses[0].Version)
+	require.WithinDuration(t, time.Now().Add(10*notary.Day), statuses[1].Expires, time.Minute)
+	require.Equal(t, repo.tufRepo.Root.Signed.Roles[data.CanonicalRootRole].KeyIDs[0], statuses[0].Keys[0].ID)
+
+	// a client without the keys sees the same expiries
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	otherStatuses, err := otherRepo.GetRoleExpiries()
+	require.NoError(t, err)
+	require.Len(t, otherStatuses, len(statuses))
+	for i, status := range otherStatuses {
+		require.Equal(t, statuses[i].RoleExpiry, status.RoleExpiry)
+		require.Equal(t, statuses[i].Keys[0].ID, status.Keys[0].ID)
+		require.False(t, status.Keys[0].Local, "%s", status.Role)
+	}
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// ContentSource provides the content of targets, so that it can be verified
+// against a repository's trusted metadata
+type ContentSource interface {
+	// Open returns a reader for the content of the named target
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// NewContentSource returns a ContentSource for the given location, which is
+// either a plain HTTP(S) base URL or a local directory.  A nil RoundTripper
+// uses the default transport for HTTP(S) sources.
+func NewContentSource(location string, rt http.RoundTripper) (ContentSource, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		s, err := NewHTTPContentSource(location, rt)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := NewDirContentSource(location)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// HTTPContentSource downloads the content of targets from paths, named after
+// the targets, under a base URL
+type HTTPContentSource struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+// NewHTTPContentSource returns a HTTPContentSource for the base URL.  A nil
+// RoundTripper uses the default transport.
+func NewHTTPContentSource(baseURL string, rt http.RoundTripper) (*HTTPContentSource, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("content source URL must be in the form of http(s)://HOST[/PATH]. Got: %s", baseURL)
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &HTTPContentSource{baseURL: base, client: &http.Client{Transport: rt}}, nil
+}
+
+// Open downloads the content of the named target
+func (s *HTTPContentSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := checkContentName(name); err != nil {
+		return nil, err
+	}
+	u := *s.baseURL
+	u.Path = path.Join(u.Path, name)
+	u.RawPath = ""
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to download %s from %s: %s", name, u.String(), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// DirContentSource reads the content of targets from files, named after the
+// targets, under a local directory
+type DirContentSource struct {
+	dir string
+}
+
+// NewDirContentSource returns a DirContentSource for the directory, which must exist
+func NewDirContentSource(dir string) (*DirContentSource, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("content source %s is not a directory", dir)
+	}
+	return &DirContentSource{dir: dir}, nil
+}
+
+// Open opens the file containing the content of the named target
+func (s *DirContentSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := checkContentName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(s.dir, filepath.FromSlash(name)))
+}
+
+// checkContentName makes sure that a target name cannot be used to read content
+// from outside of a content source
+func checkContentName(name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return fmt.Errorf("target name %s cannot be used to locate content", name)
+		}
+	}
+	return nil
+}
+
+// ErrContentVerification is returned when the content of a target does not
+// match the length and hashes in its trusted metadata
+type ErrContentVerification struct {
+	Target string
+	msg    string
+}
+
+func (err ErrContentVerification) Error() string {
+	return fmt.Sprintf("content of %s could not be verified: %s", err.Target, err.msg)
+}
+
+// FetchTarget downloads the content of the named target from the source and
+// writes it to the destination file, but only once it has been verified
+// against the length and hashes in the repository's trusted metadata.  The
+// roles are searched as in GetTargetByName.
+func (r *repository) FetchTarget(name string, source ContentSource, dest string, roles ...data.RoleName) (*TargetWithRole, error) {
+	return r.FetchTargetContext(context.Background(), name, source, dest, roles...)
+}
+
+// FetchTargetContext is FetchTarget with a context for downloading both the
+// metadata and the target content
+func (r *repository) FetchTargetContext(ctx context.Context, name string, source ContentSource, dest string, roles ...data.RoleName) (*TargetWithRole, error) {
+	target, err := r.GetTargetByNameContext(ctx, name, roles...)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := source.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	// the content is written next to the destination so that it can be renamed
+	// into place once it has been verified
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := verifyContent(target.Name, target.Hashes, target.Length, io.TeeReader(content, tmp)); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// verifyContent reads the content, which must be no longer than the expected
+// length, and checks it against the expected length and all of the expected
+// hashes that are supported
+func verifyContent(name string, hashes data.Hashes, length int64, content io.Reader) error {
+	var algorithms []string
+	for _, algorithm := range []string{notary.SHA256, notary.SHA512} {
+		if _, ok := hashes[algorithm]; ok {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if len(algorithms) == 0 {
+		return ErrContentVerification{Target: name, msg: "no supported hashes in the trusted metadata"}
+	}
+
+	// read one byte more than expected, to detect content that is too long
+	meta, err := data.NewFileMeta(io.LimitReader(content, length+1), algorithms...)
+	if err != nil {
+		return err
+	}
+	if meta.Length > length {
+		return ErrContentVerification{Target: name, msg: fmt.Sprintf("content is longer than the expected %d bytes", length)}
+	}
+	if meta.Length < length {
+		return ErrContentVerification{Target: name, msg: fmt.Sprintf("content is %d bytes, expected %d", meta.Length, length)}
+	}
+	for _, algorithm := range algorithms {
+		if !bytes.Equal(meta.Hashes[algorithm], hashes[algorithm]) {
+			return ErrContentVerification{Target: name, msg: fmt.Sprintf("mismatched %s checksum", algorithm)}
+		}
+	}
+	return nil
+}
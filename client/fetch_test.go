@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func TestVerifyContent(t *testing.T) {
+	content := []byte("some target content")
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	hashes := data.Hashes{notary.SHA256: sha256Sum[:], notary.SHA512: sha512Sum[:]}
+	length := int64(len(content))
+
+	require.NoError(t, verifyContent("t", hashes, length, bytes.NewReader(content)))
+	require.NoError(t, verifyContent("t", data.Hashes{notary.SHA512: sha512Sum[:]}, length, bytes.NewReader(content)))
+
+	for _, bad := range [][]byte{
+		append(content, 'x'), // too long
+		content[:length-1],   // too short
+		[]byte("some target CONTENT"),
+	} {
+		err := verifyContent("t", hashes, length, bytes.NewReader(bad))
+		require.IsType(t, ErrContentVerification{}, err)
+	}
+
+	// only one of the hashes matching is not enough
+	mismatched := data.Hashes{notary.SHA256: sha256Sum[:], notary.SHA512: make([]byte, sha512.Size)}
+	err := verifyContent("t", mismatched, length, bytes.NewReader(content))
+	require.IsType(t, ErrContentVerification{}, err)
+	require.Contains(t, err.Error(), notary.SHA512)
+
+	err = verifyContent("t", data.Hashes{"md5": make([]byte, 16)}, length, bytes.NewReader(content))
+	require.IsType(t, ErrContentVerification{}, err)
+}
+
+func TestContentSources(t *testing.T) {
+	contentDir, err := ioutil.TempDir("", "notary-content")
+	require.NoError(t, err)
+	defer os.RemoveAll(contentDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, "a"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(contentDir, "a", "b"), []byte("content"), 0644))
+
+	server := httptest.NewServer(http.StripPrefix("/base", http.FileServer(http.Dir(contentDir))))
+	defer server.Close()
+
+	for _, location := range []string{contentDir, server.URL + "/base"} {
+		source, err := NewContentSource(location, nil)
+		require.NoError(t, err)
+
+		r, err := source.Open(context.Background(), "a/b")
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		require.Equal(t, "content", string(content))
+
+		_, err = source.Open(context.Background(), "a/c")
+		require.Error(t, err)
+		_, err = source.Open(context.Background(), "a/../../b")
+		require.Error(t, err)
+	}
+
+	_, err = NewContentSource(filepath.Join(contentDir, "a", "b"), nil)
+	require.Error(t, err)
+	_, err = NewContentSource("https://", nil)
+	require.Error(t, err)
+}
+
+// Target content is only written to its destination once it has been verified
+func TestFetchTarget(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	targetFile := "../fixtures/intermediate-ca.crt"
+	addTarget(t, repo, "latest", targetFile)
+	require.NoError(t, repo.Publish())
+
+	expected, err := ioutil.ReadFile(targetFile)
+	require.NoError(t, err)
+	contentDir := filepath.Join(baseDir, "content")
+	require.NoError(t, os.Mkdir(contentDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(contentDir, "latest"), expected, 0644))
+	source, err := NewDirContentSource(contentDir)
+	require.NoError(t, err)
+
+	destDir := filepath.Join(baseDir, "dest")
+	require.NoError(t, os.Mkdir(destDir, 0755))
+	dest := filepath.Join(destDir, "latest")
+	target, err := repo.FetchTarget("latest", source, dest)
+	require.NoError(t, err)
+	require.Equal(t, "latest", target.Name)
+	require.Equal(t, data.CanonicalTargetsRole, target.Role)
+	fetched, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, expected, fetched)
+
+	// tampered content does not replace what was already fetched
+	require.NoError(t, ioutil.WriteFile(filepath.Join(contentDir, "latest"), append(expected, '\n'), 0644))
+	_, err = repo.FetchTarget("latest", source, dest)
+	require.IsType(t, ErrContentVerification{}, err)
+	fetched, err = ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, expected, fetched)
+	files, err := ioutil.ReadDir(destDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1, "temporary files were left behind")
+
+	_, err = repo.FetchTarget("unknown", source, filepath.Join(destDir, "unknown"))
+	require.IsType(t, ErrNoSuchTarget(""), err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.FetchTargetContext(ctx, "latest", source, dest)
+	require.Equal(t, context.Canceled, err)
+}
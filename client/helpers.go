@@ -30,34 +30,79 @@ func getRemoteStore(baseURL string, gun data.GUN, rt http.RoundTripper) (store.R
 	return s, nil
 }
 
+// applyChangelist squashes the changelist, so that redundant changes aren't
+// applied and contradictory ones are rejected before anything is changed, and
+// then applies the remaining changes to the repo
 func applyChangelist(repo *tuf.Repo, invalid *tuf.Repo, cl changelist.Changelist) error {
-	it, err := cl.NewIterator()
+	changes, indices, err := squashChangelist(cl)
 	if err != nil {
 		return err
 	}
-	index := 0
-	for it.HasNext() {
-		c, err := it.Next()
-		if err != nil {
+	for _, i := range indices {
+		if err := applyChange(repo, invalid, changes[i]); err != nil {
+			c := changes[i]
+			logrus.Debugf("error attempting to apply change #%d: %s, on scope: %s path: %s type: %s", i, c.Action(), c.Scope(), c.Path(), c.Type())
 			return err
 		}
-		isDel := data.IsDelegation(c.Scope()) || data.IsWildDelegation(c.Scope())
-		switch {
-		case c.Scope() == changelist.ScopeTargets || isDel:
-			err = applyTargetsChange(repo, invalid, c)
-		case c.Scope() == changelist.ScopeRoot:
-			err = applyRootChange(repo, c)
-		default:
-			return fmt.Errorf("scope not supported: %s", c.Scope().String())
+	}
+	logrus.Debugf("applied %d change(s)", len(indices))
+	return nil
+}
+
+// replayChangelist is like applyChangelist, but carries on applying the other
+// changes when one of them fails, and returns an ErrChangesNoLongerApply
+// listing all of the changes that failed
+func replayChangelist(repo *tuf.Repo, invalid *tuf.Repo, cl changelist.Changelist) error {
+	changes, indices, err := squashChangelist(cl)
+	if err != nil {
+		return err
+	}
+	var failed []FailedChange
+	for _, i := range indices {
+		if err := applyChange(repo, invalid, changes[i]); err != nil {
+			failed = append(failed, FailedChange{Index: i, Change: changes[i], Err: err})
 		}
+	}
+	if len(failed) > 0 {
+		return ErrChangesNoLongerApply{Changes: failed}
+	}
+	logrus.Debugf("replayed %d change(s)", len(indices))
+	return nil
+}
+
+// squashChangelist returns all of the changes in the changelist, and the
+// indices of the ones left once it is squashed
+func squashChangelist(cl changelist.Changelist) ([]changelist.Change, []int, error) {
+	it, err := cl.NewIterator()
+	if err != nil {
+		return nil, nil, err
+	}
+	var changes []changelist.Change
+	for it.HasNext() {
+		c, err := it.Next()
 		if err != nil {
-			logrus.Debugf("error attempting to apply change #%d: %s, on scope: %s path: %s type: %s", index, c.Action(), c.Scope(), c.Path(), c.Type())
-			return err
+			return nil, nil, err
 		}
-		index++
+		changes = append(changes, c)
+	}
+	indices, err := changelist.SquashedIndices(changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	logrus.Debugf("squashed %d change(s) into %d", len(changes), len(indices))
+	return changes, indices, nil
+}
+
+func applyChange(repo *tuf.Repo, invalid *tuf.Repo, c changelist.Change) error {
+	isDel := data.IsDelegation(c.Scope()) || data.IsWildDelegation(c.Scope())
+	switch {
+	case c.Scope() == changelist.ScopeTargets || isDel:
+		return applyTargetsChange(repo, invalid, c)
+	case c.Scope() == changelist.ScopeRoot:
+		return applyRootChange(repo, c)
+	default:
+		return fmt.Errorf("scope not supported: %s", c.Scope().String())
 	}
-	logrus.Debugf("applied %d change(s)", index)
-	return nil
 }
 
 func applyTargetsChange(repo *tuf.Repo, invalid *tuf.Repo, c changelist.Change) error {
@@ -88,7 +133,16 @@ func changeTargetsDelegation(repo *tuf.Repo, c changelist.Change) error {
 		if err != nil {
 			return err
 		}
-		return repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, []string{}, false)
+		if err := updateDelegationPathType(repo, c.Scope(), td); err != nil {
+			return err
+		}
+		if err := repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, []string{}, false); err != nil {
+			return err
+		}
+		if err := updateDelegationPathHashPrefixes(repo, c.Scope(), td); err != nil {
+			return err
+		}
+		return updateDelegationTerminating(repo, c.Scope(), td)
 	case changelist.ActionUpdate:
 		td := changelist.TUFDelegation{}
 		err := json.Unmarshal(c.Content(), &td)
@@ -123,7 +177,24 @@ func changeTargetsDelegation(repo *tuf.Repo, c changelist.Change) error {
 		if err != nil {
 			return err
 		}
-		return repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, td.RemovePaths, td.ClearAllPaths)
+		if td.PathType != "" {
+			// Remove paths before changing the path type, and add them afterwards, so that
+			// only the paths the role ends up with need to be valid for the new path type
+			if err := repo.UpdateDelegationPaths(c.Scope(), []string{}, td.RemovePaths, td.ClearAllPaths); err != nil {
+				return err
+			}
+			if err := updateDelegationPathType(repo, c.Scope(), td); err != nil {
+				return err
+			}
+			td.RemovePaths, td.ClearAllPaths = nil, false
+		}
+		if err := repo.UpdateDelegationPaths(c.Scope(), td.AddPaths, td.RemovePaths, td.ClearAllPaths); err != nil {
+			return err
+		}
+		if err := updateDelegationPathHashPrefixes(repo, c.Scope(), td); err != nil {
+			return err
+		}
+		return updateDelegationTerminating(repo, c.Scope(), td)
 	case changelist.ActionDelete:
 		return repo.DeleteDelegation(c.Scope())
 	default:
@@ -132,6 +203,37 @@ func changeTargetsDelegation(repo *tuf.Repo, c changelist.Change) error {
 
 }
 
+// updateDelegationPathType applies the change's path type to the delegation,
+// if the change has one
+func updateDelegationPathType(repo *tuf.Repo, role data.RoleName, td changelist.TUFDelegation) error {
+	if td.PathType == "" {
+		return nil
+	}
+	return repo.UpdateDelegationPathType(role, td.PathType)
+}
+
+// updateDelegationPathHashPrefixes adds the change's path hash prefixes to the
+// delegation, if the change has any, and moves the targets of its parent that
+// now belong in it into it
+func updateDelegationPathHashPrefixes(repo *tuf.Repo, role data.RoleName, td changelist.TUFDelegation) error {
+	if len(td.AddPathHashPrefixes) == 0 {
+		return nil
+	}
+	if err := repo.UpdateDelegationPathHashPrefixes(role, td.AddPathHashPrefixes, nil); err != nil {
+		return err
+	}
+	return repo.MoveTargetsToHashedBin(role)
+}
+
+// updateDelegationTerminating applies the change's terminating setting to the
+// delegation, if the change has one
+func updateDelegationTerminating(repo *tuf.Repo, role data.RoleName, td changelist.TUFDelegation) error {
+	if td.Terminating == nil {
+		return nil
+	}
+	return repo.UpdateDelegationTerminating(role, *td.Terminating)
+}
+
 func changeTargetMeta(repo *tuf.Repo, c changelist.Change) error {
 	var err error
 	switch c.Action() {
@@ -144,17 +246,25 @@ func changeTargetMeta(repo *tuf.Repo, c changelist.Change) error {
 		}
 		files := data.Files{c.Path(): *meta}
 
-		// Attempt to add the target to this role
-		if _, err = repo.AddTargets(c.Scope(), files); err != nil {
-			logrus.Errorf("couldn't add target to %s: %s", c.Scope(), err.Error())
+		// Attempt to add the target to this role, or to the hashed bin of this role it belongs in
+		var role data.RoleName
+		if role, err = repo.HashedBinFor(c.Scope(), c.Path()); err != nil {
+			return err
+		}
+		if _, err = repo.AddTargets(role, files); err != nil {
+			logrus.Errorf("couldn't add target to %s: %s", role, err.Error())
 		}
 
 	case changelist.ActionDelete:
 		logrus.Debug("changelist remove: ", c.Path())
 
-		// Attempt to remove the target from this role
-		if err = repo.RemoveTargets(c.Scope(), c.Path()); err != nil {
-			logrus.Errorf("couldn't remove target from %s: %s", c.Scope(), err.Error())
+		// Attempt to remove the target from this role, or from the hashed bin of this role it belongs in
+		var role data.RoleName
+		if role, err = repo.HashedBinFor(c.Scope(), c.Path()); err != nil {
+			return err
+		}
+		if err = repo.RemoveTargets(role, c.Path()); err != nil {
+			logrus.Errorf("couldn't remove target from %s: %s", role, err.Error())
 		}
 
 	default:
@@ -183,7 +293,7 @@ func applyRootRoleChange(repo *tuf.Repo, c changelist.Change) error {
 		if err != nil {
 			return err
 		}
-		err = repo.ReplaceBaseKeys(d.RoleName, d.Keys...)
+		err = repo.ReplaceBaseKeysAndThreshold(d.RoleName, d.Threshold, d.Keys...)
 		if err != nil {
 			return err
 		}
@@ -248,17 +358,35 @@ func rotateRemoteKey(role data.RoleName, remote store.RemoteStore) (data.PublicK
 	return pubKey, nil
 }
 
+// roleExpiries are the durations that the metadata for each role is valid for
+// after it is signed, where they differ from the defaults
+type roleExpiries map[data.RoleName]time.Duration
+
+// expires returns the expiry time for metadata for the role signed now.  A
+// delegation without an expiry of its own expires along with the targets role.
+func (e roleExpiries) expires(role data.RoleName) time.Time {
+	if d, ok := e[role]; ok {
+		return time.Now().Add(d)
+	}
+	if data.IsDelegation(role) {
+		role = data.CanonicalTargetsRole
+		if d, ok := e[role]; ok {
+			return time.Now().Add(d)
+		}
+	}
+	return data.DefaultExpires(role)
+}
+
 // signs and serializes the metadata for a canonical role in a TUF repo to JSON
-func serializeCanonicalRole(tufRepo *tuf.Repo, role data.RoleName, extraSigningKeys data.KeyList) (out []byte, err error) {
+func serializeCanonicalRole(tufRepo *tuf.Repo, role data.RoleName, extraSigningKeys data.KeyList, expiries roleExpiries) (out []byte, err error) {
 	var s *data.Signed
 	switch {
 	case role == data.CanonicalRootRole:
-		s, err = tufRepo.SignRoot(data.DefaultExpires(role), extraSigningKeys)
+		s, err = tufRepo.SignRoot(expiries.expires(role), extraSigningKeys)
 	case role == data.CanonicalSnapshotRole:
-		s, err = tufRepo.SignSnapshot(data.DefaultExpires(role))
+		s, err = tufRepo.SignSnapshot(expiries.expires(role))
 	case tufRepo.Targets[role] != nil:
-		s, err = tufRepo.SignTargets(
-			role, data.DefaultExpires(data.CanonicalTargetsRole))
+		s, err = tufRepo.SignTargets(role, expiries.expires(role))
 	default:
 		err = fmt.Errorf("%s not supported role to sign on the client", role)
 	}
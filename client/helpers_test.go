@@ -146,6 +146,76 @@ func TestApplyChangelist(t *testing.T) {
 	require.False(t, ok)
 }
 
+// Contradictory changes are rejected before any of the changes are applied
+func TestApplyChangelistConflictingChanges(t *testing.T) {
+	repo, _, err := testutils.EmptyRepo("docker.com/notary")
+	require.NoError(t, err)
+	_, err = repo.InitTargets(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte{})
+	fjson, err := json.Marshal(&data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": hash[:]}})
+	require.NoError(t, err)
+
+	cl := changelist.NewMemChangelist()
+	require.NoError(t, changelist.AddBatch(cl, []changelist.Change{
+		changelist.NewTUFChange(changelist.ActionCreate, changelist.ScopeTargets,
+			changelist.TypeTargetsTarget, "latest", fjson),
+		changelist.NewTUFChange(changelist.ActionDelete, "targets/level1",
+			changelist.TypeTargetsDelegation, "", nil),
+		changelist.NewTUFChange(changelist.ActionCreate, "targets/level1",
+			changelist.TypeTargetsTarget, "latest", fjson),
+	}))
+	err = applyChangelist(repo, nil, cl)
+	require.IsType(t, changelist.ErrConflictingChanges{}, err)
+	require.Equal(t, 2, err.(changelist.ErrConflictingChanges).Index)
+	_, ok := repo.Targets[data.CanonicalTargetsRole].Signed.Targets["latest"]
+	require.False(t, ok)
+}
+
+// Replaying a changelist applies all of the changes that still apply, and
+// reports the ones that don't with their indices in the changelist
+func TestReplayChangelistReportsChangesThatNoLongerApply(t *testing.T) {
+	repo, _, err := testutils.EmptyRepo("docker.com/notary")
+	require.NoError(t, err)
+	_, err = repo.InitTargets(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	hash := sha256.Sum256([]byte{})
+	fjson, err := json.Marshal(&data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": hash[:]}})
+	require.NoError(t, err)
+
+	cl := changelist.NewMemChangelist()
+	require.NoError(t, changelist.AddBatch(cl, []changelist.Change{
+		changelist.NewTUFChange(changelist.ActionCreate, "targets/gone",
+			changelist.TypeTargetsTarget, "a", fjson),
+		changelist.NewTUFChange(changelist.ActionCreate, changelist.ScopeTargets,
+			changelist.TypeTargetsTarget, "b", fjson),
+		changelist.NewTUFChange(changelist.ActionCreate, changelist.ScopeTargets,
+			changelist.TypeTargetsTarget, "b", fjson),
+		changelist.NewTUFChange(changelist.ActionUpdate, "targets/gone",
+			changelist.TypeTargetsDelegation, "", []byte("{}")),
+	}))
+
+	err = replayChangelist(repo, nil, cl)
+	require.IsType(t, ErrChangesNoLongerApply{}, err)
+	failed := err.(ErrChangesNoLongerApply).Changes
+	require.Len(t, failed, 2)
+	require.Equal(t, 0, failed[0].Index)
+	require.Equal(t, "a", failed[0].Change.Path())
+	require.Equal(t, 3, failed[1].Index)
+	require.Contains(t, err.Error(), "#3")
+	_, ok := repo.Targets[data.CanonicalTargetsRole].Signed.Targets["b"]
+	require.True(t, ok)
+
+	// applying stops at the first change that fails
+	repo, _, err = testutils.EmptyRepo("docker.com/notary")
+	require.NoError(t, err)
+	_, err = repo.InitTargets(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Error(t, applyChangelist(repo, nil, cl))
+	_, ok = repo.Targets[data.CanonicalTargetsRole].Signed.Targets["b"]
+	require.False(t, ok)
+}
+
 func TestApplyChangelistMulti(t *testing.T) {
 	repo, _, err := testutils.EmptyRepo("docker.com/notary")
 	require.NoError(t, err)
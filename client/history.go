@@ -0,0 +1,343 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// Kinds of differences between two versions of a role
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// RoleVersion is a version of a role's metadata that has been published
+type RoleVersion struct {
+	Role    data.RoleName
+	Version int
+	// Published is when the server stored this version, or the zero time if
+	// the server did not say
+	Published time.Time
+	Expires   time.Time
+	// SignedBy has the IDs of the keys whose signatures are on this version
+	SignedBy []string
+}
+
+// TargetDiff is a target that differs between two versions of a targets or
+// delegation role.  From is nil for a target that was added, and To is nil
+// for one that was removed.
+type TargetDiff struct {
+	Name   string
+	Change string
+	From   *data.FileMeta
+	To     *data.FileMeta
+}
+
+// RoleDiff is a role whose keys, threshold or paths differ between two
+// versions of the metadata that delegates to it: the root for the base roles,
+// or a targets or delegation role for the delegations
+type RoleDiff struct {
+	Role          data.RoleName
+	Change        string
+	AddedKeys     []string
+	RemovedKeys   []string
+	AddedPaths    []string
+	RemovedPaths  []string
+	FromThreshold int
+	ToThreshold   int
+}
+
+// VersionDiff is the difference between two versions of a role's metadata.
+// Targets is only set for targets and delegation roles.
+type VersionDiff struct {
+	From    RoleVersion
+	To      RoleVersion
+	Targets []TargetDiff
+	Roles   []RoleDiff
+}
+
+// GetRoleHistory updates the repository, and returns the versions of a role's
+// metadata that the server has kept, newest first.  Only the versions older
+// than before are returned, or all of them if before is 0, and at most limit
+// of them, unless limit is 0, so that a long history can be listed a page at a
+// time without a request for every version.  Versions that were never
+// published, such as the first version of the targets, which is signed again
+// before it is first published, are left out.  The versions are reported as
+// the server stored them: their signatures are not verified, since the keys
+// that signed old versions may have been rotated out since.
+func (r *repository) GetRoleHistory(role data.RoleName, before, limit int) ([]RoleVersion, error) {
+	return r.GetRoleHistoryContext(context.Background(), role, before, limit)
+}
+
+// GetRoleHistoryContext is GetRoleHistory with a context for the requests to
+// the server
+func (r *repository) GetRoleHistoryContext(ctx context.Context, role data.RoleName, before, limit int) ([]RoleVersion, error) {
+	if before < 0 || limit < 0 {
+		return nil, fmt.Errorf("the version to list versions before and the number of versions to list can't be negative")
+	}
+	current, err := r.currentRoleVersion(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	newest := current
+	if before > 0 && before <= current {
+		newest = before - 1
+	}
+	var history []RoleVersion
+	for version := newest; version > 0 && (limit == 0 || len(history) < limit); version-- {
+		rv, _, err := r.getRoleVersion(ctx, role, version)
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, rv)
+	}
+	return history, nil
+}
+
+// DiffRoleVersions updates the repository, and returns the differences between
+// two versions of the metadata for the root, targets or a delegation role: the
+// targets that were added, removed or changed, and the roles whose keys,
+// threshold or paths were.  As for GetRoleHistory, the signatures on the
+// versions are not verified.
+func (r *repository) DiffRoleVersions(role data.RoleName, from, to int) (*VersionDiff, error) {
+	return r.DiffRoleVersionsContext(context.Background(), role, from, to)
+}
+
+// DiffRoleVersionsContext is DiffRoleVersions with a context for the requests
+// to the server
+func (r *repository) DiffRoleVersionsContext(ctx context.Context, role data.RoleName, from, to int) (*VersionDiff, error) {
+	if role != data.CanonicalRootRole && role != data.CanonicalTargetsRole && !data.IsDelegation(role) {
+		return nil, data.ErrInvalidRole{Role: role, Reason: "only the root, targets and delegation roles can be compared"}
+	}
+	current, err := r.currentRoleVersion(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range []int{from, to} {
+		if version < 1 || version > current {
+			return nil, ErrInvalidRoleVersion{
+				Role:    role,
+				Version: version,
+				msg:     fmt.Sprintf("the current version is %d", current),
+			}
+		}
+	}
+	fromVersion, fromSigned, err := r.getRoleVersion(ctx, role, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, toSigned, err := r.getRoleVersion(ctx, role, to)
+	if err != nil {
+		return nil, err
+	}
+	diff := &VersionDiff{From: fromVersion, To: toVersion}
+
+	if role == data.CanonicalRootRole {
+		fromRoot, err := data.RootFromSigned(fromSigned)
+		if err != nil {
+			return nil, err
+		}
+		toRoot, err := data.RootFromSigned(toSigned)
+		if err != nil {
+			return nil, err
+		}
+		diff.Roles = diffBaseRoles(fromRoot.Signed.Roles, toRoot.Signed.Roles)
+		return diff, nil
+	}
+
+	fromTargets, err := data.TargetsFromSigned(fromSigned, role)
+	if err != nil {
+		return nil, err
+	}
+	toTargets, err := data.TargetsFromSigned(toSigned, role)
+	if err != nil {
+		return nil, err
+	}
+	diff.Targets = diffTargets(fromTargets.Signed.Targets, toTargets.Signed.Targets)
+	diff.Roles = diffDelegations(fromTargets.Signed.Delegations.Roles, toTargets.Signed.Delegations.Roles)
+	return diff, nil
+}
+
+// currentRoleVersion updates the repository and returns the current version
+// of a role's metadata
+func (r *repository) currentRoleVersion(ctx context.Context, role data.RoleName) (int, error) {
+	if err := r.UpdateContext(ctx, false); err != nil {
+		return 0, err
+	}
+	versions := publishedVersions(r.tufRepo, false)
+	if r.tufRepo.Timestamp != nil {
+		versions[data.CanonicalTimestampRole] = r.tufRepo.Timestamp.Signed.Version
+	}
+	current, ok := versions[role]
+	if !ok {
+		return 0, data.ErrInvalidRole{Role: role, Reason: "no metadata has been published for the role"}
+	}
+	return current, nil
+}
+
+// getRoleVersion downloads the given version of a role's metadata from the
+// server, checking that it is the version of the role that was asked for
+func (r *repository) getRoleVersion(ctx context.Context, role data.RoleName, version int) (RoleVersion, *data.Signed, error) {
+	published, raw, err := store.GetVersion(ctx, r.getRemoteStore(), role, version)
+	if err != nil {
+		return RoleVersion{}, nil, err
+	}
+	invalid := ErrInvalidRoleVersion{Role: role, Version: version, msg: "the server returned something else"}
+	signed := &data.Signed{}
+	var common data.SignedCommon
+	if err := json.Unmarshal(raw, signed); err != nil || signed.Signed == nil {
+		return RoleVersion{}, nil, invalid
+	}
+	if err := json.Unmarshal(*signed.Signed, &common); err != nil {
+		return RoleVersion{}, nil, invalid
+	}
+	if !data.ValidTUFType(common.Type, role) || common.Version != version {
+		return RoleVersion{}, nil, invalid
+	}
+	rv := RoleVersion{
+		Role:      role,
+		Version:   version,
+		Published: published,
+		Expires:   common.Expires,
+		SignedBy:  make([]string, 0, len(signed.Signatures)),
+	}
+	for _, sig := range signed.Signatures {
+		rv.SignedBy = append(rv.SignedBy, sig.KeyID)
+	}
+	return rv, signed, nil
+}
+
+func diffTargets(from, to data.Files) []TargetDiff {
+	var diffs []TargetDiff
+	for name, fromMeta := range from {
+		fromMeta := fromMeta
+		toMeta, ok := to[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, TargetDiff{Name: name, Change: DiffRemoved, From: &fromMeta})
+		case !fromMeta.Equals(toMeta):
+			toMeta := toMeta
+			diffs = append(diffs, TargetDiff{Name: name, Change: DiffChanged, From: &fromMeta, To: &toMeta})
+		}
+	}
+	for name, toMeta := range to {
+		toMeta := toMeta
+		if _, ok := from[name]; !ok {
+			diffs = append(diffs, TargetDiff{Name: name, Change: DiffAdded, To: &toMeta})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	return diffs
+}
+
+func diffBaseRoles(from, to map[data.RoleName]*data.RootRole) []RoleDiff {
+	fromRoles := make(map[data.RoleName]data.Role, len(from))
+	for name, role := range from {
+		fromRoles[name] = data.Role{Name: name, RootRole: *role}
+	}
+	toRoles := make(map[data.RoleName]data.Role, len(to))
+	for name, role := range to {
+		toRoles[name] = data.Role{Name: name, RootRole: *role}
+	}
+	return diffRoles(fromRoles, toRoles)
+}
+
+func diffDelegations(from, to []*data.Role) []RoleDiff {
+	fromRoles := make(map[data.RoleName]data.Role, len(from))
+	for _, role := range from {
+		fromRoles[role.Name] = *role
+	}
+	toRoles := make(map[data.RoleName]data.Role, len(to))
+	for _, role := range to {
+		toRoles[role.Name] = *role
+	}
+	return diffRoles(fromRoles, toRoles)
+}
+
+func diffRoles(from, to map[data.RoleName]data.Role) []RoleDiff {
+	var diffs []RoleDiff
+	for name, fromRole := range from {
+		toRole, ok := to[name]
+		if !ok {
+			diffs = append(diffs, RoleDiff{
+				Role:          name,
+				Change:        DiffRemoved,
+				RemovedKeys:   sortedCopy(fromRole.KeyIDs),
+				RemovedPaths:  sortedCopy(fromRole.Paths),
+				FromThreshold: fromRole.Threshold,
+			})
+			continue
+		}
+		diff := RoleDiff{
+			Role:          name,
+			Change:        DiffChanged,
+			AddedKeys:     missingFrom(toRole.KeyIDs, fromRole.KeyIDs),
+			RemovedKeys:   missingFrom(fromRole.KeyIDs, toRole.KeyIDs),
+			AddedPaths:    missingFrom(toRole.Paths, fromRole.Paths),
+			RemovedPaths:  missingFrom(fromRole.Paths, toRole.Paths),
+			FromThreshold: fromRole.Threshold,
+			ToThreshold:   toRole.Threshold,
+		}
+		if len(diff.AddedKeys) > 0 || len(diff.RemovedKeys) > 0 ||
+			len(diff.AddedPaths) > 0 || len(diff.RemovedPaths) > 0 ||
+			diff.FromThreshold != diff.ToThreshold || !sameDelegation(fromRole, toRole) {
+			diffs = append(diffs, diff)
+		}
+	}
+	for name, toRole := range to {
+		if _, ok := from[name]; !ok {
+			diffs = append(diffs, RoleDiff{
+				Role:        name,
+				Change:      DiffAdded,
+				AddedKeys:   sortedCopy(toRole.KeyIDs),
+				AddedPaths:  sortedCopy(toRole.Paths),
+				ToThreshold: toRole.Threshold,
+			})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Role < diffs[j].Role })
+	return diffs
+}
+
+// sameDelegation is whether the parts of two delegations that are not
+// reported on individually are the same
+func sameDelegation(from, to data.Role) bool {
+	return from.PathType == to.PathType && from.Terminating == to.Terminating &&
+		len(missingFrom(from.PathHashPrefixes, to.PathHashPrefixes)) == 0 &&
+		len(missingFrom(to.PathHashPrefixes, from.PathHashPrefixes)) == 0
+}
+
+// missingFrom returns the sorted strings that are in a but not in b
+func missingFrom(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var missing []string
+	for _, s := range a {
+		if !in[s] {
+			missing = append(missing, s)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func sortedCopy(strs []string) []string {
+	if len(strs) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), strs...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func hashedTarget(name, content string) *Target {
+	hash := sha256.Sum256([]byte(content))
+	return &Target{Name: name, Hashes: data.Hashes{"sha256": hash[:]}, Length: int64(len(content))}
+}
+
+// The history of a role lists every published version, newest first, and the
+// differences between two versions are the targets and keys that changed
+func TestRoleHistoryAndDiff(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("c", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+
+	require.NoError(t, repo.RemoveTarget("a", data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "second"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("c", "second"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+
+	// a client that has none of the history cached
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+
+	// the first version of the targets is signed again before being published
+	history, err := otherRepo.GetRoleHistory(data.CanonicalTargetsRole, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	targetsKeys := repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole)
+	require.Len(t, targetsKeys, 1)
+	for i, version := range history {
+		require.Equal(t, data.CanonicalTargetsRole, version.Role)
+		require.Equal(t, 4-i, version.Version)
+		require.False(t, version.Published.IsZero())
+		require.False(t, version.Expires.IsZero())
+		require.Equal(t, targetsKeys, version.SignedBy)
+	}
+
+	// the history can be listed a page at a time
+	history, err = otherRepo.GetRoleHistory(data.CanonicalTargetsRole, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, 4, history[0].Version)
+	require.Equal(t, 3, history[1].Version)
+	history, err = otherRepo.GetRoleHistory(data.CanonicalTargetsRole, 3, 2)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, 2, history[0].Version)
+	history, err = otherRepo.GetRoleHistory(data.CanonicalTargetsRole, 2, 0)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	diff, err := otherRepo.DiffRoleVersions(data.CanonicalTargetsRole, 3, 4)
+	require.NoError(t, err)
+	require.Equal(t, 3, diff.From.Version)
+	require.Equal(t, 4, diff.To.Version)
+	require.Len(t, diff.Targets, 3)
+	for i, expected := range []TargetDiff{
+		{Name: "a", Change: DiffRemoved},
+		{Name: "b", Change: DiffAdded},
+		{Name: "c", Change: DiffChanged},
+	} {
+		require.Equal(t, expected.Name, diff.Targets[i].Name)
+		require.Equal(t, expected.Change, diff.Targets[i].Change)
+	}
+	require.Nil(t, diff.Targets[0].To)
+	require.Nil(t, diff.Targets[1].From)
+	require.Equal(t, int64(len("first")), diff.Targets[2].From.Length)
+	require.Equal(t, int64(len("second")), diff.Targets[2].To.Length)
+	require.Empty(t, diff.Roles)
+
+	// comparing a version with itself shows no differences
+	diff, err = otherRepo.DiffRoleVersions(data.CanonicalTargetsRole, 4, 4)
+	require.NoError(t, err)
+	require.Empty(t, diff.Targets)
+	require.Empty(t, diff.Roles)
+
+	for _, version := range []int{0, 5} {
+		_, err = otherRepo.DiffRoleVersions(data.CanonicalTargetsRole, 2, version)
+		require.IsType(t, ErrInvalidRoleVersion{}, err)
+	}
+	_, err = otherRepo.DiffRoleVersions(data.CanonicalSnapshotRole, 1, 2)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	_, err = otherRepo.GetRoleHistory("targets/nope", 0, 0)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+// Rotating a key shows up as a change to the keys of the base role in the root
+func TestDiffRootVersions(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	oldKeys := repo.GetCryptoService().ListKeys(data.CanonicalSnapshotRole)
+	require.NoError(t, repo.RotateKey(data.CanonicalSnapshotRole, true, nil))
+	require.NoError(t, repo.Update(false))
+	newKeys := repo.tufRepo.Root.Signed.Roles[data.CanonicalSnapshotRole].KeyIDs
+
+	diff, err := repo.DiffRoleVersions(data.CanonicalRootRole, 1, 2)
+	require.NoError(t, err)
+	require.Empty(t, diff.Targets)
+	require.Equal(t, []RoleDiff{{
+		Role:          data.CanonicalSnapshotRole,
+		Change:        DiffChanged,
+		AddedKeys:     newKeys,
+		RemovedKeys:   oldKeys,
+		FromThreshold: 1,
+		ToThreshold:   1,
+	}}, diff.Roles)
+}
+
+func TestDiffDelegations(t *testing.T) {
+	unchanged := &data.Role{Name: "targets/same", RootRole: data.RootRole{KeyIDs: []string{"k1"}, Threshold: 1}, Paths: []string{"a"}}
+	before := &data.Role{Name: "targets/changed", RootRole: data.RootRole{KeyIDs: []string{"k1", "k2"}, Threshold: 1}, Paths: []string{"a", "b"}}
+	after := &data.Role{Name: "targets/changed", RootRole: data.RootRole{KeyIDs: []string{"k3", "k1"}, Threshold: 2}, Paths: []string{"c", "a"}}
+	terminating := *unchanged
+	terminating.Terminating = true
+	removed := &data.Role{Name: "targets/removed", RootRole: data.RootRole{KeyIDs: []string{"k2", "k1"}, Threshold: 1}}
+	added := &data.Role{Name: "targets/added", RootRole: data.RootRole{KeyIDs: []string{"k1"}, Threshold: 1}, Paths: []string{""}}
+
+	require.Empty(t, diffDelegations([]*data.Role{unchanged}, []*data.Role{unchanged}))
+	require.Equal(t, []RoleDiff{
+		{Role: "targets/added", Change: DiffAdded, AddedKeys: []string{"k1"}, AddedPaths: []string{""}, ToThreshold: 1},
+		{
+			Role: "targets/changed", Change: DiffChanged,
+			AddedKeys: []string{"k3"}, RemovedKeys: []string{"k2"},
+			AddedPaths: []string{"c"}, RemovedPaths: []string{"b"},
+			FromThreshold: 1, ToThreshold: 2,
+		},
+		{Role: "targets/removed", Change: DiffRemoved, RemovedKeys: []string{"k1", "k2"}, FromThreshold: 1},
+		{Role: "targets/same", Change: DiffChanged, FromThreshold: 1, ToThreshold: 1},
+	}, diffDelegations(
+		[]*data.Role{unchanged, before, removed},
+		[]*data.Role{added, after, &terminating},
+	))
+}
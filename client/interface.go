@@ -1,9 +1,13 @@
 package client
 
 import (
+	"io"
+	"time"
+
 	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
+	"golang.org/x/net/context"
 )
 
 // Repository represents the set of options that must be supported over a TUF repo.
@@ -11,37 +15,95 @@ type Repository interface {
 	// General management operations
 	Initialize(rootKeyIDs []string, serverManagedRoles ...data.RoleName) error
 	InitializeWithCertificate(rootKeyIDs []string, rootCerts []data.PublicKey, serverManagedRoles ...data.RoleName) error
+	InitializeWithRoleSpecs(rootCerts []data.PublicKey, roleSpecs map[data.RoleName]BaseRoleSpec, serverManagedRoles ...data.RoleName) error
 	Publish() error
+	PublishContext(ctx context.Context) error
+	PublishDryRun() (*PublishPlan, error)
+	PublishDryRunContext(ctx context.Context) (*PublishPlan, error)
+	PlanChangelist(cl changelist.Changelist) (*PublishPlan, error)
+	PlanChangelistContext(ctx context.Context, cl changelist.Changelist) (*PublishPlan, error)
+	PublishToDirectory(dir string) ([]data.RoleName, error)
+	PublishToDirectoryContext(ctx context.Context, dir string) ([]data.RoleName, error)
+	PushDirectory(dir string) ([]data.RoleName, error)
+	PushDirectoryContext(ctx context.Context, dir string) ([]data.RoleName, error)
 
 	// Target Operations
 	AddTarget(target *Target, roles ...data.RoleName) error
+	AddTargets(targets []*Target, roles ...data.RoleName) error
 	RemoveTarget(targetName string, roles ...data.RoleName) error
 	ListTargets(roles ...data.RoleName) ([]*TargetWithRole, error)
+	ListTargetsContext(ctx context.Context, roles ...data.RoleName) ([]*TargetWithRole, error)
 	GetTargetByName(name string, roles ...data.RoleName) (*TargetWithRole, error)
+	GetTargetByNameContext(ctx context.Context, name string, roles ...data.RoleName) (*TargetWithRole, error)
 	GetAllTargetMetadataByName(name string) ([]TargetSignedStruct, error)
+	GetAllTargetMetadataByNameContext(ctx context.Context, name string) ([]TargetSignedStruct, error)
+	FetchTarget(name string, source ContentSource, dest string, roles ...data.RoleName) (*TargetWithRole, error)
+	FetchTargetContext(ctx context.Context, name string, source ContentSource, dest string, roles ...data.RoleName) (*TargetWithRole, error)
 
 	// Changelist operations
 	GetChangelist() (changelist.Changelist, error)
+	ExportChangelist(w io.Writer, role data.RoleName) error
+	ExportChangelistContext(ctx context.Context, w io.Writer, role data.RoleName) error
+	ImportChangelist(rd io.Reader) error
+	ImportChangelistContext(ctx context.Context, rd io.Reader) error
 
 	// Role operations
 	ListRoles() ([]RoleWithSignatures, error)
+	ListRolesContext(ctx context.Context) ([]RoleWithSignatures, error)
 	GetDelegationRoles() ([]data.Role, error)
+	GetDelegationRolesContext(ctx context.Context) ([]data.Role, error)
+	GetRoleExpiries() ([]RoleExpiryStatus, error)
+	GetRoleExpiriesContext(ctx context.Context) ([]RoleExpiryStatus, error)
 	AddDelegation(name data.RoleName, delegationKeys []data.PublicKey, paths []string) error
+	AddDelegationWithThreshold(name data.RoleName, delegationKeys []data.PublicKey, paths []string, threshold int) error
 	AddDelegationRoleAndKeys(name data.RoleName, delegationKeys []data.PublicKey) error
+	AddDelegationRoleAndKeysWithThreshold(name data.RoleName, delegationKeys []data.PublicKey, threshold int) error
 	AddDelegationPaths(name data.RoleName, paths []string) error
 	RemoveDelegationKeysAndPaths(name data.RoleName, keyIDs, paths []string) error
 	RemoveDelegationRole(name data.RoleName) error
 	RemoveDelegationPaths(name data.RoleName, paths []string) error
 	RemoveDelegationKeys(name data.RoleName, keyIDs []string) error
 	ClearDelegationPaths(name data.RoleName) error
+	SetDelegationTerminating(name data.RoleName, terminating bool) error
+	SetDelegationPathType(name data.RoleName, pathType data.PathType) error
+	AddDelegationHashedBins(name data.RoleName, numBins int, delegationKeys []data.PublicKey, threshold int) ([]data.RoleName, error)
+	ConvergeDelegations(specs []DelegationSpec, cl changelist.Changelist) ([]RoleDiff, error)
+	ConvergeDelegationsContext(ctx context.Context, specs []DelegationSpec, cl changelist.Changelist) ([]RoleDiff, error)
 
 	// Witness and other re-signing operations
 	Witness(roles ...data.RoleName) ([]data.RoleName, error)
+	WitnessContext(ctx context.Context, roles ...data.RoleName) ([]data.RoleName, error)
+	Renew(within time.Duration) (*RenewResult, error)
+	RenewContext(ctx context.Context, within time.Duration) (*RenewResult, error)
+	RenewRoles(roles ...data.RoleName) (*RenewResult, error)
+	RenewRolesContext(ctx context.Context, roles ...data.RoleName) (*RenewResult, error)
+
+	// History operations
+	GetRoleHistory(role data.RoleName, before, limit int) ([]RoleVersion, error)
+	GetRoleHistoryContext(ctx context.Context, role data.RoleName, before, limit int) ([]RoleVersion, error)
+	DiffRoleVersions(role data.RoleName, from, to int) (*VersionDiff, error)
+	DiffRoleVersionsContext(ctx context.Context, role data.RoleName, from, to int) (*VersionDiff, error)
+	Rollback(role data.RoleName, version int) (*RollbackResult, error)
+	RollbackContext(ctx context.Context, role data.RoleName, version int) (*RollbackResult, error)
+
+	// Co-signing operations
+	ExportPendingMetadata() ([]*PendingMetadata, error)
+	SignPendingMetadata(pending *PendingMetadata) error
+	SignPendingMetadataContext(ctx context.Context, pending *PendingMetadata) error
+	PushPendingMetadata(pending ...*PendingMetadata) error
+	PushPendingMetadataContext(ctx context.Context, pending ...*PendingMetadata) error
+	StagePendingMetadata(pending ...*PendingMetadata) (bool, error)
+	GetStagedMetadata() ([]*PendingMetadata, error)
+	DiscardStagedMetadata() error
 
 	// Key Operations
 	RotateKey(role data.RoleName, serverManagesKey bool, keyList []string) error
+	RotateKeyWithThreshold(role data.RoleName, serverManagesKey bool, keyList []string, threshold int) error
 
 	GetCryptoService() signed.CryptoService
 	SetLegacyVersions(int)
+	SetDownloadWorkers(int)
+	SetPublishRetries(retries int, backoff time.Duration)
+	SetExpiry(role data.RoleName, expiry time.Duration) error
 	GetGUN() data.GUN
 }
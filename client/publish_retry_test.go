@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+// racingTransport runs a hook just before each metadata upload, so that
+// another client can publish in between a client updating and uploading
+type racingTransport struct {
+	mu           sync.Mutex
+	uploads      int
+	beforeUpload func(upload int)
+}
+
+func (rt *racingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "POST" {
+		rt.mu.Lock()
+		rt.uploads++
+		upload := rt.uploads
+		rt.mu.Unlock()
+		rt.beforeUpload(upload)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newRacingRepo returns a copy of the repository, with the same keys, whose
+// uploads are preceded by the hook, and which has its own changelist
+func newRacingRepo(t *testing.T, repo *repository, baseDir string, beforeUpload func(int)) (*repository, *racingTransport) {
+	rt := &racingTransport{beforeUpload: beforeUpload}
+	r, err := NewFileCachedRepository(baseDir, repo.gun, repo.baseURL, rt, passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	racing := r.(*repository)
+	racing.changelist = changelist.NewMemChangelist()
+	racing.SetPublishRetries(2, time.Millisecond)
+	return racing, rt
+}
+
+// A publish that loses a race with another client is rebased onto what the
+// other client published, and retried
+func TestPublishRetriesAfterConflict(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	racing, rt := newRacingRepo(t, repo, baseDir, func(upload int) {
+		if upload == 1 {
+			addTarget(t, repo, "theirs", "../fixtures/root-ca.crt")
+			require.NoError(t, repo.Publish())
+		}
+	})
+	addTarget(t, racing, "ours", "../fixtures/intermediate-ca.crt")
+	require.NoError(t, racing.Publish())
+	require.Equal(t, 2, rt.uploads)
+	require.Len(t, getChanges(t, racing), 0)
+
+	targets, err := repo.ListTargets()
+	require.NoError(t, err)
+	var names []string
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+	require.Len(t, names, 2)
+	require.Contains(t, names, "ours")
+	require.Contains(t, names, "theirs")
+}
+
+// Retries are bounded, and the changes are kept when they run out
+func TestPublishRetriesAreBounded(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	racing, rt := newRacingRepo(t, repo, baseDir, func(upload int) {
+		addTarget(t, repo, "theirs", "../fixtures/root-ca.crt")
+		require.NoError(t, repo.Publish())
+	})
+	addTarget(t, racing, "ours", "../fixtures/intermediate-ca.crt")
+	err := racing.Publish()
+	require.IsType(t, store.ErrVersionConflict{}, err)
+	require.Equal(t, 3, rt.uploads)
+	require.Len(t, getChanges(t, racing), 1)
+
+	// without retries, the conflict is returned straight away
+	racing, rt = newRacingRepo(t, repo, baseDir, func(upload int) {
+		addTarget(t, repo, "theirs-too", "../fixtures/root-ca.crt")
+		require.NoError(t, repo.Publish())
+	})
+	racing.SetPublishRetries(0, time.Millisecond)
+	addTarget(t, racing, "ours", "../fixtures/intermediate-ca.crt")
+	err = racing.Publish()
+	require.Equal(t, 1, rt.uploads)
+
+	// the server says which of the versions the publish was based on changed
+	conflict, ok := err.(store.ErrVersionConflict)
+	require.True(t, ok, "unexpected error: %v", err)
+	for _, role := range []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole} {
+		require.Equal(t, conflict.Expected[role]+1, conflict.Current[role])
+	}
+	require.Equal(t, conflict.Expected[data.CanonicalRootRole], conflict.Current[data.CanonicalRootRole])
+	require.Contains(t, err.Error(), "targets is at version")
+
+	// the backoff stops when the context is done
+	racing, _ = newRacingRepo(t, repo, baseDir, func(upload int) {
+		addTarget(t, repo, "theirs", "../fixtures/root-ca.crt")
+		require.NoError(t, repo.Publish())
+	})
+	racing.SetPublishRetries(1, time.Hour)
+	addTarget(t, racing, "ours", "../fixtures/intermediate-ca.crt")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, racing.PublishContext(ctx))
+}
+
+func TestPublishRetryDelay(t *testing.T) {
+	for retry := 0; retry < 4; retry++ {
+		delay := publishRetryDelay(time.Second, retry)
+		require.True(t, delay >= time.Second<<uint(retry), "retry %d: %s", retry, delay)
+		require.True(t, delay <= time.Second<<uint(retry)*3/2, "retry %d: %s", retry, delay)
+	}
+	require.Equal(t, time.Duration(0), publishRetryDelay(0, 2))
+}
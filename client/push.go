@@ -0,0 +1,371 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/client/changelist"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"golang.org/x/net/context"
+)
+
+// metadataExtension is the extension of the metadata files written by
+// PublishToDirectory
+const metadataExtension = "json"
+
+// signedChangesFile is the file in which PublishToDirectory records the
+// changes that it signed, so that PushDirectory can remove them from the
+// changelist once they are published
+const signedChangesFile = "changelist"
+
+// consistentFileName matches the name of a metadata file that is a copy of a
+// role's metadata, named with its SHA256 checksum
+var consistentFileName = regexp.MustCompile(`^(.+)\.([0-9a-f]{64})$`)
+
+// PublishToDirectory applies the changelist and signs the metadata as Publish
+// does, but writes it to a directory rather than uploading it, so that it can
+// be signed on a machine that cannot reach the server and pushed later using
+// PushDirectory.  Each role's metadata is written to <role>.json, and a copy
+// of it to <role>.<sha256 checksum>.json.  The directory must be empty or not
+// exist.  If the repository has no server to update from, the metadata is
+// signed on top of the cached metadata, which must therefore be up to date.
+// The changes that were signed are also recorded in the directory, and are
+// kept in the changelist until PushDirectory publishes them from this
+// repository, so that they are not lost if the push fails.  It returns the
+// roles that were written.
+func (r *repository) PublishToDirectory(dir string) ([]data.RoleName, error) {
+	return r.PublishToDirectoryContext(context.Background(), dir)
+}
+
+// PublishToDirectoryContext is PublishToDirectory with a context for the
+// requests to the server, if there is one
+func (r *repository) PublishToDirectoryContext(ctx context.Context, dir string) ([]data.RoleName, error) {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	initialPublish, err := r.updateForOfflinePublish(ctx)
+	if err != nil {
+		return nil, err
+	}
+	updatedFiles, err := r.signChanges(ctx, r.changelist, applyChangelist, initialPublish)
+	if err != nil {
+		return nil, err
+	}
+	if err := signSnapshotIfPossible(updatedFiles, r.tufRepo, r.expiries); err != nil {
+		return nil, err
+	}
+
+	metas := make(map[string][]byte, 2*len(updatedFiles))
+	roles := make([]data.RoleName, 0, len(updatedFiles))
+	for role, meta := range updatedFiles {
+		checksum := sha256.Sum256(meta)
+		metas[role.String()] = meta
+		metas[utils.ConsistentName(role.String(), checksum[:])] = meta
+		roles = append(roles, role)
+	}
+	out, err := store.NewFileStore(dir, metadataExtension)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.SetMulti(metas); err != nil {
+		return nil, err
+	}
+	changes, err := json.Marshal(r.changelist.List())
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, signedChangesFile), changes, notary.PrivNoExecPerms); err != nil {
+		return nil, err
+	}
+
+	sortRoles(roles)
+	return roles, nil
+}
+
+// updateForOfflinePublish is updateForPublish, unless the repository has no
+// server, in which case it is brought up to date from the cache.  Metadata
+// that has never been published has no timestamp in the cache, so without one
+// the repository is loaded as it was initialized, to be published for the
+// first time.
+func (r *repository) updateForOfflinePublish(ctx context.Context) (initialPublish bool, err error) {
+	switch r.getRemoteStore().(type) {
+	case store.OfflineStore, *store.OfflineStore:
+	default:
+		return r.updateForPublish(ctx)
+	}
+	updateErr := r.UpdateContext(ctx, false)
+	if updateErr == nil {
+		return false, nil
+	}
+	if _, err := r.cache.GetSized(data.CanonicalTimestampRole.String(), notary.MaxTimestampSize); err == nil {
+		return false, updateErr
+	}
+	if err := r.bootstrapRepo(); err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			return false, ErrRepoNotInitialized{}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// PushDirectory publishes the metadata that PublishToDirectory wrote to a
+// directory, in a single update.  The repository is updated first, and the
+// metadata is checked against it before anything is uploaded: the root must be
+// signed by the current root keys as well as its own, each targets and
+// delegation role by the keys that the root or its delegating role trusts for
+// it, and each version must be newer than the published one, which it is not
+// if another client has published in the meantime.  The snapshot is signed if
+// it is not in the directory and its key is available, otherwise the server
+// is assumed to sign it.  Once the metadata is published, the changes that
+// were signed into it are removed from the changelist, if they are staged in
+// this repository.  It returns the roles that were published.
+func (r *repository) PushDirectory(dir string) ([]data.RoleName, error) {
+	return r.PushDirectoryContext(context.Background(), dir)
+}
+
+// PushDirectoryContext is PushDirectory with a context for updating the
+// repository and uploading the metadata
+func (r *repository) PushDirectoryContext(ctx context.Context, dir string) ([]data.RoleName, error) {
+	files, err := readMetadataDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	initialPublish := false
+	if err := r.UpdateContext(ctx, true); err != nil {
+		if _, ok := err.(ErrRepositoryNotExist); !ok {
+			return nil, err
+		}
+		initialPublish = true
+		r.tufRepo = tuf.NewRepo(r.cryptoService)
+	}
+	expected := publishedVersions(r.tufRepo, initialPublish)
+	repo := r.tufRepo
+
+	roles := make([]data.RoleName, 0, len(files))
+	for role := range files {
+		roles = append(roles, role)
+	}
+	// the root comes first, and each delegating role before its delegations,
+	// so that the keys for each role are known before it is checked
+	sortRoles(roles)
+
+	if _, ok := files[data.CanonicalRootRole]; !ok && initialPublish {
+		return nil, ErrInvalidSignedMetadata{Role: data.CanonicalRootRole, msg: "the first publish must include the root"}
+	}
+	for _, role := range roles {
+		s := &data.Signed{}
+		if err := json.Unmarshal(files[role], s); err != nil || s.Signed == nil {
+			return nil, ErrInvalidSignedMetadata{Role: role, msg: "it is not signed metadata"}
+		}
+		var trusted data.BaseRole
+		switch {
+		case role == data.CanonicalRootRole:
+			// the root is checked against the trusted root, or the trust pinning
+			// configuration if there is none yet, as when it is downloaded
+			root, err := trustpinning.ValidateRoot(repo.Root, s, r.gun, r.trustPinning)
+			if err != nil {
+				return nil, ErrInvalidSignedMetadata{Role: role, msg: err.Error()}
+			}
+			if err := checkPushedVersion(role, s, expected[role]); err != nil {
+				return nil, err
+			}
+			repo.Root = root
+			continue
+		case role == data.CanonicalTargetsRole || role == data.CanonicalSnapshotRole:
+			trusted, err = repo.GetBaseRole(role)
+		case data.IsDelegation(role):
+			var delgRole data.DelegationRole
+			delgRole, err = repo.GetDelegationRole(role)
+			trusted = delgRole.BaseRole
+		default:
+			err = ErrInvalidSignedMetadata{Role: role, msg: "only the root, targets, delegation and snapshot roles can be pushed"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := signed.VerifySignatures(s, trusted); err != nil {
+			return nil, ErrInvalidSignedMetadata{Role: role, msg: err.Error()}
+		}
+		if err := checkPushedVersion(role, s, expected[role]); err != nil {
+			return nil, err
+		}
+		if role == data.CanonicalSnapshotRole {
+			if repo.Snapshot, err = data.SnapshotFromSigned(s); err != nil {
+				return nil, err
+			}
+		} else if repo.Targets[role], err = data.TargetsFromSigned(s, role); err != nil {
+			return nil, err
+		}
+	}
+
+	_, signedSnapshot := files[data.CanonicalSnapshotRole]
+	if err := r.publishSigned(ctx, files, expected); err != nil {
+		return nil, err
+	}
+	if _, ok := files[data.CanonicalSnapshotRole]; ok && !signedSnapshot {
+		roles = append(roles, data.CanonicalSnapshotRole)
+	}
+	if err := r.removeSignedChanges(dir); err != nil {
+		logrus.Warnf("Unable to remove the published changes from the changelist, you may want to clear them with `notary reset`: %v", err)
+	}
+	return roles, nil
+}
+
+// removeSignedChanges removes the changes that PublishToDirectory recorded in
+// a directory from the changelist
+func (r *repository) removeSignedChanges(dir string) error {
+	raw, err := ioutil.ReadFile(filepath.Join(dir, signedChangesFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var signedChanges []*changelist.TUFChange
+	if err := json.Unmarshal(raw, &signedChanges); err != nil {
+		return err
+	}
+	return r.removeChanges(signedChanges)
+}
+
+// removeChanges removes changes that have been signed and published from the
+// changelist.  Only staged changes that are the same as a published one are
+// removed, so that publishing metadata signed elsewhere leaves the changes
+// staged in this repository alone.
+func (r *repository) removeChanges(signedChanges []*changelist.TUFChange) error {
+	signedChanges = append([]*changelist.TUFChange{}, signedChanges...)
+	var published []int
+	for i, staged := range r.changelist.List() {
+		for j, c := range signedChanges {
+			if c != nil && sameChange(staged, c) {
+				published = append(published, i)
+				signedChanges[j] = nil
+				break
+			}
+		}
+	}
+	if len(published) == 0 {
+		return nil
+	}
+	return r.changelist.Remove(published)
+}
+
+// sameChange is whether two changes make the same change
+func sameChange(a, b changelist.Change) bool {
+	return a.Action() == b.Action() && a.Scope() == b.Scope() && a.Type() == b.Type() &&
+		a.Path() == b.Path() && bytes.Equal(a.Content(), b.Content())
+}
+
+// checkPushedVersion checks that metadata that is to be pushed has not expired,
+// and is newer than the version that has been published
+func checkPushedVersion(role data.RoleName, s *data.Signed, published int) error {
+	var common data.SignedCommon
+	if err := json.Unmarshal(*s.Signed, &common); err != nil {
+		return ErrInvalidSignedMetadata{Role: role, msg: "it is not signed metadata"}
+	}
+	if err := signed.VerifyExpiry(&common, role); err != nil {
+		return ErrInvalidSignedMetadata{Role: role, msg: err.Error()}
+	}
+	if common.Version <= published {
+		return ErrInvalidSignedMetadata{
+			Role: role,
+			msg: fmt.Sprintf(
+				"version %d is not newer than the published version %d, so it must be signed again on top of what has been published since",
+				common.Version, published),
+		}
+	}
+	return nil
+}
+
+// readMetadataDirectory reads the metadata files in a directory written by
+// PublishToDirectory.  The copies named with their checksums are only checked
+// against their checksums and against the metadata for their roles.
+func readMetadataDirectory(dir string) (map[data.RoleName][]byte, error) {
+	files := make(map[data.RoleName][]byte)
+	copies := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == signedChangesFile {
+			return nil
+		}
+		if !strings.HasSuffix(name, "."+metadataExtension) {
+			return fmt.Errorf("%s is not a metadata file", rel)
+		}
+		name = strings.TrimSuffix(name, "."+metadataExtension)
+		meta, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if consistentFileName.MatchString(name) {
+			copies[name] = meta
+		} else {
+			files[data.RoleName(name)] = meta
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("there is no metadata in %s", dir)
+	}
+	for name, meta := range copies {
+		parts := consistentFileName.FindStringSubmatch(name)
+		role := data.RoleName(parts[1])
+		checksum := sha256.Sum256(meta)
+		if hex.EncodeToString(checksum[:]) != parts[2] {
+			return nil, ErrInvalidSignedMetadata{Role: role, msg: fmt.Sprintf("%s.%s does not match its checksum", name, metadataExtension)}
+		}
+		if original, ok := files[role]; !ok || string(original) != string(meta) {
+			return nil, ErrInvalidSignedMetadata{Role: role, msg: fmt.Sprintf("%s.%s is not a copy of %s.%s", name, metadataExtension, role, metadataExtension)}
+		}
+	}
+	return files, nil
+}
+
+// sortRoles sorts roles with the root first, then the targets and its
+// delegations, each before its own delegations, and the snapshot last
+func sortRoles(roles []data.RoleName) {
+	rank := func(role data.RoleName) int {
+		switch role {
+		case data.CanonicalRootRole:
+			return 0
+		case data.CanonicalSnapshotRole:
+			return 2
+		}
+		return 1
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		if rank(roles[i]) != rank(roles[j]) {
+			return rank(roles[i]) < rank(roles[j])
+		}
+		return roles[i] < roles[j]
+	})
+}
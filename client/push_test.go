@@ -0,0 +1,193 @@
+package client
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/trustpinning"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+)
+
+// copyCachedMetadata replaces the cached metadata of one repository with that
+// of another, as is done to bring an offline machine up to date
+func copyCachedMetadata(t *testing.T, fromDir, toDir string, gun data.GUN) {
+	metadataDir := filepath.Join(tufDir, filepath.FromSlash(gun.String()), "metadata")
+	require.NoError(t, os.RemoveAll(filepath.Join(toDir, metadataDir)))
+	require.NoError(t, os.MkdirAll(filepath.Join(toDir, metadataDir), 0700))
+	files, err := ioutil.ReadDir(filepath.Join(fromDir, metadataDir))
+	require.NoError(t, err)
+	for _, f := range files {
+		meta, err := ioutil.ReadFile(filepath.Join(fromDir, metadataDir, f.Name()))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(toDir, metadataDir, f.Name()), meta, 0600))
+	}
+}
+
+// Metadata signed by a repository with no server is written to a directory,
+// and published from there by a repository without any of the keys
+func TestPublishToDirectoryAndPush(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	r, err := NewFileCachedRepository(baseDir, repo.gun, ts.URL, nil, passphraseRetriever, trustpinning.TrustPinConfig{})
+	require.NoError(t, err)
+	offline := r.(*repository)
+	online, _, onlineDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(onlineDir)
+	outDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	// the first publish includes the root, and the files are named as on the
+	// server, with a copy named with each file's checksum
+	require.NoError(t, offline.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	first := filepath.Join(outDir, "first")
+	roles, err := offline.PublishToDirectory(first)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, roles)
+	for _, role := range roles {
+		meta, err := ioutil.ReadFile(filepath.Join(first, role.String()+".json"))
+		require.NoError(t, err)
+		checksum := sha256.Sum256(meta)
+		copied, err := ioutil.ReadFile(filepath.Join(first, utils.ConsistentName(role.String(), checksum[:])+".json"))
+		require.NoError(t, err)
+		require.Equal(t, meta, copied)
+	}
+	// the changes stay staged until they are published
+	cl, err := offline.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+	require.IsType(t, ErrRepositoryNotExist{}, online.Update(false))
+	_, err = offline.PublishToDirectory(first)
+	require.Error(t, err)
+
+	roles, err = online.PushDirectory(first)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, roles)
+	require.Equal(t, []string{"a"}, listTargetNames(t, online))
+	// they were pushed from another repository, so they are cleared by hand
+	require.Len(t, cl.List(), 1)
+	require.NoError(t, cl.Clear(""))
+
+	// once its cache is up to date, the offline repository signs changes on
+	// top of what was pushed
+	copyCachedMetadata(t, onlineDir, baseDir, repo.gun)
+	require.NoError(t, offline.AddTarget(hashedTarget("b", "second"), data.CanonicalTargetsRole))
+	second := filepath.Join(outDir, "second")
+	roles, err = offline.PublishToDirectory(second)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, roles)
+	roles, err = online.PushDirectory(second)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, roles)
+
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.Equal(t, []string{"a", "b"}, listTargetNames(t, otherRepo))
+	require.Equal(t, 3, otherRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Version)
+
+	// pushing the same versions again is rejected
+	_, err = online.PushDirectory(second)
+	require.IsType(t, ErrInvalidSignedMetadata{}, err)
+	require.Contains(t, err.Error(), "not newer than the published version 3")
+	// so are changes signed on top of a cache that is out of date
+	require.NoError(t, offline.AddTarget(hashedTarget("c", "third"), data.CanonicalTargetsRole))
+	third := filepath.Join(outDir, "third")
+	_, err = offline.PublishToDirectory(third)
+	require.NoError(t, err)
+	_, err = online.PushDirectory(third)
+	require.IsType(t, ErrInvalidSignedMetadata{}, err)
+	require.Equal(t, []string{"a", "b"}, listTargetNames(t, otherRepo))
+}
+
+// Metadata that has been changed since it was signed is not pushed
+func TestPushDirectoryRequiresValidSignatures(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	outDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	_, err = repo.PublishToDirectory(outDir)
+	require.NoError(t, err)
+
+	targetsFile := filepath.Join(outDir, "targets.json")
+	meta, err := ioutil.ReadFile(targetsFile)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(targetsFile, []byte(strings.Replace(string(meta), `"a"`, `"z"`, 1)), 0600))
+
+	// the copy named with the old checksum no longer matches
+	_, err = repo.PushDirectory(outDir)
+	require.IsType(t, ErrInvalidSignedMetadata{}, err)
+	require.Contains(t, err.Error(), "is not a copy of targets.json")
+	// the changes stay staged when the push fails
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+
+	files, err := ioutil.ReadDir(outDir)
+	require.NoError(t, err)
+	for _, f := range files {
+		if f.Name() != "targets.json" {
+			require.NoError(t, os.Remove(filepath.Join(outDir, f.Name())))
+		}
+	}
+	_, err = repo.PushDirectory(outDir)
+	require.IsType(t, ErrInvalidSignedMetadata{}, err)
+	require.Empty(t, listTargetNames(t, repo))
+
+	// only the metadata written by PublishToDirectory can be pushed
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "timestamp.json"), meta, 0600))
+	_, err = repo.PushDirectory(outDir)
+	require.IsType(t, ErrInvalidSignedMetadata{}, err)
+	_, err = repo.PushDirectory(filepath.Join(outDir, "missing"))
+	require.Error(t, err)
+}
+
+// With a server, the metadata is signed on top of what has been published
+func TestPublishToDirectoryUpdatesFromServer(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+	other, _, otherDir := newRepoToTestRepo(t, repo, baseDir)
+	require.Equal(t, baseDir, otherDir)
+	require.NoError(t, other.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, other.Publish())
+
+	outDir, err := ioutil.TempDir("", "notary-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "second"), data.CanonicalTargetsRole))
+	roles, err := repo.PublishToDirectory(outDir)
+	require.NoError(t, err)
+	// the server signs the snapshot
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole}, roles)
+
+	// changes staged since the directory was written are left staged when the
+	// ones that were signed are published
+	require.NoError(t, repo.AddTarget(hashedTarget("c", "third"), data.CanonicalTargetsRole))
+	roles, err = repo.PushDirectory(outDir)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole}, roles)
+	require.Equal(t, []string{"a", "b"}, listTargetNames(t, other))
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+	require.Equal(t, "c", cl.List()[0].Path())
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// RenewResult is the outcome of renewing the roles of a repository.  Renewed
+// has the new versions and expiries of the roles that were re-signed, and
+// Skipped has the roles that are expiring but could not be re-signed because
+// not enough of their keys are available locally.
+type RenewResult struct {
+	Renewed []RoleExpiry
+	Skipped []RoleExpiry
+}
+
+// Renew re-signs the metadata for every role which expires within the given
+// duration and which can be signed with the locally available keys, and
+// publishes all of it in a single update.  The snapshot is only renewed if it
+// is signed by the client; roles signed by the server are left to the server.
+// Nothing is published if no role that can be renewed is expiring.
+func (r *repository) Renew(within time.Duration) (*RenewResult, error) {
+	return r.RenewContext(context.Background(), within)
+}
+
+// RenewContext is Renew, abandoning the update and renewal with the context's
+// error if the context is done.  If the update is rejected because another
+// client published in the meantime, the renewal is retried as for a publish.
+func (r *repository) RenewContext(ctx context.Context, within time.Duration) (*RenewResult, error) {
+	return r.renewWithRetry(ctx, func(current RoleExpiry) bool {
+		return current.Expires.Before(time.Now().Add(within))
+	})
+}
+
+// RenewRoles re-signs the metadata for the given roles, whether or not they
+// are expiring, so that they are signed with the configured expiries, and
+// publishes all of it in a single update.  As for Renew, the roles that
+// cannot be signed with the locally available keys are skipped, as is the
+// snapshot if it is signed by the server, and roles that have no metadata are
+// left out.
+func (r *repository) RenewRoles(roles ...data.RoleName) (*RenewResult, error) {
+	return r.RenewRolesContext(context.Background(), roles...)
+}
+
+// RenewRolesContext is RenewRoles with a context for the update and renewal,
+// retried as RenewContext is
+func (r *repository) RenewRolesContext(ctx context.Context, roles ...data.RoleName) (*RenewResult, error) {
+	due := make(map[data.RoleName]bool, len(roles))
+	for _, role := range roles {
+		due[role] = true
+	}
+	return r.renewWithRetry(ctx, func(current RoleExpiry) bool {
+		return due[current.Role]
+	})
+}
+
+func (r *repository) renewWithRetry(ctx context.Context, due func(RoleExpiry) bool) (*RenewResult, error) {
+	var result *RenewResult
+	err := r.retryOnConflict(ctx, func(bool) error {
+		var err error
+		result, err = r.renew(ctx, due)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// renew re-signs the roles that are due to be renewed
+func (r *repository) renew(ctx context.Context, due func(RoleExpiry) bool) (*RenewResult, error) {
+	if err := r.UpdateContext(ctx, true); err != nil {
+		return nil, err
+	}
+	expected := publishedVersions(r.tufRepo, false)
+
+	available := r.cryptoService.ListAllKeys()
+	result := &RenewResult{}
+	var toRenew []data.RoleName
+	for _, current := range listRoleExpiries(r.tufRepo) {
+		if !due(current) {
+			continue
+		}
+		switch {
+		case canSignLocally(r.tufRepo, current.Role, available):
+			toRenew = append(toRenew, current.Role)
+		case current.Role != data.CanonicalSnapshotRole:
+			result.Skipped = append(result.Skipped, current)
+		}
+	}
+	if len(toRenew) == 0 {
+		logrus.Debugf("no roles of %s that can be signed locally are due to be renewed", r.gun)
+		return result, nil
+	}
+
+	updatedFiles := make(map[data.RoleName][]byte)
+	for _, role := range toRenew {
+		var (
+			legacyKeys data.KeyList
+			err        error
+		)
+		switch role {
+		case data.CanonicalSnapshotRole:
+			// re-signed below, once everything it lists has been
+			continue
+		case data.CanonicalRootRole:
+			legacyKeys, err = r.oldKeysForLegacyClientSupport(ctx, r.LegacyVersions, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if updatedFiles[role], err = serializeCanonicalRole(r.tufRepo, role, legacyKeys, r.expiries); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.publishSigned(ctx, updatedFiles, expected); err != nil {
+		return nil, err
+	}
+
+	for _, renewed := range listRoleExpiries(r.tufRepo) {
+		if _, ok := updatedFiles[renewed.Role]; ok {
+			result.Renewed = append(result.Renewed, renewed)
+		}
+	}
+	return result, nil
+}
+
+// canSignLocally is whether enough of the keys for a role to meet its
+// threshold are among the available keys, which are keyed by canonical ID
+func canSignLocally(repo *tuf.Repo, role data.RoleName, available map[string]data.RoleName) bool {
+	keys, threshold, err := roleKeys(repo, role, available)
+	if err != nil {
+		return false
+	}
+	local := 0
+	for _, key := range keys {
+		if key.Local {
+			local++
+		}
+	}
+	return local >= threshold
+}
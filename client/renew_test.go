@@ -0,0 +1,127 @@
+package client
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func renewedRoles(expiries []RoleExpiry) []data.RoleName {
+	roles := make([]data.RoleName, 0, len(expiries))
+	for _, e := range expiries {
+		roles = append(roles, e.Role)
+	}
+	return roles
+}
+
+// Renewing re-signs the roles that are expiring soon and that can be signed
+// locally, along with the snapshot, and reports the roles that cannot be
+func TestRenewExpiringRoles(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, 2*notary.Day))
+	require.NoError(t, repo.SetExpiry(data.CanonicalSnapshotRole, 2*notary.Day))
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.Update(false))
+	published := make(map[data.RoleName]RoleExpiry)
+	for _, e := range listRoleExpiries(repo.tufRepo) {
+		published[e.Role] = e
+	}
+
+	// nothing expires within a day
+	result, err := repo.Renew(notary.Day)
+	require.NoError(t, err)
+	require.Empty(t, result.Renewed)
+	require.Empty(t, result.Skipped)
+
+	// renewed roles are signed with the configured expiries
+	result, err = repo.Renew(7 * notary.Day)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, renewedRoles(result.Renewed))
+	require.Empty(t, result.Skipped)
+	for _, renewed := range result.Renewed {
+		require.Equal(t, published[renewed.Role].Version+1, renewed.Version)
+		require.WithinDuration(t, time.Now().Add(2*notary.Day), renewed.Expires, time.Minute)
+	}
+
+	// what was published is what was reported
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.NoError(t, otherRepo.Update(false))
+	current := make(map[data.RoleName]RoleExpiry)
+	for _, e := range listRoleExpiries(otherRepo.tufRepo) {
+		current[e.Role] = e
+	}
+	for _, renewed := range result.Renewed {
+		require.Equal(t, renewed.Version, current[renewed.Role].Version)
+		require.WithinDuration(t, renewed.Expires, current[renewed.Role].Expires, time.Second)
+	}
+	require.Equal(t, published[data.CanonicalRootRole].Version, current[data.CanonicalRootRole].Version)
+
+	// without the targets key, only the snapshot can be renewed
+	for _, keyID := range repo.GetCryptoService().ListKeys(data.CanonicalTargetsRole) {
+		require.NoError(t, repo.GetCryptoService().RemoveKey(keyID))
+	}
+	result, err = repo.Renew(7 * notary.Day)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalSnapshotRole}, renewedRoles(result.Renewed))
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole}, renewedRoles(result.Skipped))
+	require.Equal(t, current[data.CanonicalTargetsRole].Version, result.Skipped[0].Version)
+	require.Equal(t, current[data.CanonicalSnapshotRole].Version+1, result.Renewed[0].Version)
+}
+
+// A snapshot signed by the server is neither renewed nor reported as skipped,
+// since the server re-signs it along with anything that is renewed
+func TestRenewWithServerManagedSnapshot(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, true)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, 2*notary.Day))
+	require.NoError(t, repo.Publish())
+
+	// everything, including the snapshot, expires within ten years
+	result, err := repo.Renew(10 * notary.Year)
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole}, renewedRoles(result.Renewed))
+	require.Empty(t, result.Skipped)
+	require.Equal(t, 2, result.Renewed[0].Version)
+}
+
+// Renewing given roles re-signs them with the configured expiries, although
+// they are not expiring
+func TestRenewRoles(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.Publish())
+
+	result, err := repo.RenewRoles()
+	require.NoError(t, err)
+	require.Empty(t, result.Renewed)
+	require.Empty(t, result.Skipped)
+
+	require.NoError(t, repo.SetExpiry(data.CanonicalTargetsRole, 30*notary.Day))
+	result, err = repo.RenewRoles(data.CanonicalTargetsRole, "targets/missing")
+	require.NoError(t, err)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, renewedRoles(result.Renewed))
+	require.Empty(t, result.Skipped)
+	require.Equal(t, 3, result.Renewed[0].Version)
+	require.WithinDuration(t, time.Now().Add(30*notary.Day), result.Renewed[0].Expires, time.Minute)
+
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.NoError(t, otherRepo.Update(false))
+	require.Equal(t, 1, otherRepo.tufRepo.Root.Signed.Version)
+	require.Equal(t, 3, otherRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Version)
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"golang.org/x/net/context"
+)
+
+// RollbackResult is the outcome of rolling back the targets of a role.
+// Version is the version that was published with the targets of the version
+// that was rolled back to, and Targets has the targets that were added,
+// removed or changed to get there from the version before it.
+type RollbackResult struct {
+	Role         data.RoleName
+	RolledBackTo int
+	Version      int
+	Targets      []TargetDiff
+}
+
+// Rollback restores the targets of a targets or delegation role to those of an
+// earlier published version.  The earlier version is downloaded from the
+// server and must be signed by enough of the keys that the current root, or
+// for a delegation the current delegating role, trusts for the role.  Its
+// targets are then published as a new version, signed with the current keys,
+// so that clients accept it as newer than the version being replaced.  The
+// role's delegations are left as they are now.  Nothing is published if the
+// targets are already the same.  Unpublished changes are not affected.
+func (r *repository) Rollback(role data.RoleName, version int) (*RollbackResult, error) {
+	return r.RollbackContext(context.Background(), role, version)
+}
+
+// RollbackContext is Rollback with a context for the requests to the server.
+// If the update is rejected because another client published in the
+// meantime, the rollback is retried as for a publish.
+func (r *repository) RollbackContext(ctx context.Context, role data.RoleName, version int) (*RollbackResult, error) {
+	var result *RollbackResult
+	err := r.retryOnConflict(ctx, func(bool) error {
+		var err error
+		result, err = r.rollback(ctx, role, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *repository) rollback(ctx context.Context, role data.RoleName, version int) (*RollbackResult, error) {
+	if role != data.CanonicalTargetsRole && !data.IsDelegation(role) {
+		return nil, data.ErrInvalidRole{Role: role, Reason: "only the targets and delegation roles can be rolled back"}
+	}
+	if err := r.UpdateContext(ctx, true); err != nil {
+		return nil, err
+	}
+	expected := publishedVersions(r.tufRepo, false)
+	current, ok := expected[role]
+	if !ok {
+		return nil, data.ErrInvalidRole{Role: role, Reason: "no metadata has been published for the role"}
+	}
+	if version < 1 || version >= current {
+		return nil, ErrInvalidRoleVersion{
+			Role:    role,
+			Version: version,
+			msg:     fmt.Sprintf("only a version before the current version %d can be rolled back to", current),
+		}
+	}
+
+	_, old, err := r.getRoleVersion(ctx, role, version)
+	if err != nil {
+		return nil, err
+	}
+	var trusted data.BaseRole
+	var paths data.DelegationRole
+	if role == data.CanonicalTargetsRole {
+		trusted, err = r.tufRepo.GetBaseRole(role)
+	} else {
+		paths, err = r.tufRepo.GetDelegationRole(role)
+		trusted = paths.BaseRole
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := signed.VerifySignatures(old, trusted); err != nil {
+		return nil, ErrInvalidRoleVersion{
+			Role:    role,
+			Version: version,
+			msg:     fmt.Sprintf("it is not signed by the role's current keys: %s", err),
+		}
+	}
+	oldTargets, err := data.TargetsFromSigned(old, role)
+	if err != nil {
+		return nil, err
+	}
+	if data.IsDelegation(role) {
+		// the role may no longer be trusted with all of the paths it was
+		for name := range oldTargets.Signed.Targets {
+			if !paths.CheckPaths(name) {
+				return nil, ErrInvalidRoleVersion{
+					Role:    role,
+					Version: version,
+					msg:     fmt.Sprintf("the role is no longer trusted for the target %s", name),
+				}
+			}
+		}
+	}
+
+	targets := r.tufRepo.Targets[role]
+	result := &RollbackResult{
+		Role:         role,
+		RolledBackTo: version,
+		Version:      current,
+		Targets:      diffTargets(targets.Signed.Targets, oldTargets.Signed.Targets),
+	}
+	if len(result.Targets) == 0 {
+		logrus.Debugf("the targets of %s are already those of version %d", role, version)
+		return result, nil
+	}
+
+	targets.Signed.Targets = oldTargets.Signed.Targets
+	targets.Dirty = true
+	updatedFiles := make(map[data.RoleName][]byte)
+	if updatedFiles[role], err = serializeCanonicalRole(r.tufRepo, role, nil, r.expiries); err != nil {
+		return nil, err
+	}
+	if err := r.publishSigned(ctx, updatedFiles, expected); err != nil {
+		return nil, err
+	}
+	result.Version = targets.Signed.Version
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func listTargetNames(t *testing.T, repo *repository) []string {
+	targets, err := repo.ListTargets()
+	require.NoError(t, err)
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rolling back publishes the targets of an earlier version as a new version,
+// which other clients accept
+func TestRollbackTargets(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+
+	require.NoError(t, repo.RemoveTarget("a", data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "bad"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.AddTarget(hashedTarget("c", "bad"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+	// unpublished changes are left alone
+	require.NoError(t, repo.AddTarget(hashedTarget("d", "pending"), data.CanonicalTargetsRole))
+
+	result, err := repo.Rollback(data.CanonicalTargetsRole, 2)
+	require.NoError(t, err)
+	require.Equal(t, data.CanonicalTargetsRole, result.Role)
+	require.Equal(t, 2, result.RolledBackTo)
+	require.Equal(t, 4, result.Version)
+	require.Len(t, result.Targets, 3)
+	for i, expected := range []TargetDiff{
+		{Name: "a", Change: DiffAdded},
+		{Name: "b", Change: DiffChanged},
+		{Name: "c", Change: DiffRemoved},
+	} {
+		require.Equal(t, expected.Name, result.Targets[i].Name)
+		require.Equal(t, expected.Change, result.Targets[i].Change)
+	}
+	cl, err := repo.GetChangelist()
+	require.NoError(t, err)
+	require.Len(t, cl.List(), 1)
+
+	otherRepo, _, otherDir := newRepoToTestRepo(t, repo, "")
+	defer os.RemoveAll(otherDir)
+	require.Equal(t, []string{"a", "b"}, listTargetNames(t, otherRepo))
+	target, err := otherRepo.GetTargetByName("b")
+	require.NoError(t, err)
+	require.Equal(t, int64(len("first")), target.Length)
+	require.Equal(t, 4, otherRepo.tufRepo.Targets[data.CanonicalTargetsRole].Signed.Version)
+
+	// rolling back to the same targets again publishes nothing
+	result, err = repo.Rollback(data.CanonicalTargetsRole, 2)
+	require.NoError(t, err)
+	require.Empty(t, result.Targets)
+	require.Equal(t, 4, result.Version)
+
+	for _, version := range []int{0, 4, 5} {
+		_, err = repo.Rollback(data.CanonicalTargetsRole, version)
+		require.IsType(t, ErrInvalidRoleVersion{}, err)
+	}
+	_, err = repo.Rollback(data.CanonicalRootRole, 1)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	_, err = repo.Rollback("targets/nope", 1)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+// A version that is not signed by the current targets keys cannot be rolled
+// back to, since clients would not trust it
+func TestRollbackRequiresCurrentKeys(t *testing.T) {
+	ts := fullTestServer(t)
+	defer ts.Close()
+
+	repo, _, baseDir := initializeRepo(t, data.ECDSAKey, "docker.com/notary", ts.URL, false)
+	defer os.RemoveAll(baseDir)
+	require.NoError(t, repo.AddTarget(hashedTarget("a", "first"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+	require.NoError(t, repo.AddTarget(hashedTarget("b", "second"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+
+	require.NoError(t, repo.RotateKey(data.CanonicalTargetsRole, false, nil))
+	require.NoError(t, repo.AddTarget(hashedTarget("c", "third"), data.CanonicalTargetsRole))
+	require.NoError(t, repo.Publish())
+
+	_, err := repo.Rollback(data.CanonicalTargetsRole, 2)
+	require.IsType(t, ErrInvalidRoleVersion{}, err)
+	require.Contains(t, err.Error(), "not signed by the role's current keys")
+	require.Equal(t, []string{"a", "b", "c"}, listTargetNames(t, repo))
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
@@ -11,6 +12,7 @@ import (
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/signed"
+	"golang.org/x/net/context"
 )
 
 // tufClient is a usability wrapper around a raw TUF repo
@@ -19,20 +21,46 @@ type tufClient struct {
 	cache      store.MetadataStore
 	oldBuilder tuf.RepoBuilder
 	newBuilder tuf.RepoBuilder
+	workers    int // number of delegations to download concurrently
+
+	// if limited, only delegations whose paths can contain targetName are downloaded
+	limited    bool
+	targetName string
 }
 
 // newTufClient initialized a tufClient with the given repo, remote source of content, and cache
-func newTufClient(oldBuilder, newBuilder tuf.RepoBuilder, remote store.RemoteStore, cache store.MetadataStore) *tufClient {
+func newTufClient(oldBuilder, newBuilder tuf.RepoBuilder, remote store.RemoteStore, cache store.MetadataStore, workers int) *tufClient {
 	return &tufClient{
 		oldBuilder: oldBuilder,
 		newBuilder: newBuilder,
 		remote:     remote,
 		cache:      cache,
+		workers:    workers,
 	}
 }
 
-// Update performs an update to the TUF repo as defined by the TUF spec
-func (c *tufClient) Update() (*tuf.Repo, *tuf.Repo, error) {
+// limitToTarget restricts the delegated targets metadata downloaded by Update to
+// the delegations whose paths can contain the given target name.
+func (c *tufClient) limitToTarget(name string) {
+	c.limited = true
+	c.targetName = name
+}
+
+// prefetchedMeta is the result of fetching a role's metadata before it can be
+// verified.  The cached copy is only fetched from the remote if it does not
+// match the checksums we expect.
+type prefetchedMeta struct {
+	cached    []byte
+	cachedErr error
+	fetched   bool // whether the remote copy was downloaded
+	remote    []byte
+	remoteErr error
+}
+
+// Update performs an update to the TUF repo as defined by the TUF spec.  If the
+// context is done, the update stops with the context's error, leaving only
+// verified metadata in the cache.
+func (c *tufClient) Update(ctx context.Context) (*tuf.Repo, *tuf.Repo, error) {
 	// 1. Get timestamp
 	//   a. If timestamp error (verification, expired, etc...) download new root and return to 1.
 	// 2. Check if local snapshot is up to date
@@ -42,38 +70,42 @@ func (c *tufClient) Update() (*tuf.Repo, *tuf.Repo, error) {
 	//   a. If incorrect, download new root and return to 1.
 	// 4. Iteratively download and search targets and delegations to find target meta
 	logrus.Debug("updating TUF client")
-	err := c.update()
+	err := c.update(ctx)
 	if err != nil {
+		// a cancelled update should not be retried
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
 		logrus.Debug("Error occurred. Root will be downloaded and another update attempted")
 		logrus.Debug("Resetting the TUF builder...")
 
 		c.newBuilder = c.newBuilder.BootstrapNewBuilder()
 
-		if err := c.updateRoot(); err != nil {
+		if err := c.updateRoot(ctx); err != nil {
 			logrus.Debug("Client Update (Root): ", err)
 			return nil, nil, err
 		}
 		// If we error again, we now have the latest root and just want to fail
 		// out as there's no expectation the problem can be resolved automatically
 		logrus.Debug("retrying TUF client update")
-		if err := c.update(); err != nil {
+		if err := c.update(ctx); err != nil {
 			return nil, nil, err
 		}
 	}
 	return c.newBuilder.Finish()
 }
 
-func (c *tufClient) update() error {
-	if err := c.downloadTimestamp(); err != nil {
+func (c *tufClient) update(ctx context.Context) error {
+	if err := c.downloadTimestamp(ctx); err != nil {
 		logrus.Debugf("Client Update (Timestamp): %s", err.Error())
 		return err
 	}
-	if err := c.downloadSnapshot(); err != nil {
+	if err := c.downloadSnapshot(ctx); err != nil {
 		logrus.Debugf("Client Update (Snapshot): %s", err.Error())
 		return err
 	}
 	// will always need top level targets at a minimum
-	if err := c.downloadTargets(); err != nil {
+	if err := c.downloadTargets(ctx); err != nil {
 		logrus.Debugf("Client Update (Targets): %s", err.Error())
 		return err
 	}
@@ -82,13 +114,13 @@ func (c *tufClient) update() error {
 
 // updateRoot checks if there is a newer version of the root available, and if so
 // downloads all intermediate root files to allow proper key rotation.
-func (c *tufClient) updateRoot() error {
+func (c *tufClient) updateRoot(ctx context.Context) error {
 	// Get current root version
 	currentRootConsistentInfo := c.oldBuilder.GetConsistentInfo(data.CanonicalRootRole)
 	currentVersion := c.oldBuilder.GetLoadedVersion(currentRootConsistentInfo.RoleName)
 
 	// Get new root version
-	raw, err := c.downloadRoot()
+	raw, err := c.downloadRoot(ctx)
 
 	switch err.(type) {
 	case *trustpinning.ErrRootRotationFail:
@@ -126,7 +158,7 @@ func (c *tufClient) updateRoot() error {
 	newestVersion := newestRoot.Signed.SignedCommon.Version
 
 	// Update from current + 1 (current already loaded) to newest - 1 (newest loaded below)
-	if err := c.updateRootVersions(currentVersion+1, newestVersion-1); err != nil {
+	if err := c.updateRootVersions(ctx, currentVersion+1, newestVersion-1); err != nil {
 		return err
 	}
 
@@ -147,13 +179,13 @@ func (c *tufClient) updateRoot() error {
 
 // updateRootVersions updates the root from it's current version to a target, rotating keys
 // as they are found
-func (c *tufClient) updateRootVersions(fromVersion, toVersion int) error {
+func (c *tufClient) updateRootVersions(ctx context.Context, fromVersion, toVersion int) error {
 	for v := fromVersion; v <= toVersion; v++ {
 		logrus.Debugf("updating root from version %d to version %d, currently fetching %d", fromVersion, toVersion, v)
 
 		versionedRole := fmt.Sprintf("%d.%s", v, data.CanonicalRootRole)
 
-		raw, err := c.remote.GetSized(versionedRole, -1)
+		raw, err := store.GetSizedContext(ctx, c.remote, versionedRole, -1)
 		if err != nil {
 			logrus.Debugf("error downloading %s: %s", versionedRole, err)
 			return err
@@ -170,14 +202,14 @@ func (c *tufClient) updateRootVersions(fromVersion, toVersion int) error {
 // downloadTimestamp is responsible for downloading the timestamp.json
 // Timestamps are special in that we ALWAYS attempt to download and only
 // use cache if the download fails (and the cache is still valid).
-func (c *tufClient) downloadTimestamp() error {
+func (c *tufClient) downloadTimestamp(ctx context.Context) error {
 	logrus.Debug("Loading timestamp...")
 	role := data.CanonicalTimestampRole
 	consistentInfo := c.newBuilder.GetConsistentInfo(role)
 
 	// always get the remote timestamp, since it supersedes the local one
 	cachedTS, cachedErr := c.cache.GetSized(role.String(), notary.MaxTimestampSize)
-	_, remoteErr := c.tryLoadRemote(consistentInfo, cachedTS)
+	_, remoteErr := c.tryLoadRemote(ctx, consistentInfo, cachedTS)
 
 	// check that there was no remote error, or if there was a network problem
 	// If there was a validation error, we should error out so we can download a new root or fail the update
@@ -206,23 +238,26 @@ func (c *tufClient) downloadTimestamp() error {
 }
 
 // downloadSnapshot is responsible for downloading the snapshot.json
-func (c *tufClient) downloadSnapshot() error {
+func (c *tufClient) downloadSnapshot(ctx context.Context) error {
 	logrus.Debug("Loading snapshot...")
 	role := data.CanonicalSnapshotRole
 	consistentInfo := c.newBuilder.GetConsistentInfo(role)
 
-	_, err := c.tryLoadCacheThenRemote(consistentInfo)
+	_, err := c.tryLoadCacheThenRemote(ctx, consistentInfo)
 	return err
 }
 
 // downloadTargets downloads all targets and delegated targets for the repository.
 // It uses a pre-order tree traversal as it's necessary to download parents first
-// to obtain the keys to validate children.
-func (c *tufClient) downloadTargets() error {
+// to obtain the keys to validate children.  Sibling delegations are fetched
+// concurrently once their parent has been verified, but are still verified, and
+// their errors reported, in traversal order.
+func (c *tufClient) downloadTargets(ctx context.Context) error {
 	toDownload := []data.DelegationRole{{
 		BaseRole: data.BaseRole{Name: data.CanonicalTargetsRole},
 		Paths:    []string{""},
 	}}
+	prefetched := make(map[data.RoleName]*prefetchedMeta)
 
 	for len(toDownload) > 0 {
 		role := toDownload[0]
@@ -234,7 +269,8 @@ func (c *tufClient) downloadTargets() error {
 			continue
 		}
 
-		children, err := c.getTargetsFile(role, consistentInfo)
+		children, err := c.getTargetsFile(ctx, role, consistentInfo, prefetched[role.Name])
+		delete(prefetched, role.Name)
 		switch err.(type) {
 		case signed.ErrExpired, signed.ErrRoleThreshold:
 			if role.Name == data.CanonicalTargetsRole {
@@ -243,6 +279,10 @@ func (c *tufClient) downloadTargets() error {
 			logrus.Warnf("Error getting %s: %s", role.Name, err)
 			break
 		case nil:
+			if c.limited {
+				children = rolesForTarget(children, c.targetName)
+			}
+			c.prefetchTargetsFiles(ctx, children, prefetched)
 			toDownload = append(children, toDownload...)
 		default:
 			return err
@@ -251,23 +291,102 @@ func (c *tufClient) downloadTargets() error {
 	return nil
 }
 
-func (c tufClient) getTargetsFile(role data.DelegationRole, ci tuf.ConsistentInfo) ([]data.DelegationRole, error) {
+// rolesForTarget filters the given delegations down to those whose paths can
+// contain the target name
+func rolesForTarget(roles []data.DelegationRole, name string) []data.DelegationRole {
+	if name == "" {
+		return roles
+	}
+	var matching []data.DelegationRole
+	for _, role := range roles {
+		if role.CheckPaths(name) {
+			matching = append(matching, role)
+		} else {
+			logrus.Debugf("skipping %s because it cannot contain %s", role.Name, name)
+		}
+	}
+	return matching
+}
+
+// prefetchTargetsFiles fetches the metadata for the given sibling delegations
+// using up to c.workers concurrent downloads, and adds the results to prefetched.
+// Nothing is verified or written to the cache here.
+func (c *tufClient) prefetchTargetsFiles(ctx context.Context, roles []data.DelegationRole, prefetched map[data.RoleName]*prefetchedMeta) {
+	var infos []tuf.ConsistentInfo
+	for _, role := range roles {
+		consistentInfo := c.newBuilder.GetConsistentInfo(role.Name)
+		if consistentInfo.ChecksumKnown() {
+			infos = append(infos, consistentInfo)
+		}
+	}
+	workers := c.workers
+	if workers > len(infos) {
+		workers = len(infos)
+	}
+	if workers < 2 {
+		// not worth fetching ahead; the roles will be downloaded as they are verified
+		return
+	}
+
+	results := make([]*prefetchedMeta, len(infos))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = c.prefetchTargetsFile(ctx, infos[i])
+			}
+		}()
+	}
+	for i := range infos {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for i, consistentInfo := range infos {
+		prefetched[consistentInfo.RoleName] = results[i]
+	}
+}
+
+func (c *tufClient) prefetchTargetsFile(ctx context.Context, consistentInfo tuf.ConsistentInfo) *prefetchedMeta {
+	p := &prefetchedMeta{}
+	p.cached, p.cachedErr = c.cache.GetSized(consistentInfo.RoleName.String(), consistentInfo.Length())
+	if p.cachedErr == nil && consistentInfo.CheckHashes(p.cached) == nil {
+		return p
+	}
+	p.fetched = true
+	p.remote, p.remoteErr = store.GetSizedContext(ctx, c.remote, consistentInfo.ConsistentName(), consistentInfo.Length())
+	return p
+}
+
+func (c tufClient) getTargetsFile(ctx context.Context, role data.DelegationRole, ci tuf.ConsistentInfo, p *prefetchedMeta) ([]data.DelegationRole, error) {
 	logrus.Debugf("Loading %s...", role.Name)
 	tgs := &data.SignedTargets{}
 
-	raw, err := c.tryLoadCacheThenRemote(ci)
+	var (
+		raw []byte
+		err error
+	)
+	if p != nil {
+		raw, err = c.loadPrefetched(ctx, ci, p)
+	} else {
+		raw, err = c.tryLoadCacheThenRemote(ctx, ci)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// we know it unmarshals because if `tryLoadCacheThenRemote` didn't fail, then
+	// we know it unmarshals because if loading didn't fail, then
 	// the raw has already been loaded into the builder
 	json.Unmarshal(raw, tgs)
 	return tgs.GetValidDelegations(role), nil
 }
 
 // downloadRoot is responsible for downloading the root.json
-func (c *tufClient) downloadRoot() ([]byte, error) {
+func (c *tufClient) downloadRoot(ctx context.Context) ([]byte, error) {
 	role := data.CanonicalRootRole
 	consistentInfo := c.newBuilder.GetConsistentInfo(role)
 
@@ -279,16 +398,16 @@ func (c *tufClient) downloadRoot() ([]byte, error) {
 		// get the cached root, if it exists, just for version checking
 		cachedRoot, _ := c.cache.GetSized(role.String(), -1)
 		// prefer to download a new root
-		return c.tryLoadRemote(consistentInfo, cachedRoot)
+		return c.tryLoadRemote(ctx, consistentInfo, cachedRoot)
 	}
-	return c.tryLoadCacheThenRemote(consistentInfo)
+	return c.tryLoadCacheThenRemote(ctx, consistentInfo)
 }
 
-func (c *tufClient) tryLoadCacheThenRemote(consistentInfo tuf.ConsistentInfo) ([]byte, error) {
+func (c *tufClient) tryLoadCacheThenRemote(ctx context.Context, consistentInfo tuf.ConsistentInfo) ([]byte, error) {
 	cachedTS, err := c.cache.GetSized(consistentInfo.RoleName.String(), consistentInfo.Length())
 	if err != nil {
 		logrus.Debugf("no %s in cache, must download", consistentInfo.RoleName)
-		return c.tryLoadRemote(consistentInfo, nil)
+		return c.tryLoadRemote(ctx, consistentInfo, nil)
 	}
 
 	if err = c.newBuilder.Load(consistentInfo.RoleName, cachedTS, 1, false); err == nil {
@@ -297,16 +416,48 @@ func (c *tufClient) tryLoadCacheThenRemote(consistentInfo tuf.ConsistentInfo) ([
 	}
 
 	logrus.Debugf("cached %s is invalid (must download): %s", consistentInfo.RoleName, err)
-	return c.tryLoadRemote(consistentInfo, cachedTS)
+	return c.tryLoadRemote(ctx, consistentInfo, cachedTS)
+}
+
+// loadPrefetched behaves like tryLoadCacheThenRemote, but uses metadata that
+// has already been fetched where it can.
+func (c *tufClient) loadPrefetched(ctx context.Context, consistentInfo tuf.ConsistentInfo, p *prefetchedMeta) ([]byte, error) {
+	if p.cachedErr != nil {
+		logrus.Debugf("no %s in cache, must download", consistentInfo.RoleName)
+		p.cached = nil
+	} else {
+		err := c.newBuilder.Load(consistentInfo.RoleName, p.cached, 1, false)
+		if err == nil {
+			logrus.Debugf("successfully verified cached %s", consistentInfo.RoleName)
+			return p.cached, nil
+		}
+		logrus.Debugf("cached %s is invalid (must download): %s", consistentInfo.RoleName, err)
+	}
+
+	if !p.fetched {
+		return c.tryLoadRemote(ctx, consistentInfo, p.cached)
+	}
+	if p.remoteErr != nil {
+		logrus.Debugf("error downloading %s: %s", consistentInfo.ConsistentName(), p.remoteErr)
+		return p.cached, p.remoteErr
+	}
+	return c.loadRemote(consistentInfo, p.remote, p.cached)
 }
 
-func (c *tufClient) tryLoadRemote(consistentInfo tuf.ConsistentInfo, old []byte) ([]byte, error) {
+func (c *tufClient) tryLoadRemote(ctx context.Context, consistentInfo tuf.ConsistentInfo, old []byte) ([]byte, error) {
 	consistentName := consistentInfo.ConsistentName()
-	raw, err := c.remote.GetSized(consistentName, consistentInfo.Length())
+	raw, err := store.GetSizedContext(ctx, c.remote, consistentName, consistentInfo.Length())
 	if err != nil {
 		logrus.Debugf("error downloading %s: %s", consistentName, err)
 		return old, err
 	}
+	return c.loadRemote(consistentInfo, raw, old)
+}
+
+// loadRemote verifies downloaded metadata, using the old data to check that the
+// version has not gone backwards, and writes it to the cache if it is valid.
+func (c *tufClient) loadRemote(consistentInfo tuf.ConsistentInfo, raw, old []byte) ([]byte, error) {
+	consistentName := consistentInfo.ConsistentName()
 
 	// try to load the old data into the old builder - only use it to validate
 	// versions if it loads successfully.  If it errors, then the loaded version
@@ -4,14 +4,25 @@ import (
 	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/tuf"
 	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
 )
 
 // Witness creates change objects to witness (i.e. re-sign) the given
 // roles on the next publish. One change is created per role
 func (r *repository) Witness(roles ...data.RoleName) ([]data.RoleName, error) {
+	return r.WitnessContext(context.Background(), roles...)
+}
+
+// WitnessContext is Witness, stopping with the context's error before adding
+// the change for the next role if the context is done.  The changes for the
+// roles that are returned have been added to the changelist.
+func (r *repository) WitnessContext(ctx context.Context, roles ...data.RoleName) ([]data.RoleName, error) {
 	var err error
 	successful := make([]data.RoleName, 0, len(roles))
 	for _, role := range roles {
+		if err = ctx.Err(); err != nil {
+			break
+		}
 		// scope is role
 		c := changelist.NewTUFChange(
 			changelist.ActionUpdate,
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"gopkg.in/yaml.v2"
+)
+
+var cmdApplyTemplate = usageTemplate{
+	Use:   "apply -f <file>",
+	Short: "Brings a trusted collection to the state declared in a configuration file.",
+	Long:  "Reads the desired state of a trusted collection from a YAML configuration file: its Globally Unique Name, its delegation roles with their keys, paths and thresholds, the expiries to sign with, and whether the server manages the snapshot key. The changes that bring the trusted collection to that state are worked out from the published metadata, shown as they would be published, and then published. Roles whose published metadata was signed with an expiry other than the declared one are re-signed with it. Delegations that are not declared are removed, apart from hashed bin delegations. A trusted collection that has not been initialized is initialized first.",
+}
+
+type applyCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+
+	file   string
+	dryRun bool
+}
+
+// repoConfig is the desired state of a trusted collection, as read by
+// `notary apply`
+type repoConfig struct {
+	GUN           string             `yaml:"gun"`
+	ServerManaged []string           `yaml:"server_managed"`
+	Expiry        map[string]string  `yaml:"expiry"`
+	Delegations   []delegationConfig `yaml:"delegations"`
+}
+
+type delegationConfig struct {
+	Name string `yaml:"name"`
+	// Keys are files with PEM encoded public keys or certificates, relative to
+	// the configuration file
+	Keys        []string `yaml:"keys"`
+	Threshold   int      `yaml:"threshold"`
+	Paths       []string `yaml:"paths"`
+	AllPaths    bool     `yaml:"all_paths"`
+	PathType    string   `yaml:"path_type"`
+	Terminating bool     `yaml:"terminating"`
+}
+
+// applyResult is the output form of `notary apply`
+type applyResult struct {
+	GUN         data.GUN       `json:"gun"`
+	Initialized bool           `json:"initialized"`
+	Delegations []roleDiffInfo `json:"delegations"`
+	// SnapshotKey is who the snapshot key is rotated to, "server" or "client",
+	// if it is rotated
+	SnapshotKey string         `json:"snapshot_key,omitempty"`
+	Roles       []rolePlanInfo `json:"roles"`
+	// Expiries are the roles that are re-signed because they were signed with
+	// an expiry other than the declared one
+	Expiries  []expiryDiffInfo `json:"expiries"`
+	Published bool             `json:"published"`
+}
+
+type expiryDiffInfo struct {
+	Role      data.RoleName `json:"role"`
+	Published time.Time     `json:"published"`
+	Expires   time.Time     `json:"expires"`
+	// Expiry is the declared expiry, as it is in the configuration file
+	Expiry string `json:"expiry"`
+}
+
+// expiryTolerance is how far the time between when a role's metadata was
+// published and when it expires can be from the declared expiry before the
+// role is re-signed, since the metadata is signed a little before the server
+// stores it
+const expiryTolerance = time.Hour
+
+func (a *applyCommander) GetCommand() *cobra.Command {
+	cmd := cmdApplyTemplate.ToCommand(a.apply)
+	cmd.Flags().StringVarP(&a.file, "file", "f", "", "YAML file declaring the desired state of the trusted collection")
+	cmd.Flags().BoolVar(&a.dryRun, "dry-run", false, "Show the changes that would be published, without publishing or staging anything")
+	return cmd
+}
+
+func (a *applyCommander) apply(cmd *cobra.Command, args []string) (err error) {
+	if a.file == "" {
+		cmd.Usage()
+		return fmt.Errorf("Must specify the configuration file to apply with -f")
+	}
+	config, err := a.configGetter()
+	if err != nil {
+		return err
+	}
+	repoConf, err := readRepoConfig(a.file)
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(repoConf.GUN)
+	specs, err := repoConf.delegationSpecs(filepath.Dir(a.file))
+	if err != nil {
+		return err
+	}
+	serverManagedSnapshot, err := repoConf.serverManagesSnapshot()
+	if err != nil {
+		return err
+	}
+	if err := setExpiryFlags(config, repoConf.expiries()); err != nil {
+		return fmt.Errorf("invalid expiry in %s: %v", a.file, err)
+	}
+
+	permission := readWrite
+	if a.dryRun {
+		permission = readOnly
+	}
+	fact := ConfigureRepo(config, a.retriever, true, permission)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	// the plan is what publishing the changelist would do, so it must only
+	// have the changes staged here
+	repoChanges, err := nRepo.GetChangelist()
+	if err != nil {
+		return err
+	}
+	if len(repoChanges.List()) > 0 {
+		return fmt.Errorf("%s has unpublished changes: publish or reset them before applying %s", gun, a.file)
+	}
+	// a dry run plans the changes in memory, so nothing is staged at all
+	cl := repoChanges
+	if a.dryRun {
+		cl = changelist.NewMemChangelist()
+	}
+	defer func() {
+		// nothing is left staged unless it was published
+		if err != nil {
+			repoChanges.Clear("")
+		}
+	}()
+
+	format := outputFormat(config)
+	result := applyResult{GUN: gun}
+	diffs, err := nRepo.ConvergeDelegations(specs, cl)
+	if _, ok := err.(notaryclient.ErrRepoNotInitialized); ok {
+		if a.dryRun {
+			return fmt.Errorf("%s has not been initialized: apply %s without --dry-run to initialize and publish it", gun, a.file)
+		}
+		if err := a.initialize(cmd, nRepo, serverManagedSnapshot, format != outputTable); err != nil {
+			return err
+		}
+		result.Initialized = true
+		diffs, err = nRepo.ConvergeDelegations(specs, cl)
+	}
+	if err != nil {
+		return err
+	}
+	result.Delegations = newRoleDiffs(diffs)
+
+	plan, err := nRepo.PlanChangelist(cl)
+	if err != nil {
+		return err
+	}
+	result.Roles = newPublishPlanResult(gun, plan).Roles
+	// the snapshot is signed by the server if the client has none of its keys
+	serverSignsSnapshot := serverManagedSnapshot
+	var expiryRoles []data.RoleName
+	if !plan.InitialPublish {
+		for _, rp := range plan.Roles {
+			if rp.Role != data.CanonicalSnapshotRole {
+				continue
+			}
+			if serverManagedSnapshot && !rp.SignedByServer {
+				result.SnapshotKey = "server"
+			} else if !serverManagedSnapshot && rp.SignedByServer {
+				result.SnapshotKey = "client"
+			}
+			serverSignsSnapshot = serverSignsSnapshot || rp.SignedByServer
+		}
+		// the first publish signs every role with the declared expiries
+		expiryRoles = repoConf.expiryRoles(specs, serverSignsSnapshot)
+		if result.Expiries, err = expiryDiffs(nRepo, repoConf, expiryRoles); err != nil {
+			return err
+		}
+	}
+	publish := len(diffs) > 0 || plan.InitialPublish
+
+	if format == outputTable {
+		printApplyPlan(cmd, a.file, result, plan, publish, a.dryRun)
+	}
+	if !a.dryRun {
+		// each step is published on its own, so a failure says which of the
+		// earlier ones were published already
+		var published []string
+		stepFailed := func(err error) error {
+			if len(published) == 0 {
+				return err
+			}
+			return fmt.Errorf("%v (already published: %s; apply %s again to finish)", err, strings.Join(published, ", "), a.file)
+		}
+		if publish {
+			if err := nRepo.Publish(); err != nil {
+				return err
+			}
+			result.Published = true
+			published = append(published, "the delegation changes")
+		}
+		if len(result.Expiries) > 0 {
+			renewed, err := a.renewExpiries(nRepo, repoConf, expiryRoles)
+			if err != nil {
+				return stepFailed(err)
+			}
+			if renewed {
+				result.Published = true
+				published = append(published, "the re-signed expiries")
+			}
+		}
+		if result.SnapshotKey != "" {
+			if err := nRepo.RotateKey(data.CanonicalSnapshotRole, result.SnapshotKey == "server", nil); err != nil {
+				return stepFailed(err)
+			}
+			result.Published = true
+		}
+	}
+
+	if format != outputTable {
+		return writeStructured(cmd.OutOrStdout(), format, result)
+	}
+	if result.Published {
+		cmd.Printf("Successfully applied %s to %s\n", a.file, gun)
+	}
+	return nil
+}
+
+// renewExpiries re-signs the roles whose expiry still differs from the
+// declared one, as publishing re-signs some of them already, and returns
+// whether any were re-signed
+func (a *applyCommander) renewExpiries(nRepo notaryclient.Repository, repoConf *repoConfig, roles []data.RoleName) (bool, error) {
+	remaining, err := expiryDiffs(nRepo, repoConf, roles)
+	if err != nil || len(remaining) == 0 {
+		return false, err
+	}
+	toRenew := make([]data.RoleName, 0, len(remaining))
+	for _, diff := range remaining {
+		toRenew = append(toRenew, diff.Role)
+	}
+	renewed, err := nRepo.RenewRoles(toRenew...)
+	if err != nil {
+		return false, err
+	}
+	if len(renewed.Skipped) > 0 {
+		skipped := make([]string, 0, len(renewed.Skipped))
+		for _, role := range renewed.Skipped {
+			skipped = append(skipped, role.Role.String())
+		}
+		return false, fmt.Errorf("unable to re-sign %s with the expiry declared in %s: not enough of the keys are available locally", strings.Join(skipped, ", "), a.file)
+	}
+	return len(renewed.Renewed) > 0, nil
+}
+
+// expiryDiffs returns those of the roles whose published metadata was signed
+// with an expiry other than the declared one.  Roles that have not been
+// published are left out, as they are signed with the declared expiry when
+// they are.
+func expiryDiffs(nRepo notaryclient.Repository, repoConf *repoConfig, roles []data.RoleName) ([]expiryDiffInfo, error) {
+	var diffs []expiryDiffInfo
+	for _, role := range roles {
+		expiry, declared := repoConf.declaredExpiry(role)
+		history, err := nRepo.GetRoleHistory(role, 0, 1)
+		if _, ok := err.(data.ErrInvalidRole); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(history) == 0 || history[0].Published.IsZero() {
+			continue
+		}
+		current := history[0]
+		validFor := current.Expires.Sub(current.Published)
+		if validFor > expiry+expiryTolerance || validFor < expiry-expiryTolerance {
+			diffs = append(diffs, expiryDiffInfo{
+				Role:      role,
+				Published: current.Published,
+				Expires:   current.Expires,
+				Expiry:    declared,
+			})
+		}
+	}
+	return diffs, nil
+}
+
+// initialize initializes a trusted collection as `notary init` does, with the
+// first root key that is available locally, or a new one
+func (a *applyCommander) initialize(cmd *cobra.Command, nRepo notaryclient.Repository, serverManagedSnapshot, quiet bool) error {
+	rootKeyIDs := nRepo.GetCryptoService().ListKeys(data.CanonicalRootRole)
+	if len(rootKeyIDs) > 0 {
+		rootKeyIDs = rootKeyIDs[:1]
+		if !quiet {
+			cmd.Printf("Root key found, using: %s\n", rootKeyIDs[0])
+		}
+	}
+	var serverManaged []data.RoleName
+	if serverManagedSnapshot {
+		serverManaged = append(serverManaged, data.CanonicalSnapshotRole)
+	}
+	return nRepo.Initialize(rootKeyIDs, serverManaged...)
+}
+
+// printApplyPlan prints what applying a configuration file does, before it is
+// published
+func printApplyPlan(cmd *cobra.Command, file string, result applyResult, plan *notaryclient.PublishPlan, publish, dryRun bool) {
+	if result.Initialized {
+		cmd.Printf("Initialized %s\n", result.GUN)
+	}
+	if !publish && len(result.Expiries) == 0 && result.SnapshotKey == "" {
+		cmd.Printf("%s already matches %s\n", result.GUN, file)
+		return
+	}
+	if dryRun {
+		cmd.Printf("Applying %s would make the following changes to %s, but nothing has been published:\n\n", file, result.GUN)
+	} else {
+		cmd.Printf("Applying %s makes the following changes to %s:\n\n", file, result.GUN)
+	}
+	if publish {
+		prettyPrintPublishPlan(plan, cmd.OutOrStdout())
+	}
+	if len(result.Expiries) > 0 {
+		if publish {
+			cmd.Printf("\nThese roles are then re-signed with their declared expiry, unless publishing the changes above already did so:\n\n")
+		} else {
+			cmd.Printf("These roles are re-signed with their declared expiry:\n\n")
+		}
+		prettyPrintExpiryDiffs(result.Expiries, cmd.OutOrStdout())
+		cmd.Println()
+	}
+	switch result.SnapshotKey {
+	case "server":
+		cmd.Printf("The snapshot key is then rotated so that the server manages it.\n\n")
+	case "client":
+		cmd.Printf("The snapshot key is then rotated to a new key held by this client.\n\n")
+	}
+}
+
+// readRepoConfig reads the desired state of a trusted collection from a YAML
+// file, rejecting any fields it does not know
+func readRepoConfig(file string) (*repoConfig, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	repoConf := &repoConfig{}
+	if err := yaml.UnmarshalStrict(contents, repoConf); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", file, err)
+	}
+	if repoConf.GUN == "" {
+		return nil, fmt.Errorf("%s does not declare the gun of the trusted collection", file)
+	}
+	return repoConf, nil
+}
+
+// delegationSpecs reads the keys of the declared delegations, from files
+// relative to the given directory
+func (c *repoConfig) delegationSpecs(dir string) ([]notaryclient.DelegationSpec, error) {
+	specs := make([]notaryclient.DelegationSpec, 0, len(c.Delegations))
+	for _, delegation := range c.Delegations {
+		pathType := data.PathType(delegation.PathType)
+		if !data.IsValidPathType(pathType) {
+			return nil, fmt.Errorf("invalid path type %q for %s: must be %q or %q", delegation.PathType, delegation.Name, data.PathTypePrefix, data.PathTypeGlob)
+		}
+		paths := delegation.Paths
+		if delegation.AllPaths {
+			if len(paths) > 0 || pathType == data.PathTypeGlob {
+				return nil, fmt.Errorf("%s cannot have all_paths along with paths or a glob path type", delegation.Name)
+			}
+			paths = []string{""}
+		}
+		spec := notaryclient.DelegationSpec{
+			Name:        data.RoleName(delegation.Name),
+			Threshold:   delegation.Threshold,
+			Paths:       paths,
+			PathType:    pathType,
+			Terminating: delegation.Terminating,
+		}
+		for _, keyFile := range delegation.Keys {
+			if !filepath.IsAbs(keyFile) {
+				keyFile = filepath.Join(dir, keyFile)
+			}
+			pemBytes, err := ioutil.ReadFile(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read public key for %s from %s: %v", delegation.Name, keyFile, err)
+			}
+			key, err := utils.ParsePEMPublicKey(pemBytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse public key for %s from %s: %v", delegation.Name, keyFile, err)
+			}
+			spec.Keys = append(spec.Keys, key)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// serverManagesSnapshot returns whether the snapshot key is declared to be
+// managed by the server.  The server always manages the timestamp key.
+func (c *repoConfig) serverManagesSnapshot() (bool, error) {
+	snapshot := false
+	for _, role := range c.ServerManaged {
+		switch data.RoleName(role) {
+		case data.CanonicalSnapshotRole:
+			snapshot = true
+		case data.CanonicalTimestampRole:
+		default:
+			return false, fmt.Errorf("invalid server managed role %s: only the snapshot and timestamp keys can be managed by the server", role)
+		}
+	}
+	return snapshot, nil
+}
+
+// declaredExpiry returns the declared expiry for a role, both as a duration and
+// as it is in the configuration file.  A delegation without an expiry of its
+// own expires along with the targets role.
+func (c *repoConfig) declaredExpiry(role data.RoleName) (time.Duration, string) {
+	declared := make(map[data.RoleName]string, len(c.Expiry))
+	for name, expiry := range c.Expiry {
+		declared[data.RoleName(strings.ToLower(name))] = expiry
+	}
+	expiry, ok := declared[role]
+	if !ok && data.IsDelegation(role) {
+		expiry, ok = declared[data.CanonicalTargetsRole]
+	}
+	if !ok {
+		return 0, ""
+	}
+	// the expiries were checked when they were set as flags
+	d, _ := parseDuration(expiry)
+	return d, expiry
+}
+
+// expiryRoles returns the roles that have a declared expiry, in the order
+// root, targets, delegations and snapshot, leaving out the snapshot if the
+// server signs it
+func (c *repoConfig) expiryRoles(specs []notaryclient.DelegationSpec, serverSignsSnapshot bool) []data.RoleName {
+	delegations := make(map[data.RoleName]bool, len(specs))
+	for _, spec := range specs {
+		delegations[spec.Name] = true
+	}
+	for name := range c.Expiry {
+		if role := data.RoleName(strings.ToLower(name)); data.IsDelegation(role) {
+			delegations[role] = true
+		}
+	}
+	roles := []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole}
+	sorted := make([]data.RoleName, 0, len(delegations))
+	for role := range delegations {
+		sorted = append(sorted, role)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	roles = append(roles, sorted...)
+	if !serverSignsSnapshot {
+		roles = append(roles, data.CanonicalSnapshotRole)
+	}
+
+	declared := make([]data.RoleName, 0, len(roles))
+	for _, role := range roles {
+		if _, expiry := c.declaredExpiry(role); expiry != "" {
+			declared = append(declared, role)
+		}
+	}
+	return declared
+}
+
+// expiries returns the declared expiries in the form of the --expiry flag
+func (c *repoConfig) expiries() []string {
+	expiries := make([]string, 0, len(c.Expiry))
+	for role, expiry := range c.Expiry {
+		expiries = append(expiries, role+"="+expiry)
+	}
+	sort.Strings(expiries)
+	return expiries
+}
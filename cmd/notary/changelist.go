@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdChangelistTemplate = usageTemplate{
+	Use:   "changelist",
+	Short: "Moves unpublished changes between machines.",
+	Long:  "Exports the unpublished changes for a Global Unique Name to a bundle file, and imports them on another machine, such as one holding the keys needed to publish them.",
+}
+
+var cmdChangelistExportTemplate = usageTemplate{
+	Use:   "export [ GUN ]",
+	Short: "Exports the unpublished changes for the Global Unique Name to a bundle file.",
+	Long:  "Writes the unpublished changes for the Global Unique Name to a bundle file that can be imported using \"notary changelist import\". The bundle is signed with a key of the targets role or of the root or delegation given with --role, which must be available locally. The changes must all be to that role or the delegations below it, unless it is the root. The changes are not cleared.",
+}
+
+var cmdChangelistImportTemplate = usageTemplate{
+	Use:   "import [ Bundle ]",
+	Short: "Imports the changes in a bundle file as unpublished changes.",
+	Long:  "Verifies that a bundle file written by \"notary changelist export\" is signed by a key that the Global Unique Name it is for trusts for the bundle's role, and that the role can make all of its changes, and stages its changes for the next publish of the Global Unique Name. Use `status` to review the imported changes before publishing them.",
+}
+
+type changelistCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+
+	output      string
+	role        string
+	autoPublish bool
+}
+
+func (c *changelistCommander) GetCommand() *cobra.Command {
+	cmd := cmdChangelistTemplate.ToCommand(nil)
+
+	cmdExport := cmdChangelistExportTemplate.ToCommand(c.changelistExport)
+	cmdExport.Flags().StringVarP(&c.output, "output", "o", "", "Path to the bundle file to write, instead of writing it to stdout")
+	cmdExport.Flags().StringVarP(&c.role, "role", "r", data.CanonicalTargetsRole.String(), "Root, targets role or delegation whose key signs the bundle")
+	cmd.AddCommand(cmdExport)
+
+	cmdImport := cmdChangelistImportTemplate.ToCommand(c.changelistImport)
+	cmdImport.Flags().BoolVarP(&c.autoPublish, "publish", "p", false, htAutoPublish)
+	cmd.AddCommand(cmdImport)
+	return cmd
+}
+
+func (c *changelistCommander) changelistExport(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+
+	config, err := c.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, c.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	role := data.RoleName(c.role)
+	if c.output == "" {
+		return nRepo.ExportChangelist(cmd.OutOrStdout(), role)
+	}
+	var buf bytes.Buffer
+	if err := nRepo.ExportChangelist(&buf, role); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.output, buf.Bytes(), notary.PrivNoExecPerms); err != nil {
+		return err
+	}
+	cmd.Printf("Exported the unpublished changes for %s to %s, signed by %s\n", gun, c.output, role)
+	return nil
+}
+
+func (c *changelistCommander) changelistImport(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a changelist bundle file")
+	}
+
+	config, err := c.configGetter()
+	if err != nil {
+		return err
+	}
+
+	bundleBytes, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	bundle, err := notaryclient.ReadChangelistBundle(bytes.NewReader(bundleBytes))
+	if err != nil {
+		return err
+	}
+
+	fact := ConfigureRepo(config, c.retriever, true, readOnly)
+	nRepo, err := fact(bundle.GUN)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.ImportChangelist(bytes.NewReader(bundleBytes)); err != nil {
+		return err
+	}
+
+	cmd.Printf("Imported %d change(s) signed by %s to repository \"%s\" from %s, staged for next publish.\n", len(bundle.Changes), bundle.Role, bundle.GUN, args[0])
+	return maybeAutoPublish(cmd, c.autoPublish, bundle.GUN, config, c.retriever)
+}
@@ -44,6 +44,12 @@ var cmdDelegationAddTemplate = usageTemplate{
 	Long:  "Add a keys to delegation using the provided public key PEM encoded X509 certificates in a specific Global Unique Name.",
 }
 
+var cmdDelegationAddBinsTemplate = usageTemplate{
+	Use:   "add-bins [ GUN ] [ Role ] <X509 file path 1> ...",
+	Short: "Divide a role between hashed bin delegations using the provided public key X509 certificates.",
+	Long:  "Divide the target paths of a role in a specific Global Unique Name between a number of new hashed bin delegations, which all use the provided public key PEM encoded X509 certificates. The targets already in the role are moved into the hashed bins they belong in when the bins are published, and targets added to the role afterwards are added to the hashed bin they belong in instead.",
+}
+
 type delegationCommander struct {
 	// these need to be set
 	configGetter func() (*viper.Viper, error)
@@ -52,6 +58,10 @@ type delegationCommander struct {
 	paths                         []string
 	allPaths, removeAll, forceYes bool
 	keyIDs                        []string
+	threshold                     int
+	terminating                   bool
+	pathType                      string
+	bins                          int
 
 	autoPublish bool
 }
@@ -75,8 +85,17 @@ func (d *delegationCommander) GetCommand() *cobra.Command {
 	cmdAddDelg := cmdDelegationAddTemplate.ToCommand(d.delegationAdd)
 	cmdAddDelg.Flags().StringSliceVar(&d.paths, "paths", nil, "List of paths to add")
 	cmdAddDelg.Flags().BoolVar(&d.allPaths, "all-paths", false, "Add all paths to this delegation")
+	cmdAddDelg.Flags().IntVar(&d.threshold, "threshold", 0, "Number of delegation key signatures required to sign the delegation. If not specified, new delegations require 1 signature and existing delegations keep their threshold")
+	cmdAddDelg.Flags().BoolVar(&d.terminating, "terminating", false, "Make this a terminating delegation, so that no other delegations are searched for target paths it matches. Use --terminating=false to make an existing delegation non-terminating")
+	cmdAddDelg.Flags().StringVar(&d.pathType, "path-type", "", "How the delegation's paths are matched against target paths: \"prefix\" (the default) or \"glob\" for shell file name patterns such as \"*/linux-amd64/*\"")
 	cmdAddDelg.Flags().BoolVarP(&d.autoPublish, "publish", "p", false, htAutoPublish)
 	cmd.AddCommand(cmdAddDelg)
+
+	cmdAddBins := cmdDelegationAddBinsTemplate.ToCommand(d.delegationAddBins)
+	cmdAddBins.Flags().IntVar(&d.bins, "bins", 16, "Number of hashed bins to divide the role into, which must be a power of 2")
+	cmdAddBins.Flags().IntVar(&d.threshold, "threshold", 0, "Number of delegation key signatures required to sign each bin. If not specified, each bin requires 1 signature")
+	cmdAddBins.Flags().BoolVarP(&d.autoPublish, "publish", "p", false, htAutoPublish)
+	cmd.AddCommand(cmdAddBins)
 	return cmd
 }
 
@@ -164,6 +183,10 @@ func (d *delegationCommander) delegationsList(cmd *cobra.Command, args []string)
 		return fmt.Errorf("Error retrieving delegation roles for repository %s: %v", gun, err)
 	}
 
+	if format := outputFormat(config); format != outputTable {
+		return writeStructured(cmd.OutOrStdout(), format, newDelegationList(gun, delegationRoles))
+	}
+
 	cmd.Println("")
 	prettyPrintRoles(delegationRoles, cmd.OutOrStdout(), "delegations")
 	cmd.Println("")
@@ -286,10 +309,20 @@ func delegationRemoveOutput(cmd *cobra.Command, d *delegationCommander, gun data
 
 // delegationAdd creates a new delegation by adding a public key from a certificate to a specific role in a GUN
 func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) error {
-	// We must have at least the gun and role name, and at least one key or path (or the --all-paths flag) to add
-	if len(args) < 2 || len(args) < 3 && d.paths == nil && !d.allPaths {
+	// We must have at least the gun and role name, and at least one key or path (or the --all-paths flag) to add,
+	// or a new threshold, terminating setting or path type to set
+	setTerminating := cmd.Flags().Changed("terminating")
+	setPathType := cmd.Flags().Changed("path-type")
+	if len(args) < 2 || len(args) < 3 && d.paths == nil && !d.allPaths && d.threshold == 0 && !setTerminating && !setPathType {
 		cmd.Usage()
-		return fmt.Errorf("must specify the Global Unique Name and the role of the delegation along with the public key certificate paths and/or a list of paths to add")
+		return fmt.Errorf("must specify the Global Unique Name and the role of the delegation along with the public key certificate paths, a list of paths, a threshold, a path type and/or whether it is terminating to add")
+	}
+	pathType := data.PathType(d.pathType)
+	if setPathType && pathType != data.PathTypePrefix && pathType != data.PathTypeGlob {
+		return fmt.Errorf("invalid path type %q: must be %q or %q", d.pathType, data.PathTypePrefix, data.PathTypeGlob)
+	}
+	if pathType == data.PathTypeGlob && d.allPaths {
+		return fmt.Errorf("all paths cannot be delegated with glob patterns")
 	}
 
 	config, err := d.configGetter()
@@ -320,11 +353,27 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 		return err
 	}
 
-	// Add the delegation to the repository
-	err = nRepo.AddDelegation(role, pubKeys, d.paths)
+	// Add the delegation to the repository, setting its path type before adding
+	// any paths so that they are matched as that path type
+	if setPathType {
+		err = nRepo.AddDelegationWithThreshold(role, pubKeys, nil, d.threshold)
+		if err == nil {
+			err = nRepo.SetDelegationPathType(role, pathType)
+		}
+		if err == nil && len(d.paths) > 0 {
+			err = nRepo.AddDelegationPaths(role, d.paths)
+		}
+	} else {
+		err = nRepo.AddDelegationWithThreshold(role, pubKeys, d.paths, d.threshold)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create delegation: %v", err)
 	}
+	if setTerminating {
+		if err := nRepo.SetDelegationTerminating(role, d.terminating); err != nil {
+			return fmt.Errorf("failed to create delegation: %v", err)
+		}
+	}
 
 	// Make keyID slice for better CLI print
 	pubKeyIDs := []string{}
@@ -347,6 +396,17 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 			strings.Join(prettyPaths(d.paths), "\n"),
 		)
 	}
+	if d.threshold > 0 {
+		addingItems = addingItems + fmt.Sprintf("with threshold %d, ", d.threshold)
+	}
+	if setPathType {
+		addingItems = addingItems + fmt.Sprintf("with path type %s, ", pathType)
+	}
+	if setTerminating && d.terminating {
+		addingItems = addingItems + "as terminating, "
+	} else if setTerminating {
+		addingItems = addingItems + "as non-terminating, "
+	}
 	cmd.Printf(
 		"Addition of delegation role %s %sto repository \"%s\" staged for next publish.\n",
 		role, addingItems, gun)
@@ -355,6 +415,53 @@ func (d *delegationCommander) delegationAdd(cmd *cobra.Command, args []string) e
 	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever)
 }
 
+// delegationAddBins divides a role in a GUN between hashed bin delegations, each using the public keys from the certificates
+func (d *delegationCommander) delegationAddBins(cmd *cobra.Command, args []string) error {
+	if len(args) < 3 {
+		cmd.Usage()
+		return fmt.Errorf("must specify the Global Unique Name and the role to divide into hashed bins along with the public key certificate paths")
+	}
+
+	config, err := d.configGetter()
+	if err != nil {
+		return err
+	}
+
+	gun := data.GUN(args[0])
+	role := data.RoleName(args[1])
+
+	pubKeys, err := ingestPublicKeys(args)
+	if err != nil {
+		return err
+	}
+
+	trustPin, err := getTrustPinning(config)
+	if err != nil {
+		return err
+	}
+
+	// no online operations are performed by add-bins so the transport argument
+	// should be nil
+	nRepo, err := notaryclient.NewFileCachedRepository(
+		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), nil, d.retriever, trustPin)
+	if err != nil {
+		return err
+	}
+
+	bins, err := nRepo.AddDelegationHashedBins(role, d.bins, pubKeys, d.threshold)
+	if err != nil {
+		return fmt.Errorf("failed to create hashed bins: %v", err)
+	}
+
+	cmd.Println("")
+	cmd.Printf(
+		"Addition of %d hashed bin delegation roles of %s, from %s to %s, to repository \"%s\" staged for next publish.\n",
+		len(bins), role, bins[0], bins[len(bins)-1], gun)
+	cmd.Println("")
+
+	return maybeAutoPublish(cmd, d.autoPublish, gun, config, d.retriever)
+}
+
 func checkAllPaths(d *delegationCommander) {
 	for _, path := range d.paths {
 		if path == "" {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+var cmdExpiryTemplate = usageTemplate{
+	Use:   "expiry",
+	Short: "Reports on the expiry of trusted collections.",
+	Long:  "Reports on when the metadata for the roles of trusted collections expires.",
+}
+
+var cmdExpiryReportTemplate = usageTemplate{
+	Use:   "report [ GUN ... ]",
+	Short: "Reports when the roles of trusted collections expire.",
+	Long:  "Updates each of the given trusted collections, or those listed in the server's catalog with the given prefix, and reports when the metadata for each of their roles expires, along with the keys that can sign for the role and whether they are held locally. Exits with an error if any role expires within the threshold. Nothing is published.",
+}
+
+type expiryCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+
+	prefix    string
+	threshold string
+}
+
+// expiryReport is the output form of `notary expiry report`
+type expiryReport struct {
+	Threshold    string                 `json:"threshold"`
+	Repositories []repositoryExpiryInfo `json:"repositories"`
+}
+
+type repositoryExpiryInfo struct {
+	GUN   data.GUN         `json:"gun"`
+	Error string           `json:"error,omitempty"`
+	Roles []roleExpiryInfo `json:"roles"`
+}
+
+type roleExpiryInfo struct {
+	Role          data.RoleName `json:"role"`
+	Version       int           `json:"version"`
+	Expires       time.Time     `json:"expires"`
+	DaysRemaining int           `json:"days_remaining"`
+	Expiring      bool          `json:"expiring"`
+	Threshold     int           `json:"threshold"`
+	Keys          []keyHeldInfo `json:"keys"`
+}
+
+type keyHeldInfo struct {
+	ID    string `json:"id"`
+	Local bool   `json:"local"`
+}
+
+func (e *expiryCommander) GetCommand() *cobra.Command {
+	cmd := cmdExpiryTemplate.ToCommand(nil)
+
+	cmdReport := cmdExpiryReportTemplate.ToCommand(e.expiryReport)
+	cmdReport.Flags().StringVar(&e.prefix, "prefix", "", "Report on every GUN in the server's catalog that starts with this prefix, which requires admin access to the server")
+	cmdReport.Flags().StringVar(&e.threshold, "threshold", "30d", "Exit with an error if any role expires within this duration, e.g. 30d or 720h")
+	cmd.AddCommand(cmdReport)
+	return cmd
+}
+
+func (e *expiryCommander) expiryReport(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !cmd.Flags().Changed("prefix") {
+		cmd.Usage()
+		return fmt.Errorf("Must specify at least one GUN, or a prefix of the GUNs to report on")
+	}
+	threshold, err := parseDuration(e.threshold)
+	if err != nil || threshold < 0 {
+		return fmt.Errorf("invalid duration for --threshold: %q", e.threshold)
+	}
+
+	config, err := e.configGetter()
+	if err != nil {
+		return err
+	}
+	guns := make([]data.GUN, 0, len(args))
+	for _, arg := range args {
+		guns = append(guns, data.GUN(arg))
+	}
+	if cmd.Flags().Changed("prefix") {
+		catalogGUNs, err := listCatalog(config, e.prefix)
+		if err != nil {
+			return err
+		}
+		guns = append(guns, catalogGUNs...)
+	}
+
+	report := expiryReport{Threshold: e.threshold, Repositories: make([]repositoryExpiryInfo, 0, len(guns))}
+	deadline := time.Now().Add(threshold)
+	var expiring, failed int
+	fact := ConfigureRepo(config, e.retriever, true, readOnly)
+	for _, gun := range guns {
+		info := repositoryExpiryInfo{GUN: gun, Roles: []roleExpiryInfo{}}
+		statuses, err := getRoleExpiries(fact, gun)
+		if err != nil {
+			info.Error = err.Error()
+			failed++
+		}
+		for _, status := range statuses {
+			role := roleExpiryInfo{
+				Role:          status.Role,
+				Version:       status.Version,
+				Expires:       status.Expires,
+				DaysRemaining: int(time.Until(status.Expires) / notary.Day),
+				Expiring:      status.Expires.Before(deadline),
+				Threshold:     status.Threshold,
+				Keys:          make([]keyHeldInfo, 0, len(status.Keys)),
+			}
+			for _, key := range status.Keys {
+				role.Keys = append(role.Keys, keyHeldInfo{ID: key.ID, Local: key.Local})
+			}
+			if role.Expiring {
+				expiring++
+			}
+			info.Roles = append(info.Roles, role)
+		}
+		report.Repositories = append(report.Repositories, info)
+	}
+
+	if format := outputFormat(config); format != outputTable {
+		if err := writeStructured(cmd.OutOrStdout(), format, report); err != nil {
+			return err
+		}
+	} else {
+		prettyPrintExpiries(report.Repositories, cmd.OutOrStdout())
+	}
+
+	switch {
+	case expiring > 0 && failed > 0:
+		return fmt.Errorf("%d roles expire within %s, and %d GUNs could not be checked", expiring, e.threshold, failed)
+	case expiring > 0:
+		return fmt.Errorf("%d roles expire within %s", expiring, e.threshold)
+	case failed > 0:
+		return fmt.Errorf("%d GUNs could not be checked", failed)
+	}
+	return nil
+}
+
+func getRoleExpiries(fact RepoFactory, gun data.GUN) ([]notaryclient.RoleExpiryStatus, error) {
+	nRepo, err := fact(gun)
+	if err != nil {
+		return nil, err
+	}
+	return nRepo.GetRoleExpiries()
+}
+
+// listCatalog lists the GUNs with the given prefix in the catalog of the
+// remote server
+func listCatalog(config *viper.Viper, prefix string) ([]data.GUN, error) {
+	rt, err := getTransport(config, "", admin)
+	if err != nil {
+		return nil, err
+	}
+	if rt == nil {
+		return nil, fmt.Errorf("unable to reach %s to list the GUNs with prefix %q", getRemoteTrustServer(config), prefix)
+	}
+	return store.ListGUNs(context.Background(), getRemoteTrustServer(config), rt, prefix)
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/server"
@@ -439,6 +440,886 @@ func TestClientTUFInteraction(t *testing.T) {
 	require.Contains(t, output, target2)
 }
 
+// Tests fetching a target from the configured content source or one given on
+// the command line, which is only written if it matches the trusted collection
+func TestClientTUFFetch(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, `{"content_source": "content"}`)
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	contentDir := filepath.Join(tempDir, "content")
+	require.NoError(t, os.MkdirAll(filepath.Join(contentDir, "images"), 0755))
+	contentFile := filepath.Join(contentDir, "images", "v1")
+	require.NoError(t, ioutil.WriteFile(contentFile, []byte("trusted content"), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "images/v1", contentFile)
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// fetch from the configured content directory
+	dest := filepath.Join(tempDir, "fetched")
+	output, err := runCommand(t, tempDir, "-s", server.URL, "fetch", "gun", "images/v1", "-o", dest)
+	require.NoError(t, err)
+	require.Contains(t, output, "images/v1")
+	fetched, err := ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "trusted content", string(fetched))
+
+	// fetch from a HTTP content source given on the command line
+	contentServer := httptest.NewServer(http.FileServer(http.Dir(contentDir)))
+	defer contentServer.Close()
+	dest = filepath.Join(tempDir, "fetched-http")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "fetch", "gun", "images/v1", "-o", dest, "--source", contentServer.URL)
+	require.NoError(t, err)
+	fetched, err = ioutil.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "trusted content", string(fetched))
+
+	// content that does not match is not written
+	require.NoError(t, ioutil.WriteFile(contentFile, []byte("tampered content"), 0644))
+	dest = filepath.Join(tempDir, "tampered")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "fetch", "gun", "images/v1", "-o", dest)
+	require.Error(t, err)
+	require.IsType(t, client.ErrContentVerification{}, err)
+	_, err = os.Stat(dest)
+	require.True(t, os.IsNotExist(err))
+
+	// there is nothing to fetch for an unknown target
+	_, err = runCommand(t, tempDir, "-s", server.URL, "fetch", "gun", "images/v2", "-o", dest)
+	require.Error(t, err)
+}
+
+// Adding a directory or a glob stages all of the files in it together
+func TestClientTUFAddDirectory(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	distDir := filepath.Join(tempDir, "dist")
+	require.NoError(t, os.MkdirAll(filepath.Join(distDir, "docs"), 0755))
+	for _, name := range []string{"app", "app.sig", filepath.Join("docs", "README")} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(distDir, name), []byte(name), 0644))
+	}
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+
+	// a directory is only added with --recursive
+	_, err = runCommand(t, tempDir, "add", "gun", "v1", distDir)
+	require.Error(t, err)
+	output, err := runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes")
+
+	output, err = runCommand(t, tempDir, "add", "gun", "v1", distDir, "--recursive")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1/app")
+	require.Contains(t, output, "v1/docs/README")
+	output, err = runCommand(t, tempDir, "add", "gun", "v2", filepath.Join(distDir, "app*"),
+		"--name-template", "{{.Base}}-{{.Target}}")
+	require.NoError(t, err)
+	require.Contains(t, output, "app.sig-v2")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	for _, name := range []string{"v1/app", "v1/app.sig", "v1/docs/README", "app-v2", "app.sig-v2"} {
+		require.Contains(t, output, name)
+	}
+
+	// the hashes match those of the files
+	output, err = runCommand(t, tempDir, "-s", server.URL, "lookup", "gun", "v1/docs/README")
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte(filepath.Join("docs", "README")))
+	require.Contains(t, output, hex.EncodeToString(sum[:]))
+}
+
+// Redundant changes are squashed before publishing, which status can preview
+// Publishing and witnessing sign metadata with the expiries set by --expiry,
+// which override the ones in the config
+func TestClientTUFPublishExpiry(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, `{"expiry": {"targets": "10d", "snapshot": "10d"}}`)
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	// reads the published metadata from the cache, once it has been updated
+	requireExpiresIn := func(role data.RoleName, expiry time.Duration) {
+		_, err := runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+		require.NoError(t, err)
+		metaJSON, err := ioutil.ReadFile(filepath.Join(tempDir, "tuf", "gun", "metadata", role.String()+".json"))
+		require.NoError(t, err)
+		var meta data.SignedMeta
+		require.NoError(t, json.Unmarshal(metaJSON, &meta))
+		require.WithinDuration(t, time.Now().Add(expiry), meta.Signed.Expires, time.Minute, "%s", role)
+	}
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--expiry", "targets=30d")
+	require.NoError(t, err)
+	requireExpiresIn(data.CanonicalTargetsRole, 30*notary.Day)
+	requireExpiresIn(data.CanonicalSnapshotRole, 10*notary.Day)
+
+	_, err = runCommand(t, tempDir, "witness", "gun", "targets", "--expiry", "targets=60d")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "-p")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "witness", "gun", "targets", "-p", "--expiry", "targets=60d,snapshot=720h")
+	require.NoError(t, err)
+	requireExpiresIn(data.CanonicalTargetsRole, 60*notary.Day)
+	requireExpiresIn(data.CanonicalSnapshotRole, 30*notary.Day)
+
+	for _, invalid := range []string{"targets", "=30d", "targets=soon", "targets=1h", "root=30d", "timestamp=30d"} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--expiry", invalid)
+		require.Error(t, err, invalid)
+		require.Contains(t, err.Error(), "expiry", invalid)
+	}
+}
+
+// Tests renewing the roles that are about to expire, with the configured
+// expiries or with those given as flags
+func TestClientTUFRenew(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, `{"expiry": {"targets": "10d", "snapshot": "10d"}}`)
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "renew", "gun", "--within", "7d")
+	require.NoError(t, err)
+	require.Contains(t, output, "No roles of gun that can be signed locally expire within 7d")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "renew", "gun", "--expiry", "targets=60d")
+	require.NoError(t, err)
+	require.Contains(t, output, "Renewed the following roles of gun")
+	require.Contains(t, output, "- targets: version 3, expires")
+	require.Contains(t, output, "- snapshot: version 3, expires")
+	require.NotContains(t, output, "root")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	for role, expiry := range map[data.RoleName]time.Duration{
+		data.CanonicalTargetsRole:  60 * notary.Day,
+		data.CanonicalSnapshotRole: 10 * notary.Day,
+	} {
+		metaJSON, err := ioutil.ReadFile(filepath.Join(tempDir, "tuf", "gun", "metadata", role.String()+".json"))
+		require.NoError(t, err)
+		var meta data.SignedMeta
+		require.NoError(t, json.Unmarshal(metaJSON, &meta))
+		require.WithinDuration(t, time.Now().Add(expiry), meta.Signed.Expires, time.Minute, "%s", role)
+		require.Equal(t, 3, meta.Signed.Version, "%s", role)
+	}
+
+	for _, invalid := range []string{"soon", "0d", "-1h"} {
+		_, err = runCommand(t, tempDir, "-s", server.URL, "renew", "gun", "--within", invalid)
+		require.Error(t, err, invalid)
+		require.Contains(t, err.Error(), "--within", invalid)
+	}
+}
+
+// Tests reporting on the expiry of GUNs, given by name or by a prefix of the
+// GUNs in the server's catalog
+func TestClientExpiryReport(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, `{"expiry": {"targets": "10d", "snapshot": "20d"}}`)
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	for _, gun := range []string{"gun1", "gun2", "other/gun3"} {
+		_, err := runCommand(t, tempDir, "-s", server.URL, "init", gun, "-p")
+		require.NoError(t, err)
+	}
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "expiry", "report", "gun1", "--threshold", "7d")
+	require.NoError(t, err)
+	for _, expected := range []string{"GUN", "DAYS LEFT", "KEYS HELD", "root", "targets", "snapshot", "1/1"} {
+		require.Contains(t, output, expected)
+	}
+	require.NotContains(t, output, "EXPIRING")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "expiry", "report", "gun1", "gun2", "--threshold", "15d")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "2 roles expire within 15d")
+	require.Contains(t, output, "EXPIRING")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "expiry", "report", "--prefix", "gun", "--format", "json", "--threshold", "7d")
+	require.NoError(t, err)
+	var report expiryReport
+	require.NoError(t, json.Unmarshal([]byte(output), &report))
+	require.Equal(t, "7d", report.Threshold)
+	require.Len(t, report.Repositories, 2)
+	for i, gun := range []data.GUN{"gun1", "gun2"} {
+		repo := report.Repositories[i]
+		require.Equal(t, gun, repo.GUN)
+		require.Empty(t, repo.Error)
+		require.Len(t, repo.Roles, 3)
+		targets := repo.Roles[1]
+		require.Equal(t, data.CanonicalTargetsRole, targets.Role)
+		require.False(t, targets.Expiring)
+		require.Contains(t, []int{9, 10}, targets.DaysRemaining)
+		require.Equal(t, 1, targets.Threshold)
+		require.Len(t, targets.Keys, 1)
+		require.True(t, targets.Keys[0].Local)
+	}
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "expiry", "report", "gun1", "nope", "--threshold", "7d")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 GUNs could not be checked")
+	require.Contains(t, output, "Unable to check nope")
+
+	for _, invalid := range [][]string{
+		{"expiry", "report"},
+		{"expiry", "report", "gun1", "--threshold", "soon"},
+		{"expiry", "report", "gun1", "--format", "xml"},
+	} {
+		_, err = runCommand(t, tempDir, append([]string{"-s", server.URL}, invalid...)...)
+		require.Error(t, err, "%v", invalid)
+	}
+}
+
+// Tests that the results of commands are output in the stable JSON and YAML
+// forms with --output
+func TestClientStructuredOutput(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	content := filepath.Join(tempDir, "content")
+	require.NoError(t, ioutil.WriteFile(content, []byte("trusted content"), 0644))
+	custom := filepath.Join(tempDir, "custom")
+	require.NoError(t, ioutil.WriteFile(custom, []byte(`{"build": 42}`), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "images/v1", content, "--custom", custom)
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "status", "gun", "--format", "json")
+	require.NoError(t, err)
+	var status statusResult
+	require.NoError(t, json.Unmarshal([]byte(output), &status))
+	require.Equal(t, data.GUN("gun"), status.GUN)
+	require.Equal(t, []changeInfo{{Number: 0, Action: "create", Scope: "targets", Type: "target", Path: "images/v1"}}, status.Changes)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--format", "json")
+	require.NoError(t, err)
+	var list listResult
+	require.NoError(t, json.Unmarshal([]byte(output), &list))
+	require.Len(t, list.Targets, 1)
+	target := list.Targets[0]
+	require.Equal(t, "images/v1", target.Name)
+	require.Equal(t, data.CanonicalTargetsRole, target.Role)
+	require.Equal(t, int64(len("trusted content")), target.Size)
+	require.Len(t, target.Hashes["sha256"], 64)
+	var customData map[string]int
+	require.NoError(t, json.Unmarshal(*target.Custom, &customData))
+	require.Equal(t, map[string]int{"build": 42}, customData)
+	require.Len(t, target.Signatures, 1)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "key", "list", "--format", "json")
+	require.NoError(t, err)
+	var keys keyListResult
+	require.NoError(t, json.Unmarshal([]byte(output), &keys))
+	require.Len(t, keys.Keys, 3)
+	require.Equal(t, data.CanonicalRootRole, keys.Keys[0].Role)
+	require.Equal(t, target.Signatures[0].KeyID, keys.Keys[2].ID)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "lookup", "gun", "images/v1", "--format", "yaml")
+	require.NoError(t, err)
+	require.Contains(t, output, "name: images/v1\n")
+	require.Contains(t, output, "build: 42\n")
+	require.Contains(t, output, "keyid: "+target.Signatures[0].KeyID+"\n")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "images/v1", "-i", content, "--format", "json")
+	require.NoError(t, err)
+	var verified lookupResult
+	require.NoError(t, json.Unmarshal([]byte(output), &verified))
+	require.True(t, verified.Verified)
+	// custom data is indented along with the rest of the output
+	target.Custom, verified.Target.Custom = nil, nil
+	require.Equal(t, target, verified.Target)
+
+	// the content is still written to a file with --output
+	verifiedContent := filepath.Join(tempDir, "verified")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "verify", "gun", "images/v1", "-i", content, "--output", verifiedContent)
+	require.NoError(t, err)
+	written, err := ioutil.ReadFile(verifiedContent)
+	require.NoError(t, err)
+	expectedContent, err := ioutil.ReadFile(content)
+	require.NoError(t, err)
+	require.Equal(t, expectedContent, written)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun", "--format", "json")
+	require.NoError(t, err)
+	var delegations delegationListResult
+	require.NoError(t, json.Unmarshal([]byte(output), &delegations))
+	require.Empty(t, delegations.Delegations)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "witness", "gun", "targets", "-p", "--format", "json")
+	require.NoError(t, err)
+	var witnessed witnessResult
+	require.NoError(t, json.Unmarshal([]byte(output), &witnessed))
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole}, witnessed.Witnessed)
+	require.True(t, witnessed.Published)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun", "--format", "xml")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid output format")
+}
+
+// Lists the published versions of the targets, and compares two of them
+func TestClientHistoryAndDiff(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	first := filepath.Join(tempDir, "first")
+	require.NoError(t, ioutil.WriteFile(first, []byte("first"), 0644))
+	second := filepath.Join(tempDir, "second")
+	require.NoError(t, ioutil.WriteFile(second, []byte("second content"), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v1", first, "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v1", second)
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v2", second, "-p")
+	require.NoError(t, err)
+
+	// the first version of the targets is signed again before it is published
+	output, err := runCommand(t, tempDir, "-s", server.URL, "history", "gun")
+	require.NoError(t, err)
+	lines := splitLines(output)
+	require.Len(t, lines, 5)
+	require.True(t, strings.HasPrefix(lines[0], "VERSION"))
+	for i, version := range []string{"4", "3", "2"} {
+		require.Equal(t, version, strings.Fields(lines[i+2])[0])
+	}
+
+	// the versions are listed a page at a time
+	output, err = runCommand(t, tempDir, "-s", server.URL, "history", "gun", "--limit", "2")
+	require.NoError(t, err)
+	lines = splitLines(output)
+	require.Len(t, lines, 5)
+	require.Equal(t, "4", strings.Fields(lines[2])[0])
+	require.Equal(t, "3", strings.Fields(lines[3])[0])
+	require.Contains(t, lines[4], "--before 3")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "history", "gun", "--before", "3")
+	require.NoError(t, err)
+	lines = splitLines(output)
+	require.Len(t, lines, 3)
+	require.Equal(t, "2", strings.Fields(lines[2])[0])
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "history", "gun", "--role", "root", "--format", "json")
+	require.NoError(t, err)
+	var history historyResult
+	require.NoError(t, json.Unmarshal([]byte(output), &history))
+	require.Equal(t, data.CanonicalRootRole, history.Role)
+	require.Len(t, history.Versions, 1)
+	require.Equal(t, 1, history.Versions[0].Version)
+	require.NotNil(t, history.Versions[0].Published)
+	require.Len(t, history.Versions[0].SignedBy, 1)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "diff", "gun", "--from", "3", "--to", "4")
+	require.NoError(t, err)
+	lines = splitLines(output)
+	require.Len(t, lines, 4)
+	require.Equal(t, []string{"v1", "changed", fmt.Sprintf("%x", sha256.Sum256([]byte("second content"))), "14"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"v2", "added"}, strings.Fields(lines[3])[:2])
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "diff", "gun", "--from", "4", "--to", "3", "--format", "json")
+	require.NoError(t, err)
+	var diff diffResult
+	require.NoError(t, json.Unmarshal([]byte(output), &diff))
+	require.Equal(t, 4, diff.From.Version)
+	require.Equal(t, 3, diff.To.Version)
+	require.Len(t, diff.Targets, 2)
+	require.Equal(t, "changed", diff.Targets[0].Change)
+	require.Equal(t, int64(len("first")), diff.Targets[0].To.Size)
+	require.Equal(t, "removed", diff.Targets[1].Change)
+	require.Nil(t, diff.Targets[1].To)
+	require.Empty(t, diff.Roles)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "diff", "gun", "--from", "3", "--to", "3")
+	require.NoError(t, err)
+	require.Contains(t, output, "No differences between versions 3 and 3 of targets")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "diff", "gun", "--from", "3")
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "diff", "gun", "--from", "3", "--to", "5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the current version is 4")
+}
+
+// Rolls back the targets to an earlier version, which is published as a new one
+func TestClientRollback(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	good := filepath.Join(tempDir, "good")
+	require.NoError(t, ioutil.WriteFile(good, []byte("good"), 0644))
+	bad := filepath.Join(tempDir, "bad")
+	require.NoError(t, ioutil.WriteFile(bad, []byte("bad release"), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v1", good, "-p")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "add", "gun", "v2", bad, "-p")
+	require.NoError(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "rollback", "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--to-version")
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "rollback", "gun", "--to-version", "2")
+	require.NoError(t, err)
+	require.Contains(t, output, "Rolled back targets in gun to the targets of version 2, published as version 4")
+	require.Contains(t, output, "- v2: removed")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+	require.NotContains(t, output, "v2")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "rollback", "gun", "--to-version", "3", "--format", "json")
+	require.NoError(t, err)
+	var rollback rollbackResult
+	require.NoError(t, json.Unmarshal([]byte(output), &rollback))
+	require.Equal(t, 3, rollback.RolledBackTo)
+	require.Equal(t, 5, rollback.Version)
+	require.Len(t, rollback.Targets, 1)
+	require.Equal(t, "v2", rollback.Targets[0].Name)
+	require.Equal(t, "added", rollback.Targets[0].Change)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "rollback", "gun", "--to-version", "5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only a version before the current version 5")
+}
+
+// A dry run shows what would be published without publishing it
+func TestClientPublishDryRun(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	content := filepath.Join(tempDir, "content")
+	require.NoError(t, ioutil.WriteFile(content, []byte("content"), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "v1", content)
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, output, "nothing has been published")
+	require.Contains(t, output, "Changes to targets:")
+	lines := splitLines(output)
+	require.Equal(t, []string{"root", "new", "->", "1", "already", "signed"}, strings.Fields(lines[3]))
+	require.Equal(t, []string{"targets", "new", "->", "2", "client", "1"}, strings.Fields(lines[4])[:6])
+	require.True(t, strings.HasSuffix(lines[4], "(local)"))
+
+	// the changes are still staged, and have not been published
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "remove", "gun", "v1")
+	require.NoError(t, err)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun", "--dry-run", "--format", "json")
+	require.NoError(t, err)
+	var plan publishPlanResult
+	require.NoError(t, json.Unmarshal([]byte(output), &plan))
+	require.False(t, plan.InitialPublish)
+	require.Len(t, plan.Roles, 2)
+	require.Equal(t, data.CanonicalTargetsRole, plan.Roles[0].Role)
+	require.Equal(t, 2, plan.Roles[0].FromVersion)
+	require.Equal(t, 3, plan.Roles[0].ToVersion)
+	require.Len(t, plan.Roles[0].Targets, 1)
+	require.Equal(t, "removed", plan.Roles[0].Targets[0].Change)
+	require.Len(t, plan.Roles[0].Keys, 1)
+	require.True(t, plan.Roles[0].Keys[0].Local)
+	require.Equal(t, data.CanonicalSnapshotRole, plan.Roles[1].Role)
+	require.False(t, plan.Roles[1].SignedByServer)
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+}
+
+func TestClientPublishOutAndPush(t *testing.T) {
+	setUp(t)
+
+	offlineDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(offlineDir)
+	onlineDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(onlineDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	content := filepath.Join(offlineDir, "content")
+	require.NoError(t, ioutil.WriteFile(content, []byte("content"), 0644))
+	outDir := filepath.Join(offlineDir, "signed")
+
+	_, err := runCommand(t, offlineDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, offlineDir, "add", "gun", "v1", content)
+	require.NoError(t, err)
+	_, err = runCommand(t, offlineDir, "publish", "gun", "--out", outDir, "--dry-run")
+	require.Error(t, err)
+
+	// the metadata is signed without the server
+	output, err := runCommand(t, offlineDir, "publish", "gun", "--out", outDir)
+	require.NoError(t, err)
+	require.Contains(t, output, "Wrote the signed metadata for gun")
+	for _, role := range []string{"root", "targets", "snapshot"} {
+		require.Contains(t, output, "- "+role)
+		_, err := os.Stat(filepath.Join(outDir, role+".json"))
+		require.NoError(t, err)
+	}
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "list", "gun")
+	require.Error(t, err)
+	// the changes stay staged until they are published
+	output, err = runCommand(t, offlineDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+
+	output, err = runCommand(t, onlineDir, "-s", server.URL, "push", outDir, "gun", "--format", "json")
+	require.NoError(t, err)
+	var result signedMetadataResult
+	require.NoError(t, json.Unmarshal([]byte(output), &result))
+	require.Equal(t, data.GUN("gun"), result.GUN)
+	require.Equal(t, []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole}, result.Roles)
+
+	output, err = runCommand(t, onlineDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v1")
+
+	// the same metadata cannot be published twice
+	_, err = runCommand(t, onlineDir, "-s", server.URL, "push", outDir, "gun")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not newer than the published version")
+}
+
+func TestClientApply(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	var keyIDs []string
+	for _, name := range []string{"alice.pem", "bob.pem"} {
+		cert, _, keyID := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, name), utils.CertToPEM(cert), 0644))
+		keyIDs = append(keyIDs, keyID)
+	}
+	repoFile := filepath.Join(tempDir, "repo.yaml")
+	require.NoError(t, ioutil.WriteFile(repoFile, []byte(`gun: gun
+server_managed: [snapshot]
+expiry:
+  targets: 90d
+delegations:
+  - name: targets/releases
+    keys: [alice.pem]
+    paths: ["releases/"]
+  - name: targets/ci
+    keys: [alice.pem, bob.pem]
+    threshold: 2
+    all_paths: true
+`), 0644))
+
+	_, err := runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile, "--dry-run")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "has not been initialized")
+
+	// the GUN is initialized and published with the delegations
+	output, err := runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "Initialized gun")
+	require.Contains(t, output, "Changes to targets:")
+	require.Contains(t, output, "Successfully applied")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.Contains(t, output, "targets/ci")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "gun already matches")
+	require.NotContains(t, output, "Successfully applied")
+
+	// undeclared delegations are removed, and the snapshot key is moved to the
+	// client
+	require.NoError(t, ioutil.WriteFile(repoFile, []byte(`gun: gun
+delegations:
+  - name: targets/releases
+    keys: [alice.pem, bob.pem]
+    paths: ["releases/", "beta/"]
+`), 0644))
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile, "--dry-run", "--format", "json")
+	require.NoError(t, err)
+	var result applyResult
+	require.NoError(t, json.Unmarshal([]byte(output), &result))
+	require.False(t, result.Initialized)
+	require.False(t, result.Published)
+	require.Equal(t, "client", result.SnapshotKey)
+	require.Len(t, result.Delegations, 2)
+	require.Equal(t, data.RoleName("targets/ci"), result.Delegations[0].Role)
+	require.Equal(t, "removed", result.Delegations[0].Change)
+	require.Equal(t, data.RoleName("targets/releases"), result.Delegations[1].Role)
+	require.Equal(t, []string{keyIDs[1]}, result.Delegations[1].AddedKeys)
+	require.Equal(t, []string{"beta/"}, result.Delegations[1].AddedPaths)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "targets/releases")
+	require.NotContains(t, output, "targets/ci")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile, "--dry-run")
+	require.NoError(t, err)
+	require.Contains(t, output, "gun already matches")
+
+	// a role signed with another expiry is re-signed, although nothing else
+	// has changed
+	require.NoError(t, ioutil.WriteFile(repoFile, []byte(`gun: gun
+expiry:
+  targets: 30d
+delegations:
+  - name: targets/releases
+    keys: [alice.pem, bob.pem]
+    paths: ["releases/", "beta/"]
+`), 0644))
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile, "--dry-run", "--format", "json")
+	require.NoError(t, err)
+	result = applyResult{}
+	require.NoError(t, json.Unmarshal([]byte(output), &result))
+	require.False(t, result.Published)
+	require.Empty(t, result.Delegations)
+	require.Len(t, result.Expiries, 1)
+	require.Equal(t, data.CanonicalTargetsRole, result.Expiries[0].Role)
+	require.Equal(t, "30d", result.Expiries[0].Expiry)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "re-signed with their declared expiry")
+	require.Contains(t, output, "Successfully applied")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.NoError(t, err)
+	require.Contains(t, output, "gun already matches")
+
+	// staged changes have to be published or reset first
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/releases", "-y")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "apply", "-f", repoFile)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unpublished changes")
+}
+
+func TestClientTUFStatusSquash(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "remove", "gun", "target")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(tempFile.Name(), []byte("new content"), 0644))
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+
+	// only the last change is left, with its number in the full list
+	output, err := runCommand(t, tempDir, "status", "gun", "--squash")
+	require.NoError(t, err)
+	require.Contains(t, output, "squashed from 3 to 1")
+	require.NotContains(t, output, "delete")
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	require.True(t, strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "2 "), output)
+
+	// the full list is still there
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "delete")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "lookup", "gun", "target")
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("new content"))
+	require.Contains(t, output, hex.EncodeToString(sum[:]))
+
+	// contradictory changes are reported
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/releases", "-y")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "add", "gun", "target", tempFile.Name(), "--roles", "targets/releases")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "status", "gun", "--squash")
+	require.Error(t, err)
+	require.IsType(t, changelist.ErrConflictingChanges{}, err)
+}
+
+// Changes staged on one machine can be exported, signed with a delegation key,
+// then imported and published on another
+func TestClientChangelistExportImport(t *testing.T) {
+	setUp(t)
+
+	server := setupServer()
+	defer server.Close()
+
+	releaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(releaseDir)
+	devDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(devDir)
+
+	_, err := runCommand(t, releaseDir, "-s", server.URL, "init", "gun", "-p")
+	require.NoError(t, err)
+
+	// the developer holds the key of a delegation
+	cert, privKey, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	certFile := filepath.Join(releaseDir, "dev.crt")
+	require.NoError(t, ioutil.WriteFile(certFile, utils.CertToPEM(cert), 0644))
+	_, err = runCommand(t, releaseDir, "-s", server.URL, "delegation", "add", "gun", "targets/dev", certFile, "--paths", "dev/", "-p")
+	require.NoError(t, err)
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, "targets/dev", "gun", "")
+	require.NoError(t, err)
+	devKey := filepath.Join(devDir, "dev.key")
+	require.NoError(t, ioutil.WriteFile(devKey, pemBytes, 0644))
+	_, err = runCommand(t, devDir, "key", "import", devKey)
+	require.NoError(t, err)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+	_, err = runCommand(t, devDir, "add", "gun", "dev/target", tempFile.Name(), "--roles", "targets/dev")
+	require.NoError(t, err)
+
+	bundle := filepath.Join(devDir, "changes.json")
+	// the developer has no targets key to sign the bundle with
+	_, err = runCommand(t, devDir, "-s", server.URL, "changelist", "export", "gun", "-o", bundle)
+	require.Error(t, err)
+	output, err := runCommand(t, devDir, "-s", server.URL, "changelist", "export", "gun", "-o", bundle, "--role", "targets/dev")
+	require.NoError(t, err)
+	require.Contains(t, output, bundle)
+	// the bundle can also be written to stdout
+	output, err = runCommand(t, devDir, "-s", server.URL, "changelist", "export", "gun", "--role", "targets/dev")
+	require.NoError(t, err)
+	written, err := ioutil.ReadFile(bundle)
+	require.NoError(t, err)
+	fromStdout, err := client.ReadChangelistBundle(strings.NewReader(output))
+	require.NoError(t, err)
+	fromFile, err := client.ReadChangelistBundle(bytes.NewReader(written))
+	require.NoError(t, err)
+	require.Equal(t, fromFile.Changes, fromStdout.Changes)
+	require.Equal(t, data.RoleName("targets/dev"), fromStdout.Role)
+
+	output, err = runCommand(t, releaseDir, "-s", server.URL, "changelist", "import", bundle)
+	require.NoError(t, err)
+	require.Contains(t, output, "Imported 1 change(s) signed by targets/dev")
+	output, err = runCommand(t, releaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "dev/target")
+	_, err = runCommand(t, releaseDir, "reset", "gun", "--all")
+	require.NoError(t, err)
+
+	// the delegation's key can't sign for changes to the targets role
+	_, err = runCommand(t, devDir, "add", "gun", "target", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, devDir, "-s", server.URL, "changelist", "export", "gun", "-o", filepath.Join(devDir, "other.json"), "--role", "targets/dev")
+	require.Error(t, err)
+	require.IsType(t, client.ErrInvalidChangelistBundle{}, err)
+
+	// a tampered bundle is rejected
+	require.NoError(t, ioutil.WriteFile(bundle, bytes.Replace(written, []byte("target"), []byte("tarqet"), 1), 0644))
+	_, err = runCommand(t, releaseDir, "-s", server.URL, "changelist", "import", bundle)
+	require.Error(t, err)
+	require.IsType(t, client.ErrInvalidChangelistBundle{}, err)
+	output, err = runCommand(t, releaseDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No unpublished changes")
+}
+
 func TestClientDeleteTUFInteraction(t *testing.T) {
 	// -- setup --
 	setUp(t)
@@ -1031,104 +1912,272 @@ func TestClientDelegationsInteraction(t *testing.T) {
 	// list delegations - we should see all of our old paths, and ""
 	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "abcdef")
-	require.Contains(t, output, "123456")
-	require.Contains(t, output, "banana/split")
-	require.Contains(t, output, "apple/crumble/pie")
-	require.Contains(t, output, "orange.peel")
-	require.Contains(t, output, "kiwi")
-	require.Contains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
+	require.Contains(t, output, "abcdef")
+	require.Contains(t, output, "123456")
+	require.Contains(t, output, "banana/split")
+	require.Contains(t, output, "apple/crumble/pie")
+	require.Contains(t, output, "orange.peel")
+	require.Contains(t, output, "kiwi")
+	require.Contains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// Try removing just ""
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "\"\"")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our old paths without ""
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "abcdef")
+	require.Contains(t, output, "123456")
+	require.Contains(t, output, "banana/split")
+	require.Contains(t, output, "apple/crumble/pie")
+	require.Contains(t, output, "orange.peel")
+	require.Contains(t, output, "kiwi")
+	require.NotContains(t, output, "\"\"")
+
+	// Remove --all-paths to clear out all paths from this delegation
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see all of our paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "abcdef")
+	require.NotContains(t, output, "123456")
+	require.NotContains(t, output, "banana/split")
+	require.NotContains(t, output, "apple/crumble/pie")
+	require.NotContains(t, output, "orange.peel")
+	require.NotContains(t, output, "kiwi")
+
+	// Check that we ignore other --paths if we pass in --all-paths on an add
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths", "--paths", "grapefruit,pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should only see "", and not the other paths specified
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// Add those extra paths we ignored to set up the next test
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "grapefruit,pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// Check that we ignore other --paths if we pass in --all-paths on a remove
+	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths", "--paths", "pomegranate")
+	require.NoError(t, err)
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see no paths
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "\"\"")
+	require.NotContains(t, output, "grapefruit")
+	require.NotContains(t, output, "pomegranate")
+
+	// remove by force to delete the delegation entirely
+	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "-y")
+	require.NoError(t, err)
+	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
+
+	// publish repo
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	// list delegations - we should see no delegations
+	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "No delegations present in this repository.")
+}
+
+// Tests making a delegation terminating, and then non-terminating again
+func TestClientDelegationsTerminating(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificate
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	targetsFile := filepath.Join(tempDir, "tuf", "gun", "metadata", data.CanonicalTargetsRole.String()+".json")
+
+	// -- tests --
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+
+	output, err := runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", tempFile.Name(),
+		"--paths", "path", "--terminating")
+	require.NoError(t, err)
+	require.Contains(t, output, "as terminating")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.NoError(t, err)
+	// listing the delegations updates the cached metadata
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	targetsJSON, err := ioutil.ReadFile(targetsFile)
+	require.NoError(t, err)
+	require.Contains(t, string(targetsJSON), `"terminating":true`)
 
-	// Try removing just ""
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--paths", "\"\"")
+	// no keys or paths are needed to change whether it is terminating
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--terminating=false")
 	require.NoError(t, err)
+	require.Contains(t, output, "as non-terminating")
 
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	require.NoError(t, err)
+	targetsJSON, err = ioutil.ReadFile(targetsFile)
+	require.NoError(t, err)
+	require.NotContains(t, string(targetsJSON), "terminating")
 
-	// list delegations - we should see all of our old paths without ""
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	// the delegation has to exist
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/other", "--terminating")
 	require.NoError(t, err)
-	require.Contains(t, output, "abcdef")
-	require.Contains(t, output, "123456")
-	require.Contains(t, output, "banana/split")
-	require.Contains(t, output, "apple/crumble/pie")
-	require.Contains(t, output, "orange.peel")
-	require.Contains(t, output, "kiwi")
-	require.NotContains(t, output, "\"\"")
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.Error(t, err)
+}
 
-	// Remove --all-paths to clear out all paths from this delegation
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths")
+func TestClientDelegationsHashedBins(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificate
+	tempFile, err := ioutil.TempFile("", "pemfile")
 	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// publish repo
+	// -- tests --
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should see all of our paths
-	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
+	// the number of bins has to be a power of 2
+	_, err = runCommand(t, tempDir, "delegation", "add-bins", "gun", "targets", tempFile.Name(), "--bins", "3")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "power of 2")
+
+	output, err := runCommand(t, tempDir, "delegation", "add-bins", "gun", "targets", tempFile.Name(), "--bins", "2")
 	require.NoError(t, err)
-	require.NotContains(t, output, "abcdef")
-	require.NotContains(t, output, "123456")
-	require.NotContains(t, output, "banana/split")
-	require.NotContains(t, output, "apple/crumble/pie")
-	require.NotContains(t, output, "orange.peel")
-	require.NotContains(t, output, "kiwi")
+	require.Contains(t, output, "Addition of 2 hashed bin delegation roles of targets, from targets/0-7 to targets/8-f")
 
-	// Check that we ignore other --paths if we pass in --all-paths on an add
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--all-paths", "--paths", "grapefruit,pomegranate")
+	output, err = runCommand(t, tempDir, "-s", server.URL, "status", "gun")
 	require.NoError(t, err)
+	require.Contains(t, output, "targets/0-7")
+	require.Contains(t, output, "targets/8-f")
 
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// list delegations - we should only see "", and not the other paths specified
 	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
+	require.Contains(t, output, "targets/0-7")
+	require.Contains(t, output, "targets/8-f")
+	require.Contains(t, output, "<path hash prefix 0>")
+	require.Contains(t, output, "<path hash prefix f>")
+}
 
-	// Add those extra paths we ignored to set up the next test
-	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/delegation", "--paths", "grapefruit,pomegranate")
+func TestClientDelegationsPathPatterns(t *testing.T) {
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	server := setupServer()
+	defer server.Close()
+
+	// Setup certificate
+	tempFile, err := ioutil.TempFile("", "pemfile")
+	require.NoError(t, err)
+	cert, _, _ := generateCertPrivKeyPair(t, "gun", data.ECDSAKey)
+	_, err = tempFile.Write(utils.CertToPEM(cert))
 	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// publish repo
+	// -- tests --
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun")
+	require.NoError(t, err)
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
 
-	// Check that we ignore other --paths if we pass in --all-paths on a remove
-	_, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "--all-paths", "--paths", "pomegranate")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/platforms", tempFile.Name(),
+		"--paths", "*/linux-amd64/*", "--path-type", "regexp")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid path type")
+	_, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/platforms", tempFile.Name(),
+		"--all-paths", "--path-type", "glob")
+	require.Error(t, err)
+
+	output, err := runCommand(t, tempDir, "delegation", "add", "gun", "targets/platforms", tempFile.Name(),
+		"--paths", "*/linux-amd64/*", "--path-type", "glob")
 	require.NoError(t, err)
+	require.Contains(t, output, "with path type glob")
 
-	// publish repo
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-
-	// list delegations - we should see no paths
 	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.NotContains(t, output, "\"\"")
-	require.NotContains(t, output, "grapefruit")
-	require.NotContains(t, output, "pomegranate")
+	require.Contains(t, output, "<path pattern */linux-amd64/*>")
 
-	// remove by force to delete the delegation entirely
-	output, err = runCommand(t, tempDir, "delegation", "remove", "gun", "targets/delegation", "-y")
+	// switching back to path prefixes keeps the paths, which are now prefixes
+	output, err = runCommand(t, tempDir, "delegation", "add", "gun", "targets/platforms", "--path-type", "prefix")
 	require.NoError(t, err)
-	require.Contains(t, output, "Forced removal (including all keys and paths) of delegation role")
-
-	// publish repo
+	require.Contains(t, output, "with path type prefix")
 	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
 	require.NoError(t, err)
-
-	// list delegations - we should see no delegations
 	output, err = runCommand(t, tempDir, "-s", server.URL, "delegation", "list", "gun")
 	require.NoError(t, err)
-	require.Contains(t, output, "No delegations present in this repository.")
+	require.NotContains(t, output, "<path pattern")
+	require.Contains(t, output, "*/linux-amd64/*")
 }
 
 // Initialize repo and test publishing targets with delegation roles
@@ -1702,6 +2751,287 @@ func TestKeyRotationNonRoot(t *testing.T) {
 	require.Error(t, err)
 }
 
+// Tests initializing a repo with several root and targets keys and thresholds,
+// and rotating keys to a new threshold
+func TestInitAndRotateWithThresholds(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	server := setupServer()
+	defer server.Close()
+
+	writeKeyFile := func(role data.RoleName, name string) string {
+		privKey, err := utils.GenerateECDSAKey(rand.Reader)
+		require.NoError(t, err)
+		pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, role, "", testPassphrase)
+		require.NoError(t, err)
+		keyFilename := filepath.Join(tempDir, name)
+		require.NoError(t, ioutil.WriteFile(keyFilename, pemBytes, 0644))
+		return keyFilename
+	}
+	readRoot := func() *data.SignedRoot {
+		cache, err := nstorage.NewFileStore(
+			filepath.Join(tempDir, "tuf", filepath.FromSlash("gun"), "metadata"),
+			"json",
+		)
+		require.NoError(t, err)
+		rawRoot, err := cache.Get(data.CanonicalRootRole.String())
+		require.NoError(t, err)
+		parsedRoot := &data.SignedRoot{}
+		require.NoError(t, json.Unmarshal(rawRoot, parsedRoot))
+		return parsedRoot
+	}
+
+	rootKeys := []string{writeKeyFile(data.CanonicalRootRole, "root1.key"), writeKeyFile(data.CanonicalRootRole, "root2.key")}
+	targetsKeys := []string{writeKeyFile(data.CanonicalTargetsRole, "targets1.key"), writeKeyFile(data.CanonicalTargetsRole, "targets2.key")}
+
+	// -- tests --
+
+	// a threshold that the keys can't meet is rejected
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun",
+		"--rootkey", rootKeys[0], "--root-threshold", "2")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid threshold")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun",
+		"--rootkey", rootKeys[0], "--rootkey", rootKeys[1], "--root-threshold", "2",
+		"--targetskey", targetsKeys[0], "--targetskey", targetsKeys[1], "--targets-threshold", "2")
+	require.NoError(t, err)
+
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", "v1", tempFile.Name())
+
+	root := readRoot()
+	require.Equal(t, 2, root.Signed.Roles[data.CanonicalRootRole].Threshold)
+	require.Len(t, root.Signed.Roles[data.CanonicalRootRole].KeyIDs, 2)
+	require.Equal(t, 2, root.Signed.Roles[data.CanonicalTargetsRole].Threshold)
+	require.Len(t, root.Signed.Roles[data.CanonicalTargetsRole].KeyIDs, 2)
+	require.Len(t, root.Signatures, 2)
+
+	// rotating to a single key requires lowering the threshold
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(),
+		"--key", targetsKeys[0])
+	require.Error(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalTargetsRole.String(),
+		"--key", targetsKeys[0], "--threshold", "1")
+	require.NoError(t, err)
+
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", "v2", tempFile.Name())
+
+	root = readRoot()
+	require.Equal(t, 1, root.Signed.Roles[data.CanonicalTargetsRole].Threshold)
+	require.Len(t, root.Signed.Roles[data.CanonicalTargetsRole].KeyIDs, 1)
+}
+
+// Tests exporting metadata that needs more signatures than are available locally,
+// co-signing it with a key from another trust directory, and pushing it
+func TestSignExportAddPush(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+	coSignerDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(coSignerDir)
+	outDir, err := ioutil.TempDir("", "notary-sign-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	server := setupServer()
+	defer server.Close()
+
+	var (
+		targetsKeys []string
+		privKeys    []data.PrivateKey
+	)
+	for i := 0; i < 2; i++ {
+		privKey, err := utils.GenerateECDSAKey(rand.Reader)
+		require.NoError(t, err)
+		pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, "", testPassphrase)
+		require.NoError(t, err)
+		keyFilename := filepath.Join(tempDir, fmt.Sprintf("targets%d.key", i))
+		require.NoError(t, ioutil.WriteFile(keyFilename, pemBytes, 0644))
+		targetsKeys = append(targetsKeys, keyFilename)
+		privKeys = append(privKeys, privKey)
+	}
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun",
+		"--targetskey", targetsKeys[0], "--targetskey", targetsKeys[1], "--targets-threshold", "2")
+	require.NoError(t, err)
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", "v1", tempFile.Name())
+
+	// hand the second targets key over to the co-signer
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKeys[1], data.CanonicalTargetsRole, "gun", "")
+	require.NoError(t, err)
+	coSignerKey := filepath.Join(coSignerDir, "targets.key")
+	require.NoError(t, ioutil.WriteFile(coSignerKey, pemBytes, 0644))
+	_, err = runCommand(t, coSignerDir, "key", "import", coSignerKey)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, notary.PrivDir, privKeys[1].ID()+".key")))
+
+	// -- tests --
+
+	_, err = runCommand(t, tempDir, "add", "gun", "v2", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "publish", "gun")
+	require.Error(t, err)
+
+	output, err := runCommand(t, tempDir, "-s", server.URL, "sign", "export", "gun", "--out", outDir)
+	require.NoError(t, err)
+	require.Contains(t, output, "more signatures are needed")
+	exported := filepath.Join(outDir, "targets.json")
+	_, err = os.Stat(exported)
+	require.NoError(t, err)
+
+	// the changes stay staged until the exported file is published
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v2")
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "sign", "push", exported)
+	require.Error(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v2")
+
+	// the co-signer checks the signing keys against the trusted metadata, but
+	// does not need to talk to the server once it has downloaded it
+	_, err = runCommand(t, coSignerDir, "sign", "add", exported)
+	require.Error(t, err)
+	_, err = runCommand(t, coSignerDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, coSignerDir, "sign", "add", exported)
+	require.NoError(t, err)
+	require.Contains(t, output, "ready to push")
+
+	// only the exported changes are removed once the file is published, not
+	// the ones staged since
+	_, err = runCommand(t, tempDir, "add", "gun", "v3", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "sign", "push", exported)
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "status", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "v2")
+	require.Contains(t, output, "v3")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v2")
+	require.NotContains(t, output, "v3")
+}
+
+// Tests staging partially signed metadata on the server, having a co-signer
+// fetch and sign it, and the server publishing it once it is fully signed
+func TestSignStageFetchPublish(t *testing.T) {
+	// -- setup --
+	setUp(t)
+
+	tempDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempDir)
+	coSignerDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(coSignerDir)
+	outDir, err := ioutil.TempDir("", "notary-sign-stage")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+	fetchDir, err := ioutil.TempDir("", "notary-sign-fetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(fetchDir)
+
+	tempFile, err := ioutil.TempFile("", "targetfile")
+	require.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	server := setupServer()
+	defer server.Close()
+
+	var (
+		targetsKeys []string
+		privKeys    []data.PrivateKey
+	)
+	for i := 0; i < 2; i++ {
+		privKey, err := utils.GenerateECDSAKey(rand.Reader)
+		require.NoError(t, err)
+		pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKey, data.CanonicalTargetsRole, "", testPassphrase)
+		require.NoError(t, err)
+		keyFilename := filepath.Join(tempDir, fmt.Sprintf("targets%d.key", i))
+		require.NoError(t, ioutil.WriteFile(keyFilename, pemBytes, 0644))
+		targetsKeys = append(targetsKeys, keyFilename)
+		privKeys = append(privKeys, privKey)
+	}
+
+	_, err = runCommand(t, tempDir, "-s", server.URL, "init", "gun",
+		"--targetskey", targetsKeys[0], "--targetskey", targetsKeys[1], "--targets-threshold", "2")
+	require.NoError(t, err)
+	assertSuccessfullyPublish(t, tempDir, server.URL, "gun", "v1", tempFile.Name())
+	// the server can only publish staged metadata if it signs the snapshot
+	_, err = runCommand(t, tempDir, "-s", server.URL, "key", "rotate", "gun", data.CanonicalSnapshotRole.String(), "-r")
+	require.NoError(t, err)
+
+	// hand the second targets key over to the co-signer
+	pemBytes, err := utils.ConvertPrivateKeyToPKCS8(privKeys[1], data.CanonicalTargetsRole, "gun", "")
+	require.NoError(t, err)
+	coSignerKey := filepath.Join(coSignerDir, "targets.key")
+	require.NoError(t, ioutil.WriteFile(coSignerKey, pemBytes, 0644))
+	_, err = runCommand(t, coSignerDir, "key", "import", coSignerKey)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, notary.PrivDir, privKeys[1].ID()+".key")))
+
+	// -- tests --
+
+	output, err := runCommand(t, coSignerDir, "-s", server.URL, "sign", "fetch", "gun", "--out", fetchDir)
+	require.NoError(t, err)
+	require.Contains(t, output, "No pending metadata for gun")
+
+	_, err = runCommand(t, tempDir, "add", "gun", "v2", tempFile.Name())
+	require.NoError(t, err)
+	_, err = runCommand(t, tempDir, "-s", server.URL, "sign", "export", "gun", "--out", outDir)
+	require.NoError(t, err)
+	output, err = runCommand(t, tempDir, "-s", server.URL, "sign", "stage", filepath.Join(outDir, "targets.json"))
+	require.NoError(t, err)
+	require.Contains(t, output, "needs more signatures")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.NotContains(t, output, "v2")
+
+	_, err = runCommand(t, coSignerDir, "-s", server.URL, "sign", "fetch", "gun", "--out", fetchDir)
+	require.NoError(t, err)
+	fetched := filepath.Join(fetchDir, "targets.json")
+	_, err = os.Stat(fetched)
+	require.NoError(t, err)
+	_, err = runCommand(t, coSignerDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	output, err = runCommand(t, coSignerDir, "sign", "add", fetched)
+	require.NoError(t, err)
+	require.Contains(t, output, "ready to push")
+	output, err = runCommand(t, coSignerDir, "-s", server.URL, "sign", "stage", fetched)
+	require.NoError(t, err)
+	require.Contains(t, output, "Successfully published")
+
+	output, err = runCommand(t, tempDir, "-s", server.URL, "list", "gun")
+	require.NoError(t, err)
+	require.Contains(t, output, "v2")
+
+	// nothing is left pending once published
+	output, err = runCommand(t, coSignerDir, "-s", server.URL, "sign", "fetch", "gun", "--out", fetchDir)
+	require.NoError(t, err)
+	require.Contains(t, output, "No pending metadata for gun")
+}
+
 // Tests default root key generation
 func TestDefaultRootKeyGeneration(t *testing.T) {
 	// -- setup --
@@ -88,6 +88,7 @@ type keyCommander struct {
 	rotateKeyRole          string
 	rotateKeyServerManaged bool
 	rotateKeyFiles         []string
+	rotateKeyThreshold     int
 	legacyVersions         int
 	input                  io.Reader
 
@@ -129,6 +130,8 @@ func (k *keyCommander) GetCommand() *cobra.Command {
 		nil,
 		"New key(s) to rotate to. If not specified, one will be generated.",
 	)
+	cmdRotateKey.Flags().IntVarP(&k.rotateKeyThreshold, "threshold", "t", 0,
+		"Number of signatures required for the role after rotation. If not specified, the current threshold is kept.")
 	cmd.AddCommand(cmdRotateKey)
 
 	cmdKeysImport := cmdKeyImportTemplate.ToCommand(k.importKeys)
@@ -176,6 +179,20 @@ func (k *keyCommander) keysList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if format := outputFormat(config); format != outputTable {
+		info := listKeys(ks)
+		result := keyListResult{Keys: make([]keyListInfo, 0, len(info))}
+		for _, key := range info {
+			result.Keys = append(result.Keys, keyListInfo{
+				Role:     key.role,
+				GUN:      key.gun,
+				ID:       key.keyID,
+				Location: key.location,
+			})
+		}
+		return writeStructured(cmd.OutOrStdout(), format, result)
+	}
+
 	cmd.Println("")
 	prettyPrintKeys(ks, cmd.OutOrStdout())
 	cmd.Println("")
@@ -316,18 +333,9 @@ func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	var keyList []string
-
-	for _, keyFile := range k.rotateKeyFiles {
-		privKey, err := readKey(rotateKeyRole, keyFile, k.getRetriever())
-		if err != nil {
-			return err
-		}
-		err = nRepo.GetCryptoService().AddKey(rotateKeyRole, gun, privKey)
-		if err != nil {
-			return fmt.Errorf("Error importing key: %v", err)
-		}
-		keyList = append(keyList, privKey.ID())
+	keyList, err := importKeyFiles(rotateKeyRole, gun, k.rotateKeyFiles, nRepo, k.getRetriever())
+	if err != nil {
+		return err
 	}
 
 	if rotateKeyRole == data.CanonicalRootRole {
@@ -341,7 +349,7 @@ func (k *keyCommander) keysRotate(cmd *cobra.Command, args []string) error {
 		}
 	}
 	nRepo.SetLegacyVersions(k.legacyVersions)
-	if err := nRepo.RotateKey(rotateKeyRole, k.rotateKeyServerManaged, keyList); err != nil {
+	if err := nRepo.RotateKeyWithThreshold(rotateKeyRole, k.rotateKeyServerManaged, keyList, k.rotateKeyThreshold); err != nil {
 		return err
 	}
 	cmd.Printf("Successfully rotated %s key for repository %s\n", rotateKeyRole, gun)
@@ -64,6 +64,7 @@ type notaryCommander struct {
 	trustDir          string
 	configFile        string
 	remoteTrustServer string
+	format            string
 
 	tlsCAFile   string
 	tlsCertFile string
@@ -126,6 +127,11 @@ func (n *notaryCommander) parseConfig() (*viper.Viper, error) {
 	if n.remoteTrustServer != "" {
 		config.Set("remote_server.url", n.remoteTrustServer)
 	}
+	if n.format != "" && !validOutputFormat(n.format) {
+		return nil, fmt.Errorf(
+			"invalid output format %q: must be %q, %q or %q", n.format, outputJSON, outputYAML, outputTable)
+	}
+	config.Set("format", n.format)
 
 	// Expands all the possible ~/ that have been given, either through -d or config
 	// Otherwise just attempt to use whatever the user gave us
@@ -165,6 +171,7 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 	notaryCmd.PersistentFlags().StringVar(&n.tlsCAFile, "tlscacert", "", "Trust certs signed only by this CA")
 	notaryCmd.PersistentFlags().StringVar(&n.tlsCertFile, "tlscert", "", "Path to TLS certificate file")
 	notaryCmd.PersistentFlags().StringVar(&n.tlsKeyFile, "tlskey", "", "Path to TLS key file")
+	notaryCmd.PersistentFlags().StringVar(&n.format, "format", outputTable, "Output format of the results of commands, either \"table\", \"json\" or \"yaml\"")
 
 	cmdKeyGenerator := &keyCommander{
 		configGetter: n.parseConfig,
@@ -177,6 +184,26 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 		retriever:    n.getRetriever(),
 	}
 
+	cmdSignGenerator := &signCommander{
+		configGetter: n.parseConfig,
+		retriever:    n.getRetriever(),
+	}
+
+	cmdChangelistGenerator := &changelistCommander{
+		configGetter: n.parseConfig,
+		retriever:    n.getRetriever(),
+	}
+
+	cmdExpiryGenerator := &expiryCommander{
+		configGetter: n.parseConfig,
+		retriever:    n.getRetriever(),
+	}
+
+	cmdApplyGenerator := &applyCommander{
+		configGetter: n.parseConfig,
+		retriever:    n.getRetriever(),
+	}
+
 	cmdTUFGenerator := &tufCommander{
 		configGetter: n.parseConfig,
 		retriever:    n.getRetriever(),
@@ -184,6 +211,10 @@ func (n *notaryCommander) GetCommand() *cobra.Command {
 
 	notaryCmd.AddCommand(cmdKeyGenerator.GetCommand())
 	notaryCmd.AddCommand(cmdDelegationGenerator.GetCommand())
+	notaryCmd.AddCommand(cmdSignGenerator.GetCommand())
+	notaryCmd.AddCommand(cmdChangelistGenerator.GetCommand())
+	notaryCmd.AddCommand(cmdExpiryGenerator.GetCommand())
+	notaryCmd.AddCommand(cmdApplyGenerator.GetCommand())
 
 	cmdTUFGenerator.AddToCommand(&notaryCmd)
 
@@ -168,7 +168,16 @@ var exampleValidCommands = []string{
 	"delegation add repo targets/releases path/to/pem/file.pem",
 	"delegation remove repo targets/releases",
 	"witness gun targets/releases",
+	"renew repo",
+	"history repo",
+	"diff --from 1 --to 2 repo",
+	"rollback --to-version 1 repo",
+	"push dir repo",
 	"delete repo",
+	"changelist export repo",
+	"changelist import bundle",
+	"expiry report repo",
+	"apply --file=repo.yaml",
 }
 
 // config parsing bugs are propagated in all commands
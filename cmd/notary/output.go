@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+	"gopkg.in/yaml.v2"
+)
+
+// output formats for the global --format flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// validOutputFormat is whether the format is one of the output formats
+func validOutputFormat(format string) bool {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return true
+	}
+	return false
+}
+
+// outputFormat returns the output format in the configuration, which is the
+// table format unless another was given with --format
+func outputFormat(config *viper.Viper) string {
+	if format := config.GetString("format"); format != "" {
+		return format
+	}
+	return outputTable
+}
+
+// writeStructured writes the JSON or YAML form of a result.  The YAML form is
+// converted from the JSON form, so that both have the same fields.
+func writeStructured(writer io.Writer, format string, result interface{}) error {
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == outputYAML {
+		decoder := json.NewDecoder(bytes.NewReader(out))
+		decoder.UseNumber()
+		var generic interface{}
+		if err := decoder.Decode(&generic); err != nil {
+			return err
+		}
+		if out, err = yaml.Marshal(yamlNumbers(generic)); err != nil {
+			return err
+		}
+		_, err = writer.Write(out)
+		return err
+	}
+	_, err = fmt.Fprintln(writer, string(out))
+	return err
+}
+
+// yamlNumbers replaces the JSON numbers in a decoded JSON value with integers
+// or floats, which would otherwise be written to YAML as strings
+func yamlNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = yamlNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = yamlNumbers(elem)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// targetInfo is the output form of a target, along with the signatures on
+// the metadata of the role that it is in
+type targetInfo struct {
+	Name       string            `json:"name"`
+	Role       data.RoleName     `json:"role"`
+	Hashes     map[string]string `json:"hashes"`
+	Size       int64             `json:"size"`
+	Custom     *json.RawMessage  `json:"custom,omitempty"`
+	Signatures []signatureInfo   `json:"signatures"`
+}
+
+type signatureInfo struct {
+	KeyID     string `json:"keyid"`
+	Method    string `json:"method"`
+	Signature string `json:"sig"`
+}
+
+// listResult is the output form of `notary list`
+type listResult struct {
+	GUN     data.GUN     `json:"gun"`
+	Targets []targetInfo `json:"targets"`
+}
+
+// lookupResult is the output form of `notary lookup`, and of `notary verify`,
+// for which Verified is always true as nothing is output if the content
+// fails to verify
+type lookupResult struct {
+	GUN      data.GUN   `json:"gun"`
+	Target   targetInfo `json:"target"`
+	Verified bool       `json:"verified,omitempty"`
+}
+
+// statusResult is the output form of `notary status`
+type statusResult struct {
+	GUN      data.GUN     `json:"gun"`
+	Squashed bool         `json:"squashed"`
+	Changes  []changeInfo `json:"changes"`
+}
+
+type changeInfo struct {
+	Number int           `json:"number"`
+	Action string        `json:"action"`
+	Scope  data.RoleName `json:"scope"`
+	Type   string        `json:"type"`
+	Path   string        `json:"path"`
+}
+
+// keyListResult is the output form of `notary key list`
+type keyListResult struct {
+	Keys []keyListInfo `json:"keys"`
+}
+
+type keyListInfo struct {
+	Role     data.RoleName `json:"role"`
+	GUN      data.GUN      `json:"gun"`
+	ID       string        `json:"id"`
+	Location string        `json:"location"`
+}
+
+// delegationListResult is the output form of `notary delegation list`
+type delegationListResult struct {
+	GUN         data.GUN         `json:"gun"`
+	Delegations []delegationInfo `json:"delegations"`
+}
+
+type delegationInfo struct {
+	Name             data.RoleName `json:"name"`
+	Paths            []string      `json:"paths"`
+	PathType         data.PathType `json:"path_type"`
+	PathHashPrefixes []string      `json:"path_hash_prefixes"`
+	Terminating      bool          `json:"terminating"`
+	KeyIDs           []string      `json:"keyids"`
+	Threshold        int           `json:"threshold"`
+}
+
+// witnessResult is the output form of `notary witness`
+type witnessResult struct {
+	GUN       data.GUN        `json:"gun"`
+	Witnessed []data.RoleName `json:"witnessed"`
+	Error     string          `json:"error,omitempty"`
+	Published bool            `json:"published"`
+}
+
+// historyResult is the output form of `notary history`
+type historyResult struct {
+	GUN      data.GUN          `json:"gun"`
+	Role     data.RoleName     `json:"role"`
+	Versions []roleVersionInfo `json:"versions"`
+}
+
+type roleVersionInfo struct {
+	Version   int        `json:"version"`
+	Published *time.Time `json:"published,omitempty"`
+	Expires   time.Time  `json:"expires"`
+	SignedBy  []string   `json:"signed_by"`
+}
+
+// diffResult is the output form of `notary diff`
+type diffResult struct {
+	GUN     data.GUN         `json:"gun"`
+	Role    data.RoleName    `json:"role"`
+	From    roleVersionInfo  `json:"from"`
+	To      roleVersionInfo  `json:"to"`
+	Targets []targetDiffInfo `json:"targets"`
+	Roles   []roleDiffInfo   `json:"roles"`
+}
+
+type targetDiffInfo struct {
+	Name   string    `json:"name"`
+	Change string    `json:"change"`
+	From   *fileInfo `json:"from,omitempty"`
+	To     *fileInfo `json:"to,omitempty"`
+}
+
+type fileInfo struct {
+	Hashes map[string]string `json:"hashes"`
+	Size   int64             `json:"size"`
+	Custom *json.RawMessage  `json:"custom,omitempty"`
+}
+
+type roleDiffInfo struct {
+	Role          data.RoleName `json:"role"`
+	Change        string        `json:"change"`
+	AddedKeys     []string      `json:"added_keys"`
+	RemovedKeys   []string      `json:"removed_keys"`
+	AddedPaths    []string      `json:"added_paths"`
+	RemovedPaths  []string      `json:"removed_paths"`
+	FromThreshold int           `json:"from_threshold"`
+	ToThreshold   int           `json:"to_threshold"`
+}
+
+// rollbackResult is the output form of `notary rollback`
+type rollbackResult struct {
+	GUN          data.GUN         `json:"gun"`
+	Role         data.RoleName    `json:"role"`
+	RolledBackTo int              `json:"rolled_back_to"`
+	Version      int              `json:"version"`
+	Targets      []targetDiffInfo `json:"targets"`
+}
+
+// signedMetadataResult is the output form of `notary publish --out` and
+// `notary push`: the roles whose metadata was written to or pushed from the
+// directory
+type signedMetadataResult struct {
+	GUN       data.GUN        `json:"gun"`
+	Directory string          `json:"directory"`
+	Roles     []data.RoleName `json:"roles"`
+}
+
+// publishPlanResult is the output form of `notary publish --dry-run`
+type publishPlanResult struct {
+	GUN            data.GUN       `json:"gun"`
+	InitialPublish bool           `json:"initial_publish"`
+	Roles          []rolePlanInfo `json:"roles"`
+}
+
+type rolePlanInfo struct {
+	Role           data.RoleName    `json:"role"`
+	FromVersion    int              `json:"from_version"`
+	ToVersion      int              `json:"to_version"`
+	SignedByServer bool             `json:"signed_by_server"`
+	Targets        []targetDiffInfo `json:"targets"`
+	Roles          []roleDiffInfo   `json:"roles"`
+	Threshold      int              `json:"threshold"`
+	Keys           []keyHeldInfo    `json:"keys"`
+}
+
+func newTargetInfo(target *notaryclient.TargetWithRole, signatures []data.Signature) targetInfo {
+	info := targetInfo{
+		Name:       target.Name,
+		Role:       target.Role,
+		Hashes:     hexHashes(target.Hashes),
+		Size:       target.Length,
+		Signatures: make([]signatureInfo, 0, len(signatures)),
+	}
+	if target.Custom != nil {
+		custom := json.RawMessage(*target.Custom)
+		info.Custom = &custom
+	}
+	for _, sig := range signatures {
+		info.Signatures = append(info.Signatures, signatureInfo{
+			KeyID:     sig.KeyID,
+			Method:    sig.Method.String(),
+			Signature: base64.StdEncoding.EncodeToString(sig.Signature),
+		})
+	}
+	return info
+}
+
+// hexHashes hex encodes each of the hashes, by algorithm
+func hexHashes(hashes data.Hashes) map[string]string {
+	encoded := make(map[string]string, len(hashes))
+	for algorithm, hash := range hashes {
+		encoded[algorithm] = hex.EncodeToString(hash)
+	}
+	return encoded
+}
+
+// getTargetSignatures returns the signatures on the metadata of each role
+// that has a target with the given name, or that has any targets if the name
+// is empty
+func getTargetSignatures(nRepo notaryclient.Repository, name string) (map[data.RoleName][]data.Signature, error) {
+	signed, err := nRepo.GetAllTargetMetadataByName(name)
+	if _, ok := err.(notaryclient.ErrNoSuchTarget); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	signatures := make(map[data.RoleName][]data.Signature)
+	for _, s := range signed {
+		signatures[s.Role.Name] = s.Signatures
+	}
+	return signatures, nil
+}
+
+func newDelegationList(gun data.GUN, roles []data.Role) delegationListResult {
+	sort.Stable(roleSorter(roles))
+	list := delegationListResult{GUN: gun, Delegations: make([]delegationInfo, 0, len(roles))}
+	for _, r := range roles {
+		pathType := r.PathType
+		if pathType == "" {
+			pathType = data.PathTypePrefix
+		}
+		info := delegationInfo{
+			Name:             r.Name,
+			Paths:            nonNil(r.Paths),
+			PathType:         pathType,
+			PathHashPrefixes: nonNil(r.PathHashPrefixes),
+			Terminating:      r.Terminating,
+			KeyIDs:           nonNil(r.KeyIDs),
+			Threshold:        r.Threshold,
+		}
+		list.Delegations = append(list.Delegations, info)
+	}
+	return list
+}
+
+func newRoleVersionInfo(version notaryclient.RoleVersion) roleVersionInfo {
+	info := roleVersionInfo{
+		Version:  version.Version,
+		Expires:  version.Expires,
+		SignedBy: nonNil(version.SignedBy),
+	}
+	if !version.Published.IsZero() {
+		published := version.Published
+		info.Published = &published
+	}
+	return info
+}
+
+func newHistoryResult(gun data.GUN, role data.RoleName, history []notaryclient.RoleVersion) historyResult {
+	result := historyResult{GUN: gun, Role: role, Versions: make([]roleVersionInfo, 0, len(history))}
+	for _, version := range history {
+		result.Versions = append(result.Versions, newRoleVersionInfo(version))
+	}
+	return result
+}
+
+func newDiffResult(gun data.GUN, diff *notaryclient.VersionDiff) diffResult {
+	result := diffResult{
+		GUN:     gun,
+		Role:    diff.To.Role,
+		From:    newRoleVersionInfo(diff.From),
+		To:      newRoleVersionInfo(diff.To),
+		Targets: newTargetDiffs(diff.Targets),
+		Roles:   newRoleDiffs(diff.Roles),
+	}
+	return result
+}
+
+func newRoleDiffs(diffs []notaryclient.RoleDiff) []roleDiffInfo {
+	roles := make([]roleDiffInfo, 0, len(diffs))
+	for _, role := range diffs {
+		roles = append(roles, roleDiffInfo{
+			Role:          role.Role,
+			Change:        role.Change,
+			AddedKeys:     nonNil(role.AddedKeys),
+			RemovedKeys:   nonNil(role.RemovedKeys),
+			AddedPaths:    nonNil(role.AddedPaths),
+			RemovedPaths:  nonNil(role.RemovedPaths),
+			FromThreshold: role.FromThreshold,
+			ToThreshold:   role.ToThreshold,
+		})
+	}
+	return roles
+}
+
+func newPublishPlanResult(gun data.GUN, plan *notaryclient.PublishPlan) publishPlanResult {
+	result := publishPlanResult{
+		GUN:            gun,
+		InitialPublish: plan.InitialPublish,
+		Roles:          make([]rolePlanInfo, 0, len(plan.Roles)),
+	}
+	for _, rp := range plan.Roles {
+		info := rolePlanInfo{
+			Role:           rp.Role,
+			FromVersion:    rp.FromVersion,
+			ToVersion:      rp.ToVersion,
+			SignedByServer: rp.SignedByServer,
+			Targets:        newTargetDiffs(rp.Targets),
+			Roles:          newRoleDiffs(rp.Roles),
+			Threshold:      rp.Threshold,
+			Keys:           make([]keyHeldInfo, 0, len(rp.Keys)),
+		}
+		for _, key := range rp.Keys {
+			info.Keys = append(info.Keys, keyHeldInfo{ID: key.ID, Local: key.Local})
+		}
+		result.Roles = append(result.Roles, info)
+	}
+	return result
+}
+
+func newRollbackResult(gun data.GUN, rollback *notaryclient.RollbackResult) rollbackResult {
+	return rollbackResult{
+		GUN:          gun,
+		Role:         rollback.Role,
+		RolledBackTo: rollback.RolledBackTo,
+		Version:      rollback.Version,
+		Targets:      newTargetDiffs(rollback.Targets),
+	}
+}
+
+func newTargetDiffs(diffs []notaryclient.TargetDiff) []targetDiffInfo {
+	targets := make([]targetDiffInfo, 0, len(diffs))
+	for _, target := range diffs {
+		targets = append(targets, targetDiffInfo{
+			Name:   target.Name,
+			Change: target.Change,
+			From:   newFileInfo(target.From),
+			To:     newFileInfo(target.To),
+		})
+	}
+	return targets
+}
+
+func newFileInfo(meta *data.FileMeta) *fileInfo {
+	if meta == nil {
+		return nil
+	}
+	info := &fileInfo{Hashes: hexHashes(meta.Hashes), Size: meta.Length}
+	if meta.Custom != nil {
+		custom := json.RawMessage(*meta.Custom)
+		info.Custom = &custom
+	}
+	return info
+}
+
+// nonNil returns an empty list rather than a nil one, so that it is output
+// as an empty list rather than as null
+func nonNil(strs []string) []string {
+	if strs == nil {
+		return []string{}
+	}
+	return strs
+}
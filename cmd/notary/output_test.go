@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+	"gopkg.in/yaml.v2"
+)
+
+func TestWriteStructured(t *testing.T) {
+	custom := canonicaljson.RawMessage(`{"build":{"number":1234567,"ratio":0.5}}`)
+	target := &client.TargetWithRole{
+		Target: client.Target{
+			Name:   "images/v1",
+			Hashes: data.Hashes{"sha256": []byte{0xab, 0xcd}},
+			Length: 4294967296,
+			Custom: &custom,
+		},
+		Role: data.CanonicalTargetsRole,
+	}
+	signatures := []data.Signature{{KeyID: "abc", Method: data.ECDSASignature, Signature: []byte{1, 2, 3}}}
+	result := listResult{GUN: "gun", Targets: []targetInfo{newTargetInfo(target, signatures)}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeStructured(&buf, outputJSON, result))
+	var fromJSON map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &fromJSON))
+	targets := fromJSON["targets"].([]interface{})
+	require.Len(t, targets, 1)
+	require.Equal(t, map[string]interface{}{
+		"name":   "images/v1",
+		"role":   "targets",
+		"hashes": map[string]interface{}{"sha256": "abcd"},
+		"size":   float64(4294967296),
+		"custom": map[string]interface{}{"build": map[string]interface{}{"number": float64(1234567), "ratio": 0.5}},
+		"signatures": []interface{}{
+			map[string]interface{}{"keyid": "abc", "method": "ecdsa", "sig": "AQID"},
+		},
+	}, targets[0])
+
+	// the YAML form has the same fields, with numbers that are still numbers
+	buf.Reset()
+	require.NoError(t, writeStructured(&buf, outputYAML, result))
+	require.Contains(t, buf.String(), "size: 4294967296\n")
+	require.Contains(t, buf.String(), "number: 1234567\n")
+	var fromYAML struct {
+		GUN     string `yaml:"gun"`
+		Targets []struct {
+			Name       string            `yaml:"name"`
+			Hashes     map[string]string `yaml:"hashes"`
+			Size       int64             `yaml:"size"`
+			Signatures []struct {
+				KeyID string `yaml:"keyid"`
+			} `yaml:"signatures"`
+		} `yaml:"targets"`
+	}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &fromYAML))
+	require.Equal(t, "gun", fromYAML.GUN)
+	require.Len(t, fromYAML.Targets, 1)
+	require.Equal(t, "images/v1", fromYAML.Targets[0].Name)
+	require.Equal(t, "abcd", fromYAML.Targets[0].Hashes["sha256"])
+	require.Equal(t, int64(4294967296), fromYAML.Targets[0].Size)
+	require.Equal(t, "abc", fromYAML.Targets[0].Signatures[0].KeyID)
+}
+
+func TestNewDelegationList(t *testing.T) {
+	glob, err := data.NewRole("targets/b", 2, []string{"key1", "key2"}, []string{"*.tar"})
+	require.NoError(t, err)
+	glob.PathType = data.PathTypeGlob
+	glob.Terminating = true
+	prefix, err := data.NewRole("targets/a", 1, []string{"key3"}, nil)
+	require.NoError(t, err)
+
+	result := newDelegationList("gun", []data.Role{*glob, *prefix})
+	require.Equal(t, delegationListResult{
+		GUN: "gun",
+		Delegations: []delegationInfo{
+			{
+				Name:             "targets/a",
+				Paths:            []string{},
+				PathType:         data.PathTypePrefix,
+				PathHashPrefixes: []string{},
+				KeyIDs:           []string{"key3"},
+				Threshold:        1,
+			},
+			{
+				Name:             "targets/b",
+				Paths:            []string{"*.tar"},
+				PathType:         data.PathTypeGlob,
+				PathHashPrefixes: []string{},
+				Terminating:      true,
+				KeyIDs:           []string{"key1", "key2"},
+				Threshold:        2,
+			},
+		},
+	}, result)
+}
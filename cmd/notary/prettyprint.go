@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/theupdateframework/notary/client"
 	"github.com/theupdateframework/notary/trustmanager"
@@ -93,9 +94,9 @@ func (k keyInfoSorter) Less(i, j int) bool {
 	return false
 }
 
-// Given a list of KeyStores in order of listing preference, pretty-prints the
-// root keys and then the signing keys.
-func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
+// Given a list of KeyStores in order of listing preference, lists the root
+// keys and then the signing keys.
+func listKeys(keyStores []trustmanager.KeyStore) []keyInfo {
 	var info []keyInfo
 
 	for _, store := range keyStores {
@@ -109,13 +110,19 @@ func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
 		}
 	}
 
+	sort.Stable(keyInfoSorter(info))
+	return info
+}
+
+// Given a list of KeyStores in order of listing preference, pretty-prints the
+// root keys and then the signing keys.
+func prettyPrintKeys(keyStores []trustmanager.KeyStore, writer io.Writer) {
+	info := listKeys(keyStores)
 	if len(info) == 0 {
 		writer.Write([]byte("No signing keys found.\n"))
 		return
 	}
 
-	sort.Stable(keyInfoSorter(info))
-
 	tw := initTabWriter([]string{"ROLE", "GUN", "KEY ID", "LOCATION"}, writer)
 
 	for _, oneKeyInfo := range info {
@@ -189,7 +196,7 @@ func prettyPrintRoles(rs []data.Role, writer io.Writer, roleType string) {
 
 	for _, r := range rs {
 		var path, kid string
-		pp := prettyPaths(r.Paths)
+		pp := append(prettyRolePaths(r), prettyPathHashPrefixes(r.PathHashPrefixes)...)
 		if len(pp) > 0 {
 			path = pp[0]
 		}
@@ -235,6 +242,30 @@ func printExtraRoleRows(tw *tabwriter.Writer, paths, keyIDs []string) {
 	}
 }
 
+// prettyPathHashPrefixes designates path hash prefixes so that they can be
+// printed along with paths
+func prettyPathHashPrefixes(prefixes []string) []string {
+	pp := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		pp = append(pp, fmt.Sprintf("<path hash prefix %s>", prefix))
+	}
+	return pp
+}
+
+// prettyRolePaths pretty-formats the paths of a delegation role, designating
+// glob patterns so that they are not mistaken for path prefixes
+func prettyRolePaths(r data.Role) []string {
+	if r.PathType != data.PathTypeGlob {
+		return prettyPaths(r.Paths)
+	}
+	sort.Strings(r.Paths)
+	pp := make([]string, 0, len(r.Paths))
+	for _, pattern := range r.Paths {
+		pp = append(pp, fmt.Sprintf("<path pattern %s>", pattern))
+	}
+	return pp
+}
+
 // Pretty-formats a list of delegation paths, and ensures the empty string is printed as "" in the console
 func prettyPaths(paths []string) []string {
 	// sort paths first
@@ -249,3 +280,214 @@ func prettyPaths(paths []string) []string {
 	}
 	return pp
 }
+
+// --- pretty printing expiries ---
+
+// Pretty-prints the expiry of each role of each repository, and then any
+// errors checking the repositories
+func prettyPrintExpiries(repos []repositoryExpiryInfo, writer io.Writer) {
+	tw := initTabWriter(
+		[]string{"GUN", "ROLE", "VERSION", "EXPIRES", "DAYS LEFT", "STATUS", "THRESHOLD", "KEYS HELD", "KEY IDS"},
+		writer,
+	)
+	var failed []repositoryExpiryInfo
+	for _, repo := range repos {
+		if repo.Error != "" {
+			failed = append(failed, repo)
+		}
+		for _, role := range repo.Roles {
+			status := "ok"
+			switch {
+			case role.Expires.Before(time.Now()):
+				status = "EXPIRED"
+			case role.Expiring:
+				status = "EXPIRING"
+			}
+			held := 0
+			keyIDs := make([]string, 0, len(role.Keys))
+			for _, key := range role.Keys {
+				if key.Local {
+					held++
+					keyIDs = append(keyIDs, key.ID+" (local)")
+				} else {
+					keyIDs = append(keyIDs, key.ID)
+				}
+			}
+			fmt.Fprintf(
+				tw, "%s\t%s\t%d\t%s\t%d\t%s\t%d\t%d/%d\t%s\n",
+				repo.GUN,
+				role.Role,
+				role.Version,
+				role.Expires.Format(time.RFC3339),
+				role.DaysRemaining,
+				status,
+				role.Threshold,
+				held, len(role.Keys),
+				strings.Join(keyIDs, ", "),
+			)
+		}
+	}
+	tw.Flush()
+	for _, repo := range failed {
+		fmt.Fprintf(writer, "\nUnable to check %s: %s\n", repo.GUN, repo.Error)
+	}
+}
+
+// --- pretty printing history ---
+
+// Pretty-prints the published versions of a role, newest first
+func prettyPrintHistory(history []client.RoleVersion, writer io.Writer) {
+	if len(history) == 0 {
+		writer.Write([]byte("\nNo versions of this role have been published.\n\n"))
+		return
+	}
+
+	tw := initTabWriter([]string{"VERSION", "PUBLISHED", "EXPIRES", "SIGNED BY"}, writer)
+	for _, version := range history {
+		published := "unknown"
+		if !version.Published.IsZero() {
+			published = version.Published.Format(time.RFC3339)
+		}
+		fmt.Fprintf(
+			tw,
+			fourItemRow,
+			fmt.Sprintf("%d", version.Version),
+			published,
+			version.Expires.Format(time.RFC3339),
+			strings.Join(version.SignedBy, ", "),
+		)
+	}
+	tw.Flush()
+}
+
+// Pretty-prints the targets and then the roles that differ between two
+// versions of a role
+func prettyPrintDiff(diff *client.VersionDiff, writer io.Writer) {
+	if len(diff.Targets) == 0 && len(diff.Roles) == 0 {
+		fmt.Fprintf(writer, "\nNo differences between versions %d and %d of %s.\n\n",
+			diff.From.Version, diff.To.Version, diff.To.Role)
+		return
+	}
+
+	prettyPrintChanges(diff.Targets, diff.Roles, writer)
+}
+
+// Pretty-prints the targets and then the roles that were changed
+func prettyPrintChanges(targets []client.TargetDiff, roles []client.RoleDiff, writer io.Writer) {
+	if len(targets) > 0 {
+		tw := initTabWriter([]string{"TARGET", "CHANGE", "DIGEST", "SIZE (BYTES)"}, writer)
+		for _, target := range targets {
+			// a removed target is shown as it was, and any other as it is now
+			meta := target.To
+			if meta == nil {
+				meta = target.From
+			}
+			fmt.Fprintf(
+				tw,
+				fourItemRow,
+				target.Name,
+				target.Change,
+				hex.EncodeToString(meta.Hashes["sha256"]),
+				fmt.Sprintf("%d", meta.Length),
+			)
+		}
+		tw.Flush()
+	}
+
+	if len(roles) > 0 {
+		if len(targets) > 0 {
+			fmt.Fprintln(writer)
+		}
+		tw := initTabWriter([]string{"ROLE", "CHANGE", "KEY IDS", "PATHS", "THRESHOLD"}, writer)
+		for _, role := range roles {
+			keyIDs := append(prefixAll("+", role.AddedKeys), prefixAll("-", role.RemovedKeys)...)
+			paths := append(prefixAll("+", prettyPaths(role.AddedPaths)), prefixAll("-", prettyPaths(role.RemovedPaths))...)
+			threshold := fmt.Sprintf("%d -> %d", role.FromThreshold, role.ToThreshold)
+			switch {
+			case role.Change == client.DiffAdded:
+				threshold = fmt.Sprintf("%d", role.ToThreshold)
+			case role.Change == client.DiffRemoved || role.FromThreshold == role.ToThreshold:
+				threshold = fmt.Sprintf("%d", role.FromThreshold)
+			}
+			rows := len(keyIDs)
+			if len(paths) > rows {
+				rows = len(paths)
+			}
+			if rows == 0 {
+				rows = 1
+			}
+			for i := 0; i < rows; i++ {
+				var name, change, kid, path, thresh string
+				if i == 0 {
+					name, change, thresh = role.Role.String(), role.Change, threshold
+				}
+				if i < len(keyIDs) {
+					kid = keyIDs[i]
+				}
+				if i < len(paths) {
+					path = paths[i]
+				}
+				fmt.Fprintf(tw, fiveItemRow, name, change, kid, path, thresh)
+			}
+		}
+		tw.Flush()
+	}
+}
+
+// Pretty-prints the roles that publishing would sign, and the keys needed for
+// each, followed by the changes to each role
+func prettyPrintPublishPlan(plan *client.PublishPlan, writer io.Writer) {
+	tw := initTabWriter([]string{"ROLE", "VERSION", "SIGNED BY", "THRESHOLD", "KEY IDS"}, writer)
+	for _, rp := range plan.Roles {
+		version := fmt.Sprintf("%d -> %d", rp.FromVersion, rp.ToVersion)
+		if rp.FromVersion == 0 {
+			version = fmt.Sprintf("new -> %d", rp.ToVersion)
+		}
+		signer, threshold := "client", fmt.Sprintf("%d", rp.Threshold)
+		switch {
+		case rp.SignedByServer:
+			signer, threshold = "server", ""
+		case len(rp.Keys) == 0:
+			// a root published for the first time was signed when initialized
+			signer, threshold = "already signed", ""
+		}
+		keyIDs := make([]string, 0, len(rp.Keys))
+		for _, key := range rp.Keys {
+			if key.Local {
+				keyIDs = append(keyIDs, key.ID+" (local)")
+			} else {
+				keyIDs = append(keyIDs, key.ID)
+			}
+		}
+		fmt.Fprintf(tw, fiveItemRow, rp.Role, version, signer, threshold, strings.Join(keyIDs, ", "))
+	}
+	tw.Flush()
+
+	for _, rp := range plan.Roles {
+		if len(rp.Targets) == 0 && len(rp.Roles) == 0 {
+			continue
+		}
+		fmt.Fprintf(writer, "\nChanges to %s:\n\n", rp.Role)
+		prettyPrintChanges(rp.Targets, rp.Roles, writer)
+	}
+}
+
+// prettyPrintExpiryDiffs prints the roles that were signed with an expiry other
+// than the declared one, with when they were published and when they expire
+func prettyPrintExpiryDiffs(diffs []expiryDiffInfo, writer io.Writer) {
+	tw := initTabWriter([]string{"ROLE", "PUBLISHED", "EXPIRES", "DECLARED EXPIRY"}, writer)
+	for _, diff := range diffs {
+		fmt.Fprintf(tw, fourItemRow, diff.Role, diff.Published.Format(time.RFC3339), diff.Expires.Format(time.RFC3339), diff.Expiry)
+	}
+	tw.Flush()
+}
+
+// prefixAll prefixes each of the strings, such as with + for those that were
+// added and - for those that were removed
+func prefixAll(prefix string, strs []string) []string {
+	prefixed := make([]string, 0, len(strs))
+	for _, s := range strs {
+		prefixed = append(prefixed, prefix+s)
+	}
+	return prefixed
+}
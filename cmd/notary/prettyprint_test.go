@@ -253,3 +253,39 @@ func TestPrettyPrintSortedRoles(t *testing.T) {
 		require.Equal(t, expected[i], splitted)
 	}
 }
+
+func TestPrettyPrintDiffRoles(t *testing.T) {
+	diff := &client.VersionDiff{
+		From: client.RoleVersion{Role: data.CanonicalTargetsRole, Version: 2},
+		To:   client.RoleVersion{Role: data.CanonicalTargetsRole, Version: 3},
+		Roles: []client.RoleDiff{
+			{Role: "targets/a", Change: client.DiffAdded, AddedKeys: []string{"101"}, AddedPaths: []string{""}, ToThreshold: 1},
+			{
+				Role: "targets/b", Change: client.DiffChanged,
+				AddedKeys: []string{"246"}, RemovedKeys: []string{"135"},
+				RemovedPaths: []string{"stuff"}, FromThreshold: 1, ToThreshold: 2,
+			},
+			{Role: "targets/c", Change: client.DiffChanged, FromThreshold: 1, ToThreshold: 1},
+		},
+	}
+
+	var b bytes.Buffer
+	prettyPrintDiff(diff, &b)
+
+	expected := [][]string{
+		{"targets/a", "added", "+101", `+""`, "<all", "paths>", "1"},
+		{"targets/b", "changed", "+246", "-stuff", "1", "->", "2"},
+		{"-135"},
+		{"targets/c", "changed", "1"},
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, len(expected)+2)
+	require.Equal(t, []string{"ROLE", "CHANGE", "KEY", "IDS", "PATHS", "THRESHOLD"}, strings.Fields(lines[0]))
+	for i, line := range lines[2:] {
+		require.Equal(t, expected[i], strings.Fields(line))
+	}
+
+	b.Reset()
+	prettyPrintDiff(&client.VersionDiff{From: diff.From, To: diff.From}, &b)
+	require.Equal(t, "\nNo differences between versions 2 and 2 of targets.\n\n", b.String())
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/spf13/viper"
 
 	"net/http"
@@ -31,7 +35,7 @@ func ConfigureRepo(v *viper.Viper, retriever notary.PassRetriever, onlineOperati
 				return nil, err
 			}
 		}
-		return client.NewFileCachedRepository(
+		repo, err := client.NewFileCachedRepository(
 			v.GetString("trust_dir"),
 			gun,
 			getRemoteTrustServer(v),
@@ -39,7 +43,58 @@ func ConfigureRepo(v *viper.Viper, retriever notary.PassRetriever, onlineOperati
 			retriever,
 			trustPin,
 		)
+		if err != nil {
+			return nil, err
+		}
+		if v.IsSet("remote_server.download_workers") {
+			workers := v.GetInt("remote_server.download_workers")
+			if workers < 1 {
+				return nil, fmt.Errorf("invalid remote_server.download_workers %d: must be at least 1", workers)
+			}
+			repo.SetDownloadWorkers(workers)
+		}
+		if v.IsSet("remote_server.publish_retries") {
+			retries := v.GetInt("remote_server.publish_retries")
+			if retries < 0 {
+				return nil, fmt.Errorf("invalid remote_server.publish_retries %d: must not be negative", retries)
+			}
+			repo.SetPublishRetries(retries, notary.DefaultPublishRetryBackoff)
+		}
+		if err := setExpiries(v, repo); err != nil {
+			return nil, err
+		}
+		return repo, nil
 	}
 
 	return localRepo
 }
+
+// setExpiries sets the expiry of each role in the expiry section of the config,
+// or set by the --expiry flag.  Role names are lowercased by the config parser.
+func setExpiries(v *viper.Viper, repo client.Repository) error {
+	roles := make(map[string]bool)
+	for role := range v.GetStringMap("expiry") {
+		roles[role] = true
+	}
+	for _, key := range v.AllKeys() {
+		if strings.HasPrefix(key, "expiry.") {
+			roles[strings.TrimPrefix(key, "expiry.")] = true
+		}
+	}
+	sortedRoles := make([]string, 0, len(roles))
+	for role := range roles {
+		sortedRoles = append(sortedRoles, role)
+	}
+	sort.Strings(sortedRoles)
+
+	for _, role := range sortedRoles {
+		expiry, err := parseDuration(v.GetString("expiry." + role))
+		if err != nil {
+			return fmt.Errorf("invalid expiry.%s: %v", role, err)
+		}
+		if err := repo.SetExpiry(data.RoleName(role), expiry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+var cmdSignTemplate = usageTemplate{
+	Use:   "sign",
+	Short: "Co-signs metadata offline.",
+	Long:  "Exports, co-signs and pushes metadata for roles that need signatures from keys held by different people.",
+}
+
+var cmdSignExportTemplate = usageTemplate{
+	Use:   "export [ GUN ]",
+	Short: "Exports the unpublished changes for the Global Unique Name as partially signed metadata files.",
+	Long:  "Applies the staged changes for the Global Unique Name and writes the resulting metadata, signed with the locally available keys, to one file per role so that other key holders can add their signatures. The staged changes are kept until the metadata is published with \"notary sign push\" or \"notary sign stage\".",
+}
+
+var cmdSignAddTemplate = usageTemplate{
+	Use:   "add [ File ] ...",
+	Short: "Adds signatures to exported metadata files.",
+	Long:  "Adds signatures to metadata files produced by \"notary sign export\", using any of the role's keys that are available locally. The keys and threshold that the files name for their roles must be the ones trusted by the Global Unique Name's metadata, which is checked against the locally cached metadata if the remote trust server cannot be reached.",
+}
+
+var cmdSignPushTemplate = usageTemplate{
+	Use:   "push [ File ] ...",
+	Short: "Publishes co-signed metadata files.",
+	Long:  "Publishes metadata files produced by \"notary sign export\" to the remote trust server, once they have been signed by enough keys to meet the threshold of their roles. The staged changes for the Global Unique Name are cleared once it is published.",
+}
+
+var cmdSignStageTemplate = usageTemplate{
+	Use:   "stage [ File ] ...",
+	Short: "Uploads exported metadata files to the remote trust server's pending metadata.",
+	Long:  "Uploads metadata files produced by \"notary sign export\" or \"notary sign fetch\" to the remote trust server, which merges their signatures with the pending metadata it already holds. Once the metadata for every pending role has been signed by enough keys, the server publishes it, and the staged changes for the Global Unique Name are cleared. This requires the server to manage the snapshot key.",
+}
+
+var cmdSignFetchTemplate = usageTemplate{
+	Use:   "fetch [ GUN ]",
+	Short: "Downloads the pending metadata for the Global Unique Name from the remote trust server.",
+	Long:  "Downloads the pending metadata for the Global Unique Name from the remote trust server, and writes it to one file per role so that it can be signed using \"notary sign add\" and then uploaded again using \"notary sign stage\".",
+}
+
+var cmdSignDiscardTemplate = usageTemplate{
+	Use:   "discard [ GUN ]",
+	Short: "Discards the pending metadata for the Global Unique Name on the remote trust server.",
+	Long:  "Discards the pending metadata for the Global Unique Name on the remote trust server, along with any signatures that have been uploaded for it.",
+}
+
+type signCommander struct {
+	// these need to be set
+	configGetter func() (*viper.Viper, error)
+	retriever    notary.PassRetriever
+
+	outDir string
+}
+
+func (s *signCommander) GetCommand() *cobra.Command {
+	cmd := cmdSignTemplate.ToCommand(nil)
+
+	cmdExport := cmdSignExportTemplate.ToCommand(s.signExport)
+	cmdExport.Flags().StringVar(&s.outDir, "out", ".", "Directory to write the metadata files to")
+	cmd.AddCommand(cmdExport)
+
+	cmd.AddCommand(cmdSignAddTemplate.ToCommand(s.signAdd))
+	cmd.AddCommand(cmdSignPushTemplate.ToCommand(s.signPush))
+	cmd.AddCommand(cmdSignStageTemplate.ToCommand(s.signStage))
+
+	cmdFetch := cmdSignFetchTemplate.ToCommand(s.signFetch)
+	cmdFetch.Flags().StringVar(&s.outDir, "out", ".", "Directory to write the metadata files to")
+	cmd.AddCommand(cmdFetch)
+
+	cmd.AddCommand(cmdSignDiscardTemplate.ToCommand(s.signDiscard))
+	return cmd
+}
+
+func (s *signCommander) signExport(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, s.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	pending, err := nRepo.ExportPendingMetadata()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		cmd.Printf("No changes to export for %s\n", gun)
+		return nil
+	}
+
+	// the changes stay staged until the exported metadata is published
+	return s.writePendingFiles(cmd, "Exported", pending)
+}
+
+func (s *signCommander) signAdd(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify at least one metadata file to sign")
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	// signing is an offline operation
+	fact := ConfigureRepo(config, s.retriever, false, readOnly)
+
+	for _, filename := range args {
+		p, err := readPendingMetadata(filename)
+		if err != nil {
+			return err
+		}
+		nRepo, err := fact(p.GUN)
+		if err != nil {
+			return err
+		}
+		if err := nRepo.SignPendingMetadata(p); err != nil {
+			return fmt.Errorf("failed to sign %s: %v", filename, err)
+		}
+		if err := writePendingMetadata(filename, p); err != nil {
+			return err
+		}
+		cmd.Printf("Signed %s metadata for %s in %s: %s\n", p.Role, p.GUN, filename, pendingStatus(p))
+	}
+	return nil
+}
+
+func (s *signCommander) signPush(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify at least one metadata file to push")
+	}
+
+	pending, err := readPendingMetadataFiles(args)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := pending[0].GUN
+
+	cmd.Println("Pushing co-signed metadata to", gun)
+
+	fact := ConfigureRepo(config, s.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.PushPendingMetadata(pending...); err != nil {
+		return err
+	}
+	cmd.Printf("Successfully published co-signed metadata for repository %s\n", gun)
+	return nil
+}
+
+func (s *signCommander) signStage(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify at least one metadata file to stage")
+	}
+
+	pending, err := readPendingMetadataFiles(args)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := pending[0].GUN
+
+	fact := ConfigureRepo(config, s.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	published, err := nRepo.StagePendingMetadata(pending...)
+	if err != nil {
+		return err
+	}
+	if !published {
+		cmd.Printf("Staged metadata for repository %s, which needs more signatures before it can be published\n", gun)
+		return nil
+	}
+	cmd.Printf("Successfully published pending metadata for repository %s\n", gun)
+	return nil
+}
+
+func (s *signCommander) signFetch(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, s.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	pending, err := nRepo.GetStagedMetadata()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		cmd.Printf("No pending metadata for %s\n", gun)
+		return nil
+	}
+	return s.writePendingFiles(cmd, "Fetched", pending)
+}
+
+func (s *signCommander) signDiscard(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+
+	config, err := s.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, s.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+	if err := nRepo.DiscardStagedMetadata(); err != nil {
+		return err
+	}
+	cmd.Printf("Discarded pending metadata for %s\n", gun)
+	return nil
+}
+
+// writePendingFiles writes each role's pending metadata to its own file in the output directory
+func (s *signCommander) writePendingFiles(cmd *cobra.Command, action string, pending []*notaryclient.PendingMetadata) error {
+	for _, p := range pending {
+		filename := filepath.Join(s.outDir, filepath.FromSlash(p.Role.String())+".json")
+		if err := os.MkdirAll(filepath.Dir(filename), notary.PrivExecPerms); err != nil {
+			return err
+		}
+		if err := writePendingMetadata(filename, p); err != nil {
+			return err
+		}
+		cmd.Printf("%s %s metadata to %s: %s\n", action, p.Role, filename, pendingStatus(p))
+	}
+	return nil
+}
+
+// readPendingMetadataFiles reads metadata files, which must all be for the same GUN
+func readPendingMetadataFiles(filenames []string) ([]*notaryclient.PendingMetadata, error) {
+	var pending []*notaryclient.PendingMetadata
+	for _, filename := range filenames {
+		p, err := readPendingMetadata(filename)
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) > 0 && p.GUN != pending[0].GUN {
+			return nil, fmt.Errorf("all metadata files must be for the same GUN, but %s is for %s rather than %s", filename, p.GUN, pending[0].GUN)
+		}
+		pending = append(pending, p)
+	}
+	return pending, nil
+}
+
+func readPendingMetadata(filename string) (*notaryclient.PendingMetadata, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &notaryclient.PendingMetadata{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("%s is not an exported metadata file: %v", filename, err)
+	}
+	return p, nil
+}
+
+func writePendingMetadata(filename string, p *notaryclient.PendingMetadata) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, raw, notary.PrivNoExecPerms)
+}
+
+func pendingStatus(p *notaryclient.PendingMetadata) string {
+	if err := p.Verify(); err != nil {
+		return fmt.Sprintf("more signatures are needed (%v)", err)
+	}
+	return "ready to push"
+}
@@ -13,6 +13,8 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +29,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/theupdateframework/notary"
 	notaryclient "github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/client/changelist"
 	"github.com/theupdateframework/notary/cryptoservice"
 	"github.com/theupdateframework/notary/passphrase"
 	"github.com/theupdateframework/notary/trustmanager"
@@ -45,7 +48,7 @@ var cmdTUFListTemplate = usageTemplate{
 var cmdTUFAddTemplate = usageTemplate{
 	Use:   "add [ GUN ] <target> <file>",
 	Short: "Adds the file as a target to the trusted collection.",
-	Long:  "Adds the file as a target to the local trusted collection identified by the Globally Unique Name. This is an offline operation.  Please then use `publish` to push the changes to the remote trusted collection.",
+	Long:  "Adds the file as a target to the local trusted collection identified by the Globally Unique Name. This is an offline operation.  Please then use `publish` to push the changes to the remote trusted collection.\n\nThe file may also be a directory, whose files are all added with --recursive, or a glob pattern. Each of these files is added as a target named after its path relative to the directory, or to the part of the glob pattern before the first wildcard, under the given target name. A Go template given with --name-template names the targets instead, using the fields .Target, .Path, .Dir, .Base and .Ext. All of the targets are staged together, or not at all.",
 }
 
 var cmdTUFAddHashTemplate = usageTemplate{
@@ -69,7 +72,13 @@ var cmdTUFInitTemplate = usageTemplate{
 var cmdTUFLookupTemplate = usageTemplate{
 	Use:   "lookup [ GUN ] <target>",
 	Short: "Looks up a specific target in a remote trusted collection.",
-	Long:  "Looks up a specific target in a remote trusted collection identified by the Globally Unique Name.",
+	Long:  "Looks up a specific target in a remote trusted collection identified by the Globally Unique Name. Only the delegations that can contain the target are downloaded.",
+}
+
+var cmdTUFFetchTemplate = usageTemplate{
+	Use:   "fetch [ GUN ] <target>",
+	Short: "Downloads a target and verifies it against a remote trusted collection.",
+	Long:  "Downloads the content of a target from a content source, which is either a plain HTTP(S) base URL or a local directory, and verifies its length and hashes against the trusted collection identified by the Globally Unique Name. The content is only written once it has been verified.",
 }
 
 var cmdTUFPublishTemplate = usageTemplate{
@@ -78,10 +87,16 @@ var cmdTUFPublishTemplate = usageTemplate{
 	Long:  "Publishes the local trusted collection identified by the Globally Unique Name, sending the local changes to a remote trusted server.",
 }
 
+var cmdTUFPushTemplate = usageTemplate{
+	Use:   "push <directory> [ GUN ]",
+	Short: "Publishes metadata that was signed offline with publish --out.",
+	Long:  "Publishes the signed metadata that `notary publish --out` wrote to a directory for the trusted collection identified by the Globally Unique Name, in a single update. The metadata is checked against what has been published before anything is uploaded: it must be signed by the keys that are trusted for each role, and be newer than what has been published since it was signed. The snapshot is signed if it is not in the directory and its key is available, otherwise the server signs it.",
+}
+
 var cmdTUFStatusTemplate = usageTemplate{
 	Use:   "status [ GUN ]",
 	Short: "Displays status of unpublished changes to the local trusted collection.",
-	Long:  "Displays status of unpublished changes to the local trusted collection identified by the Globally Unique Name.",
+	Long:  "Displays status of unpublished changes to the local trusted collection identified by the Globally Unique Name.\n\nWith --squash, only the changes that will be published are shown, as changes that are made redundant by later ones are squashed before publishing.  Changes that contradict each other are reported as errors.",
 }
 
 var cmdTUFResetTemplate = usageTemplate{
@@ -102,6 +117,34 @@ var cmdWitnessTemplate = usageTemplate{
 	Long:  "Marks roles to be re-signed the next time they're published. Currently will always bump version and expiry for role. N.B. behaviour may change when thresholding is introduced.",
 }
 
+var cmdTUFRenewTemplate = usageTemplate{
+	Use:   "renew [ GUN ]",
+	Short: "Re-signs and publishes roles that are about to expire",
+	Long:  "Re-signs every role of the trusted collection identified by the Globally Unique Name that expires within the given duration and that can be signed with the local keys, bumping its version and expiry, and publishes them all in a single update.",
+}
+
+// defaultHistoryLimit is the number of versions `notary history` lists by
+// default, as each version is a request to the server
+const defaultHistoryLimit = 20
+
+var cmdTUFHistoryTemplate = usageTemplate{
+	Use:   "history [ GUN ]",
+	Short: "Lists the published versions of a role.",
+	Long:  "Lists the versions of a role's metadata that the server has kept for the trusted collection identified by the Globally Unique Name, newest first, with when each was published, when it expires and the IDs of the keys that signed it. Only the newest 20 versions are listed unless another limit is given, and older ones can be listed with --before. The versions are listed as the server stored them, without verifying their signatures.",
+}
+
+var cmdTUFDiffTemplate = usageTemplate{
+	Use:   "diff [ GUN ]",
+	Short: "Shows the differences between two published versions of a role.",
+	Long:  "Shows the differences between two published versions of the root, targets or a delegation role of the trusted collection identified by the Globally Unique Name: the targets that were added, removed or changed, and the roles whose keys, paths or threshold changed, which are the delegations of a targets or delegation role and the base roles for the root.",
+}
+
+var cmdTUFRollbackTemplate = usageTemplate{
+	Use:   "rollback [ GUN ]",
+	Short: "Restores the targets of a role to those of an earlier published version.",
+	Long:  "Restores the targets of the targets or a delegation role of the trusted collection identified by the Globally Unique Name to those of an earlier published version, which must be signed by the role's current keys. The targets are published as a new version, signed with the current keys, so that clients accept it. The role's delegations and any unpublished changes are left as they are.",
+}
+
 var cmdTUFDeleteTemplate = usageTemplate{
 	Use:   "delete [ GUN ]",
 	Short: "Deletes all content for a trusted collection",
@@ -114,12 +157,15 @@ type tufCommander struct {
 	retriever    notary.PassRetriever
 
 	// these are for command line parsing - no need to set
-	roles    []string
-	sha256   string
-	sha512   string
-	rootKey  string
-	rootCert string
-	custom   string
+	roles            []string
+	sha256           string
+	sha512           string
+	rootKeys         []string
+	rootCerts        []string
+	rootThreshold    int
+	targetsKeys      []string
+	targetsThreshold int
+	custom           string
 
 	input  string
 	output string
@@ -128,31 +174,65 @@ type tufCommander struct {
 	resetAll          bool
 	deleteIdx         []int
 	archiveChangelist string
+	squash            bool
 
 	deleteRemote bool
 
 	autoPublish bool
+
+	source string
+
+	recursive    bool
+	nameTemplate string
+
+	expiries []string
+	within   string
+
+	role          string
+	fromVersion   int
+	toVersion     int
+	beforeVersion int
+	limit         int
+
+	dryRun bool
+	outDir string
 }
 
 func (t *tufCommander) AddToCommand(cmd *cobra.Command) {
 	//
 	cmdTUFInit := cmdTUFInitTemplate.ToCommand(t.tufInit)
-	cmdTUFInit.Flags().StringVar(&t.rootKey, "rootkey", "", "Root key to initialize the repository with")
-	cmdTUFInit.Flags().StringVar(&t.rootCert, "rootcert", "", "Root certificate must match root key if a root key is supplied, otherwise it must match a key present in keystore")
+	cmdTUFInit.Flags().StringSliceVar(&t.rootKeys, "rootkey", nil, "Root key(s) to initialize the repository with")
+	cmdTUFInit.Flags().StringSliceVar(&t.rootCerts, "rootcert", nil, "Root certificate(s) must match root key(s) if root keys are supplied, otherwise they must match keys present in keystore")
+	cmdTUFInit.Flags().IntVar(&t.rootThreshold, "root-threshold", notary.MinThreshold, "Number of root key signatures required to sign the root role")
+	cmdTUFInit.Flags().StringSliceVar(&t.targetsKeys, "targetskey", nil, "Targets key(s) to initialize the repository with. If not specified, one will be generated.")
+	cmdTUFInit.Flags().IntVar(&t.targetsThreshold, "targets-threshold", notary.MinThreshold, "Number of targets key signatures required to sign the targets role")
 	cmdTUFInit.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
 	cmd.AddCommand(cmdTUFInit)
 
-	cmd.AddCommand(cmdTUFStatusTemplate.ToCommand(t.tufStatus))
+	cmdStatus := cmdTUFStatusTemplate.ToCommand(t.tufStatus)
+	cmdStatus.Flags().BoolVar(&t.squash, "squash", false, "Show the changes left once redundant changes are squashed, as they will be published")
+	cmd.AddCommand(cmdStatus)
 
 	cmdReset := cmdTUFResetTemplate.ToCommand(t.tufReset)
 	cmdReset.Flags().IntSliceVarP(&t.deleteIdx, "number", "n", nil, "Numbers of specific changes to exclusively reset, as shown in status list")
 	cmdReset.Flags().BoolVar(&t.resetAll, "all", false, "Reset all changes shown in the status list")
 	cmd.AddCommand(cmdReset)
 
-	cmd.AddCommand(cmdTUFPublishTemplate.ToCommand(t.tufPublish))
+	cmdTUFPublish := cmdTUFPublishTemplate.ToCommand(t.tufPublish)
+	cmdTUFPublish.Flags().StringSliceVar(&t.expiries, "expiry", nil, htExpiry)
+	cmdTUFPublish.Flags().BoolVar(&t.dryRun, "dry-run", false, "Show what would be published and the keys needed to sign it, without signing or publishing anything")
+	cmdTUFPublish.Flags().StringVar(&t.outDir, "out", "", "Sign the changes on top of the cached metadata and write the metadata to this directory, to be published with `notary push`, instead of publishing it")
+	cmd.AddCommand(cmdTUFPublish)
+
+	cmd.AddCommand(cmdTUFPushTemplate.ToCommand(t.tufPush))
 
 	cmd.AddCommand(cmdTUFLookupTemplate.ToCommand(t.tufLookup))
 
+	cmdTUFFetch := cmdTUFFetchTemplate.ToCommand(t.tufFetch)
+	cmdTUFFetch.Flags().StringVar(&t.source, "source", "", "HTTP(S) base URL or local directory to download the target from, instead of the configured content_source")
+	cmdTUFFetch.Flags().StringVarP(&t.output, "output", "o", "", "Write to a file, instead of a file named after the target in the current directory")
+	cmd.AddCommand(cmdTUFFetch)
+
 	cmdTUFList := cmdTUFListTemplate.ToCommand(t.tufList)
 	cmdTUFList.Flags().StringSliceVarP(
 		&t.roles, "roles", "r", nil, "Delegation roles to list targets for (will shadow targets role)")
@@ -162,6 +242,8 @@ func (t *tufCommander) AddToCommand(cmd *cobra.Command) {
 	cmdTUFAdd.Flags().StringSliceVarP(&t.roles, "roles", "r", nil, "Delegation roles to add this target to")
 	cmdTUFAdd.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
 	cmdTUFAdd.Flags().StringVar(&t.custom, "custom", "", "Path to the file containing custom data for this target")
+	cmdTUFAdd.Flags().BoolVarP(&t.recursive, "recursive", "R", false, "Add all of the files in a directory as targets")
+	cmdTUFAdd.Flags().StringVar(&t.nameTemplate, "name-template", "", "Go template for the names of the targets being added, e.g. \"{{.Target}}/{{.Base}}\"")
 	cmd.AddCommand(cmdTUFAdd)
 
 	cmdTUFRemove := cmdTUFRemoveTemplate.ToCommand(t.tufRemove)
@@ -185,8 +267,31 @@ func (t *tufCommander) AddToCommand(cmd *cobra.Command) {
 
 	cmdWitness := cmdWitnessTemplate.ToCommand(t.tufWitness)
 	cmdWitness.Flags().BoolVarP(&t.autoPublish, "publish", "p", false, htAutoPublish)
+	cmdWitness.Flags().StringSliceVar(&t.expiries, "expiry", nil, htExpiry+", when publishing with -p")
 	cmd.AddCommand(cmdWitness)
 
+	cmdTUFRenew := cmdTUFRenewTemplate.ToCommand(t.tufRenew)
+	cmdTUFRenew.Flags().StringVar(&t.within, "within", "30d", "Renew the roles that expire within this duration, e.g. 30d or 720h")
+	cmdTUFRenew.Flags().StringSliceVar(&t.expiries, "expiry", nil, htExpiry)
+	cmd.AddCommand(cmdTUFRenew)
+
+	cmdTUFHistory := cmdTUFHistoryTemplate.ToCommand(t.tufHistory)
+	cmdTUFHistory.Flags().StringVarP(&t.role, "role", "r", data.CanonicalTargetsRole.String(), "Role to list the versions of")
+	cmdTUFHistory.Flags().IntVar(&t.beforeVersion, "before", 0, "Only list the versions older than this one")
+	cmdTUFHistory.Flags().IntVar(&t.limit, "limit", defaultHistoryLimit, "Maximum number of versions to list, or 0 to list all of them")
+	cmd.AddCommand(cmdTUFHistory)
+
+	cmdTUFDiff := cmdTUFDiffTemplate.ToCommand(t.tufDiff)
+	cmdTUFDiff.Flags().StringVarP(&t.role, "role", "r", data.CanonicalTargetsRole.String(), "Role to compare versions of: root, targets or a delegation role")
+	cmdTUFDiff.Flags().IntVar(&t.fromVersion, "from", 0, "Version to compare from")
+	cmdTUFDiff.Flags().IntVar(&t.toVersion, "to", 0, "Version to compare to")
+	cmd.AddCommand(cmdTUFDiff)
+
+	cmdTUFRollback := cmdTUFRollbackTemplate.ToCommand(t.tufRollback)
+	cmdTUFRollback.Flags().StringVarP(&t.role, "role", "r", data.CanonicalTargetsRole.String(), "Role to roll back: targets or a delegation role")
+	cmdTUFRollback.Flags().IntVar(&t.toVersion, "to-version", 0, "Version whose targets to restore")
+	cmd.AddCommand(cmdTUFRollback)
+
 	cmdTUFDeleteGUN := cmdTUFDeleteTemplate.ToCommand(t.tufDeleteGUN)
 	cmdTUFDeleteGUN.Flags().BoolVar(&t.deleteRemote, "remote", false, "Delete remote data for GUN in addition to local cache")
 	cmd.AddCommand(cmdTUFDeleteGUN)
@@ -204,6 +309,12 @@ func (t *tufCommander) tufWitness(cmd *cobra.Command, args []string) error {
 
 	gun := data.GUN(args[0])
 	roles := data.NewRoleList(args[1:])
+	if len(t.expiries) > 0 && !t.autoPublish {
+		return fmt.Errorf("--expiry only applies when the witnessed roles are published with -p")
+	}
+	if err := setExpiryFlags(config, t.expiries); err != nil {
+		return err
+	}
 
 	fact := ConfigureRepo(config, t.retriever, false, readOnly)
 	nRepo, err := fact(gun)
@@ -212,6 +323,22 @@ func (t *tufCommander) tufWitness(cmd *cobra.Command, args []string) error {
 	}
 
 	success, err := nRepo.Witness(roles...)
+	if format := outputFormat(config); format != outputTable {
+		result := witnessResult{GUN: gun, Witnessed: success}
+		if result.Witnessed == nil {
+			result.Witnessed = []data.RoleName{}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if t.autoPublish {
+			if err := publishQuietly(gun, config, t.retriever); err != nil {
+				return err
+			}
+			result.Published = true
+		}
+		return writeStructured(cmd.OutOrStdout(), format, result)
+	}
 	if err != nil {
 		cmd.Printf("Some roles have failed to be marked for witnessing: %s", err.Error())
 	}
@@ -356,16 +483,22 @@ func (t *tufCommander) tufAdd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	target, err := notaryclient.NewTarget(targetName, targetPath, targetCustom)
+	files, err := getTargetFiles(targetName, targetPath, t.nameTemplate, t.recursive)
+	if err != nil {
+		return err
+	}
+	targets, err := notaryclient.NewTargets(files, targetCustom, runtime.NumCPU())
 	if err != nil {
 		return err
 	}
 	// If roles is empty, we default to adding to targets
-	if err = nRepo.AddTarget(target, data.NewRoleList(t.roles)...); err != nil {
+	if err = nRepo.AddTargets(targets, data.NewRoleList(t.roles)...); err != nil {
 		return err
 	}
 
-	cmd.Printf("Addition of target \"%s\" to repository \"%s\" staged for next publish.\n", targetName, gun)
+	for _, target := range targets {
+		cmd.Printf("Addition of target \"%s\" to repository \"%s\" staged for next publish.\n", target.Name, gun)
+	}
 
 	return maybeAutoPublish(cmd, t.autoPublish, gun, config, t.retriever)
 }
@@ -408,36 +541,61 @@ func (t *tufCommander) tufDeleteGUN(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// importRootKey imports the root key from path then adds the key to repo
+// importRootKey imports the root keys from paths then adds the keys to repo
 // returns key ids
-func importRootKey(cmd *cobra.Command, rootKey string, nRepo notaryclient.Repository, retriever notary.PassRetriever) ([]string, error) {
-	var rootKeyList []string
+func importRootKey(cmd *cobra.Command, rootKeys []string, nRepo notaryclient.Repository, retriever notary.PassRetriever) ([]string, error) {
+	rootKeyList, err := importKeyFiles(data.CanonicalRootRole, "", rootKeys, nRepo, retriever)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rootKeyList) == 0 {
+		rootKeyList = nRepo.GetCryptoService().ListKeys(data.CanonicalRootRole)
+		if len(rootKeyList) > 0 {
+			// Chooses the first root key available, which is initialization specific
+			// but should return the HW one first.
+			rootKeyList = rootKeyList[:1]
+		}
+	}
 
-	if rootKey != "" {
-		privKey, err := readKey(data.CanonicalRootRole, rootKey, retriever)
+	for _, rootKeyID := range rootKeyList {
+		cmd.Printf("Root key found, using: %s\n", rootKeyID)
+	}
+	return rootKeyList, nil
+}
+
+// importKeyFiles reads the private keys from the given files and adds them to the
+// repo's key storage for the given role
+// returns key ids
+func importKeyFiles(role data.RoleName, gun data.GUN, keyFiles []string, nRepo notaryclient.Repository, retriever notary.PassRetriever) ([]string, error) {
+	keyIDs := make([]string, 0, len(keyFiles))
+	for _, keyFile := range keyFiles {
+		privKey, err := readKey(role, keyFile, retriever)
 		if err != nil {
 			return nil, err
 		}
-		// add root key to repo
-		err = nRepo.GetCryptoService().AddKey(data.CanonicalRootRole, "", privKey)
+		err = nRepo.GetCryptoService().AddKey(role, gun, privKey)
 		if err != nil {
 			return nil, fmt.Errorf("Error importing key: %v", err)
 		}
-		rootKeyList = []string{privKey.ID()}
-	} else {
-		rootKeyList = nRepo.GetCryptoService().ListKeys(data.CanonicalRootRole)
+		keyIDs = append(keyIDs, privKey.ID())
 	}
+	return keyIDs, nil
+}
 
-	if len(rootKeyList) > 0 {
-		// Chooses the first root key available, which is initialization specific
-		// but should return the HW one first.
-		rootKeyID := rootKeyList[0]
-		cmd.Printf("Root key found, using: %s\n", rootKeyID)
+// importRootCerts imports the base64 encoded public certificates corresponding to the root keys
+// returns empty slice if no paths are given
+func importRootCerts(certFilePaths []string) ([]data.PublicKey, error) {
+	publicKeys := make([]data.PublicKey, 0, len(certFilePaths))
 
-		return []string{rootKeyID}, nil
+	for _, certFilePath := range certFilePaths {
+		certKeys, err := importRootCert(certFilePath)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, certKeys...)
 	}
-
-	return []string{}, nil
+	return publicKeys, nil
 }
 
 // importRootCert imports the base64 encoded public certificate corresponding to the root key
@@ -487,22 +645,31 @@ func (t *tufCommander) tufInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	rootKeyIDs, err := importRootKey(cmd, t.rootKey, nRepo, t.retriever)
+	rootKeyIDs, err := importRootKey(cmd, t.rootKeys, nRepo, t.retriever)
 	if err != nil {
 		return err
 	}
 
-	rootCerts, err := importRootCert(t.rootCert)
+	rootCerts, err := importRootCerts(t.rootCerts)
 	if err != nil {
 		return err
 	}
 
 	// if key is not defined but cert is, then clear the key to to allow key to be searched in keystore
-	if t.rootKey == "" && t.rootCert != "" {
+	if len(t.rootKeys) == 0 && len(t.rootCerts) != 0 {
 		rootKeyIDs = []string{}
 	}
 
-	if err = nRepo.InitializeWithCertificate(rootKeyIDs, rootCerts); err != nil {
+	targetsKeyIDs, err := importKeyFiles(data.CanonicalTargetsRole, gun, t.targetsKeys, nRepo, t.retriever)
+	if err != nil {
+		return err
+	}
+
+	roleSpecs := map[data.RoleName]notaryclient.BaseRoleSpec{
+		data.CanonicalRootRole:    {KeyIDs: rootKeyIDs, Threshold: t.rootThreshold},
+		data.CanonicalTargetsRole: {KeyIDs: targetsKeyIDs, Threshold: t.targetsThreshold},
+	}
+	if err = nRepo.InitializeWithRoleSpecs(rootCerts, roleSpecs); err != nil {
 		return err
 	}
 
@@ -559,8 +726,21 @@ func (t *tufCommander) tufList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	prettyPrintTargets(targetList, cmd.OutOrStdout())
-	return nil
+	format := outputFormat(config)
+	if format == outputTable {
+		prettyPrintTargets(targetList, cmd.OutOrStdout())
+		return nil
+	}
+	signatures, err := getTargetSignatures(nRepo, "")
+	if err != nil {
+		return err
+	}
+	sort.Stable(targetsSorter(targetList))
+	result := listResult{GUN: gun, Targets: make([]targetInfo, 0, len(targetList))}
+	for _, target := range targetList {
+		result.Targets = append(result.Targets, newTargetInfo(target, signatures[target.Role]))
+	}
+	return writeStructured(cmd.OutOrStdout(), format, result)
 }
 
 func (t *tufCommander) tufLookup(cmd *cobra.Command, args []string) error {
@@ -587,10 +767,86 @@ func (t *tufCommander) tufLookup(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cmd.Println(target.Name, fmt.Sprintf("sha256:%x", target.Hashes["sha256"]), target.Length)
+	format := outputFormat(config)
+	if format == outputTable {
+		cmd.Println(target.Name, fmt.Sprintf("sha256:%x", target.Hashes["sha256"]), target.Length)
+		return nil
+	}
+	result, err := lookupTarget(nRepo, target)
+	if err != nil {
+		return err
+	}
+	return writeStructured(cmd.OutOrStdout(), format, result)
+}
+
+// lookupTarget returns the output form of a target that was looked up, with
+// the signatures on the metadata of the role that it was found in
+func lookupTarget(nRepo notaryclient.Repository, target *notaryclient.TargetWithRole) (lookupResult, error) {
+	signatures, err := getTargetSignatures(nRepo, target.Name)
+	if err != nil {
+		return lookupResult{}, err
+	}
+	return lookupResult{
+		GUN:    nRepo.GetGUN(),
+		Target: newTargetInfo(target, signatures[target.Role]),
+	}, nil
+}
+
+func (t *tufCommander) tufFetch(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN and target")
+	}
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+
+	gun := data.GUN(args[0])
+	targetName := args[1]
+
+	location := t.source
+	if location == "" {
+		location = getContentSource(config)
+	}
+	if location == "" {
+		return fmt.Errorf("Must specify a content source with --source, or content_source in the configuration file")
+	}
+	source, err := notaryclient.NewContentSource(location, nil)
+	if err != nil {
+		return err
+	}
+
+	dest := t.output
+	if dest == "" {
+		dest = path.Base(targetName)
+	}
+
+	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	target, err := nRepo.FetchTarget(targetName, source, dest)
+	if err != nil {
+		return err
+	}
+
+	cmd.Printf("Verified %s (%d bytes) and wrote it to %s\n", target.Name, target.Length, dest)
 	return nil
 }
 
+// getContentSource returns the configured content source, with a directory
+// being relative to the configuration file
+func getContentSource(config *viper.Viper) string {
+	location := config.GetString("content_source")
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location
+	}
+	return utils.GetPathRelativeToConfig(config, "content_source")
+}
+
 func (t *tufCommander) tufStatus(cmd *cobra.Command, args []string) error {
 	if len(args) < 1 {
 		cmd.Usage()
@@ -614,17 +870,48 @@ func (t *tufCommander) tufStatus(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if len(cl.List()) == 0 {
+	changes := cl.List()
+	format := outputFormat(config)
+	if len(changes) == 0 && format == outputTable {
 		cmd.Printf("No unpublished changes for %s\n", gun)
 		return nil
 	}
 
-	cmd.Printf("Unpublished changes for %s:\n\n", gun)
+	// the changes keep their numbers in the full list, so that they can be reset
+	indices := make([]int, len(changes))
+	for i := range changes {
+		indices[i] = i
+	}
+	if t.squash {
+		if indices, err = changelist.SquashedIndices(changes); err != nil {
+			return err
+		}
+	}
+	if format != outputTable {
+		result := statusResult{GUN: gun, Squashed: t.squash, Changes: make([]changeInfo, 0, len(indices))}
+		for _, i := range indices {
+			ch := changes[i]
+			result.Changes = append(result.Changes, changeInfo{
+				Number: i,
+				Action: ch.Action(),
+				Scope:  ch.Scope(),
+				Type:   ch.Type(),
+				Path:   ch.Path(),
+			})
+		}
+		return writeStructured(cmd.OutOrStdout(), format, result)
+	}
+	if t.squash {
+		cmd.Printf("Unpublished changes for %s, squashed from %d to %d:\n\n", gun, len(changes), len(indices))
+	} else {
+		cmd.Printf("Unpublished changes for %s:\n\n", gun)
+	}
 	tw := initTabWriter(
 		[]string{"#", "ACTION", "SCOPE", "TYPE", "PATH"},
 		cmd.OutOrStdout(),
 	)
-	for i, ch := range cl.List() {
+	for _, i := range indices {
+		ch := changes[i]
 		fmt.Fprintf(
 			tw,
 			fiveItemRow,
@@ -689,6 +976,18 @@ func (t *tufCommander) tufPublish(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	gun := data.GUN(args[0])
+	if err := setExpiryFlags(config, t.expiries); err != nil {
+		return err
+	}
+	if t.dryRun && t.outDir != "" {
+		return fmt.Errorf("--dry-run and --out cannot be used together")
+	}
+	if t.dryRun {
+		return t.publishDryRun(cmd, config, gun)
+	}
+	if t.outDir != "" {
+		return t.publishToDirectory(cmd, config, gun)
+	}
 
 	cmd.Println("Pushing changes to", gun)
 
@@ -701,6 +1000,246 @@ func (t *tufCommander) tufPublish(cmd *cobra.Command, args []string) error {
 	return publishAndPrintToCLI(cmd, nRepo)
 }
 
+// publishDryRun shows what publishing the changelist would do, which only
+// needs read access to the server
+func (t *tufCommander) publishDryRun(cmd *cobra.Command, config *viper.Viper, gun data.GUN) error {
+	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	plan, err := nRepo.PublishDryRun()
+	if err != nil {
+		return err
+	}
+
+	format := outputFormat(config)
+	if format != outputTable {
+		return writeStructured(cmd.OutOrStdout(), format, newPublishPlanResult(gun, plan))
+	}
+	cmd.Printf("Publishing %s would sign and upload the following, but nothing has been published:\n\n", gun)
+	prettyPrintPublishPlan(plan, cmd.OutOrStdout())
+	return nil
+}
+
+// publishToDirectory signs the changelist without contacting the server, and
+// writes the signed metadata to a directory instead of publishing it
+func (t *tufCommander) publishToDirectory(cmd *cobra.Command, config *viper.Viper, gun data.GUN) error {
+	fact := ConfigureRepo(config, t.retriever, false, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	roles, err := nRepo.PublishToDirectory(t.outDir)
+	if err != nil {
+		return err
+	}
+	return printSignedMetadata(cmd, config, gun, t.outDir, roles,
+		fmt.Sprintf("Wrote the signed metadata for %s to %s, to be published with `notary push`:", gun, t.outDir))
+}
+
+func (t *tufCommander) tufPush(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a directory and a GUN")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	dir := args[0]
+	gun := data.GUN(args[1])
+
+	fact := ConfigureRepo(config, t.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	roles, err := nRepo.PushDirectory(dir)
+	if err != nil {
+		return err
+	}
+	return printSignedMetadata(cmd, config, gun, dir, roles,
+		fmt.Sprintf("Published the signed metadata in %s to %s:", dir, gun))
+}
+
+// printSignedMetadata prints the roles written by `publish --out` or published
+// by `push`, after the given message
+func printSignedMetadata(cmd *cobra.Command, config *viper.Viper, gun data.GUN, dir string, roles []data.RoleName, message string) error {
+	format := outputFormat(config)
+	if format != outputTable {
+		return writeStructured(cmd.OutOrStdout(), format, signedMetadataResult{GUN: gun, Directory: dir, Roles: roles})
+	}
+	cmd.Println(message)
+	for _, role := range roles {
+		cmd.Printf("\t- %s\n", role)
+	}
+	return nil
+}
+
+func (t *tufCommander) tufRenew(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+	within, err := parseDuration(t.within)
+	if err != nil || within <= 0 {
+		return fmt.Errorf("invalid duration for --within: %q", t.within)
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+	if err := setExpiryFlags(config, t.expiries); err != nil {
+		return err
+	}
+
+	fact := ConfigureRepo(config, t.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	result, err := nRepo.Renew(within)
+	if err != nil {
+		return err
+	}
+	if len(result.Renewed) == 0 {
+		cmd.Printf("No roles of %s that can be signed locally expire within %s\n", gun, t.within)
+	} else {
+		cmd.Printf("Renewed the following roles of %s:\n", gun)
+		for _, renewed := range result.Renewed {
+			cmd.Printf("\t- %s: version %d, expires %s\n", renewed.Role, renewed.Version, renewed.Expires.Format(time.RFC3339))
+		}
+	}
+	if len(result.Skipped) > 0 {
+		cmd.Printf("The following roles expire within %s, but not enough of their keys are available to renew them:\n", t.within)
+		for _, skipped := range result.Skipped {
+			cmd.Printf("\t- %s: version %d, expires %s\n", skipped.Role, skipped.Version, skipped.Expires.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func (t *tufCommander) tufHistory(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+	role := data.RoleName(t.role)
+
+	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	history, err := nRepo.GetRoleHistory(role, t.beforeVersion, t.limit)
+	if err != nil {
+		return err
+	}
+
+	format := outputFormat(config)
+	if format == outputTable {
+		prettyPrintHistory(history, cmd.OutOrStdout())
+		if oldest := len(history) - 1; t.limit > 0 && len(history) == t.limit && history[oldest].Version > 1 {
+			cmd.Printf("Older versions can be listed with --before %d\n", history[oldest].Version)
+		}
+		return nil
+	}
+	return writeStructured(cmd.OutOrStdout(), format, newHistoryResult(gun, role, history))
+}
+
+func (t *tufCommander) tufDiff(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+	if !cmd.Flags().Changed("from") || !cmd.Flags().Changed("to") {
+		cmd.Usage()
+		return fmt.Errorf("Must specify the versions to compare with --from and --to")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, t.retriever, true, readOnly)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	diff, err := nRepo.DiffRoleVersions(data.RoleName(t.role), t.fromVersion, t.toVersion)
+	if err != nil {
+		return err
+	}
+
+	format := outputFormat(config)
+	if format == outputTable {
+		prettyPrintDiff(diff, cmd.OutOrStdout())
+		return nil
+	}
+	return writeStructured(cmd.OutOrStdout(), format, newDiffResult(gun, diff))
+}
+
+func (t *tufCommander) tufRollback(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		cmd.Usage()
+		return fmt.Errorf("Must specify a GUN")
+	}
+	if !cmd.Flags().Changed("to-version") {
+		cmd.Usage()
+		return fmt.Errorf("Must specify the version to roll back to with --to-version")
+	}
+
+	config, err := t.configGetter()
+	if err != nil {
+		return err
+	}
+	gun := data.GUN(args[0])
+
+	fact := ConfigureRepo(config, t.retriever, true, readWrite)
+	nRepo, err := fact(gun)
+	if err != nil {
+		return err
+	}
+
+	result, err := nRepo.Rollback(data.RoleName(t.role), t.toVersion)
+	if err != nil {
+		return err
+	}
+
+	format := outputFormat(config)
+	if format != outputTable {
+		return writeStructured(cmd.OutOrStdout(), format, newRollbackResult(gun, result))
+	}
+	if len(result.Targets) == 0 {
+		cmd.Printf("The targets of %s in %s are already those of version %d\n", result.Role, gun, result.RolledBackTo)
+		return nil
+	}
+	cmd.Printf("Rolled back %s in %s to the targets of version %d, published as version %d:\n",
+		result.Role, gun, result.RolledBackTo, result.Version)
+	for _, target := range result.Targets {
+		cmd.Printf("\t- %s: %s\n", target.Name, target.Change)
+	}
+	return nil
+}
+
 func (t *tufCommander) tufRemove(cmd *cobra.Command, args []string) error {
 	if len(args) < 2 {
 		return fmt.Errorf("Must specify a GUN and target")
@@ -763,7 +1302,23 @@ func (t *tufCommander) tufVerify(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("data not present in the trusted collection, %v", err)
 	}
 
-	return feedback(t, payload)
+	format := outputFormat(config)
+	if format == outputTable || t.quiet {
+		return feedback(t, payload)
+	}
+	// the verified content can still be written to a file, but only the
+	// result of verifying it is written to STDOUT
+	if t.output != "" {
+		if err := ioutil.WriteFile(t.output, payload, 0644); err != nil {
+			return err
+		}
+	}
+	result, err := lookupTarget(nRepo, target)
+	if err != nil {
+		return err
+	}
+	result.Verified = true
+	return writeStructured(cmd.OutOrStdout(), format, result)
 }
 
 type passwordStore struct {
@@ -963,7 +1518,17 @@ func tokenAuth(trustServerURL string, baseTransport *http.Transport, gun data.GU
 		return nil, fmt.Errorf("Invalid permission requested for token authentication of gun %s", gun)
 	}
 
-	tokenHandler := auth.NewTokenHandler(authTransport, ps, gun.String(), actions...)
+	var tokenHandler auth.AuthenticationHandler
+	if gun == "" {
+		// without a GUN, the only resource to access is the server's catalog
+		tokenHandler = auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
+			Transport:   authTransport,
+			Credentials: ps,
+			Scopes:      []auth.Scope{auth.RegistryScope{Name: "catalog", Actions: actions}},
+		})
+	} else {
+		tokenHandler = auth.NewTokenHandler(authTransport, ps, gun.String(), actions...)
+	}
 	basicHandler := auth.NewBasicHandler(ps)
 
 	modifier := auth.NewAuthorizer(challengeManager, tokenHandler, basicHandler)
@@ -1049,24 +1614,25 @@ func maybeAutoPublish(cmd *cobra.Command, doPublish bool, gun data.GUN, config *
 	}
 
 	// We need to set up a http RoundTripper when publishing
-	rt, err := getTransport(config, gun, readWrite)
+	fact := ConfigureRepo(config, passRetriever, true, readWrite)
+	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
 
-	trustPin, err := getTrustPinning(config)
-	if err != nil {
-		return err
-	}
+	cmd.Println("Auto-publishing changes to", nRepo.GetGUN())
+	return publishAndPrintToCLI(cmd, nRepo)
+}
 
-	nRepo, err := notaryclient.NewFileCachedRepository(
-		config.GetString("trust_dir"), gun, getRemoteTrustServer(config), rt, passRetriever, trustPin)
+// publishQuietly publishes as with -p, without reporting on it, for when
+// the result of a command is being output as JSON or YAML
+func publishQuietly(gun data.GUN, config *viper.Viper, passRetriever notary.PassRetriever) error {
+	fact := ConfigureRepo(config, passRetriever, true, readWrite)
+	nRepo, err := fact(gun)
 	if err != nil {
 		return err
 	}
-
-	cmd.Println("Auto-publishing changes to", nRepo.GetGUN())
-	return publishAndPrintToCLI(cmd, nRepo)
+	return nRepo.Publish()
 }
 
 func publishAndPrintToCLI(cmd *cobra.Command, nRepo notaryclient.Repository) error {
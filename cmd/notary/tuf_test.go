@@ -270,6 +270,60 @@ func TestConfigureRepoAdmin(t *testing.T) {
 	repo.ListRoles()
 }
 
+func TestConfigureRepoDownloadWorkers(t *testing.T) {
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+	v := viper.New()
+	v.SetDefault("trust_dir", tempBaseDir)
+
+	v.Set("remote_server.download_workers", 2)
+	_, err := ConfigureRepo(v, nil, false, readOnly)("yes")
+	require.NoError(t, err)
+
+	v.Set("remote_server.download_workers", 0)
+	_, err = ConfigureRepo(v, nil, false, readOnly)("yes")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "download_workers")
+}
+
+func TestConfigureRepoPublishRetries(t *testing.T) {
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+	v := viper.New()
+	v.SetDefault("trust_dir", tempBaseDir)
+
+	for _, retries := range []int{0, 5} {
+		v.Set("remote_server.publish_retries", retries)
+		_, err := ConfigureRepo(v, nil, false, readOnly)("yes")
+		require.NoError(t, err)
+	}
+
+	v.Set("remote_server.publish_retries", -1)
+	_, err := ConfigureRepo(v, nil, false, readOnly)("yes")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "publish_retries")
+}
+
+func TestConfigureRepoExpiries(t *testing.T) {
+	tempBaseDir := tempDirWithConfig(t, "{}")
+	defer os.RemoveAll(tempBaseDir)
+	v := viper.New()
+	v.SetDefault("trust_dir", tempBaseDir)
+
+	v.Set("expiry", map[string]interface{}{"targets": "90d", "targets/releases": "720h", "root": "5y"})
+	_, err := ConfigureRepo(v, nil, false, readOnly)("yes")
+	require.NoError(t, err)
+
+	for role, invalid := range map[string]string{"snapshot": "soon", "targets": "1h", "timestamp": "1d"} {
+		v := viper.New()
+		v.SetDefault("trust_dir", tempBaseDir)
+		v.Set("expiry", map[string]interface{}{role: invalid})
+		_, err = ConfigureRepo(v, nil, false, readOnly)("yes")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "expiry")
+	}
+}
+
 func TestStatusUnstageAndReset(t *testing.T) {
 	setUp(t)
 	tempBaseDir := tempDirWithConfig(t, "{}")
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
 )
 
 const (
 	// The help text of auto publish
 	htAutoPublish string = "Automatically attempt to publish after staging the change. Will also publish existing staged changes."
+	// The help text of the expiry flag
+	htExpiry string = "Expiry of the metadata signed for a role, as ROLE=DURATION, e.g. targets=90d or snapshot=720h"
 )
 
 // getPayload is a helper function to get the content used to be verified
@@ -62,3 +77,162 @@ func homeExpand(homeDir, path string) string {
 	}
 	return filepath.Join(homeDir, path[1:])
 }
+
+// parseDuration parses a duration such as "720h" or "1h30m", or a whole number
+// of days or years such as "90d" or "2y", where a year is 365 days
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": notary.Day, "y": notary.Year}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(s, suffix), 10, 64)
+		if err != nil || n < 0 || n > int64(math.MaxInt64/unit) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// setExpiryFlags validates the values of an --expiry flag, which are each
+// ROLE=DURATION, and sets them in the config, overriding its expiry section
+func setExpiryFlags(config *viper.Viper, expiries []string) error {
+	for _, expiry := range expiries {
+		parts := strings.SplitN(expiry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("invalid --expiry %q: must be ROLE=DURATION, e.g. targets=90d", expiry)
+		}
+		if _, err := parseDuration(parts[1]); err != nil {
+			return fmt.Errorf("invalid --expiry %q: %v", expiry, err)
+		}
+		config.Set("expiry."+strings.ToLower(parts[0]), parts[1])
+	}
+	return nil
+}
+
+// targetNameData is what a target name template is executed with for each file
+// being added as a target
+type targetNameData struct {
+	Target string // the target name given on the command line
+	Path   string // the file's path relative to the directory it was found in, with forward slashes
+	Dir    string // the directory part of Path, or "." if there is none
+	Base   string // the file's name
+	Ext    string // the extension of the file's name, including the dot
+}
+
+// getTargetFiles returns the files to add as targets, and their target names,
+// for the file argument of `notary add`.  This is either a single file, a
+// directory whose files are all added (only if recursive is set), or a glob
+// pattern matching files or directories.
+//
+// A single file is added with the given target name.  Otherwise, each file is
+// named after its path relative to the directory or to the non-pattern part of
+// the glob, under the given target name.  If a name template is given, it is
+// used to name all of the files instead.
+func getTargetFiles(targetName, filePath, nameTemplate string, recursive bool) ([]notaryclient.TargetFile, error) {
+	var tmpl *template.Template
+	if nameTemplate != "" {
+		var err error
+		if tmpl, err = template.New("name").Option("missingkey=error").Parse(nameTemplate); err != nil {
+			return nil, fmt.Errorf("invalid target name template: %v", err)
+		}
+	}
+
+	var matches []string
+	baseDir := filePath
+	if strings.ContainsAny(filePath, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(filePath); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %s: %v", filePath, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", filePath)
+		}
+		for strings.ContainsAny(baseDir, "*?[") {
+			baseDir = filepath.Dir(baseDir)
+		}
+	} else {
+		fi, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode().IsRegular() && tmpl == nil {
+			return []notaryclient.TargetFile{{Name: targetName, Path: filePath}}, nil
+		}
+		if !fi.IsDir() {
+			baseDir = filepath.Dir(filePath)
+		}
+		matches = []string{filePath}
+	}
+
+	var paths []string
+	for _, match := range matches {
+		fi, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case fi.Mode().IsRegular():
+			paths = append(paths, match)
+		case fi.IsDir():
+			if !recursive {
+				return nil, fmt.Errorf("%s is a directory: use --recursive to add the files in it", match)
+			}
+			err := filepath.Walk(match, func(p string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Mode().IsRegular() {
+					paths = append(paths, p)
+				} else if !info.IsDir() {
+					logrus.Debugf("skipping %s, which is not a regular file", p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		default:
+			logrus.Debugf("skipping %s, which is not a regular file", match)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files found in %s", filePath)
+	}
+
+	files := make([]notaryclient.TargetFile, 0, len(paths))
+	names := make(map[string]string)
+	for _, p := range paths {
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		name := path.Join(targetName, rel)
+		if tmpl != nil {
+			nameData := targetNameData{
+				Target: targetName,
+				Path:   rel,
+				Dir:    path.Dir(rel),
+				Base:   path.Base(rel),
+				Ext:    path.Ext(rel),
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, nameData); err != nil {
+				return nil, fmt.Errorf("invalid target name template: %v", err)
+			}
+			name = buf.String()
+		}
+		if name == "" {
+			return nil, fmt.Errorf("the target name for %s is empty", p)
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be added as the target %s", other, p, name)
+		}
+		names[name] = p
+		files = append(files, notaryclient.TargetFile{Name: name, Path: p})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
@@ -6,8 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
+	notaryclient "github.com/theupdateframework/notary/client"
 )
 
 func TestGetPayload(t *testing.T) {
@@ -61,3 +64,95 @@ func TestHomeExpand(t *testing.T) {
 	require.Equal(t, homeExpand("home", "~cyli"), "~cyli")
 	require.Equal(t, homeExpand(string(os.PathSeparator)+"home", filepath.Join("~", "test")), string(os.PathSeparator)+filepath.Join("home", "test"))
 }
+
+func TestGetTargetFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "test-get-target-files")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	for _, name := range []string{"a.txt", "b.bin", filepath.Join("sub", "c.txt")} {
+		p := filepath.Join(tempDir, "dist", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte(name), 0644))
+	}
+	dist := filepath.Join(tempDir, "dist")
+
+	requireFiles := func(expected map[string]string, files []notaryclient.TargetFile) {
+		require.Len(t, files, len(expected))
+		for _, f := range files {
+			require.Equal(t, filepath.Join(dist, expected[f.Name]), f.Path, f.Name)
+		}
+	}
+
+	// a single file is added with the given name
+	files, err := getTargetFiles("latest", filepath.Join(dist, "a.txt"), "", false)
+	require.NoError(t, err)
+	requireFiles(map[string]string{"latest": "a.txt"}, files)
+
+	// directories need to be recursive
+	_, err = getTargetFiles("v1", dist, "", false)
+	require.Error(t, err)
+	files, err = getTargetFiles("v1", dist, "", true)
+	require.NoError(t, err)
+	requireFiles(map[string]string{
+		"v1/a.txt":     "a.txt",
+		"v1/b.bin":     "b.bin",
+		"v1/sub/c.txt": filepath.Join("sub", "c.txt"),
+	}, files)
+	require.Equal(t, "v1/a.txt", files[0].Name)
+
+	// glob matches are named relative to the part of the pattern before the wildcard
+	files, err = getTargetFiles("v1", filepath.Join(dist, "*.txt"), "", false)
+	require.NoError(t, err)
+	requireFiles(map[string]string{"v1/a.txt": "a.txt"}, files)
+	_, err = getTargetFiles("v1", filepath.Join(dist, "*"), "", false)
+	require.Error(t, err)
+	files, err = getTargetFiles("v1", filepath.Join(dist, "s*"), "", true)
+	require.NoError(t, err)
+	requireFiles(map[string]string{"v1/sub/c.txt": filepath.Join("sub", "c.txt")}, files)
+	_, err = getTargetFiles("v1", filepath.Join(dist, "*.none"), "", true)
+	require.Error(t, err)
+
+	// templates name all of the files, including a single file
+	files, err = getTargetFiles("v1", dist, "{{.Target}}/{{.Ext}}/{{.Base}}", true)
+	require.NoError(t, err)
+	requireFiles(map[string]string{
+		"v1/.txt/a.txt": "a.txt",
+		"v1/.bin/b.bin": "b.bin",
+		"v1/.txt/c.txt": filepath.Join("sub", "c.txt"),
+	}, files)
+	files, err = getTargetFiles("v1", filepath.Join(dist, "sub", "c.txt"), "{{.Dir}}:{{.Path}}", false)
+	require.NoError(t, err)
+	requireFiles(map[string]string{".:c.txt": filepath.Join("sub", "c.txt")}, files)
+
+	// templates that don't give every file a different name are rejected
+	_, err = getTargetFiles("v1", dist, "{{.Target}}/{{.Ext}}", true)
+	require.Error(t, err)
+	_, err = getTargetFiles("v1", dist, "{{.Unknown}}", true)
+	require.Error(t, err)
+	_, err = getTargetFiles("v1", dist, "{{", true)
+	require.Error(t, err)
+
+	_, err = getTargetFiles("v1", filepath.Join(dist, "missing"), "", true)
+	require.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"90d":    90 * notary.Day,
+		"2y":     2 * notary.Year,
+		"0d":     0,
+		"720h":   720 * time.Hour,
+		"1h30m":  90 * time.Minute,
+		"-1h30m": -90 * time.Minute,
+	} {
+		d, err := parseDuration(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, d, s)
+	}
+
+	for _, s := range []string{"", "d", "1.5d", "-1d", "ten", "90", "300y", "99999999999999999999d"} {
+		_, err := parseDuration(s)
+		require.Error(t, err, s)
+	}
+}
@@ -45,6 +45,14 @@ const (
 	NotarySnapshotExpiry  = 3 * Year
 	NotaryTimestampExpiry = 14 * Day
 
+	// MinExpiry and MaxExpiry bound the expiry durations that can be set for
+	// the metadata that clients sign
+	MinExpiry = Day
+	MaxExpiry = 100 * Year
+	// MinRootExpiry is the lower bound for the root role, which clients
+	// re-sign on every publish once it is within six months of expiring
+	MinRootExpiry = Year
+
 	ConsistentMetadataCacheMaxAge = 30 * Day
 	CurrentMetadataCacheMaxAge    = 5 * time.Minute
 	// CacheMaxAgeLimit is the generally recommended maximum age for Cache-Control headers
@@ -52,6 +60,12 @@ const (
 	// content)
 	CacheMaxAgeLimit = 1 * Year
 
+	// ExpectedVersionsHeader is the header, or multipart form field, in which a
+	// client can send the versions of the metadata that it based an update on,
+	// as comma separated role=version pairs, so that the server rejects the
+	// update if any of them has changed
+	ExpectedVersionsHeader = "Notary-Expected-Versions"
+
 	MySQLBackend     = "mysql"
 	MemoryBackend    = "memory"
 	PostgresBackend  = "postgres"
@@ -75,6 +89,17 @@ const (
 
 	// DefaultPageSize is the default number of records to return from the changefeed
 	DefaultPageSize = 100
+
+	// DefaultDownloadWorkers is the default number of delegated targets metadata
+	// files that a client will download concurrently
+	DefaultDownloadWorkers = 8
+
+	// DefaultPublishRetries is the default number of times a client retries a
+	// publish that conflicts with one by another client
+	DefaultPublishRetries = 3
+	// DefaultPublishRetryBackoff is the default delay before the first retry of
+	// a conflicting publish, which doubles with each further retry
+	DefaultPublishRetryBackoff = time.Second
 )
 
 // enum to use for setting and retrieving values from contexts
@@ -0,0 +1,11 @@
+CREATE TABLE `pending_tuf_metadata` (
+	  `id` int(11) NOT NULL AUTO_INCREMENT,
+	  `created_at` timestamp NULL DEFAULT NULL,
+	  `updated_at` timestamp NULL DEFAULT NULL,
+	  `deleted_at` timestamp NULL DEFAULT NULL,
+	  `gun` varchar(255) NOT NULL,
+	  `sha256` varchar(64) NOT NULL,
+	  `data` longblob NOT NULL,
+	  PRIMARY KEY (`id`),
+	  UNIQUE KEY `idx_pending_gun` (`gun`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
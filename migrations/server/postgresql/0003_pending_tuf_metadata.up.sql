@@ -0,0 +1,10 @@
+CREATE TABLE "pending_tuf_metadata" (
+  "id" serial PRIMARY KEY,
+  "created_at" timestamp NULL DEFAULT NULL,
+  "updated_at" timestamp NULL DEFAULT NULL,
+  "deleted_at" timestamp NULL DEFAULT NULL,
+  "gun" varchar(255) NOT NULL,
+  "sha256" varchar(64) NOT NULL,
+  "data" bytea NOT NULL,
+  UNIQUE ("gun")
+);
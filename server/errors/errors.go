@@ -50,6 +50,18 @@ var (
 		Description:    "A newer version of the repository's metadata is already available in storage.",
 		HTTPStatusCode: http.StatusBadRequest,
 	})
+	ErrVersionConflict = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "VERSION_CONFLICT",
+		Message:        "The metadata the update is based on has changed.",
+		Description:    "The versions of the metadata the user based the update on are not the current versions in storage.",
+		HTTPStatusCode: http.StatusConflict,
+	})
+	ErrPendingBusy = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "PENDING_BUSY",
+		Message:        "The pending metadata kept changing while the upload was merged into it. Try again.",
+		Description:    "Other uploads replaced the pending metadata every time the server tried to merge the user's upload into it.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
 	ErrMetadataNotFound = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:          "METADATA_NOT_FOUND",
 		Message:        "You have requested metadata that does not exist.",
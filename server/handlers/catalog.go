@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ctxu "github.com/docker/distribution/context"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+type catalogResponse struct {
+	NumberOfGUNs int        `json:"count"`
+	GUNs         []data.GUN `json:"guns"`
+}
+
+// Catalog returns the GUNs that have metadata on the server, limited to those
+// starting with the "prefix" query parameter if it is provided
+func Catalog(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	logger := ctxu.GetLogger(ctx)
+	store, ok := ctx.Value(notary.CtxKeyMetaStore).(storage.MetaStore)
+	if !ok {
+		logger.Errorf("%d GET unable to retrieve storage", http.StatusInternalServerError)
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	out, err := catalog(logger, store, r.URL.Query().Get("prefix"))
+	if err == nil {
+		w.Write(out)
+	}
+	return err
+}
+
+func catalog(logger ctxu.Logger, store storage.MetaStore, prefix string) ([]byte, error) {
+	guns, err := store.ListGUNs(prefix)
+	if err != nil {
+		logger.Errorf("%d GET could not list GUNs: %s", http.StatusInternalServerError, err.Error())
+		return nil, errors.ErrUnknown.WithDetail(err)
+	}
+	if guns == nil {
+		guns = []data.GUN{}
+	}
+	out, err := json.Marshal(&catalogResponse{
+		NumberOfGUNs: len(guns),
+		GUNs:         guns,
+	})
+	if err != nil {
+		logger.Errorf("%d GET could not json.Marshal catalogResponse", http.StatusInternalServerError)
+		return nil, errors.ErrUnknown.WithDetail(err)
+	}
+	return out, nil
+}
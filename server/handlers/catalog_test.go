@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+)
+
+func TestCatalog(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	out, err := catalog(logrus.New(), s, "")
+	require.NoError(t, err)
+	require.Equal(t, `{"count":0,"guns":[]}`, string(out))
+
+	for _, gun := range []data.GUN{"docker.io/b", "docker.io/a", "quay.io/a"} {
+		require.NoError(t, s.UpdateCurrent(gun, storage.MetaUpdate{Role: data.CanonicalRootRole, Version: 1, Data: []byte(gun)}))
+	}
+
+	for prefix, expected := range map[string][]data.GUN{
+		"":           {"docker.io/a", "docker.io/b", "quay.io/a"},
+		"docker.io/": {"docker.io/a", "docker.io/b"},
+		"gcr.io/":    {},
+	} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/v2/_trust/catalog?prefix=%s", prefix), nil)
+		w := httptest.NewRecorder()
+		require.NoError(t, Catalog(context.WithValue(context.Background(), notary.CtxKeyMetaStore, s), w, req))
+		var resp catalogResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, len(expected), resp.NumberOfGUNs, prefix)
+		require.Equal(t, expected, resp.GUNs, prefix)
+	}
+}
+
+func TestCatalogNoStorage(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v2/_trust/catalog", nil)
+	err := Catalog(context.Background(), httptest.NewRecorder(), req)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "storage")
+}
@@ -5,8 +5,11 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	ctxu "github.com/docker/distribution/context"
@@ -61,10 +64,36 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return errors.ErrNoCryptoService.WithDetail(nil)
 	}
 
+	updates, expected, err := parseMultipartUpdates(logger, r)
+	if err != nil {
+		return err
+	}
+	updates, err = validateUpdate(cryptoService, gun, updates, store)
+	if err != nil {
+		return invalidUpdateError(logger, err)
+	}
+	if err := applyUpdates(logger, store, gun, updates, expected); err != nil {
+		return err
+	}
+
+	logTS(logger, gun.String(), updates)
+
+	return nil
+}
+
+// parseMultipartUpdates reads the TUF files in a multipart request, and the
+// versions of the metadata that the client based them on, if it sent them
+// either in the expected versions header or form field
+func parseMultipartUpdates(logger ctxu.Logger, r *http.Request) ([]storage.MetaUpdate, map[data.RoleName]int, error) {
+	expected, err := parseExpectedVersions(r.Header.Get(notary.ExpectedVersionsHeader))
+	if err != nil {
+		logger.Infof("400 POST invalid expected versions: %v", err)
+		return nil, nil, errors.ErrInvalidParams.WithDetail(err.Error())
+	}
 	reader, err := r.MultipartReader()
 	if err != nil {
 		logger.Info("400 POST unable to parse TUF data")
-		return errors.ErrMalformedUpload.WithDetail(nil)
+		return nil, nil, errors.ErrMalformedUpload.WithDetail(nil)
 	}
 	var updates []storage.MetaUpdate
 	for {
@@ -72,13 +101,29 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		if err == io.EOF {
 			break
 		}
+		if part.FileName() == "" && part.FormName() == notary.ExpectedVersionsHeader {
+			value, err := ioutil.ReadAll(io.LimitReader(part, maxExpectedVersionsSize))
+			if err != nil {
+				logger.Info("400 POST unable to read expected versions")
+				return nil, nil, errors.ErrMalformedUpload.WithDetail(nil)
+			}
+			fieldExpected, err := parseExpectedVersions(string(value))
+			if err != nil {
+				logger.Infof("400 POST invalid expected versions: %v", err)
+				return nil, nil, errors.ErrInvalidParams.WithDetail(err.Error())
+			}
+			for role, version := range fieldExpected {
+				expected[role] = version
+			}
+			continue
+		}
 		role := data.RoleName(strings.TrimSuffix(part.FileName(), ".json"))
 		if role.String() == "" {
 			logger.Info("400 POST empty role")
-			return errors.ErrNoFilename.WithDetail(nil)
+			return nil, nil, errors.ErrNoFilename.WithDetail(nil)
 		} else if !data.ValidRole(role) {
 			logger.Infof("400 POST invalid role: %s", role)
-			return errors.ErrInvalidRole.WithDetail(role)
+			return nil, nil, errors.ErrInvalidRole.WithDetail(role)
 		}
 		meta := &data.SignedMeta{}
 		var input []byte
@@ -87,7 +132,7 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		err = dec.Decode(meta)
 		if err != nil {
 			logger.Info("400 POST malformed update JSON")
-			return errors.ErrMalformedJSON.WithDetail(nil)
+			return nil, nil, errors.ErrMalformedJSON.WithDetail(nil)
 		}
 		version := meta.Signed.Version
 		updates = append(updates, storage.MetaUpdate{
@@ -96,17 +141,57 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 			Data:    inBuf.Bytes(),
 		})
 	}
-	updates, err = validateUpdate(cryptoService, gun, updates, store)
-	if err != nil {
-		serializable, serializableError := validation.NewSerializableError(err)
-		if serializableError != nil {
-			logger.Info("400 POST error validating update")
-			return errors.ErrInvalidUpdate.WithDetail(nil)
+	return updates, expected, nil
+}
+
+// maxExpectedVersionsSize limits the size of the expected versions form field
+const maxExpectedVersionsSize = 64 << 10
+
+// parseExpectedVersions parses comma separated role=version pairs, where a
+// version of 0 means that the role is expected not to have been published yet
+func parseExpectedVersions(value string) (map[data.RoleName]int, error) {
+	expected := make(map[data.RoleName]int)
+	if strings.TrimSpace(value) == "" {
+		return expected, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected role=version, got %q", pair)
+		}
+		role := data.RoleName(parts[0])
+		if !data.ValidRole(role) {
+			return nil, fmt.Errorf("invalid role %q", role)
 		}
-		return errors.ErrInvalidUpdate.WithDetail(serializable)
+		version, err := strconv.Atoi(parts[1])
+		if err != nil || version < 0 {
+			return nil, fmt.Errorf("invalid version %q for %s", parts[1], role)
+		}
+		expected[role] = version
 	}
-	err = store.UpdateMany(gun, updates)
+	return expected, nil
+}
+
+// invalidUpdateError converts a validation error into an error response,
+// which includes the validation error if it can be serialized
+func invalidUpdateError(logger ctxu.Logger, err error) error {
+	serializable, serializableError := validation.NewSerializableError(err)
+	if serializableError != nil {
+		logger.Info("400 POST error validating update")
+		return errors.ErrInvalidUpdate.WithDetail(nil)
+	}
+	return errors.ErrInvalidUpdate.WithDetail(serializable)
+}
+
+// applyUpdates atomically writes validated updates to the store, if the
+// current versions of the metadata are still the expected ones
+func applyUpdates(logger ctxu.Logger, store storage.MetaStore, gun data.GUN, updates []storage.MetaUpdate, expected map[data.RoleName]int) error {
+	err := store.UpdateMany(gun, updates, expected)
 	if err != nil {
+		if conflict, ok := err.(storage.ErrVersionConflict); ok {
+			logger.Infof("409 POST update based on outdated metadata: expected %v, current %v", conflict.Expected, conflict.Current)
+			return errors.ErrVersionConflict.WithDetail(conflict)
+		}
 		// If we have an old version error, surface to user with error code
 		if _, ok := err.(storage.ErrOldVersion); ok {
 			logger.Info("400 POST old version error")
@@ -116,9 +201,6 @@ func atomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 		logger.Errorf("500 POST error applying update request: %v", err)
 		return errors.ErrUpdating.WithDetail(nil)
 	}
-
-	logTS(logger, gun.String(), updates)
-
 	return nil
 }
 
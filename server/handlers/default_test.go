@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -458,7 +459,7 @@ type invalidVersionStore struct {
 	storage.MemStorage
 }
 
-func (s *invalidVersionStore) UpdateMany(_ data.GUN, _ []storage.MetaUpdate) error {
+func (s *invalidVersionStore) UpdateMany(_ data.GUN, _ []storage.MetaUpdate, _ map[data.RoleName]int) error {
 	return storage.ErrOldVersion{}
 }
 
@@ -496,3 +497,93 @@ func TestAtomicUpdateVersionErrorPropagated(t *testing.T) {
 	require.Equal(t, errors.ErrOldVersion, errorObj.Code)
 	require.Equal(t, storage.ErrOldVersion{}, errorObj.Detail)
 }
+
+// An update is rejected if the current version of any of the metadata that the
+// client based it on is not the one the client expected, whether the expected
+// versions are sent in the header or in a form field
+func TestAtomicUpdateExpectedVersions(t *testing.T) {
+	metaStore := storage.NewMemStorage()
+	var gun data.GUN = "testGUN"
+	vars := map[string]string{"gun": gun.String()}
+
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	state := handlerState{store: metaStore, crypto: testutils.CopyKeys(t, cs, data.CanonicalTimestampRole)}
+
+	// signs the next version of targets and snapshot, and of root if it is given
+	update := func(roles ...data.RoleName) map[string][]byte {
+		metas := make(map[string][]byte)
+		for _, role := range roles {
+			var s *data.Signed
+			var err error
+			switch role {
+			case data.CanonicalRootRole:
+				s, err = repo.SignRoot(data.DefaultExpires(role), nil)
+			case data.CanonicalTargetsRole:
+				s, err = repo.SignTargets(role, data.DefaultExpires(role))
+			case data.CanonicalSnapshotRole:
+				s, err = repo.SignSnapshot(data.DefaultExpires(role))
+			}
+			require.NoError(t, err)
+			metas[role.String()], err = json.Marshal(s)
+			require.NoError(t, err)
+		}
+		return metas
+	}
+	post := func(metas map[string][]byte, header, field string) error {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if field != "" {
+			require.NoError(t, writer.WriteField(notary.ExpectedVersionsHeader, field))
+		}
+		for role, blob := range metas {
+			part, err := writer.CreateFormFile("files", role)
+			require.NoError(t, err)
+			_, err = part.Write(blob)
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+		req, err := http.NewRequest("POST", "", body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if header != "" {
+			req.Header.Set(notary.ExpectedVersionsHeader, header)
+		}
+		return atomicUpdateHandler(getContext(state), httptest.NewRecorder(), req, vars)
+	}
+	requireConflict := func(err error, expected, current map[data.RoleName]int) {
+		require.Error(t, err)
+		errorObj, ok := err.(errcode.Error)
+		require.True(t, ok, "Expected an errcode.Error, got %v", err)
+		require.Equal(t, errors.ErrVersionConflict, errorObj.Code)
+		require.Equal(t, http.StatusConflict, errorObj.Code.Descriptor().HTTPStatusCode)
+		require.Equal(t, storage.ErrVersionConflict{Expected: expected, Current: current}, errorObj.Detail)
+	}
+
+	initial := update(data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole)
+	requireConflict(post(initial, "root=1", ""),
+		map[data.RoleName]int{data.CanonicalRootRole: 1}, map[data.RoleName]int{data.CanonicalRootRole: 0})
+	require.NoError(t, post(initial, "root=0", ""))
+
+	// another client published version 2 of targets in the meantime
+	require.NoError(t, post(update(data.CanonicalTargetsRole, data.CanonicalSnapshotRole), "root=1,targets=1,snapshot=1", ""))
+	stale := update(data.CanonicalTargetsRole, data.CanonicalSnapshotRole)
+	requireConflict(post(stale, "root=1, targets=1", ""),
+		map[data.RoleName]int{data.CanonicalRootRole: 1, data.CanonicalTargetsRole: 1},
+		map[data.RoleName]int{data.CanonicalRootRole: 1, data.CanonicalTargetsRole: 2})
+	requireConflict(post(stale, "", "snapshot=1"),
+		map[data.RoleName]int{data.CanonicalSnapshotRole: 1}, map[data.RoleName]int{data.CanonicalSnapshotRole: 2})
+	// the form field is combined with the header
+	requireConflict(post(stale, "targets=2", "snapshot=1"),
+		map[data.RoleName]int{data.CanonicalTargetsRole: 2, data.CanonicalSnapshotRole: 1},
+		map[data.RoleName]int{data.CanonicalTargetsRole: 2, data.CanonicalSnapshotRole: 2})
+	require.NoError(t, post(stale, "targets=2", "snapshot=2"))
+
+	for _, invalid := range []string{"targets", "targets=one", "targets=-1", "nonsense=1"} {
+		err := post(stale, invalid, "")
+		require.Error(t, err)
+		errorObj, ok := err.(errcode.Error)
+		require.True(t, ok, "Expected an errcode.Error, got %v", err)
+		require.Equal(t, errors.ErrInvalidParams, errorObj.Code)
+	}
+}
@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/go/canonical/json"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/utils"
+	"github.com/theupdateframework/notary/tuf/validation"
+)
+
+// pendingMetadata is the pending metadata for a single role, along with the
+// roles whose thresholds its signatures must meet.  It has the same format as
+// the files written by "notary sign export", so that it can be co-signed in
+// the same way.
+type pendingMetadata struct {
+	GUN     data.GUN        `json:"gun"`
+	Role    data.RoleName   `json:"role"`
+	Signers []pendingSigner `json:"signers"`
+	Signed  *data.Signed    `json:"signed"`
+}
+
+type pendingSigner struct {
+	Role      data.RoleName `json:"role"`
+	Keys      data.KeyList  `json:"keys"`
+	Threshold int           `json:"threshold"`
+}
+
+// pendingStatus is the response to an upload of pending metadata
+type pendingStatus struct {
+	Published bool            `json:"published"`
+	Waiting   []data.RoleName `json:"waiting,omitempty"`
+}
+
+// PendingUpdateHandler accepts root, targets and delegation metadata that may
+// not yet be signed by enough keys to be published.  Signatures on metadata
+// that is already pending for the same role are merged, and once the metadata
+// for every pending role meets its thresholds, it is validated and published
+// in a single update exactly as if it had been uploaded to AtomicUpdateHandler.
+func PendingUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	return pendingUpdateHandler(ctx, w, r, vars)
+}
+
+func pendingUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	gun := data.GUN(vars["gun"])
+	s := ctx.Value(notary.CtxKeyMetaStore)
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		logger.Error("500 POST unable to retrieve storage")
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	cryptoServiceVal := ctx.Value(notary.CtxKeyCryptoSvc)
+	cryptoService, ok := cryptoServiceVal.(signed.CryptoService)
+	if !ok {
+		logger.Error("500 POST unable to retrieve signing service")
+		return errors.ErrNoCryptoService.WithDetail(nil)
+	}
+
+	updates, _, err := parseMultipartUpdates(logger, r)
+	if err != nil {
+		return err
+	}
+	for _, update := range updates {
+		if update.Role != data.CanonicalRootRole && update.Role != data.CanonicalTargetsRole && !data.IsDelegation(update.Role) {
+			logger.Infof("400 POST pending metadata for invalid role: %s", update.Role)
+			return errors.ErrInvalidRole.WithDetail(update.Role)
+		}
+	}
+	incoming, err := decodePending(updates)
+	if err != nil {
+		logger.Info("400 POST malformed pending metadata")
+		return errors.ErrMalformedJSON.WithDetail(nil)
+	}
+
+	// the upload is merged into the pending metadata that was read, which is
+	// only replaced if no other upload has replaced it in the meantime, so
+	// merge it again into whatever another upload replaced it with
+	for attempt := 0; ; attempt++ {
+		err := stagePending(logger, w, gun, store, cryptoService, incoming)
+		if _, ok := err.(storage.ErrOldVersion); !ok {
+			return err
+		}
+		if attempt == maxPendingAttempts-1 {
+			logger.Info("503 POST pending metadata kept changing while merging")
+			return errors.ErrPendingBusy.WithDetail(nil)
+		}
+		logger.Debugf("pending metadata for %s changed while merging, trying again", gun)
+	}
+}
+
+// maxPendingAttempts is how many times an upload of pending metadata is merged
+// before giving up because other uploads keep replacing the pending metadata
+const maxPendingAttempts = 5
+
+// stagePending merges uploaded metadata into the pending metadata for a GUN,
+// and stores the result, or publishes it if it meets its thresholds.  It
+// returns storage.ErrOldVersion, without writing a response, if the pending
+// metadata changed after it was read.
+func stagePending(logger ctxu.Logger, w http.ResponseWriter, gun data.GUN, store storage.MetaStore,
+	cryptoService signed.CryptoService, incoming map[data.RoleName]*data.Signed) error {
+
+	existing, checksum, err := store.GetPending(gun)
+	if err != nil {
+		logger.Errorf("500 POST unable to retrieve pending metadata: %v", err)
+		return errors.ErrUnknown.WithDetail(nil)
+	}
+	pending, err := decodePending(existing)
+	if err != nil {
+		logger.Errorf("500 POST unable to parse stored pending metadata: %v", err)
+		return errors.ErrUnknown.WithDetail(nil)
+	}
+	for role, s := range incoming {
+		if pending[role], err = mergeSignatures(pending[role], s); err != nil {
+			logger.Info("400 POST malformed pending metadata")
+			return errors.ErrMalformedJSON.WithDetail(nil)
+		}
+	}
+
+	var waiting []data.RoleName
+	for _, role := range sortedRoles(pending) {
+		signers, err := pendingSigners(gun, role, pending, store)
+		if err != nil {
+			return invalidUpdateError(logger, err)
+		}
+		if _, ok := incoming[role]; ok {
+			// the first signing role is the one that is already trusted, so
+			// a new root must be vouched for by the current root, rather than
+			// only by the keys that it declares itself
+			if err := signedByAny(pending[role], role, signers[0]); err != nil {
+				return invalidUpdateError(logger, err)
+			}
+		}
+		met, err := meetsThresholds(pending[role], signers)
+		if err != nil {
+			return invalidUpdateError(logger, validation.ErrValidation{Msg: err.Error()})
+		}
+		if !met {
+			waiting = append(waiting, role)
+		}
+	}
+
+	updates, err := encodePending(pending)
+	if err != nil {
+		logger.Errorf("500 POST unable to serialize pending metadata: %v", err)
+		return errors.ErrUnknown.WithDetail(nil)
+	}
+
+	if len(waiting) > 0 {
+		if err := store.SetPending(gun, checksum, updates); err != nil {
+			if _, ok := err.(storage.ErrOldVersion); ok {
+				return err
+			}
+			logger.Errorf("500 POST unable to store pending metadata: %v", err)
+			return errors.ErrUpdating.WithDetail(nil)
+		}
+		logger.Infof("stored pending metadata for %s, waiting for signatures on %v", gun, waiting)
+		return writePendingStatus(w, http.StatusAccepted, pendingStatus{Waiting: waiting})
+	}
+
+	updates, err = validateUpdate(cryptoService, gun, updates, store)
+	if err != nil {
+		return invalidUpdateError(logger, err)
+	}
+	if err := applyUpdates(logger, store, gun, updates, nil); err != nil {
+		return err
+	}
+	// the metadata has been published, so failing to clean up only means that
+	// the stale pending metadata will be rejected if it is signed again.  If
+	// another upload has replaced it in the meantime, that is left pending.
+	if err := store.SetPending(gun, checksum, nil); err != nil {
+		logger.Infof("pending metadata was not removed after publishing: %v", err)
+	}
+	logTS(logger, gun.String(), updates)
+
+	return writePendingStatus(w, http.StatusOK, pendingStatus{Published: true})
+}
+
+// GetPendingHandler returns the pending metadata for a GUN, along with the
+// roles whose thresholds it must meet.
+func GetPendingHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	return getPendingHandler(ctx, w, r, vars)
+}
+
+func getPendingHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	gun := data.GUN(vars["gun"])
+	s := ctx.Value(notary.CtxKeyMetaStore)
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		logger.Error("500 GET: no storage exists")
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+
+	updates, _, err := store.GetPending(gun)
+	if err != nil {
+		logger.Errorf("500 GET unable to retrieve pending metadata: %v", err)
+		return errors.ErrUnknown.WithDetail(nil)
+	}
+	if len(updates) == 0 {
+		logger.Info("404 GET pending metadata")
+		return errors.ErrMetadataNotFound.WithDetail(nil)
+	}
+	pending, err := decodePending(updates)
+	if err != nil {
+		logger.Errorf("500 GET unable to parse stored pending metadata: %v", err)
+		return errors.ErrUnknown.WithDetail(nil)
+	}
+
+	output := make([]pendingMetadata, 0, len(pending))
+	for _, role := range sortedRoles(pending) {
+		signers, err := pendingSigners(gun, role, pending, store)
+		if err != nil {
+			// the metadata can still be inspected, but it can't be co-signed
+			logger.Warnf("unable to determine the signing roles for pending %s metadata: %v", role, err)
+		}
+		p := pendingMetadata{GUN: gun, Role: role, Signed: pending[role]}
+		for _, signer := range signers {
+			p.Signers = append(p.Signers, pendingSigner{
+				Role:      signer.Name,
+				Keys:      signer.ListKeys(),
+				Threshold: signer.Threshold,
+			})
+		}
+		output = append(output, p)
+	}
+
+	out, err := json.Marshal(output)
+	if err != nil {
+		logger.Error("500 GET pending metadata")
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Write(out)
+	return nil
+}
+
+// DeletePendingHandler discards the pending metadata for a GUN. A 200 response
+// indicates success.
+func DeletePendingHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	return deletePendingHandler(ctx, w, r, vars)
+}
+
+func deletePendingHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	gun := data.GUN(vars["gun"])
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+	s := ctx.Value(notary.CtxKeyMetaStore)
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		logger.Error("500 DELETE pending metadata: no storage exists")
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	if err := store.DeletePending(gun); err != nil {
+		logger.Error("500 DELETE pending metadata")
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	logger.Infof("pending metadata deleted for %s", gun)
+	return nil
+}
+
+func writePendingStatus(w http.ResponseWriter, code int, status pendingStatus) error {
+	out, err := json.Marshal(status)
+	if err != nil {
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.WriteHeader(code)
+	w.Write(out)
+	return nil
+}
+
+func decodePending(updates []storage.MetaUpdate) (map[data.RoleName]*data.Signed, error) {
+	pending := make(map[data.RoleName]*data.Signed, len(updates))
+	for _, update := range updates {
+		s := &data.Signed{}
+		if err := json.Unmarshal(update.Data, s); err != nil {
+			return nil, err
+		}
+		if s.Signed == nil {
+			return nil, fmt.Errorf("no signed content in %s metadata", update.Role)
+		}
+		pending[update.Role] = s
+	}
+	return pending, nil
+}
+
+func encodePending(pending map[data.RoleName]*data.Signed) ([]storage.MetaUpdate, error) {
+	updates := make([]storage.MetaUpdate, 0, len(pending))
+	for _, role := range sortedRoles(pending) {
+		common := &data.SignedCommon{}
+		if err := json.Unmarshal(*pending[role].Signed, common); err != nil {
+			return nil, err
+		}
+		raw, err := json.Marshal(pending[role])
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, storage.MetaUpdate{Role: role, Version: common.Version, Data: raw})
+	}
+	return updates, nil
+}
+
+// sortedRoles returns the pending roles with parents before their delegations
+func sortedRoles(pending map[data.RoleName]*data.Signed) []data.RoleName {
+	roleList := make(utils.RoleList, 0, len(pending))
+	for role := range pending {
+		roleList = append(roleList, role.String())
+	}
+	sort.Sort(roleList)
+	roles := make([]data.RoleName, 0, len(roleList))
+	for _, role := range roleList {
+		roles = append(roles, data.RoleName(role))
+	}
+	return roles
+}
+
+// mergeSignatures adds the signatures from newly uploaded metadata to the pending
+// metadata for the same role, if both have the same signed content.  Otherwise
+// the new metadata replaces the pending metadata, since the existing signatures
+// are not valid for it.
+func mergeSignatures(pending, uploaded *data.Signed) (*data.Signed, error) {
+	if pending == nil {
+		return uploaded, nil
+	}
+	pendingContent, err := canonicalContent(pending)
+	if err != nil {
+		return nil, err
+	}
+	uploadedContent, err := canonicalContent(uploaded)
+	if err != nil {
+		return nil, err
+	}
+	if string(pendingContent) != string(uploadedContent) {
+		return uploaded, nil
+	}
+
+	merged := &data.Signed{
+		Signed:     pending.Signed,
+		Signatures: append([]data.Signature{}, pending.Signatures...),
+	}
+	seen := make(map[string]struct{})
+	for _, sig := range merged.Signatures {
+		seen[sig.KeyID] = struct{}{}
+	}
+	for _, sig := range uploaded.Signatures {
+		if _, ok := seen[sig.KeyID]; !ok {
+			merged.Signatures = append(merged.Signatures, sig)
+			seen[sig.KeyID] = struct{}{}
+		}
+	}
+	return merged, nil
+}
+
+func canonicalContent(s *data.Signed) ([]byte, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(*s.Signed, &decoded); err != nil {
+		return nil, err
+	}
+	return json.MarshalCanonical(decoded)
+}
+
+// pendingSigners returns the roles whose thresholds the signatures on pending
+// metadata must meet.  These are determined by the pending metadata of the
+// parent role if there is any, otherwise by the current metadata in the store.
+// A root that changes the root keys or threshold must be signed by both the
+// current and the new root role, in that order.
+func pendingSigners(gun data.GUN, role data.RoleName, pending map[data.RoleName]*data.Signed, store storage.MetaStore) ([]data.BaseRole, error) {
+	switch {
+	case role == data.CanonicalRootRole:
+		newRoot, err := data.RootFromSigned(pending[role])
+		if err != nil {
+			return nil, validation.ErrBadRoot{Msg: err.Error()}
+		}
+		newRole, err := newRoot.BuildBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, validation.ErrBadRoot{Msg: err.Error()}
+		}
+		current, err := pendingOrCurrent(gun, role, nil, store)
+		if _, ok := err.(storage.ErrNotFound); ok {
+			return []data.BaseRole{newRole}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		currentRoot, err := data.RootFromSigned(current)
+		if err != nil {
+			return nil, err
+		}
+		currentRole, err := currentRoot.BuildBaseRole(data.CanonicalRootRole)
+		if err != nil {
+			return nil, err
+		}
+		if currentRole.Equals(newRole) {
+			return []data.BaseRole{newRole}, nil
+		}
+		return []data.BaseRole{currentRole, newRole}, nil
+
+	case role == data.CanonicalTargetsRole:
+		root, err := pendingOrCurrent(gun, data.CanonicalRootRole, pending, store)
+		if _, ok := err.(storage.ErrNotFound); ok {
+			return nil, validation.ErrValidation{Msg: "no pre-existing root and no root provided in update."}
+		} else if err != nil {
+			return nil, err
+		}
+		signedRoot, err := data.RootFromSigned(root)
+		if err != nil {
+			return nil, validation.ErrBadRoot{Msg: err.Error()}
+		}
+		targetsRole, err := signedRoot.BuildBaseRole(data.CanonicalTargetsRole)
+		if err != nil {
+			return nil, validation.ErrBadRoot{Msg: err.Error()}
+		}
+		return []data.BaseRole{targetsRole}, nil
+
+	default:
+		parentName := role.Parent()
+		parent, err := pendingOrCurrent(gun, parentName, pending, store)
+		if _, ok := err.(storage.ErrNotFound); ok {
+			return nil, validation.ErrBadTargets{Msg: fmt.Sprintf("parent role %s of %s does not exist", parentName, role)}
+		} else if err != nil {
+			return nil, err
+		}
+		signedParent, err := data.TargetsFromSigned(parent, parentName)
+		if err != nil {
+			return nil, validation.ErrBadTargets{Msg: err.Error()}
+		}
+		delgRole, err := signedParent.BuildDelegationRole(role)
+		if err != nil {
+			return nil, validation.ErrBadTargets{Msg: err.Error()}
+		}
+		return []data.BaseRole{delgRole.BaseRole}, nil
+	}
+}
+
+func pendingOrCurrent(gun data.GUN, role data.RoleName, pending map[data.RoleName]*data.Signed, store storage.MetaStore) (*data.Signed, error) {
+	if s, ok := pending[role]; ok {
+		return s, nil
+	}
+	_, raw, err := store.GetCurrent(gun, role)
+	if err != nil {
+		return nil, err
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// signedByAny checks that newly uploaded pending metadata has at least one valid
+// signature from a key of the given signing role, so that it can't be replaced
+// by arbitrary data
+func signedByAny(s *data.Signed, role data.RoleName, signer data.BaseRole) error {
+	if err := signed.VerifySignatures(s, data.NewBaseRole(role, 1, signer.ListKeys()...)); err != nil {
+		return validation.ErrValidation{Msg: fmt.Sprintf("%s metadata is not signed by any of its signing keys: %v", role, err)}
+	}
+	return nil
+}
+
+// meetsThresholds returns whether the metadata has enough valid signatures to
+// meet the threshold of every one of its signing roles
+func meetsThresholds(s *data.Signed, signers []data.BaseRole) (bool, error) {
+	for _, signer := range signers {
+		err := signed.VerifySignatures(s, signer)
+		if _, ok := err.(signed.ErrRoleThreshold); ok || err == signed.ErrNoSignatures {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/stretchr/testify/require"
+
+	"github.com/theupdateframework/notary/cryptoservice"
+	"github.com/theupdateframework/notary/passphrase"
+	"github.com/theupdateframework/notary/server/errors"
+	"github.com/theupdateframework/notary/server/storage"
+	store "github.com/theupdateframework/notary/storage"
+	"github.com/theupdateframework/notary/trustmanager"
+	"github.com/theupdateframework/notary/tuf"
+	"github.com/theupdateframework/notary/tuf/data"
+	"github.com/theupdateframework/notary/tuf/signed"
+	"github.com/theupdateframework/notary/tuf/testutils"
+)
+
+func postPending(t *testing.T, state handlerState, gun data.GUN, metas map[data.RoleName]*data.Signed) (*httptest.ResponseRecorder, error) {
+	serialized := make(map[string][]byte)
+	for role, s := range metas {
+		raw, err := json.Marshal(s)
+		require.NoError(t, err)
+		serialized[role.String()] = raw
+	}
+	req, err := store.NewMultiPartMetaRequest("", serialized)
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	return rw, pendingUpdateHandler(getContext(state), rw, req, map[string]string{"gun": gun.String()})
+}
+
+func getPending(t *testing.T, state handlerState, gun data.GUN) ([]pendingMetadata, error) {
+	req, err := http.NewRequest("GET", "", nil)
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	if err := getPendingHandler(getContext(state), rw, req, map[string]string{"gun": gun.String()}); err != nil {
+		return nil, err
+	}
+	var pending []pendingMetadata
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &pending))
+	return pending, nil
+}
+
+// creates a repo whose targets role needs signatures from two keys, only one
+// of which is in the repo's crypto service
+func emptyRepoWithTwoTargetsSigners(t *testing.T, gun data.GUN) (*tuf.Repo, signed.CryptoService, signed.CryptoService, data.PublicKey) {
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	coSignerCS := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("")))
+	coSignerKey, err := testutils.CreateKey(coSignerCS, gun, data.CanonicalTargetsRole, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddBaseKeys(data.CanonicalTargetsRole, coSignerKey))
+	require.NoError(t, repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, 2))
+	return repo, cs, coSignerCS, coSignerKey
+}
+
+// Pending metadata is stored without being published until enough signatures
+// have been uploaded, at which point it is published and a change is recorded.
+func TestPendingUpdatePublishedOnceThresholdIsMet(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	metaStore := storage.NewMemStorage()
+	repo, cs, coSignerCS, coSignerKey := emptyRepoWithTwoTargetsSigners(t, gun)
+	state := handlerState{
+		store:  metaStore,
+		crypto: testutils.CopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole),
+	}
+
+	root, err := repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+	require.NoError(t, err)
+	targets, err := repo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	require.Len(t, targets.Signatures, 1)
+
+	rw, err := postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: targets,
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, rw.Code)
+	var status pendingStatus
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &status))
+	require.False(t, status.Published)
+	require.Equal(t, []data.RoleName{data.CanonicalTargetsRole}, status.Waiting)
+
+	// nothing has been published yet
+	_, _, err = metaStore.GetCurrent(gun, data.CanonicalRootRole)
+	require.IsType(t, storage.ErrNotFound{}, err)
+	changes, err := metaStore.GetChanges("0", 10, gun.String())
+	require.NoError(t, err)
+	require.Len(t, changes, 0)
+
+	pending, err := getPending(t, state, gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, data.CanonicalRootRole, pending[0].Role)
+	require.Equal(t, data.CanonicalTargetsRole, pending[1].Role)
+	require.Len(t, pending[1].Signers, 1)
+	require.Equal(t, 2, pending[1].Signers[0].Threshold)
+	require.Len(t, pending[1].Signers[0].Keys, 2)
+
+	// the co-signer only uploads their own signature, which is merged with the pending one
+	coSigned := &data.Signed{Signed: pending[1].Signed.Signed}
+	require.NoError(t, signed.Sign(coSignerCS, coSigned, []data.PublicKey{coSignerKey}, 1, nil))
+	require.Len(t, coSigned.Signatures, 1)
+
+	rw, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{data.CanonicalTargetsRole: coSigned})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rw.Code)
+	var published pendingStatus
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &published))
+	require.True(t, published.Published)
+	require.Empty(t, published.Waiting)
+
+	_, publishedJSON, err := metaStore.GetCurrent(gun, data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	publishedTargets := &data.Signed{}
+	require.NoError(t, json.Unmarshal(publishedJSON, publishedTargets))
+	require.Len(t, publishedTargets.Signatures, 2)
+	for _, role := range []data.RoleName{data.CanonicalRootRole, data.CanonicalSnapshotRole, data.CanonicalTimestampRole} {
+		_, _, err = metaStore.GetCurrent(gun, role)
+		require.NoError(t, err)
+	}
+
+	changes, err = metaStore.GetChanges("0", 10, gun.String())
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, "update", changes[0].Category)
+
+	_, err = getPending(t, state, gun)
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrMetadataNotFound, errorObj.Code)
+}
+
+// interleavedPendingStore runs a function, such as another upload, just before
+// the first time pending metadata is set
+type interleavedPendingStore struct {
+	*storage.MemStorage
+	before func()
+}
+
+func (s *interleavedPendingStore) SetPending(gun data.GUN, checksum string, updates []storage.MetaUpdate) error {
+	if s.before != nil {
+		before := s.before
+		s.before = nil
+		before()
+	}
+	return s.MemStorage.SetPending(gun, checksum, updates)
+}
+
+// Signatures uploaded by two co-signers at the same time are both merged into
+// the pending metadata, rather than one upload overwriting the other.
+func TestPendingUpdateConcurrentSignaturesAreMerged(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	metaStore := storage.NewMemStorage()
+	repo, cs, coSignerCS, coSignerKey := emptyRepoWithTwoTargetsSigners(t, gun)
+	otherCS := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("")))
+	otherKey, err := testutils.CreateKey(otherCS, gun, data.CanonicalTargetsRole, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddBaseKeys(data.CanonicalTargetsRole, otherKey))
+	require.NoError(t, repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, 3))
+	crypto := testutils.CopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
+	state := handlerState{store: metaStore, crypto: crypto}
+
+	root, err := repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+	require.NoError(t, err)
+	targets, err := repo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	rw, err := postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: targets,
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, rw.Code)
+
+	coSigned := &data.Signed{Signed: targets.Signed}
+	require.NoError(t, signed.Sign(coSignerCS, coSigned, []data.PublicKey{coSignerKey}, 1, nil))
+	otherSigned := &data.Signed{Signed: targets.Signed}
+	require.NoError(t, signed.Sign(otherCS, otherSigned, []data.PublicKey{otherKey}, 1, nil))
+
+	// the other co-signer's upload lands after the first co-signer's upload has
+	// read the pending metadata, but before it has written it
+	racing := &interleavedPendingStore{MemStorage: metaStore}
+	racing.before = func() {
+		rw, err := postPending(t, state, gun, map[data.RoleName]*data.Signed{data.CanonicalTargetsRole: otherSigned})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, rw.Code)
+	}
+	rw, err = postPending(t, handlerState{store: racing, crypto: crypto}, gun,
+		map[data.RoleName]*data.Signed{data.CanonicalTargetsRole: coSigned})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	_, publishedJSON, err := metaStore.GetCurrent(gun, data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	publishedTargets := &data.Signed{}
+	require.NoError(t, json.Unmarshal(publishedJSON, publishedTargets))
+	require.Len(t, publishedTargets.Signatures, 3)
+}
+
+// busyPendingStore never sets pending metadata, as if another upload always
+// replaced it first
+type busyPendingStore struct {
+	*storage.MemStorage
+	attempts int
+}
+
+func (s *busyPendingStore) SetPending(gun data.GUN, checksum string, updates []storage.MetaUpdate) error {
+	s.attempts++
+	return storage.ErrOldVersion{}
+}
+
+// An upload that cannot be merged because other uploads keep replacing the
+// pending metadata fails with an error that says to try again, rather than one
+// that says the metadata is out of date.
+func TestPendingUpdateBusy(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	metaStore := storage.NewMemStorage()
+	repo, cs, _, _ := emptyRepoWithTwoTargetsSigners(t, gun)
+	crypto := testutils.CopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole)
+
+	root, err := repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+	require.NoError(t, err)
+	targets, err := repo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+
+	racing := &busyPendingStore{MemStorage: metaStore}
+	_, err = postPending(t, handlerState{store: racing, crypto: crypto}, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: targets,
+	})
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrPendingBusy, errorObj.Code)
+	require.Equal(t, http.StatusServiceUnavailable, errorObj.Code.Descriptor().HTTPStatusCode)
+	require.Equal(t, maxPendingAttempts, racing.attempts)
+}
+
+// Pending metadata with different signed content replaces what is pending,
+// rather than having its signatures merged.
+func TestPendingUpdateReplacesDifferentContent(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	repo, cs, _, _ := emptyRepoWithTwoTargetsSigners(t, gun)
+	state := handlerState{
+		store:  storage.NewMemStorage(),
+		crypto: testutils.CopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole),
+	}
+
+	root, err := repo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+	require.NoError(t, err)
+	targets, err := repo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	_, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: targets,
+	})
+	require.NoError(t, err)
+
+	_, err = repo.AddTargets(data.CanonicalTargetsRole, data.Files{"latest": data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}})
+	require.NoError(t, err)
+	changed, err := repo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	rw, err := postPending(t, state, gun, map[data.RoleName]*data.Signed{data.CanonicalTargetsRole: changed})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, rw.Code)
+
+	pending, err := getPending(t, state, gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	require.Equal(t, changed.Signed, pending[1].Signed.Signed)
+	require.Len(t, pending[1].Signed.Signatures, 1)
+
+	// the pending metadata can be discarded
+	req, err := http.NewRequest("DELETE", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, deletePendingHandler(getContext(state), httptest.NewRecorder(), req, map[string]string{"gun": gun.String()}))
+	_, err = getPending(t, state, gun)
+	require.Error(t, err)
+}
+
+// Only root, targets and delegation metadata that is signed by at least one of
+// its signing keys can be uploaded as pending metadata.
+func TestPendingUpdateInvalid(t *testing.T) {
+	var gun data.GUN = "testGUN"
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	state := handlerState{
+		store:  storage.NewMemStorage(),
+		crypto: testutils.CopyKeys(t, cs, data.CanonicalTimestampRole, data.CanonicalSnapshotRole),
+	}
+
+	root, tg, sn, _, err := testutils.Sign(repo)
+	require.NoError(t, err)
+
+	_, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{data.CanonicalSnapshotRole: sn})
+	require.Error(t, err)
+	errorObj, ok := err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrInvalidRole, errorObj.Code)
+
+	// there is no root to determine the targets keys from
+	_, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{data.CanonicalTargetsRole: tg})
+	require.Error(t, err)
+	errorObj, ok = err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrInvalidUpdate, errorObj.Code)
+
+	// targets signed by the wrong key
+	otherCS := cryptoservice.NewCryptoService(trustmanager.NewKeyMemoryStore(passphrase.ConstantRetriever("")))
+	otherKey, err := testutils.CreateKey(otherCS, gun, data.CanonicalTargetsRole, data.ECDSAKey)
+	require.NoError(t, err)
+	badTargets := &data.Signed{Signed: tg.Signed}
+	require.NoError(t, signed.Sign(otherCS, badTargets, []data.PublicKey{otherKey}, 1, nil))
+	_, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: badTargets,
+	})
+	require.Error(t, err)
+	errorObj, ok = err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrInvalidUpdate, errorObj.Code)
+
+	// metadata that already meets its thresholds is published straight away
+	rw, err := postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    root,
+		data.CanonicalTargetsRole: tg,
+	})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	// a root signed only by the keys it declares itself is not trusted, and
+	// neither are the targets keys it declares
+	otherRepo, _, _, _ := emptyRepoWithTwoTargetsSigners(t, gun)
+	selfSignedRoot, err := otherRepo.SignRoot(data.DefaultExpires(data.CanonicalRootRole), nil)
+	require.NoError(t, err)
+	otherTargets, err := otherRepo.SignTargetsPartially(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	_, err = postPending(t, state, gun, map[data.RoleName]*data.Signed{
+		data.CanonicalRootRole:    selfSignedRoot,
+		data.CanonicalTargetsRole: otherTargets,
+	})
+	require.Error(t, err)
+	errorObj, ok = err.(errcode.Error)
+	require.True(t, ok)
+	require.Equal(t, errors.ErrInvalidUpdate, errorObj.Code)
+	_, err = getPending(t, state, gun)
+	require.Error(t, err)
+}
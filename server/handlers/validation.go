@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
@@ -140,6 +141,16 @@ func loadAndValidateTargets(gun data.GUN, builder tuf.RepoBuilder, roles map[dat
 			logrus.Error("ErrBadTargets: ", err.Error())
 			return nil, validation.ErrBadTargets{Msg: err.Error()}
 		}
+		if data.IsDelegation(roleName) {
+			if err := validateHashedBinTargets(gun, roleName, roles, store); err != nil {
+				logrus.Error("ErrBadTargets: ", err.Error())
+				return nil, err
+			}
+			if err := validateTerminatingDelegations(gun, roleName, roles, store); err != nil {
+				logrus.Error("ErrBadTargets: ", err.Error())
+				return nil, err
+			}
+		}
 		updatesToApply = append(updatesToApply, roles[roleName])
 	}
 
@@ -223,6 +234,108 @@ func generateTimestamp(gun data.GUN, builder tuf.RepoBuilder, store storage.Meta
 	}
 }
 
+// validateHashedBinTargets checks that every target in the metadata for a hashed
+// bin delegation belongs in the bin, since no client would look for it there
+// otherwise.  The delegation's metadata and its parent's metadata must already
+// have been validated.
+func validateHashedBinTargets(gun data.GUN, roleName data.RoleName, roles map[data.RoleName]storage.MetaUpdate, store storage.MetaStore) error {
+	parentTargets, err := updatedTargets(gun, roleName.Parent(), roles, store)
+	if err != nil {
+		return err
+	}
+	delgRole, err := parentTargets.BuildDelegationRole(roleName)
+	if err != nil {
+		return validation.ErrBadTargets{Msg: err.Error()}
+	}
+	if len(delgRole.PathHashPrefixes) == 0 {
+		return nil
+	}
+
+	delgTargets, err := targetsFromJSON(roles[roleName].Data, roleName)
+	if err != nil {
+		return validation.ErrBadTargets{Msg: err.Error()}
+	}
+	for targetPath := range delgTargets.Signed.Targets {
+		if !delgRole.CheckPaths(targetPath) {
+			return validation.ErrBadTargets{
+				Msg: fmt.Sprintf("target %s does not belong in hashed bin %s", targetPath, roleName)}
+		}
+	}
+	return nil
+}
+
+// validateTerminatingDelegations checks that no target in the metadata for a
+// delegation is matched by a terminating delegation that a search for the
+// target reaches first, which is one listed before the delegation or before
+// any of its ancestors, since no client would find the target otherwise.  The
+// metadata of the delegation and its ancestors must already have been validated.
+func validateTerminatingDelegations(gun data.GUN, roleName data.RoleName, roles map[data.RoleName]storage.MetaUpdate, store storage.MetaStore) error {
+	delgTargets, err := targetsFromJSON(roles[roleName].Data, roleName)
+	if err != nil {
+		return validation.ErrBadTargets{Msg: err.Error()}
+	}
+	if len(delgTargets.Signed.Targets) == 0 {
+		return nil
+	}
+
+	// walk down from the targets role, through the delegations of each ancestor
+	parent := data.DelegationRole{
+		BaseRole: data.BaseRole{Name: data.CanonicalTargetsRole},
+		Paths:    []string{""},
+	}
+	for parent.Name != roleName {
+		parentTargets, err := updatedTargets(gun, parent.Name, roles, store)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, child := range parentTargets.GetValidDelegations(parent) {
+			if child.Name == roleName || strings.HasPrefix(roleName.String(), child.Name.String()+"/") {
+				parent = child
+				found = true
+				break
+			}
+			for targetPath := range delgTargets.Signed.Targets {
+				if child.Terminates(targetPath) {
+					return validation.ErrBadTargets{
+						Msg: fmt.Sprintf("target %s in %s is hidden by terminating delegation %s", targetPath, roleName, child.Name)}
+				}
+			}
+		}
+		if !found {
+			// loading the delegation has already checked that it is delegated
+			return nil
+		}
+	}
+	return nil
+}
+
+// updatedTargets returns the targets metadata for a role that is being updated,
+// or else the current targets metadata for the role in the store
+func updatedTargets(gun data.GUN, roleName data.RoleName, roles map[data.RoleName]storage.MetaUpdate, store storage.MetaStore) (*data.SignedTargets, error) {
+	update, ok := roles[roleName]
+	metaJSON := update.Data
+	if !ok {
+		var err error
+		if _, metaJSON, err = store.GetCurrent(gun, roleName); err != nil {
+			return nil, err
+		}
+	}
+	signedTargets, err := targetsFromJSON(metaJSON, roleName)
+	if err != nil {
+		return nil, validation.ErrBadTargets{Msg: err.Error()}
+	}
+	return signedTargets, nil
+}
+
+func targetsFromJSON(metaJSON []byte, roleName data.RoleName) (*data.SignedTargets, error) {
+	signedObj := &data.Signed{}
+	if err := json.Unmarshal(metaJSON, signedObj); err != nil {
+		return nil, err
+	}
+	return data.TargetsFromSigned(signedObj, roleName)
+}
+
 func loadFromStore(gun data.GUN, roleName data.RoleName, builder tuf.RepoBuilder, store storage.MetaStore) error {
 	_, metaJSON, err := store.GetCurrent(gun, roleName)
 	if err != nil {
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"fmt"
 	"path"
 	"testing"
 	"time"
@@ -409,7 +410,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 
 	// set the original root in the store
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	// rotate the root key, sign with both keys, and update - update should succeed
 	newRootKey, err := testutils.CreateKey(crypto, gun, data.CanonicalRootRole, data.ECDSAKey)
@@ -426,7 +427,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 
 	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
 	require.NoError(t, err)
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	// the next root does NOT need to be signed by both keys, because we only care
 	// about signing with both keys if the root keys have changed (signRoot again to bump the version)
@@ -450,7 +451,7 @@ func TestValidateRootRotationWithOldSigs(t *testing.T) {
 	snapshot.Version = repo.Snapshot.Signed.Version
 	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
 	require.NoError(t, err)
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	// another root rotation requires only the previous and new keys, and not the
 	// original root key even though that original role is still in the metadata
@@ -519,7 +520,7 @@ func TestValidateRootRotationMultipleKeysThreshold1(t *testing.T) {
 
 	// set the original root in the store
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	// replace the keys with just 1 key
 	rotatedRootKey, err := testutils.CreateKey(crypto, gun, data.CanonicalRootRole, data.ECDSAKey)
@@ -553,6 +554,40 @@ func TestValidateRootRotationMultipleKeysThreshold1(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// A targets role with a threshold greater than 1 is only accepted once it
+// carries enough valid signatures to meet the threshold
+func TestValidateTargetsThreshold(t *testing.T) {
+	var gun data.GUN = "docker.com/notary"
+	repo, crypto, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	serverCrypto := testutils.CopyKeys(t, crypto, data.CanonicalTimestampRole)
+	store := storage.NewMemStorage()
+
+	additionalTargetsKey, err := testutils.CreateKey(crypto, gun, data.CanonicalTargetsRole, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddBaseKeys(data.CanonicalTargetsRole, additionalTargetsKey))
+	require.NoError(t, repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, 2))
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	require.NoError(t, err)
+	require.Len(t, tg.Signatures, 2)
+	allSigs := tg.Signatures
+
+	// drop one of the targets signatures
+	tg.Signatures = allSigs[:1]
+	root, targets, snapshot, timestamp, err := getUpdates(r, tg, sn, ts)
+	require.NoError(t, err)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, targets, snapshot, timestamp}, store)
+	require.Error(t, err)
+	require.IsType(t, validation.ErrBadTargets{}, err)
+
+	tg.Signatures = allSigs
+	root, targets, snapshot, timestamp, err = getUpdates(r, tg, sn, ts)
+	require.NoError(t, err)
+	_, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, targets, snapshot, timestamp}, store)
+	require.NoError(t, err)
+}
+
 // A root rotation must be signed with old and new root keys such that it satisfies
 // the old and new roles, otherwise the new root fails to validate
 func TestRootRotationNotSignedWithOldKeysForOldRole(t *testing.T) {
@@ -580,7 +615,7 @@ func TestRootRotationNotSignedWithOldKeysForOldRole(t *testing.T) {
 	require.NoError(t, err)
 
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	finalRootKey, err := testutils.CreateKey(crypto, gun, data.CanonicalRootRole, data.ECDSAKey)
 	require.NoError(t, err)
@@ -646,7 +681,7 @@ func TestRootRotationVersionIncrement(t *testing.T) {
 
 	// set the original root in the store
 	updates := []storage.MetaUpdate{root, targets, snapshot, timestamp}
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 
 	// rotate the root key, sign with both keys, and update - update should succeed
 	newRootKey, err := testutils.CreateKey(crypto, gun, data.CanonicalRootRole, data.ECDSAKey)
@@ -670,7 +705,7 @@ func TestRootRotationVersionIncrement(t *testing.T) {
 	root.Version = root.Version - 1
 	updates, err = validateUpdate(serverCrypto, gun, []storage.MetaUpdate{root, snapshot}, store)
 	require.NoError(t, err)
-	require.NoError(t, store.UpdateMany(gun, updates))
+	require.NoError(t, store.UpdateMany(gun, updates, nil))
 }
 
 // An update is not valid without the root metadata.
@@ -1486,4 +1521,119 @@ func TestValidateTargetsRoleNotInParent(t *testing.T) {
 	require.IsType(t, validation.ErrBadTargets{}, err)
 }
 
+// Delegations of a terminating delegation are validated against it like any
+// other, and the terminating field survives validation.  Targets that it hides
+// from the delegations listed after it are rejected.
+func TestValidateTargetsTerminatingDelegation(t *testing.T) {
+	var (
+		gun       data.GUN      = "docker.com/notary"
+		delgName  data.RoleName = "targets/level1"
+		childName data.RoleName = "targets/level1/level2"
+		otherName data.RoleName = "targets/other"
+		deepName  data.RoleName = "targets/other/deep"
+	)
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	// targets/level1 is delegated before targets/other
+	for _, role := range []data.RoleName{delgName, childName, otherName, deepName} {
+		path := "level1"
+		if role == otherName || role == deepName {
+			path = ""
+		}
+		key, err := testutils.CreateKey(cs, gun, role, data.ECDSAKey)
+		require.NoError(t, err)
+		require.NoError(t, repo.UpdateDelegationKeys(role, []data.PublicKey{key}, []string{}, 1))
+		require.NoError(t, repo.UpdateDelegationPaths(role, []string{path}, []string{}, false))
+		_, err = repo.InitTargets(role)
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.UpdateDelegationTerminating(delgName, true))
+	targetMeta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = repo.AddTargets(childName, data.Files{"level1/image": targetMeta})
+	require.NoError(t, err)
+	_, err = repo.AddTargets(otherName, data.Files{"other/image": targetMeta})
+	require.NoError(t, err)
+
+	meta, err := testutils.SignAndSerialize(repo)
+	require.NoError(t, err)
+	require.Contains(t, string(meta[data.CanonicalTargetsRole]), `"terminating":true`)
+
+	validate := func(meta map[data.RoleName][]byte, roleNames ...data.RoleName) ([]storage.MetaUpdate, error) {
+		builder := tuf.NewRepoBuilder(gun, nil, trustpinning.TrustPinConfig{})
+		require.NoError(t, builder.Load(data.CanonicalRootRole, meta[data.CanonicalRootRole], 0, false))
+		roles := make(map[data.RoleName]storage.MetaUpdate)
+		for _, role := range roleNames {
+			roles[role] = storage.MetaUpdate{Role: role, Version: 1, Data: meta[role]}
+		}
+		return loadAndValidateTargets(gun, builder, roles, storage.NewMemStorage())
+	}
+	updates, err := validate(meta, data.CanonicalTargetsRole, delgName, childName, otherName, deepName)
+	require.NoError(t, err)
+	require.Len(t, updates, 5)
+	require.Equal(t, data.CanonicalTargetsRole, updates[0].Role)
+
+	// a target that a search ends at targets/level1 before reaching it
+	for _, role := range []data.RoleName{otherName, deepName} {
+		_, err = repo.AddTargets(role, data.Files{"level1/hidden": targetMeta})
+		require.NoError(t, err)
+		hidden, err := testutils.SignAndSerialize(repo)
+		require.NoError(t, err)
+		_, err = validate(hidden, data.CanonicalTargetsRole, delgName, childName, otherName, deepName)
+		require.IsType(t, validation.ErrBadTargets{}, err)
+		require.Contains(t, err.Error(), "terminating")
+		require.NoError(t, repo.RemoveTargets(role, "level1/hidden"))
+	}
+}
+
+func TestValidateTargetsHashedBinDelegation(t *testing.T) {
+	var (
+		gun    data.GUN      = "docker.com/notary"
+		lowBin data.RoleName = "targets/0-7"
+	)
+	repo, cs, err := testutils.EmptyRepo(gun)
+	require.NoError(t, err)
+	key, err := testutils.CreateKey(cs, gun, lowBin, data.ECDSAKey)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateDelegationKeys(lowBin, []data.PublicKey{key}, []string{}, 1))
+	require.NoError(t, repo.UpdateDelegationPathHashPrefixes(lowBin, []string{"0", "1", "2", "3", "4", "5", "6", "7"}, nil))
+
+	var lowPath, highPath string
+	for i := 0; lowPath == "" || highPath == ""; i++ {
+		targetPath := fmt.Sprintf("target%d", i)
+		if data.PathHash(targetPath)[0] < '8' {
+			lowPath = targetPath
+		} else {
+			highPath = targetPath
+		}
+	}
+	meta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = repo.AddTargets(lowBin, data.Files{lowPath: meta})
+	require.NoError(t, err)
+
+	validate := func() ([]storage.MetaUpdate, error) {
+		metas, err := testutils.SignAndSerialize(repo)
+		require.NoError(t, err)
+		builder := tuf.NewRepoBuilder(gun, nil, trustpinning.TrustPinConfig{})
+		require.NoError(t, builder.Load(data.CanonicalRootRole, metas[data.CanonicalRootRole], 0, false))
+		roles := map[data.RoleName]storage.MetaUpdate{
+			data.CanonicalTargetsRole: {Role: data.CanonicalTargetsRole, Version: 1, Data: metas[data.CanonicalTargetsRole]},
+			lowBin:                    {Role: lowBin, Version: 1, Data: metas[lowBin]},
+		}
+		return loadAndValidateTargets(gun, builder, roles, storage.NewMemStorage())
+	}
+
+	updates, err := validate()
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+
+	// a target that does not belong in the bin cannot be added with the
+	// repo, so it is put into the bin's metadata directly
+	repo.Targets[lowBin].Signed.Targets[highPath] = meta
+	repo.Targets[lowBin].Dirty = true
+	_, err = validate()
+	require.Error(t, err)
+	require.IsType(t, validation.ErrBadTargets{}, err)
+	require.Contains(t, err.Error(), highPath)
+}
+
 // ### End target validation with delegations tests
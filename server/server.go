@@ -149,6 +149,36 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 		authWrapper,
 		repoPrefixes,
 	))
+	r.Methods("POST").Path("/v2/{gun:[^*]+}/_trust/tuf/pending").Handler(CreateHandler(
+		"UpdatePendingTUF",
+		handlers.PendingUpdateHandler,
+		invalidGUNErr,
+		false,
+		nil,
+		[]string{"push", "pull"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("GET").Path("/v2/{gun:[^*]+}/_trust/tuf/pending").Handler(CreateHandler(
+		"GetPendingTUF",
+		handlers.GetPendingHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"pull"},
+		authWrapper,
+		repoPrefixes,
+	))
+	r.Methods("DELETE").Path("/v2/{gun:[^*]+}/_trust/tuf/pending").Handler(CreateHandler(
+		"DeletePendingTUF",
+		handlers.DeletePendingHandler,
+		notFoundError,
+		false,
+		nil,
+		[]string{"push", "pull"},
+		authWrapper,
+		repoPrefixes,
+	))
 	r.Methods("GET").Path("/v2/{gun:[^*]+}/_trust/tuf/{tufRole:root|targets(?:/[^/\\s]+)*|snapshot|timestamp}.{checksum:[a-fA-F0-9]{64}|[a-fA-F0-9]{96}|[a-fA-F0-9]{128}}.json").Handler(CreateHandler(
 		"GetRoleByHash",
 		handlers.GetHandler,
@@ -231,6 +261,16 @@ func RootHandler(ctx context.Context, ac auth.AccessController, trust signed.Cry
 		authWrapper,
 		repoPrefixes,
 	))
+	r.Methods("GET").Path("/v2/_trust/catalog").Handler(CreateHandler(
+		"Catalog",
+		handlers.Catalog,
+		notFoundError,
+		false,
+		nil,
+		[]string{"*"},
+		authWrapper,
+		repoPrefixes,
+	))
 	r.Methods("GET").Path("/_notary_server/health").HandlerFunc(health.StatusHandler)
 	r.Methods("GET").Path("/metrics").Handler(prometheus.Handler())
 	r.Methods("GET", "POST", "PUT", "HEAD", "DELETE").Path("/{other:.*}").Handler(
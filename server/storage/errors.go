@@ -2,6 +2,8 @@ package storage
 
 import (
 	"fmt"
+
+	"github.com/theupdateframework/notary/tuf/data"
 )
 
 // ErrOldVersion is returned when a newer version of TUF metadata is already available
@@ -12,6 +14,45 @@ func (err ErrOldVersion) Error() string {
 	return fmt.Sprintf("Error updating metadata. A newer version is already available")
 }
 
+// ErrVersionConflict is returned when an update is not based on the current
+// versions of the metadata.  A version of 0 means that the role has not been
+// published.
+type ErrVersionConflict struct {
+	Expected map[data.RoleName]int `json:"expected"`
+	Current  map[data.RoleName]int `json:"current"`
+}
+
+// ErrVersionConflict is returned when an update is not based on the current
+// versions of the metadata
+func (err ErrVersionConflict) Error() string {
+	return fmt.Sprintf("Error updating metadata. Expected versions %v, but the current versions are %v", err.Expected, err.Current)
+}
+
+// checkExpectedVersions returns an ErrVersionConflict if the current version
+// of any of the expected roles, as looked up by currentVersion, is not the
+// expected one
+func checkExpectedVersions(expected map[data.RoleName]int, currentVersion func(data.RoleName) (int, error)) error {
+	if len(expected) == 0 {
+		return nil
+	}
+	conflict := ErrVersionConflict{Expected: expected, Current: make(map[data.RoleName]int)}
+	conflicting := false
+	for role, version := range expected {
+		current, err := currentVersion(role)
+		if err != nil {
+			return err
+		}
+		conflict.Current[role] = current
+		if current != version {
+			conflicting = true
+		}
+	}
+	if conflicting {
+		return conflict
+	}
+	return nil
+}
+
 // ErrNotFound is returned when TUF metadata isn't found for a specific record
 type ErrNotFound struct{}
 
@@ -26,9 +26,14 @@ type MetaStore interface {
 
 	// UpdateMany adds multiple new metadata for the given GUN.  It can even
 	// add multiple versions for the same role, so long as those versions are
-	// all unique and greater than any current versions.  Otherwise,
-	// none of the metadata is added, and an error is be returned.
-	UpdateMany(gun data.GUN, updates []MetaUpdate) error
+	// all unique and greater than any current versions.  If expected
+	// versions are given, the metadata is also only added if the current
+	// version of each of the expected roles is the expected one, where 0
+	// means that the role has no metadata, and ErrVersionConflict is
+	// returned otherwise.  This is checked atomically with adding the
+	// metadata.  Otherwise, none of the metadata is added, and an error is
+	// be returned.
+	UpdateMany(gun data.GUN, updates []MetaUpdate, expected map[data.RoleName]int) error
 
 	// GetCurrent returns the modification date and data part of the metadata for
 	// the latest version of the given GUN and role.  If there is no data for
@@ -45,10 +50,33 @@ type MetaStore interface {
 	// not found, it returns storage.ErrNotFound
 	GetVersion(gun data.GUN, tufRole data.RoleName, version int) (created *time.Time, data []byte, err error)
 
-	// Delete removes all metadata for a given GUN.  It does not return an
-	// error if no metadata exists for the given GUN.
+	// Delete removes all metadata for a given GUN, including any pending
+	// metadata.  It does not return an error if no metadata exists for the
+	// given GUN.
 	Delete(gun data.GUN) error
 
+	// SetPending replaces the pending metadata for the given GUN, which is
+	// metadata that has been uploaded but that is not yet signed by enough
+	// keys to be published.  It is only replaced if it is still the pending
+	// metadata with the given checksum, as returned by GetPending, or if
+	// there is none and the checksum is empty; otherwise ErrOldVersion is
+	// returned, so that concurrent uploads can't overwrite each other's
+	// signatures.  Setting no updates removes the pending metadata.
+	SetPending(gun data.GUN, checksum string, updates []MetaUpdate) error
+
+	// GetPending returns the pending metadata for the given GUN, and its
+	// checksum for SetPending.  If there is none, an empty slice and an
+	// empty checksum are returned.
+	GetPending(gun data.GUN) ([]MetaUpdate, string, error)
+
+	// DeletePending removes the pending metadata for the given GUN.  It does
+	// not return an error if there is no pending metadata for the given GUN.
+	DeletePending(gun data.GUN) error
+
+	// ListGUNs returns, in order, the GUNs that have metadata and start with
+	// the given prefix.  An empty prefix lists all of the GUNs.
+	ListGUNs(prefix string) ([]data.GUN, error)
+
 	// GetChanges returns an ordered slice of changes. It starts from
 	// the change matching changeID, but excludes this change from the results
 	// on the assumption that if a user provides an ID, they've seen that change.
@@ -41,6 +41,7 @@ type MemStorage struct {
 	tufMeta   map[string]verList
 	keys      map[string]map[string]*key
 	checksums map[string]map[string]ver
+	pending   map[string][]byte
 	changes   []Change
 }
 
@@ -50,6 +51,7 @@ func NewMemStorage() *MemStorage {
 		tufMeta:   make(map[string]verList),
 		keys:      make(map[string]map[string]*key),
 		checksums: make(map[string]map[string]ver),
+		pending:   make(map[string][]byte),
 	}
 }
 
@@ -96,10 +98,20 @@ func (st *MemStorage) writeChange(gun data.GUN, version int, checksum string) {
 }
 
 // UpdateMany updates multiple TUF records
-func (st *MemStorage) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
+func (st *MemStorage) UpdateMany(gun data.GUN, updates []MetaUpdate, expected map[data.RoleName]int) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 
+	if err := checkExpectedVersions(expected, func(role data.RoleName) (int, error) {
+		space := st.tufMeta[entryKey(gun, role)]
+		if len(space) == 0 {
+			return 0, nil
+		}
+		return space[len(space)-1].version, nil
+	}); err != nil {
+		return err
+	}
+
 	versioner := make(map[string]map[int]struct{})
 	constant := struct{}{}
 
@@ -188,6 +200,7 @@ func (st *MemStorage) GetVersion(gun data.GUN, role data.RoleName, version int)
 func (st *MemStorage) Delete(gun data.GUN) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
+	delete(st.pending, gun.String())
 	l := len(st.tufMeta)
 	for k := range st.tufMeta {
 		if strings.HasPrefix(k, gun.String()) {
@@ -209,6 +222,61 @@ func (st *MemStorage) Delete(gun data.GUN) error {
 	return nil
 }
 
+// SetPending replaces the pending metadata for a given GUN, if its checksum
+// has not changed
+func (st *MemStorage) SetPending(gun data.GUN, checksum string, updates []MetaUpdate) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if pendingChecksum(st.pending[gun.String()]) != checksum {
+		return ErrOldVersion{}
+	}
+	if len(updates) == 0 {
+		delete(st.pending, gun.String())
+		return nil
+	}
+	raw, _, err := encodePending(updates)
+	if err != nil {
+		return err
+	}
+	st.pending[gun.String()] = raw
+	return nil
+}
+
+// GetPending returns the pending metadata for a given GUN, and its checksum
+func (st *MemStorage) GetPending(gun data.GUN) ([]MetaUpdate, string, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	raw := st.pending[gun.String()]
+	updates, err := decodePending(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	return updates, pendingChecksum(raw), nil
+}
+
+// DeletePending deletes the pending metadata for a given GUN
+func (st *MemStorage) DeletePending(gun data.GUN) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.pending, gun.String())
+	return nil
+}
+
+// ListGUNs returns the GUNs with metadata that start with the given prefix
+func (st *MemStorage) ListGUNs(prefix string) ([]data.GUN, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	var guns []data.GUN
+	// every update records a checksum under its GUN, until the GUN is deleted
+	for gun := range st.checksums {
+		if strings.HasPrefix(gun, prefix) {
+			guns = append(guns, data.GUN(gun))
+		}
+	}
+	sort.Slice(guns, func(i, j int) bool { return guns[i] < guns[j] })
+	return guns, nil
+}
+
 // GetChanges returns a []Change starting from but excluding the record
 // identified by changeID. In the context of the memory store, changeID
 // is simply an index into st.changes. The ID of a change is its
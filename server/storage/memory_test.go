@@ -65,6 +65,13 @@ func TestMemoryUpdateManyConflictRollback(t *testing.T) {
 	assertExpectedMemoryTUFMeta(t, expected, s)
 }
 
+// UpdateMany only inserts the updates if the current versions are the expected ones
+func TestMemoryUpdateManyExpectedVersions(t *testing.T) {
+	s := NewMemStorage()
+	expected := testUpdateManyExpectedVersions(t, s)
+	assertExpectedMemoryTUFMeta(t, expected, s)
+}
+
 // Delete will remove all TUF metadata, all versions, associated with a gun
 func TestMemoryDeleteSuccess(t *testing.T) {
 	s := NewMemStorage()
@@ -72,6 +79,18 @@ func TestMemoryDeleteSuccess(t *testing.T) {
 	assertExpectedMemoryTUFMeta(t, nil, s)
 }
 
+// Pending metadata can be set, replaced and deleted without being published
+func TestMemoryPending(t *testing.T) {
+	s := NewMemStorage()
+	testPending(t, s)
+}
+
+// GUNs with metadata can be listed by prefix
+func TestMemoryListGUNs(t *testing.T) {
+	s := NewMemStorage()
+	testListGUNs(t, s)
+}
+
 func TestGetCurrent(t *testing.T) {
 	s := NewMemStorage()
 
@@ -36,6 +36,7 @@ func rethinkDBSetup(t *testing.T) (RethinkDB, func()) {
 	cleanup()
 	require.NoError(t, rethinkdb.SetupDB(session, dbName, []rethinkdb.Table{
 		TUFFilesRethinkTable,
+		PendingTUFMetadataRethinkTable,
 		ChangeRethinkTable,
 	}))
 	return NewRethinkDBStorage(dbName, "", "", session), cleanup
@@ -156,6 +157,14 @@ func TestRethinkUpdateManyConflictRollback(t *testing.T) {
 	testUpdateManyConflictRollback(t, dbStore)
 }
 
+// UpdateMany only inserts the updates if the current versions are the expected ones
+func TestRethinkUpdateManyExpectedVersions(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testUpdateManyExpectedVersions(t, dbStore)
+}
+
 // Delete will remove all TUF metadata, all versions, associated with a gun
 func TestRethinkDeleteSuccess(t *testing.T) {
 	dbStore, cleanup := rethinkDBSetup(t)
@@ -164,6 +173,22 @@ func TestRethinkDeleteSuccess(t *testing.T) {
 	testDeleteSuccess(t, dbStore)
 }
 
+// Pending metadata can be set, replaced and deleted without being published
+func TestRethinkPending(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testPending(t, dbStore)
+}
+
+// GUNs with metadata can be listed by prefix
+func TestRethinkListGUNs(t *testing.T) {
+	dbStore, cleanup := rethinkDBSetup(t)
+	defer cleanup()
+
+	testListGUNs(t, dbStore)
+}
+
 func TestRethinkTUFMetaStoreGetCurrent(t *testing.T) {
 	dbStore, cleanup := rethinkDBSetup(t)
 	defer cleanup()
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -38,6 +39,21 @@ func (r RDBTUFFile) TableName() string {
 	return TUFFileTableName
 }
 
+// RDBPendingTUFMetadata is the TUF metadata for a GUN that is not yet signed
+// by enough keys to be published.  All of it is kept in a single document,
+// which is only replaced if its checksum has not changed.
+type RDBPendingTUFMetadata struct {
+	rethinkdb.Timing
+	Gun    string `gorethink:"gun"`
+	SHA256 string `gorethink:"sha256"`
+	Data   []byte `gorethink:"data"`
+}
+
+// TableName returns the table name for the record type
+func (r RDBPendingTUFMetadata) TableName() string {
+	return PendingTUFMetadataTableName
+}
+
 // Change defines the the fields required for an object in the changefeed
 type Change struct {
 	ID        string    `gorethink:"id,omitempty" gorm:"primary_key" sql:"not null"`
@@ -86,6 +102,30 @@ func rdbTUFFileFromJSON(data []byte) (interface{}, error) {
 	}, nil
 }
 
+func rdbPendingTUFMetadataFromJSON(data []byte) (interface{}, error) {
+	a := struct {
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		DeletedAt time.Time `json:"deleted_at"`
+		Gun       string    `json:"gun"`
+		SHA256    string    `json:"sha256"`
+		Data      []byte    `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return RDBPendingTUFMetadata{}, err
+	}
+	return RDBPendingTUFMetadata{
+		Timing: rethinkdb.Timing{
+			CreatedAt: a.CreatedAt,
+			UpdatedAt: a.UpdatedAt,
+			DeletedAt: a.DeletedAt,
+		},
+		Gun:    a.Gun,
+		SHA256: a.SHA256,
+		Data:   a.Data,
+	}, nil
+}
+
 func rdbChangeFromJSON(data []byte) (interface{}, error) {
 	res := Change{}
 	if err := json.Unmarshal(data, &res); err != nil {
@@ -178,8 +218,12 @@ func (u updateSorter) Less(i, j int) bool {
 // not support transactions, therefore we will attempt to insert the timestamp
 // last as this represents a published version of the repo.  However, we will
 // insert all other role data in alphabetical order first, and also include the
-// associated timestamp checksum so that we can easily roll back this pseudotransaction
-func (rdb RethinkDB) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
+// associated timestamp checksum so that we can easily roll back this pseudotransaction.
+// The expected versions are checked before inserting anything, and again
+// before inserting the timestamp, ignoring the versions this update inserted,
+// so that of two concurrent updates expecting the same versions at least one
+// is rolled back.
+func (rdb RethinkDB) UpdateMany(gun data.GUN, updates []MetaUpdate, expected map[data.RoleName]int) error {
 	// find the timestamp first and save its checksum
 	// then apply the updates in alphabetic role order with the timestamp last
 	// if there are any failures, we roll back in the same alphabetic order
@@ -196,18 +240,47 @@ func (rdb RethinkDB) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
 		}
 	}
 
+	inserted := make(map[data.RoleName]map[int]bool)
+	checkExpected := func() error {
+		return checkExpectedVersions(expected, func(role data.RoleName) (int, error) {
+			return rdb.currentVersion(gun, role, inserted[role])
+		})
+	}
+	if err := checkExpected(); err != nil {
+		return err
+	}
+
 	// alphabetize the updates by Role name
 	sort.Stable(updateSorter(updates))
 
+	rollback := func(err error) error {
+		// roll back with best-effort deletion, and then error out
+		rollbackErr := rdb.deleteByTSChecksum(tsChecksum)
+		if rollbackErr != nil {
+			logrus.Errorf("Unable to rollback DB conflict - items with timestamp_checksum %s: %v",
+				tsChecksum, rollbackErr)
+		}
+		return err
+	}
+	rechecked := false
 	for _, up := range updates {
-		if err := rdb.updateCurrentWithTSChecksum(gun.String(), tsChecksum, up); err != nil {
-			// roll back with best-effort deletion, and then error out
-			rollbackErr := rdb.deleteByTSChecksum(tsChecksum)
-			if rollbackErr != nil {
-				logrus.Errorf("Unable to rollback DB conflict - items with timestamp_checksum %s: %v",
-					tsChecksum, rollbackErr)
+		if up.Role == data.CanonicalTimestampRole {
+			rechecked = true
+			if err := checkExpected(); err != nil {
+				return rollback(err)
 			}
-			return err
+		}
+		if err := rdb.updateCurrentWithTSChecksum(gun.String(), tsChecksum, up); err != nil {
+			return rollback(err)
+		}
+		if inserted[up.Role] == nil {
+			inserted[up.Role] = make(map[int]bool)
+		}
+		inserted[up.Role][up.Version] = true
+	}
+	if !rechecked {
+		if err := checkExpected(); err != nil {
+			return rollback(err)
 		}
 	}
 
@@ -218,6 +291,29 @@ func (rdb RethinkDB) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
 	return nil
 }
 
+// currentVersion returns the latest version of the metadata for a role,
+// ignoring the given versions, or 0 if there is none
+func (rdb RethinkDB) currentVersion(gun data.GUN, role data.RoleName, ignored map[int]bool) (int, error) {
+	res, err := gorethink.DB(rdb.dbName).Table(RDBTUFFile{}.TableName(), gorethink.TableOpts{ReadMode: "majority"}).GetAllByIndex(
+		rdbGunRoleIdx, []string{gun.String(), role.String()},
+	).Field("version").Run(rdb.sess)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+	var versions []int
+	if err := res.All(&versions); err != nil {
+		return 0, err
+	}
+	current := 0
+	for _, version := range versions {
+		if !ignored[version] && version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
 // GetCurrent returns the modification date and data part of the metadata for
 // the latest version of the given GUN and role.  If there is no data for
 // the given GUN and role, an error is returned.
@@ -283,6 +379,9 @@ func (rdb RethinkDB) GetVersion(gun data.GUN, role data.RoleName, version int) (
 // Delete removes all metadata for a given GUN.  It does not return an
 // error if no metadata exists for the given GUN.
 func (rdb RethinkDB) Delete(gun data.GUN) error {
+	if err := rdb.DeletePending(gun); err != nil {
+		return err
+	}
 	resp, err := gorethink.DB(rdb.dbName).Table(RDBTUFFile{}.TableName()).GetAllByIndex(
 		"gun", gun.String(),
 	).Delete().RunWrite(rdb.sess)
@@ -295,6 +394,137 @@ func (rdb RethinkDB) Delete(gun data.GUN) error {
 	return nil
 }
 
+// SetPending replaces the pending metadata for the given GUN, if its checksum
+// has not changed.  RethinkDB does not support transactions, but all of a
+// GUN's pending metadata is a single document, and a document is replaced or
+// deleted atomically by a function that compares the checksum.
+func (rdb RethinkDB) SetPending(gun data.GUN, checksum string, updates []MetaUpdate) error {
+	var (
+		raw         []byte
+		newChecksum string
+		err         error
+	)
+	if len(updates) > 0 {
+		if raw, newChecksum, err = encodePending(updates); err != nil {
+			return err
+		}
+	}
+	table := gorethink.DB(rdb.dbName).Table(RDBPendingTUFMetadata{}.TableName())
+
+	switch {
+	case checksum == newChecksum:
+		// nothing changes, as long as it is still the same
+		_, current, err := rdb.GetPending(gun)
+		if err != nil {
+			return err
+		}
+		if current != checksum {
+			return ErrOldVersion{}
+		}
+		return nil
+	case checksum == "":
+		now := time.Now()
+		_, err := table.Insert(
+			RDBPendingTUFMetadata{
+				Timing: rethinkdb.Timing{
+					CreatedAt: now,
+					UpdatedAt: now,
+				},
+				Gun:    gun.String(),
+				SHA256: newChecksum,
+				Data:   raw,
+			},
+			gorethink.InsertOpts{
+				Conflict: "error", // another upload has stored pending metadata in the meantime
+			},
+		).RunWrite(rdb.sess)
+		if err != nil && gorethink.IsConflictErr(err) {
+			return ErrOldVersion{}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to set pending metadata for %s: %s", gun, err.Error())
+		}
+		return nil
+	}
+
+	resp, err := table.Get(gun.String()).Replace(func(row gorethink.Term) gorethink.Term {
+		// replacing a document with null deletes it
+		var replacement interface{}
+		if len(updates) > 0 {
+			replacement = row.Merge(map[string]interface{}{
+				"sha256":     newChecksum,
+				"data":       gorethink.Binary(raw),
+				"updated_at": time.Now(),
+			})
+		}
+		return gorethink.Branch(row.Field("sha256").Default("").Eq(checksum), replacement, row)
+	}).RunWrite(rdb.sess)
+	if err != nil {
+		return fmt.Errorf("unable to set pending metadata for %s: %s", gun, err.Error())
+	}
+	if resp.Replaced == 0 && resp.Deleted == 0 {
+		return ErrOldVersion{}
+	}
+	return nil
+}
+
+// GetPending returns the pending metadata for the given GUN, and its checksum
+func (rdb RethinkDB) GetPending(gun data.GUN) ([]MetaUpdate, string, error) {
+	res, err := gorethink.DB(rdb.dbName).Table(RDBPendingTUFMetadata{}.TableName(), gorethink.TableOpts{ReadMode: "majority"}).Get(
+		gun.String(),
+	).Run(rdb.sess)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Close()
+	var pending RDBPendingTUFMetadata
+	if err := res.One(&pending); err == gorethink.ErrEmptyResult {
+		return []MetaUpdate{}, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	updates, err := decodePending(pending.Data)
+	if err != nil {
+		return nil, "", err
+	}
+	return updates, pending.SHA256, nil
+}
+
+// DeletePending removes the pending metadata for the given GUN.  It does not
+// return an error if there is no pending metadata for the given GUN.
+func (rdb RethinkDB) DeletePending(gun data.GUN) error {
+	_, err := gorethink.DB(rdb.dbName).Table(RDBPendingTUFMetadata{}.TableName()).Get(
+		gun.String(),
+	).Delete().RunWrite(rdb.sess)
+	if err != nil {
+		return fmt.Errorf("unable to delete pending metadata for %s from database: %s", gun.String(), err.Error())
+	}
+	return nil
+}
+
+// ListGUNs returns the GUNs with metadata that start with the given prefix,
+// which are read from the GUN index in order
+func (rdb RethinkDB) ListGUNs(prefix string) ([]data.GUN, error) {
+	res, err := gorethink.DB(rdb.dbName).Table(RDBTUFFile{}.TableName(), gorethink.TableOpts{ReadMode: "majority"}).Distinct(
+		gorethink.DistinctOpts{Index: "gun"},
+	).Run(rdb.sess)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	var names []string
+	if err := res.All(&names); err != nil {
+		return nil, err
+	}
+	var guns []data.GUN
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			guns = append(guns, data.GUN(name))
+		}
+	}
+	return guns, nil
+}
+
 // deleteByTSChecksum removes all metadata by a timestamp checksum, used for rolling back a "transaction"
 // from a call to rethinkdb's UpdateMany
 func (rdb RethinkDB) deleteByTSChecksum(tsChecksum string) error {
@@ -312,6 +542,7 @@ func (rdb RethinkDB) deleteByTSChecksum(tsChecksum string) error {
 func (rdb RethinkDB) Bootstrap() error {
 	if err := rethinkdb.SetupDB(rdb.sess, rdb.dbName, []rethinkdb.Table{
 		TUFFilesRethinkTable,
+		PendingTUFMetadataRethinkTable,
 		ChangeRethinkTable,
 	}); err != nil {
 		return err
@@ -31,6 +31,16 @@ var (
 		JSONUnmarshaller: rdbTUFFileFromJSON,
 	}
 
+	// PendingTUFMetadataRethinkTable is the table definition of notary server's pending TUF metadata
+	PendingTUFMetadataRethinkTable = rethinkdb.Table{
+		Name:       RDBPendingTUFMetadata{}.TableName(),
+		PrimaryKey: "gun",
+		Config: map[string]string{
+			"write_acks": "majority",
+		},
+		JSONUnmarshaller: rdbPendingTUFMetadataFromJSON,
+	}
+
 	// ChangeRethinkTable is the table definition for changefeed objects
 	ChangeRethinkTable = rethinkdb.Table{
 		Name:       Change{}.TableName(),
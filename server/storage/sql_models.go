@@ -14,6 +14,9 @@ const (
 // TUFFileTableName returns the name used for the tuf file table
 const TUFFileTableName = "tuf_files"
 
+// PendingTUFMetadataTableName returns the name used for the pending tuf metadata table
+const PendingTUFMetadataTableName = "pending_tuf_metadata"
+
 // ChangefeedTableName returns the name used for the changefeed table
 const ChangefeedTableName = "changefeed"
 
@@ -32,6 +35,22 @@ func (g TUFFile) TableName() string {
 	return TUFFileTableName
 }
 
+// PendingTUFMetadata represents the TUF metadata for a GUN that has been
+// uploaded, but that is not yet signed by enough keys to be published.  All
+// of it is kept in a single row, which is only replaced if its checksum has
+// not changed.
+type PendingTUFMetadata struct {
+	gorm.Model
+	Gun    string `sql:"type:varchar(255);not null"`
+	SHA256 string `gorm:"column:sha256" sql:"type:varchar(64);not null"`
+	Data   []byte `sql:"type:longblob;not null"`
+}
+
+// TableName sets a specific table name for PendingTUFMetadata
+func (g PendingTUFMetadata) TableName() string {
+	return PendingTUFMetadataTableName
+}
+
 // SQLChange defines the the fields required for an object in the changefeed
 type SQLChange struct {
 	ID        uint `gorm:"primary_key" sql:"not null" json:",string"`
@@ -59,6 +78,17 @@ func CreateTUFTable(db gorm.DB) error {
 	return query.Error
 }
 
+// CreatePendingTUFTable creates the DB table for PendingTUFMetadata
+func CreatePendingTUFTable(db gorm.DB) error {
+	query := db.AutoMigrate(&PendingTUFMetadata{})
+	if query.Error != nil {
+		return query.Error
+	}
+	query = db.Model(&PendingTUFMetadata{}).AddUniqueIndex(
+		"idx_pending_gun", "gun")
+	return query.Error
+}
+
 // CreateChangefeedTable creates the DB table for Changefeed
 func CreateChangefeedTable(db gorm.DB) error {
 	query := db.AutoMigrate(&SQLChange{})
@@ -5,10 +5,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary/tuf/data"
 )
@@ -31,7 +33,7 @@ func NewSQLStorage(dialect string, args ...interface{}) (*SQLStorage, error) {
 }
 
 // translateOldVersionError captures DB errors, and attempts to translate
-// duplicate entry - currently only supports MySQL and Sqlite3
+// duplicate entry - currently only supports MySQL and PostgreSQL
 func translateOldVersionError(err error) error {
 	switch err := err.(type) {
 	case *mysql.MySQLError:
@@ -41,6 +43,11 @@ func translateOldVersionError(err error) error {
 		if err.Number == 1022 || err.Number == 1062 {
 			return ErrOldVersion{}
 		}
+	case *pq.Error:
+		// https://www.postgresql.org/docs/current/static/errcodes-appendix.html
+		if err.Code == "23505" { // unique_violation
+			return ErrOldVersion{}
+		}
 	}
 	return err
 }
@@ -112,7 +119,7 @@ func (db *SQLStorage) getTransaction() (*gorm.DB, rollback, error) {
 }
 
 // UpdateMany atomically updates many TUF records in a single transaction
-func (db *SQLStorage) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
+func (db *SQLStorage) UpdateMany(gun data.GUN, updates []MetaUpdate, expected map[data.RoleName]int) error {
 	tx, rb, err := db.getTransaction()
 	if err != nil {
 		return err
@@ -122,6 +129,11 @@ func (db *SQLStorage) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
 		added = make(map[uint]bool)
 	)
 	if err := func() error {
+		if err := checkExpectedVersions(expected, func(role data.RoleName) (int, error) {
+			return db.currentVersion(tx, gun, role)
+		}); err != nil {
+			return err
+		}
 		for _, update := range updates {
 			// This looks like the same logic as UpdateCurrent, but if we just
 			// called, version ordering in the updates list must be enforced
@@ -165,6 +177,25 @@ func (db *SQLStorage) UpdateMany(gun data.GUN, updates []MetaUpdate) error {
 	return tx.Commit().Error
 }
 
+// currentVersion returns the version of the current metadata for a role in
+// the transaction, or 0 if there is none.  Where the database supports it, the
+// row is locked until the end of the transaction, so that concurrent updates
+// that expect the same version are applied one after the other.
+func (db *SQLStorage) currentVersion(tx *gorm.DB, gun data.GUN, role data.RoleName) (int, error) {
+	if db.Dialect().GetName() != "sqlite3" {
+		tx = tx.Set("gorm:query_option", "FOR UPDATE")
+	}
+	var row TUFFile
+	q := tx.Select("version").Where(
+		&TUFFile{Gun: gun.String(), Role: role.String()}).Order("version desc").Limit(1).First(&row)
+	if q.RecordNotFound() {
+		return 0, nil
+	} else if q.Error != nil {
+		return 0, q.Error
+	}
+	return row.Version, nil
+}
+
 func (db *SQLStorage) writeChangefeed(tx *gorm.DB, gun data.GUN, version int, checksum string) error {
 	c := &SQLChange{
 		GUN:      gun.String(),
@@ -235,6 +266,9 @@ func (db *SQLStorage) Delete(gun data.GUN) error {
 		return err
 	}
 	if err := func() error {
+		if err := tx.Unscoped().Where(&PendingTUFMetadata{Gun: gun.String()}).Delete(PendingTUFMetadata{}).Error; err != nil {
+			return err
+		}
 		res := tx.Unscoped().Where(&TUFFile{Gun: gun.String()}).Delete(TUFFile{})
 		if err := res.Error; err != nil {
 			return err
@@ -255,6 +289,99 @@ func (db *SQLStorage) Delete(gun data.GUN) error {
 	return tx.Commit().Error
 }
 
+// SetPending replaces the pending metadata for a specific GUN, if its
+// checksum has not changed.  The checksum is compared in the same statement
+// that replaces or deletes the row, and a GUN can only have one row, so that
+// concurrent uploads can't both replace the same pending metadata.
+func (db *SQLStorage) SetPending(gun data.GUN, checksum string, updates []MetaUpdate) error {
+	var (
+		raw         []byte
+		newChecksum string
+		err         error
+	)
+	if len(updates) > 0 {
+		if raw, newChecksum, err = encodePending(updates); err != nil {
+			return err
+		}
+	}
+
+	var res *gorm.DB
+	switch {
+	case checksum == newChecksum:
+		// nothing changes, as long as it is still the same
+		_, current, err := db.GetPending(gun)
+		if err != nil {
+			return err
+		}
+		if current != checksum {
+			return ErrOldVersion{}
+		}
+		return nil
+	case checksum == "":
+		// the unique index on the GUN rejects the row if another upload has
+		// stored pending metadata in the meantime
+		return translateOldVersionError(db.Create(&PendingTUFMetadata{
+			Gun:    gun.String(),
+			SHA256: newChecksum,
+			Data:   raw,
+		}).Error)
+	case len(updates) == 0:
+		res = db.Unscoped().Where("gun = ? and sha256 = ?", gun.String(), checksum).Delete(PendingTUFMetadata{})
+	default:
+		res = db.Model(&PendingTUFMetadata{}).Where("gun = ? and sha256 = ?", gun.String(), checksum).Updates(
+			map[string]interface{}{"sha256": newChecksum, "data": raw})
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOldVersion{}
+	}
+	return nil
+}
+
+// GetPending gets the pending metadata for a specific GUN, and its checksum
+func (db *SQLStorage) GetPending(gun data.GUN) ([]MetaUpdate, string, error) {
+	var row PendingTUFMetadata
+	q := db.Where(&PendingTUFMetadata{Gun: gun.String()}).First(&row)
+	if q.RecordNotFound() {
+		return []MetaUpdate{}, "", nil
+	} else if q.Error != nil {
+		return nil, "", q.Error
+	}
+	updates, err := decodePending(row.Data)
+	if err != nil {
+		return nil, "", err
+	}
+	return updates, row.SHA256, nil
+}
+
+// DeletePending deletes the pending metadata for a specific GUN - as with
+// Delete, this has to be a hard delete
+func (db *SQLStorage) DeletePending(gun data.GUN) error {
+	return db.Unscoped().Where(&PendingTUFMetadata{Gun: gun.String()}).Delete(PendingTUFMetadata{}).Error
+}
+
+// ListGUNs returns the GUNs with metadata that start with the given prefix
+func (db *SQLStorage) ListGUNs(prefix string) ([]data.GUN, error) {
+	var names []string
+	q := db.Model(&TUFFile{}).Where("gun LIKE ? ESCAPE '!'", likePrefix(prefix)).Order("gun").Pluck("DISTINCT gun", &names)
+	if q.Error != nil && !q.RecordNotFound() {
+		return nil, q.Error
+	}
+	guns := make([]data.GUN, 0, len(names))
+	for _, name := range names {
+		guns = append(guns, data.GUN(name))
+	}
+	return guns, nil
+}
+
+// likePrefix is a pattern for LIKE ... ESCAPE '!' which matches strings that
+// start with the prefix, escaping any wildcards in the prefix itself
+func likePrefix(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix) + "%"
+}
+
 // CheckHealth asserts that the tuf_files table is present
 func (db *SQLStorage) CheckHealth() error {
 	tableOk := db.HasTable(&TUFFile{})
@@ -21,6 +21,7 @@ func SetupSQLDB(t *testing.T, dbtype, dburl string) *SQLStorage {
 	// Create the DB tables
 	require.NoError(t, CreateTUFTable(dbStore.DB))
 	require.NoError(t, CreateChangefeedTable(dbStore.DB))
+	require.NoError(t, CreatePendingTUFTable(dbStore.DB))
 
 	// verify that the tables are empty
 	var count int
@@ -122,6 +123,18 @@ func TestSQLUpdateManyConflictRollback(t *testing.T) {
 	dbStore.DB.Close()
 }
 
+// TestSQLUpdateManyExpectedVersions asserts that updates are only inserted if
+// the current versions are the expected ones
+func TestSQLUpdateManyExpectedVersions(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	expected := testUpdateManyExpectedVersions(t, dbStore)
+	assertExpectedGormTUFMeta(t, expected, dbStore.DB)
+
+	dbStore.DB.Close()
+}
+
 // TestSQLDelete asserts that Delete will remove all TUF metadata, all versions,
 // associated with a gun
 func TestSQLDelete(t *testing.T) {
@@ -134,6 +147,27 @@ func TestSQLDelete(t *testing.T) {
 	dbStore.DB.Close()
 }
 
+// TestSQLPending asserts that pending metadata can be set, replaced and deleted
+// without being published
+func TestSQLPending(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testPending(t, dbStore)
+
+	dbStore.DB.Close()
+}
+
+// TestSQLListGUNs asserts that GUNs with metadata can be listed by prefix
+func TestSQLListGUNs(t *testing.T) {
+	dbStore, cleanup := sqldbSetup(t)
+	defer cleanup()
+
+	testListGUNs(t, dbStore)
+
+	dbStore.DB.Close()
+}
+
 // TestSQLDBCheckHealthTableMissing asserts that the health check fails if the table is missing
 func TestSQLDBCheckHealthTableMissing(t *testing.T) {
 	dbStore, cleanup := sqldbSetup(t)
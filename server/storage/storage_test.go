@@ -157,7 +157,7 @@ func testUpdateManyNoConflicts(t *testing.T, s MetaStore) []StoredTUFMeta {
 		updates[i] = MakeUpdate(firstBatch[i])
 	}
 
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 	assertExpectedTUFMetaInStore(t, s, firstBatch, true)
 
 	secondBatch := make([]StoredTUFMeta, 4)
@@ -167,7 +167,7 @@ func testUpdateManyNoConflicts(t *testing.T, s MetaStore) []StoredTUFMeta {
 		updates[i] = MakeUpdate(secondBatch[i])
 	}
 
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 	// the first batch is still there, but are no longer the current ones
 	assertExpectedTUFMetaInStore(t, s, firstBatch, false)
 	assertExpectedTUFMetaInStore(t, s, secondBatch, true)
@@ -182,7 +182,7 @@ func testUpdateManyNoConflicts(t *testing.T, s MetaStore) []StoredTUFMeta {
 		updates[i] = MakeUpdate(thirdBatch[i])
 	}
 
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 
 	// all the other data is still there, but are no longer the current ones
 	assertExpectedTUFMetaInStore(t, s, append(firstBatch, secondBatch...), false)
@@ -204,7 +204,7 @@ func testUpdateManyConflictRollback(t *testing.T, s MetaStore) []StoredTUFMeta {
 		updates[i] = MakeUpdate(successBatch[i])
 	}
 
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 
 	before, err := s.GetChanges("0", 1000, "")
 	require.NoError(t, err)
@@ -226,14 +226,14 @@ func testUpdateManyConflictRollback(t *testing.T, s MetaStore) []StoredTUFMeta {
 	require.NoError(t, err)
 	require.Equal(t, len(before), len(after))
 
-	err = s.UpdateMany(gun, updates)
+	err = s.UpdateMany(gun, updates, nil)
 	require.Error(t, err)
 	require.IsType(t, ErrOldVersion{}, err)
 
 	// self-conflicting, in that it's a duplicate, but otherwise no DB conflicts
 	duplicate := SampleCustomTUFObj(gun, data.CanonicalTimestampRole, 3, []byte("duplicate"))
 	duplicateUpdate := MakeUpdate(duplicate)
-	err = s.UpdateMany(gun, []MetaUpdate{duplicateUpdate, duplicateUpdate})
+	err = s.UpdateMany(gun, []MetaUpdate{duplicateUpdate, duplicateUpdate}, nil)
 	require.Error(t, err)
 	require.IsType(t, ErrOldVersion{}, err)
 
@@ -251,6 +251,46 @@ func testUpdateManyConflictRollback(t *testing.T, s MetaStore) []StoredTUFMeta {
 	return successBatch
 }
 
+// UpdateMany only inserts the updates if the current versions are the expected
+// ones, and otherwise returns the expected and current versions
+func testUpdateManyExpectedVersions(t *testing.T, s MetaStore) []StoredTUFMeta {
+	var gun data.GUN = "testGUN"
+	first := []StoredTUFMeta{
+		SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 1, nil),
+		SampleCustomTUFObj(gun, data.CanonicalSnapshotRole, 1, nil),
+	}
+	updates := []MetaUpdate{MakeUpdate(first[0]), MakeUpdate(first[1])}
+
+	err := s.UpdateMany(gun, updates, map[data.RoleName]int{data.CanonicalTargetsRole: 1})
+	require.Equal(t, ErrVersionConflict{
+		Expected: map[data.RoleName]int{data.CanonicalTargetsRole: 1},
+		Current:  map[data.RoleName]int{data.CanonicalTargetsRole: 0},
+	}, err)
+	require.NoError(t, s.UpdateMany(gun, updates, map[data.RoleName]int{data.CanonicalTargetsRole: 0}))
+
+	// an update based on version 1 of the targets, when another update based on
+	// it has been applied in the meantime, is rejected even if it only updates
+	// another role
+	second := SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 2, nil)
+	require.NoError(t, s.UpdateMany(gun, []MetaUpdate{MakeUpdate(second)},
+		map[data.RoleName]int{data.CanonicalTargetsRole: 1, data.CanonicalSnapshotRole: 1}))
+	stale := SampleCustomTUFObj(gun, data.CanonicalSnapshotRole, 2, nil)
+	err = s.UpdateMany(gun, []MetaUpdate{MakeUpdate(stale)},
+		map[data.RoleName]int{data.CanonicalTargetsRole: 1, data.CanonicalSnapshotRole: 1})
+	require.Equal(t, ErrVersionConflict{
+		Expected: map[data.RoleName]int{data.CanonicalTargetsRole: 1, data.CanonicalSnapshotRole: 1},
+		Current:  map[data.RoleName]int{data.CanonicalTargetsRole: 2, data.CanonicalSnapshotRole: 1},
+	}, err)
+
+	assertExpectedTUFMetaInStore(t, s, first[:1], false)
+	assertExpectedTUFMetaInStore(t, s, []StoredTUFMeta{second, first[1]}, true)
+	checksumBytes := sha256.Sum256(stale.Data)
+	_, _, err = s.GetChecksum(gun, stale.Role, hex.EncodeToString(checksumBytes[:]))
+	require.IsType(t, ErrNotFound{}, err)
+
+	return append(first, second)
+}
+
 // Delete will remove all TUF metadata, all versions, associated with a gun
 func testDeleteSuccess(t *testing.T, s MetaStore) {
 	var gun data.GUN = "testGUN"
@@ -267,7 +307,7 @@ func testDeleteSuccess(t *testing.T, s MetaStore) {
 			updates = append(updates, MakeUpdate(tufObj))
 		}
 	}
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 	assertExpectedTUFMetaInStore(t, s, unexpected[:5], false)
 	assertExpectedTUFMetaInStore(t, s, unexpected[5:], true)
 
@@ -286,7 +326,7 @@ func testDeleteSuccess(t *testing.T, s MetaStore) {
 	}
 
 	// We can now write the same files without conflicts to the DB
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 	assertExpectedTUFMetaInStore(t, s, unexpected[:5], false)
 	assertExpectedTUFMetaInStore(t, s, unexpected[5:], true)
 
@@ -294,6 +334,116 @@ func testDeleteSuccess(t *testing.T, s MetaStore) {
 	require.NoError(t, s.Delete(gun))
 }
 
+func testPending(t *testing.T, s MetaStore) {
+	var gun data.GUN = "testGUN"
+	pending, checksum, err := s.GetPending(gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+	require.Equal(t, "", checksum)
+	// deleting when there is nothing pending is a no-op success
+	require.NoError(t, s.DeletePending(gun))
+
+	root := MakeUpdate(SampleCustomTUFObj(gun, data.CanonicalRootRole, 2, nil))
+	targets := MakeUpdate(SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 1, nil))
+	// nothing is pending, so the pending metadata can't be replaced
+	require.IsType(t, ErrOldVersion{}, s.SetPending(gun, "not-the-checksum", []MetaUpdate{root}))
+	require.NoError(t, s.SetPending(gun, "", []MetaUpdate{root, targets}))
+	pending, checksum, err = s.GetPending(gun)
+	require.NoError(t, err)
+	require.Equal(t, []MetaUpdate{root, targets}, pending)
+	require.NotEqual(t, "", checksum)
+
+	// something is pending now, so it can't be set as if nothing were
+	require.IsType(t, ErrOldVersion{}, s.SetPending(gun, "", []MetaUpdate{targets}))
+
+	// pending metadata is not published
+	_, _, err = s.GetCurrent(gun, data.CanonicalRootRole)
+	require.IsType(t, ErrNotFound{}, err)
+	changes, err := s.GetChanges("0", 10, gun.String())
+	require.NoError(t, err)
+	require.Len(t, changes, 0)
+
+	// setting the pending metadata again replaces all of it
+	newTargets := MakeUpdate(SampleCustomTUFObj(gun, data.CanonicalTargetsRole, 2, nil))
+	require.NoError(t, s.SetPending(gun, checksum, []MetaUpdate{newTargets}))
+	pending, newChecksum, err := s.GetPending(gun)
+	require.NoError(t, err)
+	require.Equal(t, []MetaUpdate{newTargets}, pending)
+	require.NotEqual(t, checksum, newChecksum)
+
+	// but only if it has not been replaced since it was read
+	require.IsType(t, ErrOldVersion{}, s.SetPending(gun, checksum, []MetaUpdate{root}))
+	require.IsType(t, ErrOldVersion{}, s.SetPending(gun, checksum, nil))
+	pending, _, err = s.GetPending(gun)
+	require.NoError(t, err)
+	require.Equal(t, []MetaUpdate{newTargets}, pending)
+
+	// other GUNs are unaffected
+	pending, checksum, err = s.GetPending("otherGUN")
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+	require.Equal(t, "", checksum)
+
+	// setting no updates removes the pending metadata
+	require.NoError(t, s.SetPending(gun, newChecksum, nil))
+	pending, checksum, err = s.GetPending(gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+	require.Equal(t, "", checksum)
+
+	require.NoError(t, s.SetPending(gun, "", []MetaUpdate{root}))
+	require.NoError(t, s.DeletePending(gun))
+	pending, _, err = s.GetPending(gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+
+	// deleting the GUN deletes the pending metadata too
+	require.NoError(t, s.SetPending(gun, "", []MetaUpdate{root}))
+	require.NoError(t, s.Delete(gun))
+	pending, _, err = s.GetPending(gun)
+	require.NoError(t, err)
+	require.Len(t, pending, 0)
+}
+
+func testListGUNs(t *testing.T, s MetaStore) {
+	guns, err := s.ListGUNs("")
+	require.NoError(t, err)
+	require.Len(t, guns, 0)
+
+	for _, gun := range []data.GUN{"docker.io/library/b", "docker.io/library/a", "docker.io/other", "quay.io/library_a"} {
+		for _, role := range []data.RoleName{data.CanonicalRootRole, data.CanonicalTargetsRole} {
+			require.NoError(t, s.UpdateCurrent(gun, MakeUpdate(SampleCustomTUFObj(gun, role, 1, nil))))
+		}
+	}
+	// pending metadata is not enough to list a GUN
+	pendingGUN := data.GUN("docker.io/library/pending")
+	require.NoError(t, s.SetPending(pendingGUN, "", []MetaUpdate{MakeUpdate(SampleCustomTUFObj(pendingGUN, data.CanonicalRootRole, 1, nil))}))
+
+	guns, err = s.ListGUNs("")
+	require.NoError(t, err)
+	require.Equal(t, []data.GUN{"docker.io/library/a", "docker.io/library/b", "docker.io/other", "quay.io/library_a"}, guns)
+
+	guns, err = s.ListGUNs("docker.io/library/")
+	require.NoError(t, err)
+	require.Equal(t, []data.GUN{"docker.io/library/a", "docker.io/library/b"}, guns)
+
+	// wildcards in the prefix are matched literally
+	guns, err = s.ListGUNs("quay.io/library_")
+	require.NoError(t, err)
+	require.Equal(t, []data.GUN{"quay.io/library_a"}, guns)
+	for _, prefix := range []string{"docker.io/library_", "docker.io/%", "nothing"} {
+		guns, err = s.ListGUNs(prefix)
+		require.NoError(t, err)
+		require.Len(t, guns, 0, prefix)
+	}
+
+	// deleted GUNs are no longer listed
+	require.NoError(t, s.Delete("docker.io/library/a"))
+	guns, err = s.ListGUNs("docker.io/library/")
+	require.NoError(t, err)
+	require.Equal(t, []data.GUN{"docker.io/library/b"}, guns)
+}
+
 func testGetChanges(t *testing.T, s MetaStore) {
 	blackoutTime = 0
 	// non-int changeID
@@ -308,56 +458,56 @@ func testGetChanges(t *testing.T, s MetaStore) {
 			Version: 1,
 			Data:    []byte{'1'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("alpine", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 2,
 			Data:    []byte{'2'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("alpine", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 3,
 			Data:    []byte{'3'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("alpine", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 4,
 			Data:    []byte{'4'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("busybox", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 1,
 			Data:    []byte{'5'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("busybox", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 2,
 			Data:    []byte{'6'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("busybox", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 3,
 			Data:    []byte{'7'},
 		},
-	}))
+	}, nil))
 	require.NoError(t, s.UpdateMany("busybox", []MetaUpdate{
 		{
 			Role:    data.CanonicalTimestampRole,
 			Version: 4,
 			Data:    []byte{'8'},
 		},
-	}))
+	}, nil))
 
 	// check non-error cases
 	c, err = s.GetChanges("0", 8, "")
@@ -424,7 +574,7 @@ func testGetChanges(t *testing.T, s MetaStore) {
 			Version: 1,
 			Data:    []byte{'1'},
 		},
-	}))
+	}, nil))
 	after, err := s.GetChanges("-1", -1, "")
 	require.NoError(t, err)
 	require.Equal(t, before, after)
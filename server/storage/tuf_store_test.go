@@ -55,7 +55,7 @@ func testTUFMetaStoreGetCurrent(t *testing.T, s MetaStore) {
 	for _, tufObj := range tufMetaByRole {
 		updates = append(updates, MakeUpdate(tufObj))
 	}
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 
 	// GetCurrent on all of these roles should succeed
 	for _, tufobj := range tufMetaByRole {
@@ -71,7 +71,7 @@ func testTUFMetaStoreGetCurrent(t *testing.T, s MetaStore) {
 			updates = append(updates, MakeUpdate(tufObj))
 		}
 	}
-	require.NoError(t, s.UpdateMany(gun, updates))
+	require.NoError(t, s.UpdateMany(gun, updates, nil))
 	_, _, err = s.GetCurrent(gun, data.CanonicalSnapshotRole)
 	require.IsType(t, ErrNotFound{}, err)
 
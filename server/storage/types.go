@@ -1,6 +1,12 @@
 package storage
 
-import "github.com/theupdateframework/notary/tuf/data"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/theupdateframework/notary/tuf/data"
+)
 
 // MetaUpdate packages up the fields required to update a TUF record
 type MetaUpdate struct {
@@ -8,3 +14,36 @@ type MetaUpdate struct {
 	Version int
 	Data    []byte
 }
+
+// encodePending serializes the pending metadata for a GUN, which is stored
+// as a single record so that it can be replaced atomically, and returns the
+// checksum that SetPending compares against
+func encodePending(updates []MetaUpdate) ([]byte, string, error) {
+	raw, err := json.Marshal(updates)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, pendingChecksum(raw), nil
+}
+
+// decodePending deserializes the pending metadata stored by encodePending
+func decodePending(raw []byte) ([]MetaUpdate, error) {
+	updates := []MetaUpdate{}
+	if len(raw) == 0 {
+		return updates, nil
+	}
+	if err := json.Unmarshal(raw, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// pendingChecksum is the checksum of stored pending metadata, which is empty
+// if there is none
+func pendingChecksum(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	checksum := sha256.Sum256(raw)
+	return hex.EncodeToString(checksum[:])
+}
@@ -126,7 +126,7 @@ func GetOrCreateTimestamp(gun data.GUN, store storage.MetaStore, cryptoService s
 	c := time.Now()
 
 	// Write the timestamp, and potentially snapshot
-	if err = store.UpdateMany(gun, updates); err != nil {
+	if err = store.UpdateMany(gun, updates, nil); err != nil {
 		return nil, nil, err
 	}
 	return &c, tsUpdate.Data, nil
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/theupdateframework/notary"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+// catalogResource names the catalog in errors about downloading it
+const catalogResource = "catalog"
+
+// ListGUNs lists the GUNs that start with the given prefix, from the catalog
+// of the notary server at baseURL.  Servers that authenticate clients only
+// allow admins to list the catalog.
+func ListGUNs(ctx context.Context, baseURL string, roundTrip http.RoundTripper, prefix string) ([]data.GUN, error) {
+	catalogURL := strings.TrimRight(baseURL, "/") + "/v2/_trust/catalog?" + url.Values{"prefix": {prefix}}.Encode()
+	req, err := http.NewRequest("GET", catalogURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := roundTrip.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if err := translateStatusToError(resp, catalogResource); err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, notary.MaxDownloadSize))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	var catalog struct {
+		GUNs []data.GUN `json:"guns"`
+	}
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog.GUNs, nil
+}
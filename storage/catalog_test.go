@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
+)
+
+func TestListGUNs(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v2/_trust/catalog", r.URL.Path)
+		switch r.URL.Query().Get("prefix") {
+		case "docker.io/":
+			fmt.Fprint(w, `{"count":2,"guns":["docker.io/a","docker.io/b"]}`)
+		case "gcr.io/":
+			fmt.Fprint(w, `{"count":0,"guns":[]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	guns, err := ListGUNs(context.Background(), server.URL+"/", &TestRoundTripper{}, "docker.io/")
+	require.NoError(t, err)
+	require.Equal(t, []data.GUN{"docker.io/a", "docker.io/b"}, guns)
+
+	guns, err = ListGUNs(context.Background(), server.URL, &TestRoundTripper{}, "gcr.io/")
+	require.NoError(t, err)
+	require.Len(t, guns, 0)
+
+	// as from a server without a catalog
+	_, err = ListGUNs(context.Background(), server.URL, &TestRoundTripper{}, "")
+	require.Equal(t, ErrMetaNotFound{Resource: catalogResource}, err)
+
+	_, err = ListGUNs(context.Background(), server.URL, failRoundTripper{}, "")
+	require.IsType(t, NetworkError{}, err)
+}
+
+func TestListGUNsUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := ListGUNs(context.Background(), server.URL, &TestRoundTripper{}, "")
+	require.IsType(t, ErrServerUnavailable{}, err)
+	require.Contains(t, err.Error(), "not authorized")
+}
@@ -20,3 +20,13 @@ type ErrMetaNotFound struct {
 func (err ErrMetaNotFound) Error() string {
 	return fmt.Sprintf("%s trust data unavailable.  Has a notary repository been initialized?", err.Resource)
 }
+
+// ErrNotSupported indicates that a store, or the server behind it, does not
+// support a feature
+type ErrNotSupported struct {
+	Feature string
+}
+
+func (err ErrNotSupported) Error() string {
+	return fmt.Sprintf("the server or store does not support %s", err.Feature)
+}
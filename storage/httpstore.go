@@ -21,11 +21,15 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/validation"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -84,7 +88,14 @@ func (err ErrMaliciousServer) Error() string {
 // ErrInvalidOperation indicates that the server returned a 400 response and
 // propagate any body we received.
 type ErrInvalidOperation struct {
-	msg string
+	msg  string
+	code string
+}
+
+// OldVersion is whether the server rejected the operation because the
+// metadata is not newer than the version that has been published
+func (err ErrInvalidOperation) OldVersion() bool {
+	return err.code == errCodeOldVersion
 }
 
 func (err ErrInvalidOperation) Error() string {
@@ -94,6 +105,43 @@ func (err ErrInvalidOperation) Error() string {
 	return "trust server rejected operation."
 }
 
+// ErrVersionConflict indicates that the server rejected an update because a
+// newer version of the metadata has been published since the update was made
+type ErrVersionConflict struct {
+	// Expected and Current are the versions of the metadata that the update
+	// was based on and the versions on the server, when the server rejected
+	// the update because they differ.  A version of 0 means that the role has
+	// not been published.
+	Expected map[data.RoleName]int `json:"expected"`
+	Current  map[data.RoleName]int `json:"current"`
+}
+
+func (err ErrVersionConflict) Error() string {
+	msg := "trust server rejected operation: a newer version of the metadata is already available"
+	var changed []string
+	for _, role := range sortedRoles(err.Current) {
+		if expected, ok := err.Expected[role]; ok && expected != err.Current[role] {
+			changed = append(changed, fmt.Sprintf("%s is at version %d, not %d", role, err.Current[role], expected))
+		}
+	}
+	if len(changed) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(changed, ", "))
+}
+
+const (
+	// errCodeOldVersion is the error code the server responds with when an
+	// update conflicts with a newer version of the metadata
+	errCodeOldVersion = "VERSION"
+	// errCodeVersionConflict is the error code the server responds with when
+	// an update is not based on the current versions of the metadata
+	errCodeVersionConflict = "VERSION_CONFLICT"
+	// maxVersionConflictSize is the maximum size for a version conflict
+	// error, which lists the versions of the roles - 64KiB
+	maxVersionConflictSize int64 = 64 << 10
+)
+
 // HTTPStore manages pulling and pushing metadata from and to a remote
 // service over HTTP. It assumes the URL structure of the remote service
 // maps identically to the structure of the TUF repo:
@@ -135,14 +183,19 @@ func NewHTTPStore(baseURL, metaPrefix, metaExtension, keyExtension string, round
 }
 
 func tryUnmarshalError(resp *http.Response, defaultError error) error {
-	b := io.LimitReader(resp.Body, MaxErrorResponseSize)
+	return tryUnmarshalSizedError(resp, MaxErrorResponseSize, defaultError)
+}
+
+func tryUnmarshalSizedError(resp *http.Response, size int64, defaultError error) error {
+	b := io.LimitReader(resp.Body, size)
 	bodyBytes, err := ioutil.ReadAll(b)
 	if err != nil {
 		return defaultError
 	}
 	var parsedErrors struct {
 		Errors []struct {
-			Detail validation.SerializableError `json:"detail"`
+			Code   string          `json:"code"`
+			Detail json.RawMessage `json:"detail"`
 		} `json:"errors"`
 	}
 	if err := json.Unmarshal(bodyBytes, &parsedErrors); err != nil {
@@ -151,11 +204,24 @@ func tryUnmarshalError(resp *http.Response, defaultError error) error {
 	if len(parsedErrors.Errors) != 1 {
 		return defaultError
 	}
-	err = parsedErrors.Errors[0].Detail.Error
-	if err == nil {
+	switch parsedErrors.Errors[0].Code {
+	case errCodeOldVersion:
+		if _, ok := defaultError.(ErrInvalidOperation); ok {
+			return ErrInvalidOperation{code: errCodeOldVersion}
+		}
 		return defaultError
+	case errCodeVersionConflict:
+		conflict := ErrVersionConflict{}
+		if err := json.Unmarshal(parsedErrors.Errors[0].Detail, &conflict); err != nil {
+			return ErrVersionConflict{}
+		}
+		return conflict
 	}
-	return err
+	var detail validation.SerializableError
+	if err := json.Unmarshal(parsedErrors.Errors[0].Detail, &detail); err != nil || detail.Error == nil {
+		return defaultError
+	}
+	return detail.Error
 }
 
 func translateStatusToError(resp *http.Response, resource string) error {
@@ -166,6 +232,8 @@ func translateStatusToError(resp *http.Response, resource string) error {
 		return ErrMetaNotFound{Resource: resource}
 	case http.StatusBadRequest:
 		return tryUnmarshalError(resp, ErrInvalidOperation{})
+	case http.StatusConflict:
+		return tryUnmarshalSizedError(resp, maxVersionConflictSize, ErrVersionConflict{})
 	default:
 		return ErrServerUnavailable{code: resp.StatusCode}
 	}
@@ -177,6 +245,12 @@ func translateStatusToError(resp *http.Response, resource string) error {
 // If size is "NoSizeLimit", this corresponds to "infinite," but we cut off at a
 // predefined threshold "notary.MaxDownloadSize".
 func (s HTTPStore) GetSized(name string, size int64) ([]byte, error) {
+	return s.GetSizedContext(context.Background(), name, size)
+}
+
+// GetSizedContext is GetSized with a context for the request, which returns
+// the context's error if the context is done before the download completes.
+func (s HTTPStore) GetSizedContext(ctx context.Context, name string, size int64) ([]byte, error) {
 	url, err := s.buildMetaURL(name)
 	if err != nil {
 		return nil, err
@@ -185,8 +259,11 @@ func (s HTTPStore) GetSized(name string, size int64) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	resp, err := s.roundTrip.RoundTrip(req)
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
@@ -204,11 +281,64 @@ func (s HTTPStore) GetSized(name string, size int64) ([]byte, error) {
 	b := io.LimitReader(resp.Body, size)
 	body, err := ioutil.ReadAll(b)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
 	return body, nil
 }
 
+// GetVersion downloads the given version of a role's metadata, which the
+// server keeps for every version that was published.  The time it was
+// published is taken from the Last-Modified header.
+func (s HTTPStore) GetVersion(ctx context.Context, role data.RoleName, version int) (time.Time, []byte, error) {
+	name := fmt.Sprintf("%d.%s", version, role)
+	url, err := s.buildMetaURL(name)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	req, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return time.Time{}, nil, ctxErr
+		}
+		return time.Time{}, nil, NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if err := translateStatusToError(resp, name); err != nil {
+		return time.Time{}, nil, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, notary.MaxDownloadSize))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return time.Time{}, nil, ctxErr
+		}
+		return time.Time{}, nil, err
+	}
+	return parseLastModified(resp.Header.Get("Last-Modified")), body, nil
+}
+
+// parseLastModified parses a Last-Modified header in the format set by the
+// notary server, or any of the formats allowed by HTTP.  The server sets a
+// zero time if it does not know, as it does for an unparseable header.
+func parseLastModified(header string) time.Time {
+	modified, err := time.Parse(time.RFC1123, header)
+	if err != nil {
+		if modified, err = http.ParseTime(header); err != nil {
+			return time.Time{}
+		}
+	}
+	if modified.Before(time.Unix(0, 0)) {
+		return time.Time{}
+	}
+	return modified
+}
+
 // Set sends a single piece of metadata to the TUF server
 func (s HTTPStore) Set(name string, blob []byte) error {
 	return s.SetMulti(map[string][]byte{name: blob})
@@ -251,6 +381,20 @@ func NewMultiPartMetaRequest(url string, metas map[string][]byte) (*http.Request
 // This should be preferred for updating a remote server as it enable the server
 // to remain consistent, either accepting or rejecting the complete update.
 func (s HTTPStore) SetMulti(metas map[string][]byte) error {
+	return s.SetMultiContext(context.Background(), metas)
+}
+
+// SetMultiContext is SetMulti with a context for the request, which returns
+// the context's error if the context is done before the upload completes.  The
+// server may still have accepted the update in that case.
+func (s HTTPStore) SetMultiContext(ctx context.Context, metas map[string][]byte) error {
+	return s.SetMultiExpecting(ctx, metas, nil)
+}
+
+// SetMultiExpecting is SetMultiContext for an update based on the given
+// versions of the metadata, which the server rejects with an
+// ErrVersionConflict if any of the roles is no longer at the expected version.
+func (s HTTPStore) SetMultiExpecting(ctx context.Context, metas map[string][]byte, expected map[data.RoleName]int) error {
 	url, err := s.buildMetaURL("")
 	if err != nil {
 		return err
@@ -259,8 +403,14 @@ func (s HTTPStore) SetMulti(metas map[string][]byte) error {
 	if err != nil {
 		return err
 	}
-	resp, err := s.roundTrip.RoundTrip(req)
+	if len(expected) > 0 {
+		req.Header.Set(notary.ExpectedVersionsHeader, formatExpectedVersions(expected))
+	}
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		return NetworkError{Wrapped: err}
 	}
 	defer resp.Body.Close()
@@ -286,6 +436,101 @@ func (s HTTPStore) RemoveAll() error {
 	return translateStatusToError(resp, "DELETE metadata for GUN endpoint")
 }
 
+// SetPending uploads metadata that may not yet be signed by enough keys to be
+// published to the server's pending metadata, where it is merged with any
+// signatures that have already been uploaded.  It returns true if, as a result,
+// the server has published all the pending metadata.
+func (s HTTPStore) SetPending(ctx context.Context, metas map[string][]byte) (bool, error) {
+	url, err := s.buildPendingURL()
+	if err != nil {
+		return false, err
+	}
+	req, err := NewMultiPartMetaRequest(url.String(), metas)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+		return false, NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		return false, nil
+	}
+	if err := translateStatusToError(resp, "POST pending metadata endpoint"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetPending downloads the server's pending metadata for the GUN
+func (s HTTPStore) GetPending(ctx context.Context) ([]byte, error) {
+	url, err := s.buildPendingURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	if err := translateStatusToError(resp, "pending metadata"); err != nil {
+		return nil, err
+	}
+	b := io.LimitReader(resp.Body, notary.MaxDownloadSize)
+	return ioutil.ReadAll(b)
+}
+
+// RemovePending discards the server's pending metadata for the GUN
+func (s HTTPStore) RemovePending(ctx context.Context) error {
+	url, err := s.buildPendingURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", url.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.roundTrip.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return NetworkError{Wrapped: err}
+	}
+	defer resp.Body.Close()
+	return translateStatusToError(resp, "DELETE pending metadata endpoint")
+}
+
+// formatExpectedVersions formats expected versions as comma separated
+// role=version pairs
+func formatExpectedVersions(expected map[data.RoleName]int) string {
+	pairs := make([]string, 0, len(expected))
+	for _, role := range sortedRoles(expected) {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", role, expected[role]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedRoles(versions map[data.RoleName]int) []data.RoleName {
+	roles := make([]data.RoleName, 0, len(versions))
+	for role := range versions {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
 func (s HTTPStore) buildMetaURL(name string) (*url.URL, error) {
 	var filename string
 	if name != "" {
@@ -295,6 +540,10 @@ func (s HTTPStore) buildMetaURL(name string) (*url.URL, error) {
 	return s.buildURL(uri)
 }
 
+func (s HTTPStore) buildPendingURL() (*url.URL, error) {
+	return s.buildURL(path.Join(s.metaPrefix, "pending"))
+}
+
 func (s HTTPStore) buildKeyURL(name data.RoleName) (*url.URL, error) {
 	filename := fmt.Sprintf("%s.%s", name.String(), s.keyExtension)
 	uri := path.Join(s.metaPrefix, filename)
@@ -11,11 +11,14 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/go/canonical/json"
 	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/notary"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/validation"
+	"golang.org/x/net/context"
 )
 
 const testRoot = `{"signed":{"_type":"Root","consistent_snapshot":false,"expires":"2025-07-17T16:19:21.101698314-07:00","keys":{"1ca15c7f4b2b0c6efce202a545e7267152da28ab7c91590b3b60bdb4da723aad":{"keytype":"ecdsa","keyval":{"private":null,"public":"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEb0720c99Cj6ZmuDlznEZ52NA6YpeY9Sj45z51XvPnG63Bi2RSBezMJlPzbSfP39mXKXqOJyT+z9BZhi3FVWczg=="}},"b1d6813b55442ecbfb1f4b40eb1fcdb4290e53434cfc9ba2da24c26c9143873b":{"keytype":"ecdsa-x509","keyval":{"private":null,"public":"LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUJVekNCKzZBREFnRUNBaEFCWDNKLzkzaW8zbHcrZUsvNFhvSHhNQW9HQ0NxR1NNNDlCQU1DTUJFeER6QU4KQmdOVkJBTVRCbVY0Y0dseVpUQWVGdzB4TlRBM01qQXlNekU1TVRkYUZ3MHlOVEEzTVRjeU16RTVNVGRhTUJFeApEekFOQmdOVkJBTVRCbVY0Y0dseVpUQlpNQk1HQnlxR1NNNDlBZ0VHQ0NxR1NNNDlBd0VIQTBJQUJFTDhOTFhQCitreUJZYzhYY0FTMXB2S2l5MXRQUDlCZHJ1dEdrWlR3Z0dEYTM1THMzSUFXaWlrUmlPbGRuWmxVVEE5cG5JekoKOFlRQThhTjQ1TDQvUlplak5UQXpNQTRHQTFVZER3RUIvd1FFQXdJQW9EQVRCZ05WSFNVRUREQUtCZ2dyQmdFRgpCUWNEQXpBTUJnTlZIUk1CQWY4RUFqQUFNQW9HQ0NxR1NNNDlCQU1DQTBjQU1FUUNJRVJ1ZUVURG5xMlRqRFBmClhGRStqUFJqMEtqdXdEOG9HSmtoVGpMUDAycjhBaUI5cUNyL2ZqSXpJZ1NQcTJVSXZqR0hlYmZOYXh1QlpZZUUKYW8xNjd6dHNYZz09Ci0tLS0tRU5EIENFUlRJRklDQVRFLS0tLS0K"}},"fbddae7f25a6c23ca735b017206a849d4c89304a4d8de4dcc4b3d6f3eb22ce3b":{"keytype":"ecdsa","keyval":{"private":null,"public":"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE/xS5fBHK2HKmlGcvAr06vwPITvmxWP4P3CMDCgY25iSaIiM21OiXA1/Uvo3Pa3xh5G3cwCtDvi+4FpflW2iB/w=="}},"fd75751f010c3442e23b3e3e99a1442a112f2f21038603cb8609d8b17c9e912a":{"keytype":"ed25519","keyval":{"private":null,"public":"rc+glN01m+q8jmX8SolGsjTfk6NMhUQTWyj10hjmne0="}}},"roles":{"root":{"keyids":["b1d6813b55442ecbfb1f4b40eb1fcdb4290e53434cfc9ba2da24c26c9143873b"],"threshold":1},"snapshot":{"keyids":["1ca15c7f4b2b0c6efce202a545e7267152da28ab7c91590b3b60bdb4da723aad"],"threshold":1},"targets":{"keyids":["fbddae7f25a6c23ca735b017206a849d4c89304a4d8de4dcc4b3d6f3eb22ce3b"],"threshold":1},"timestamp":{"keyids":["fd75751f010c3442e23b3e3e99a1442a112f2f21038603cb8609d8b17c9e912a"],"threshold":1}},"version":2},"signatures":[{"keyid":"b1d6813b55442ecbfb1f4b40eb1fcdb4290e53434cfc9ba2da24c26c9143873b","method":"ecdsa","sig":"A2lNVwxHBnD9ViFtRre8r5oG6VvcvJnC6gdvvxv/Jyag40q/fNMjllCqyHrb+6z8XDZcrTTDsFU1R3/e+92d1A=="}]}`
@@ -69,6 +72,51 @@ func TestHTTPStoreGetSized(t *testing.T) {
 	require.Equal(t, "FAIL", err.Error())
 }
 
+// A cancelled or expired context aborts requests with the context's error,
+// rather than a NetworkError
+func TestHTTPStoreContextCancellation(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+	httpStore, ok := store.(*HTTPStore)
+	require.True(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = httpStore.GetSizedContext(ctx, "root", 4801)
+	require.Equal(t, context.Canceled, err)
+	err = httpStore.SetMultiContext(ctx, map[string][]byte{"targets": []byte("{}")})
+	require.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = GetSizedContext(ctx, store, "root", 4801)
+	require.Equal(t, context.DeadlineExceeded, err)
+	err = SetMultiContext(ctx, store, map[string][]byte{"targets": []byte("{}")})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+// Stores that are not context aware still honor a context that is already done
+func TestContextHelpersWithPlainStore(t *testing.T) {
+	store := NewMemoryStore(map[data.RoleName][]byte{"root": []byte(testRoot)})
+
+	meta, err := GetSizedContext(context.Background(), store, "root", NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, testRoot, string(meta))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = GetSizedContext(ctx, store, "root", NoSizeLimit)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, context.Canceled, SetMultiContext(ctx, store, map[string][]byte{"targets": []byte("{}")}))
+	_, err = store.GetSized("targets", NoSizeLimit)
+	require.IsType(t, ErrMetaNotFound{}, err)
+}
+
 // Test that passing -1 to httpstore's GetSized will return all content
 func TestHTTPStoreGetAllMeta(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -240,6 +288,78 @@ func TestTranslateErrorsWhenCannotParse400(t *testing.T) {
 	}
 }
 
+// The server's old version error is translated into an ErrInvalidOperation
+// that says so, whatever its detail
+func TestTranslateOldVersionError(t *testing.T) {
+	for _, body := range []string{
+		`{"errors": [{"code": "VERSION", "message": "A newer version of metadata is already available.", "detail": {}}]}`,
+		`{"errors": [{"code": "VERSION"}]}`,
+	} {
+		errorResp := http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(body))),
+		}
+		err := translateStatusToError(&errorResp, "")
+		require.IsType(t, ErrInvalidOperation{}, err)
+		require.True(t, err.(ErrInvalidOperation).OldVersion())
+	}
+	require.False(t, ErrInvalidOperation{}.OldVersion())
+}
+
+// Expected versions are sent in a header, and a version conflict is
+// translated into an ErrVersionConflict with the versions the server sent
+func TestHTTPStoreSetMultiExpecting(t *testing.T) {
+	var header string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(notary.ExpectedVersionsHeader)
+		if header == "root=1,targets=3" {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"errors": [{"code": "VERSION_CONFLICT", "message": "The metadata the update is based on has changed.",
+				"detail": {"expected": {"root": 1, "targets": 3}, "current": {"root": 1, "targets": 4}}}]}`))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+	metas := map[string][]byte{data.CanonicalTargetsRole.String(): []byte("targets data")}
+
+	require.NoError(t, SetMultiExpecting(context.Background(), store, metas,
+		map[data.RoleName]int{data.CanonicalTargetsRole: 4, data.CanonicalRootRole: 1}))
+	require.Equal(t, "root=1,targets=4", header)
+
+	require.NoError(t, store.SetMulti(metas))
+	require.Equal(t, "", header)
+
+	err = SetMultiExpecting(context.Background(), store, metas,
+		map[data.RoleName]int{data.CanonicalTargetsRole: 3, data.CanonicalRootRole: 1})
+	require.Equal(t, ErrVersionConflict{
+		Expected: map[data.RoleName]int{data.CanonicalRootRole: 1, data.CanonicalTargetsRole: 3},
+		Current:  map[data.RoleName]int{data.CanonicalRootRole: 1, data.CanonicalTargetsRole: 4},
+	}, err)
+	require.Contains(t, err.Error(), "(targets is at version 4, not 3)")
+
+	// stores that can't check the versions just set the metadata
+	memStore := NewMemoryStore(nil)
+	require.NoError(t, SetMultiExpecting(context.Background(), memStore, metas,
+		map[data.RoleName]int{data.CanonicalTargetsRole: 3}))
+	stored, err := memStore.GetSized(data.CanonicalTargetsRole.String(), NoSizeLimit)
+	require.NoError(t, err)
+	require.Equal(t, metas[data.CanonicalTargetsRole.String()], stored)
+}
+
+// A conflict is still an ErrVersionConflict if its body cannot be parsed
+func TestTranslateUnparseableVersionConflict(t *testing.T) {
+	for _, body := range []string{"", "{", `{"errors": [{"code": "VERSION_CONFLICT", "detail": "versions"}]}`} {
+		errorResp := http.Response{
+			StatusCode: http.StatusConflict,
+			Body:       ioutil.NopCloser(bytes.NewBuffer([]byte(body))),
+		}
+		err := translateStatusToError(&errorResp, "")
+		require.Equal(t, ErrVersionConflict{}, err)
+	}
+}
+
 // Cut off error reading after a certain size
 func TestTranslateErrorsLimitsErrorSize(t *testing.T) {
 	// if the error message itself is the max error size, then extra JSON surrounding it will put it over
@@ -319,6 +439,108 @@ func TestHTTPStoreRotateKey(t *testing.T) {
 	require.Equal(t, "FAIL", err.Error())
 }
 
+func TestHTTPStorePending(t *testing.T) {
+	status := http.StatusAccepted
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/metadata/pending", r.URL.Path)
+		switch r.Method {
+		case "POST":
+			reader, err := r.MultipartReader()
+			require.NoError(t, err)
+			part, err := reader.NextPart()
+			require.NoError(t, err)
+			require.Equal(t, "targets", part.FileName())
+			w.WriteHeader(status)
+		case "GET":
+			w.Write([]byte("[]"))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	published, err := SetPending(ctx, store, map[string][]byte{"targets": []byte("{}")})
+	require.NoError(t, err)
+	require.False(t, published)
+
+	status = http.StatusOK
+	published, err = SetPending(ctx, store, map[string][]byte{"targets": []byte("{}")})
+	require.NoError(t, err)
+	require.True(t, published)
+
+	status = http.StatusBadRequest
+	_, err = SetPending(ctx, store, map[string][]byte{"targets": []byte("{}")})
+	require.IsType(t, ErrInvalidOperation{}, err)
+
+	pending, err := GetPending(ctx, store)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[]"), pending)
+
+	require.NoError(t, RemovePending(ctx, store))
+
+	// if there is a network error, it gets translated to NetworkError
+	store, err = NewHTTPStore(server.URL, "metadata", "json", "key", failRoundTripper{})
+	require.NoError(t, err)
+	_, err = SetPending(ctx, store, map[string][]byte{"targets": []byte("{}")})
+	require.IsType(t, NetworkError{}, err)
+	_, err = GetPending(ctx, store)
+	require.IsType(t, NetworkError{}, err)
+	require.IsType(t, NetworkError{}, RemovePending(ctx, store))
+
+	// a store that cannot hold pending metadata says so
+	memStore := NewMemoryStore(nil)
+	_, err = SetPending(ctx, memStore, map[string][]byte{"targets": []byte("{}")})
+	require.IsType(t, ErrNotSupported{}, err)
+	_, err = GetPending(ctx, memStore)
+	require.IsType(t, ErrNotSupported{}, err)
+	require.IsType(t, ErrNotSupported{}, RemovePending(ctx, memStore))
+}
+
+func TestHTTPStoreGetVersion(t *testing.T) {
+	published := time.Date(2018, time.March, 1, 12, 30, 0, 0, time.UTC)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/3.targets/releases.json":
+			w.Header().Set("Last-Modified", published.Format(time.RFC1123))
+			w.Write([]byte("{}"))
+		case "/metadata/2.targets.json":
+			w.Header().Set("Last-Modified", time.Time{}.Format(time.RFC1123))
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "key", http.DefaultTransport)
+	require.NoError(t, err)
+
+	modified, meta, err := GetVersion(context.Background(), store, "targets/releases", 3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("{}"), meta)
+	require.True(t, published.Equal(modified))
+
+	// a zero Last-Modified time means that the server does not know
+	modified, _, err = GetVersion(context.Background(), store, data.CanonicalTargetsRole, 2)
+	require.NoError(t, err)
+	require.True(t, modified.IsZero())
+
+	_, _, err = GetVersion(context.Background(), store, data.CanonicalTargetsRole, 1)
+	require.IsType(t, ErrMetaNotFound{}, err)
+
+	// if there is a network error, it gets translated to NetworkError
+	store, err = NewHTTPStore(server.URL, "metadata", "json", "key", failRoundTripper{})
+	require.NoError(t, err)
+	_, _, err = GetVersion(context.Background(), store, data.CanonicalTargetsRole, 2)
+	require.IsType(t, NetworkError{}, err)
+
+	// a store that does not keep earlier versions says so
+	_, _, err = GetVersion(context.Background(), NewMemoryStore(nil), data.CanonicalTargetsRole, 2)
+	require.IsType(t, ErrNotSupported{}, err)
+}
+
 func TestHTTPStoreGetKey(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		require.Equal(t, "GET", r.Method)
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
 )
 
 // NoSizeLimit is represented as -1 for arguments to GetMeta
@@ -17,12 +20,117 @@ type MetadataStore interface {
 	Remove(name string) error
 }
 
+// ContextMetadataStore is implemented by a MetadataStore that can make its
+// requests with a context, so that they can be cancelled or given a deadline.
+// If the context is done before a request completes, the context's error is
+// returned.
+type ContextMetadataStore interface {
+	GetSizedContext(ctx context.Context, name string, size int64) ([]byte, error)
+	SetMultiContext(ctx context.Context, metas map[string][]byte) error
+}
+
+// GetSizedContext gets the named metadata from the store with the context, if
+// the store supports contexts.  Otherwise the context is only checked before
+// the metadata is requested.
+func GetSizedContext(ctx context.Context, s MetadataStore, name string, size int64) ([]byte, error) {
+	if cs, ok := s.(ContextMetadataStore); ok {
+		return cs.GetSizedContext(ctx, name, size)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.GetSized(name, size)
+}
+
+// SetMultiContext sets the metadata in the store with the context, if the
+// store supports contexts.  Otherwise the context is only checked before the
+// metadata is set.
+func SetMultiContext(ctx context.Context, s MetadataStore, metas map[string][]byte) error {
+	if cs, ok := s.(ContextMetadataStore); ok {
+		return cs.SetMultiContext(ctx, metas)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.SetMulti(metas)
+}
+
+// VersionedMetadataStore is implemented by a MetadataStore that can reject an
+// update with an ErrVersionConflict if the metadata that it was based on has
+// changed since.  expected maps each role the update was based on to its
+// version, or to 0 if the role had not been published.
+type VersionedMetadataStore interface {
+	SetMultiExpecting(ctx context.Context, metas map[string][]byte, expected map[data.RoleName]int) error
+}
+
+// SetMultiExpecting sets the metadata in the store if the roles are still at
+// the expected versions, if the store supports checking them.  Otherwise the
+// metadata is set as by SetMultiContext.
+func SetMultiExpecting(ctx context.Context, s MetadataStore, metas map[string][]byte, expected map[data.RoleName]int) error {
+	if vs, ok := s.(VersionedMetadataStore); ok {
+		return vs.SetMultiExpecting(ctx, metas, expected)
+	}
+	return SetMultiContext(ctx, s, metas)
+}
+
 // PublicKeyStore must be implemented by a key service
 type PublicKeyStore interface {
 	GetKey(role data.RoleName) ([]byte, error)
 	RotateKey(role data.RoleName) ([]byte, error)
 }
 
+// PendingMetadataStore is implemented by a MetadataStore that can hold
+// metadata until it has been signed by enough keys to be published
+type PendingMetadataStore interface {
+	SetPending(ctx context.Context, metas map[string][]byte) (published bool, err error)
+	GetPending(ctx context.Context) ([]byte, error)
+	RemovePending(ctx context.Context) error
+}
+
+// SetPending uploads metadata to the store's pending metadata, if the store
+// can hold pending metadata.  Otherwise an ErrNotSupported is returned.
+func SetPending(ctx context.Context, s MetadataStore, metas map[string][]byte) (bool, error) {
+	if ps, ok := s.(PendingMetadataStore); ok {
+		return ps.SetPending(ctx, metas)
+	}
+	return false, ErrNotSupported{Feature: "pending metadata"}
+}
+
+// GetPending gets the store's pending metadata, if the store can hold pending
+// metadata.  Otherwise an ErrNotSupported is returned.
+func GetPending(ctx context.Context, s MetadataStore) ([]byte, error) {
+	if ps, ok := s.(PendingMetadataStore); ok {
+		return ps.GetPending(ctx)
+	}
+	return nil, ErrNotSupported{Feature: "pending metadata"}
+}
+
+// RemovePending discards the store's pending metadata, if the store can hold
+// pending metadata.  Otherwise an ErrNotSupported is returned.
+func RemovePending(ctx context.Context, s MetadataStore) error {
+	if ps, ok := s.(PendingMetadataStore); ok {
+		return ps.RemovePending(ctx)
+	}
+	return ErrNotSupported{Feature: "pending metadata"}
+}
+
+// HistoricalMetadataStore is implemented by a MetadataStore that keeps every
+// version of each role's metadata that has been published
+type HistoricalMetadataStore interface {
+	// GetVersion returns the given version of a role's metadata, along with
+	// when it was published, which is the zero time if it is not known
+	GetVersion(ctx context.Context, role data.RoleName, version int) (published time.Time, meta []byte, err error)
+}
+
+// GetVersion gets the given version of a role's metadata from the store, if
+// the store keeps earlier versions.  Otherwise an ErrNotSupported is returned.
+func GetVersion(ctx context.Context, s MetadataStore, role data.RoleName, version int) (time.Time, []byte, error) {
+	if hs, ok := s.(HistoricalMetadataStore); ok {
+		return hs.GetVersion(ctx, role, version)
+	}
+	return time.Time{}, nil, ErrNotSupported{Feature: "metadata history"}
+}
+
 // RemoteStore is similar to LocalStore with the added expectation that it should
 // provide a way to download targets once located
 type RemoteStore interface {
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/theupdateframework/notary/tuf/data"
+	"golang.org/x/net/context"
 )
 
 // ErrOffline is used to indicate we are operating offline
@@ -47,6 +50,26 @@ func (es OfflineStore) RotateKey(role data.RoleName) ([]byte, error) {
 	return nil, err
 }
 
+// SetPending returns ErrOffline
+func (es OfflineStore) SetPending(context.Context, map[string][]byte) (bool, error) {
+	return false, err
+}
+
+// GetPending returns ErrOffline
+func (es OfflineStore) GetPending(context.Context) ([]byte, error) {
+	return nil, err
+}
+
+// GetVersion returns ErrOffline
+func (es OfflineStore) GetVersion(ctx context.Context, role data.RoleName, version int) (time.Time, []byte, error) {
+	return time.Time{}, nil, err
+}
+
+// RemovePending returns ErrOffline
+func (es OfflineStore) RemovePending(context.Context) error {
+	return err
+}
+
 // RemoveAll return ErrOffline
 func (es OfflineStore) RemoveAll() error {
 	return err
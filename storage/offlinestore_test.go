@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 )
 
 func TestOfflineStore(t *testing.T) {
@@ -28,6 +29,10 @@ func TestOfflineStore(t *testing.T) {
 	require.Error(t, err)
 	require.IsType(t, ErrOffline{}, err)
 
+	_, _, err = s.GetVersion(context.Background(), "", 1)
+	require.Error(t, err)
+	require.IsType(t, ErrOffline{}, err)
+
 	err = s.RemoveAll()
 	require.Error(t, err)
 	require.IsType(t, ErrOffline{}, err)
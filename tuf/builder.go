@@ -54,6 +54,12 @@ func (c ConsistentInfo) Length() int64 {
 	return -1
 }
 
+// CheckHashes verifies that the payload matches the checksums in this
+// consistent information.  It errors if no checksums are known.
+func (c ConsistentInfo) CheckHashes(payload []byte) error {
+	return data.CheckHashes(payload, c.RoleName.String(), c.fileMeta.Hashes)
+}
+
 // RepoBuilder is an interface for an object which builds a tuf.Repo
 type RepoBuilder interface {
 	Load(roleName data.RoleName, content []byte, minVersion int, allowExpired bool) error
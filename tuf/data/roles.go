@@ -1,6 +1,8 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"regexp"
@@ -29,6 +31,28 @@ var BaseRoles = []RoleName{
 // Regex for validating delegation names
 var delegationRegexp = regexp.MustCompile("^[-a-z0-9_/]+$")
 
+// Regex for validating path hash prefixes, which are lowercase hex digits
+var pathHashPrefixRegexp = regexp.MustCompile("^[0-9a-f]+$")
+
+// PathType determines how the paths of a delegation are matched against target paths
+type PathType string
+
+// Delegation path types.  Metadata that doesn't specify a path type uses prefixes.
+const (
+	// PathTypePrefix paths match every target path that they are a prefix of
+	PathTypePrefix PathType = "prefix"
+	// PathTypeGlob paths are shell file name patterns, matched against target
+	// paths one "/" separated segment at a time as by path.Match, so "*" never
+	// matches across a "/"
+	PathTypeGlob PathType = "glob"
+)
+
+// IsValidPathType returns whether the path type is known, treating an empty
+// path type as prefixes
+func IsValidPathType(pathType PathType) bool {
+	return pathType == "" || pathType == PathTypePrefix || pathType == PathTypeGlob
+}
+
 // ErrNoSuchRole indicates the roles doesn't exist
 type ErrNoSuchRole struct {
 	Role RoleName
@@ -161,7 +185,10 @@ func (b BaseRole) Equals(o BaseRole) bool {
 // DelegationRole is an internal representation of a delegation role, with its public keys included
 type DelegationRole struct {
 	BaseRole
-	Paths []string
+	Paths            []string
+	PathType         PathType
+	PathHashPrefixes []string
+	Terminating      bool
 }
 
 func listKeys(keyMap map[string]PublicKey) KeyList {
@@ -192,7 +219,10 @@ func (d DelegationRole) Restrict(child DelegationRole) (DelegationRole, error) {
 			Name:      child.Name,
 			Threshold: child.Threshold,
 		},
-		Paths: RestrictDelegationPathPrefixes(d.Paths, child.Paths),
+		Paths:            RestrictDelegationPaths(d.Paths, d.PathType, child.Paths, child.PathType),
+		PathType:         child.PathType,
+		PathHashPrefixes: RestrictDelegationPathHashPrefixes(d.Paths, d.PathType, d.PathHashPrefixes, child.PathHashPrefixes),
+		Terminating:      child.Terminating,
 	}, nil
 }
 
@@ -203,22 +233,130 @@ func (d DelegationRole) IsParentOf(child DelegationRole) bool {
 	return path.Dir(child.Name.String()) == d.Name.String()
 }
 
-// CheckPaths checks if a given path is valid for the role
+// CheckPaths checks if a given path is valid for the role, either because it
+// matches one of the role's paths or because its hash has one of the role's
+// path hash prefixes
 func (d DelegationRole) CheckPaths(path string) bool {
-	return checkPaths(path, d.Paths)
+	return checkPaths(path, d.Paths, d.PathType) || checkPathHashPrefixes(path, d.PathHashPrefixes)
+}
+
+// Terminates returns whether a search for the given path should end with this
+// role's subtree, because the role is a terminating delegation for the path
+func (d DelegationRole) Terminates(path string) bool {
+	return d.Terminating && d.CheckPaths(path)
+}
+
+func checkPaths(targetPath string, permitted []string, pathType PathType) bool {
+	for _, p := range permitted {
+		if pathType == PathTypeGlob {
+			if matchPathPattern(p, targetPath) {
+				return true
+			}
+		} else if strings.HasPrefix(targetPath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern returns whether the target path has as many segments as the
+// pattern, and each of its segments matches the pattern's segment
+func matchPathPattern(pattern, targetPath string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(targetPath, "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if matched, err := path.Match(segment, pathSegments[i]); err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidPathPattern returns whether the pattern is a non-empty glob pattern
+// each of whose segments is well formed
+func IsValidPathPattern(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
 }
 
-func checkPaths(path string, permitted []string) bool {
+// literalPrefix returns the part of a glob pattern before its first special character
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// PathHash returns the hex encoded SHA256 hash of a target path, which is
+// matched against the path hash prefixes of hashed bin delegations
+func PathHash(path string) string {
+	digest := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(digest[:])
+}
+
+func checkPathHashPrefixes(path string, permitted []string) bool {
+	if len(permitted) == 0 {
+		return false
+	}
+	pathHash := PathHash(path)
 	for _, p := range permitted {
-		if strings.HasPrefix(path, p) {
+		if strings.HasPrefix(pathHash, p) {
 			return true
 		}
 	}
 	return false
 }
 
+// RestrictDelegationPathHashPrefixes returns the list of valid delegationHashPrefixes
+// given the paths and path hash prefixes of the parent.  A parent that may sign for all
+// paths may delegate any hash prefix, and otherwise a hash prefix must be prefixed by
+// one of the parent's hash prefixes.  Since a hash prefix may match any path, none are
+// valid if the parent only has paths that don't include all paths.
+func RestrictDelegationPathHashPrefixes(parentPaths []string, parentType PathType, parentHashPrefixes, delegationHashPrefixes []string) []string {
+	validPrefixes := []string{}
+	if len(delegationHashPrefixes) == 0 {
+		return validPrefixes
+	}
+	if parentType != PathTypeGlob {
+		for _, parentPath := range parentPaths {
+			if parentPath == "" {
+				return append(validPrefixes, delegationHashPrefixes...)
+			}
+		}
+	}
+
+	for _, delgPrefix := range delegationHashPrefixes {
+		for _, parentPrefix := range parentHashPrefixes {
+			if strings.HasPrefix(delgPrefix, parentPrefix) {
+				validPrefixes = append(validPrefixes, delgPrefix)
+				break
+			}
+		}
+	}
+	return validPrefixes
+}
+
 // RestrictDelegationPathPrefixes returns the list of valid delegationPaths that are prefixed by parentPaths
 func RestrictDelegationPathPrefixes(parentPaths, delegationPaths []string) []string {
+	return RestrictDelegationPaths(parentPaths, PathTypePrefix, delegationPaths, PathTypePrefix)
+}
+
+// RestrictDelegationPaths returns the list of valid delegationPaths, of the delegation's path
+// type, given the paths of the parent and their path type.  A delegation path is valid if one
+// of the parent's paths matches every target path that it matches.  This is decided
+// conservatively for glob patterns, so some patterns that only match paths the parent matches
+// may still be rejected, for instance if the parent's patterns only cover them between them.
+func RestrictDelegationPaths(parentPaths []string, parentType PathType, delegationPaths []string, delegationType PathType) []string {
 	validPaths := []string{}
 	if len(delegationPaths) == 0 {
 		return validPaths
@@ -226,21 +364,63 @@ func RestrictDelegationPathPrefixes(parentPaths, delegationPaths []string) []str
 
 	// Validate each individual delegation path
 	for _, delgPath := range delegationPaths {
-		isPrefixed := false
+		if delegationType == PathTypeGlob && !IsValidPathPattern(delgPath) {
+			continue
+		}
 		for _, parentPath := range parentPaths {
-			if strings.HasPrefix(delgPath, parentPath) {
-				isPrefixed = true
+			if pathCovers(parentPath, parentType, delgPath, delegationType) {
+				validPaths = append(validPaths, delgPath)
 				break
 			}
 		}
-		// If the delegation path did not match prefix against any parent path, it is not valid
-		if isPrefixed {
-			validPaths = append(validPaths, delgPath)
-		}
 	}
 	return validPaths
 }
 
+// pathCovers returns whether every target path the delegation path matches is
+// also matched by the parent path
+func pathCovers(parentPath string, parentType PathType, delgPath string, delegationType PathType) bool {
+	switch {
+	case parentType != PathTypeGlob && delegationType != PathTypeGlob:
+		return strings.HasPrefix(delgPath, parentPath)
+	case parentType != PathTypeGlob:
+		// every path the pattern matches starts with the pattern's literal prefix
+		return strings.HasPrefix(literalPrefix(delgPath), parentPath)
+	case delegationType != PathTypeGlob:
+		// a prefix matches paths with any number of segments, which no pattern does
+		return false
+	}
+
+	parentSegments := strings.Split(parentPath, "/")
+	delgSegments := strings.Split(delgPath, "/")
+	if len(parentSegments) != len(delgSegments) {
+		return false
+	}
+	for i, delgSegment := range delgSegments {
+		if !segmentCovers(parentSegments[i], delgSegment) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentCovers returns whether every path segment the delegation's pattern
+// segment matches is also matched by the parent's pattern segment
+func segmentCovers(parentSegment, delgSegment string) bool {
+	if literalPrefix(delgSegment) == delgSegment {
+		matched, err := path.Match(parentSegment, delgSegment)
+		return err == nil && matched
+	}
+	if parentSegment == delgSegment {
+		return true
+	}
+	// a parent segment of literal text followed by a "*" matches everything
+	// that starts with the literal text
+	parentLiteral := strings.TrimSuffix(parentSegment, "*")
+	return parentLiteral != parentSegment && literalPrefix(parentLiteral) == parentLiteral &&
+		strings.HasPrefix(literalPrefix(delgSegment), parentLiteral)
+}
+
 // RootRole is a cut down role as it appears in the root.json
 // Eventually should only be used for immediately before and after serialization/deserialization
 type RootRole struct {
@@ -254,6 +434,16 @@ type Role struct {
 	RootRole
 	Name  RoleName `json:"name"`
 	Paths []string `json:"paths,omitempty"`
+	// PathType determines how Paths are matched against target paths, and is
+	// omitted for path prefixes
+	PathType PathType `json:"path_type,omitempty"`
+	// PathHashPrefixes make this a hashed bin delegation, which may sign for
+	// any target path whose hex encoded SHA256 hash has one of the prefixes
+	PathHashPrefixes []string `json:"path_hash_prefixes,omitempty"`
+	// Terminating delegations end a search for any target path they match:
+	// no other delegations are consulted for the path once this role's
+	// subtree has been searched
+	Terminating bool `json:"terminating,omitempty"`
 }
 
 // NewRole creates a new Role object from the given parameters
@@ -282,7 +472,7 @@ func NewRole(name RoleName, threshold int, keyIDs, paths []string) (*Role, error
 
 // CheckPaths checks if a given path is valid for the role
 func (r Role) CheckPaths(path string) bool {
-	return checkPaths(path, r.Paths)
+	return checkPaths(path, r.Paths, r.PathType) || checkPathHashPrefixes(path, r.PathHashPrefixes)
 }
 
 // AddKeys merges the ids into the current list of role key ids
@@ -295,10 +485,50 @@ func (r *Role) AddPaths(paths []string) error {
 	if len(paths) == 0 {
 		return nil
 	}
+	if r.PathType == PathTypeGlob {
+		for _, pattern := range paths {
+			if !IsValidPathPattern(pattern) {
+				return ErrInvalidRole{Role: r.Name, Reason: fmt.Sprintf("invalid path pattern %q", pattern)}
+			}
+		}
+	}
 	r.Paths = mergeStrSlices(r.Paths, paths)
 	return nil
 }
 
+// SetPathType changes how the role's paths are matched against target paths.
+// Path prefixes are stored as an empty path type, so that the role serializes
+// the same way as roles from before path types existed.
+func (r *Role) SetPathType(pathType PathType) error {
+	if !IsValidPathType(pathType) {
+		return ErrInvalidRole{Role: r.Name, Reason: fmt.Sprintf("invalid path type %q", pathType)}
+	}
+	if pathType == PathTypeGlob {
+		for _, pattern := range r.Paths {
+			if !IsValidPathPattern(pattern) {
+				return ErrInvalidRole{Role: r.Name, Reason: fmt.Sprintf("invalid path pattern %q", pattern)}
+			}
+		}
+	}
+	if pathType == PathTypePrefix {
+		pathType = ""
+	}
+	r.PathType = pathType
+	return nil
+}
+
+// AddPathHashPrefixes merges the path hash prefixes into the current list of
+// role path hash prefixes
+func (r *Role) AddPathHashPrefixes(prefixes []string) error {
+	for _, prefix := range prefixes {
+		if !IsValidPathHashPrefix(prefix) {
+			return ErrInvalidRole{Role: r.Name, Reason: fmt.Sprintf("invalid path hash prefix %q", prefix)}
+		}
+	}
+	r.PathHashPrefixes = mergeStrSlices(r.PathHashPrefixes, prefixes)
+	return nil
+}
+
 // RemoveKeys removes the ids from the current list of key ids
 func (r *Role) RemoveKeys(ids []string) {
 	r.KeyIDs = subtractStrSlices(r.KeyIDs, ids)
@@ -309,6 +539,18 @@ func (r *Role) RemovePaths(paths []string) {
 	r.Paths = subtractStrSlices(r.Paths, paths)
 }
 
+// RemovePathHashPrefixes removes the path hash prefixes from the current list
+// of role path hash prefixes
+func (r *Role) RemovePathHashPrefixes(prefixes []string) {
+	r.PathHashPrefixes = subtractStrSlices(r.PathHashPrefixes, prefixes)
+}
+
+// IsValidPathHashPrefix returns whether the prefix is a non-empty string of
+// lowercase hex digits no longer than a SHA256 hash
+func IsValidPathHashPrefix(prefix string) bool {
+	return len(prefix) <= sha256.Size*2 && pathHashPrefixRegexp.MatchString(prefix)
+}
+
 func mergeStrSlices(orig, new []string) []string {
 	have := make(map[string]bool)
 	for _, e := range orig {
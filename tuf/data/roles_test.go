@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -95,6 +96,197 @@ func TestAddPathNil(t *testing.T) {
 	require.NoError(t, err)
 }
 
+// Roles are only serialized with a terminating field if they are terminating,
+// so metadata for non-terminating delegations is unchanged
+func TestRoleTerminatingSerialization(t *testing.T) {
+	role, err := NewRole("targets/a", 1, []string{"abc"}, []string{"123"})
+	require.NoError(t, err)
+	serialized, err := json.Marshal(role)
+	require.NoError(t, err)
+	require.NotContains(t, string(serialized), "terminating")
+
+	role.Terminating = true
+	serialized, err = json.Marshal(role)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"terminating":true`)
+
+	var unmarshalled Role
+	require.NoError(t, json.Unmarshal(serialized, &unmarshalled))
+	require.True(t, unmarshalled.Terminating)
+}
+
+func TestDelegationRoleRestrictTerminating(t *testing.T) {
+	parent := DelegationRole{BaseRole: BaseRole{Name: "targets/a"}, Paths: []string{"foo"}}
+	child := DelegationRole{BaseRole: BaseRole{Name: "targets/a/b"}, Paths: []string{"foo/bar", "baz"}, Terminating: true}
+
+	restricted, err := parent.Restrict(child)
+	require.NoError(t, err)
+	require.True(t, restricted.Terminating)
+	require.Equal(t, []string{"foo/bar"}, restricted.Paths)
+	require.True(t, restricted.Terminates("foo/bar/baz"))
+	require.False(t, restricted.Terminates("baz"))
+	require.False(t, parent.Terminates("foo"))
+}
+
+func TestPathHashPrefixes(t *testing.T) {
+	pathHash := PathHash("some/target")
+	require.Len(t, pathHash, 64)
+
+	role, err := NewRole("targets/bin", 1, []string{"abc"}, nil)
+	require.NoError(t, err)
+	require.False(t, role.CheckPaths("some/target"))
+
+	require.Error(t, role.AddPathHashPrefixes([]string{"0G"}))
+	require.Error(t, role.AddPathHashPrefixes([]string{""}))
+	require.Empty(t, role.PathHashPrefixes)
+
+	require.NoError(t, role.AddPathHashPrefixes([]string{pathHash[:2]}))
+	require.NoError(t, role.AddPathHashPrefixes([]string{pathHash[:2]}))
+	require.Equal(t, []string{pathHash[:2]}, role.PathHashPrefixes)
+	require.True(t, role.CheckPaths("some/target"))
+
+	role.RemovePathHashPrefixes([]string{pathHash[:2]})
+	require.Empty(t, role.PathHashPrefixes)
+	require.False(t, role.CheckPaths("some/target"))
+}
+
+func TestDelegationRoleRestrictPathHashPrefixes(t *testing.T) {
+	child := DelegationRole{
+		BaseRole:         BaseRole{Name: "targets/a/b"},
+		PathHashPrefixes: []string{"00", "1a", "ff"},
+	}
+
+	// a parent with all paths can delegate any hash prefix
+	parent := DelegationRole{BaseRole: BaseRole{Name: "targets/a"}, Paths: []string{""}}
+	restricted, err := parent.Restrict(child)
+	require.NoError(t, err)
+	require.Equal(t, []string{"00", "1a", "ff"}, restricted.PathHashPrefixes)
+
+	// a parent with hash prefixes can only delegate longer hash prefixes
+	parent = DelegationRole{BaseRole: BaseRole{Name: "targets/a"}, PathHashPrefixes: []string{"0", "1a"}}
+	restricted, err = parent.Restrict(child)
+	require.NoError(t, err)
+	require.Equal(t, []string{"00", "1a"}, restricted.PathHashPrefixes)
+
+	// a parent with only some paths cannot delegate any hash prefixes
+	parent = DelegationRole{BaseRole: BaseRole{Name: "targets/a"}, Paths: []string{"foo"}}
+	restricted, err = parent.Restrict(child)
+	require.NoError(t, err)
+	require.Empty(t, restricted.PathHashPrefixes)
+	require.False(t, restricted.CheckPaths("foo"))
+}
+
+func TestPathPatterns(t *testing.T) {
+	role, err := NewRole("targets/a", 1, []string{"abc"}, []string{"*/linux-amd64/*", "releases/v?.*"})
+	require.NoError(t, err)
+
+	// path prefixes are the default, and are not serialized
+	serialized, err := json.Marshal(role)
+	require.NoError(t, err)
+	require.NotContains(t, string(serialized), "path_type")
+	require.False(t, role.CheckPaths("foo/linux-amd64/bar"))
+	require.True(t, role.CheckPaths("releases/v?.*/foo"))
+
+	require.Error(t, role.SetPathType("regexp"))
+	require.NoError(t, role.SetPathType(PathTypeGlob))
+	serialized, err = json.Marshal(role)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"path_type":"glob"`)
+
+	for targetPath, matches := range map[string]bool{
+		"foo/linux-amd64/bar":     true,
+		"foo/linux-amd64/":        true,
+		"foo/linux-amd64/bar/baz": false,
+		"foo/bar/linux-amd64/baz": false,
+		"linux-amd64/bar":         false,
+		"releases/v1.2":           true,
+		"releases/v1.2.3":         true,
+		"releases/v10.2":          false,
+		"releases/v1.2/foo":       false,
+		"releases/v?.*/foo":       false,
+	} {
+		require.Equal(t, matches, role.CheckPaths(targetPath), targetPath)
+	}
+
+	// patterns must be well formed
+	require.Error(t, role.AddPaths([]string{"foo/[a"}))
+	require.Error(t, role.AddPaths([]string{""}))
+	require.Len(t, role.Paths, 2)
+
+	// setting path prefixes again serializes as before
+	require.NoError(t, role.SetPathType(PathTypePrefix))
+	require.Equal(t, PathType(""), role.PathType)
+	require.NoError(t, role.AddPaths([]string{"foo/[a"}))
+	require.Error(t, role.SetPathType(PathTypeGlob))
+}
+
+func TestRestrictDelegationPaths(t *testing.T) {
+	testCases := []struct {
+		parentPath string
+		parentType PathType
+		delgPath   string
+		delgType   PathType
+		valid      bool
+	}{
+		{"", PathTypePrefix, "*/linux-amd64/*", PathTypeGlob, true},
+		{"releases/", PathTypePrefix, "releases/v*", PathTypeGlob, true},
+		{"releases/", PathTypePrefix, "releases/", PathTypeGlob, true},
+		{"releases/", PathTypePrefix, "rel*", PathTypeGlob, false},
+		{"releases/", PathTypePrefix, "*/releases/v1", PathTypeGlob, false},
+		{"releases/", PathTypePrefix, "releases/[", PathTypeGlob, false},
+		{"releases/", PathTypePrefix, "releases/v1", PathTypePrefix, true},
+		{"releases/", PathTypePrefix, "rel", PathTypePrefix, false},
+		{"*/linux-amd64/*", PathTypeGlob, "foo/linux-amd64/*", PathTypeGlob, true},
+		{"*/linux-amd64/*", PathTypeGlob, "*/linux-amd64/bar", PathTypeGlob, true},
+		{"*/linux-amd64/*", PathTypeGlob, "*/linux-amd64/[ab]*", PathTypeGlob, true},
+		{"*/linux-amd64/*", PathTypeGlob, "*/linux-amd64/*", PathTypeGlob, true},
+		{"*/linux-amd64/*", PathTypeGlob, "foo/*/*", PathTypeGlob, false},
+		{"*/linux-amd64/*", PathTypeGlob, "*/linux-amd64/*/bar", PathTypeGlob, false},
+		{"*/linux-amd64/*", PathTypeGlob, "foo/linux-amd64/", PathTypePrefix, false},
+		{"releases/v*", PathTypeGlob, "releases/v1.*", PathTypeGlob, true},
+		{"releases/v*", PathTypeGlob, "releases/v1.2", PathTypeGlob, true},
+		{"releases/v*", PathTypeGlob, "releases/*", PathTypeGlob, false},
+		{"releases/v?.*", PathTypeGlob, "releases/v1.*", PathTypeGlob, false},
+		{"releases/v?.*", PathTypeGlob, "releases/v1.0", PathTypeGlob, true},
+	}
+	for _, tc := range testCases {
+		restricted := RestrictDelegationPaths([]string{tc.parentPath}, tc.parentType, []string{tc.delgPath}, tc.delgType)
+		if tc.valid {
+			require.Equal(t, []string{tc.delgPath}, restricted, "%+v", tc)
+		} else {
+			require.Empty(t, restricted, "%+v", tc)
+		}
+	}
+}
+
+func TestDelegationRoleRestrictPathPatterns(t *testing.T) {
+	parent := DelegationRole{
+		BaseRole: BaseRole{Name: "targets/a"},
+		Paths:    []string{"*/linux-amd64/*"},
+		PathType: PathTypeGlob,
+	}
+	child := DelegationRole{
+		BaseRole:         BaseRole{Name: "targets/a/b"},
+		Paths:            []string{"foo/linux-amd64/*", "foo/darwin-amd64/*"},
+		PathType:         PathTypeGlob,
+		PathHashPrefixes: []string{"0"},
+	}
+	restricted, err := parent.Restrict(child)
+	require.NoError(t, err)
+	require.Equal(t, PathTypeGlob, restricted.PathType)
+	require.Equal(t, []string{"foo/linux-amd64/*"}, restricted.Paths)
+	// a pattern never matches every path, so no hash prefixes can be delegated
+	require.Empty(t, restricted.PathHashPrefixes)
+	require.True(t, restricted.CheckPaths("foo/linux-amd64/bar"))
+	require.False(t, restricted.CheckPaths("foo/darwin-amd64/bar"))
+
+	// path prefixes cannot be delegated by a role with patterns
+	child = DelegationRole{BaseRole: BaseRole{Name: "targets/a/b"}, Paths: []string{"foo/linux-amd64/"}}
+	restricted, err = parent.Restrict(child)
+	require.NoError(t, err)
+	require.Empty(t, restricted.Paths)
+}
+
 func TestErrNoSuchRole(t *testing.T) {
 	var err error = ErrNoSuchRole{Role: "test"}
 	require.True(t, strings.HasSuffix(err.Error(), "test"))
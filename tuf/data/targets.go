@@ -50,6 +50,24 @@ func isValidTargetsStructure(t Targets, roleName RoleName) error {
 		if err := isValidRootRoleStructure(roleName, roleObj.Name, roleObj.RootRole, t.Delegations.Keys); err != nil {
 			return err
 		}
+		if !IsValidPathType(roleObj.PathType) {
+			return ErrInvalidMetadata{
+				role: roleName, msg: fmt.Sprintf("delegation role %s has invalid path type %q", roleObj.Name, roleObj.PathType)}
+		}
+		if roleObj.PathType == PathTypeGlob {
+			for _, pattern := range roleObj.Paths {
+				if !IsValidPathPattern(pattern) {
+					return ErrInvalidMetadata{
+						role: roleName, msg: fmt.Sprintf("delegation role %s has invalid path pattern %q", roleObj.Name, pattern)}
+				}
+			}
+		}
+		for _, prefix := range roleObj.PathHashPrefixes {
+			if !IsValidPathHashPrefix(prefix) {
+				return ErrInvalidMetadata{
+					role: roleName, msg: fmt.Sprintf("delegation role %s has invalid path hash prefix %q", roleObj.Name, prefix)}
+			}
+		}
 	}
 	return nil
 }
@@ -120,7 +138,10 @@ func (t *SignedTargets) BuildDelegationRole(roleName RoleName) (DelegationRole,
 					Keys:      pubKeys,
 					Threshold: role.Threshold,
 				},
-				Paths: role.Paths,
+				Paths:            role.Paths,
+				PathType:         role.PathType,
+				PathHashPrefixes: role.PathHashPrefixes,
+				Terminating:      role.Terminating,
 			}, nil
 		}
 	}
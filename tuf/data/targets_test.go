@@ -193,6 +193,63 @@ func TestTargetsFromSignedValidatesDelegations(t *testing.T) {
 	}
 }
 
+// Delegations' path hash prefixes must be hex encoded hash prefixes
+func TestTargetsFromSignedValidatesPathHashPrefixes(t *testing.T) {
+	targets := validTargetsTemplate()
+	delgRole, err := NewRole("targets/bin", 1, []string{"key1"}, nil)
+	require.NoError(t, err)
+	targets.Signed.Delegations.Roles = []*Role{delgRole}
+
+	for _, prefix := range []string{"", "0G", "AB", string(bytes.Repeat([]byte("0"), 65))} {
+		delgRole.PathHashPrefixes = []string{"00", prefix}
+		s, err := targets.ToSigned()
+		require.NoError(t, err)
+		_, err = TargetsFromSigned(s, CanonicalTargetsRole)
+		require.Error(t, err)
+		require.IsType(t, ErrInvalidMetadata{}, err)
+	}
+
+	delgRole.PathHashPrefixes = []string{"00", "0a1"}
+	s, err := targets.ToSigned()
+	require.NoError(t, err)
+	parsed, err := TargetsFromSigned(s, CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, []string{"00", "0a1"}, parsed.Signed.Delegations.Roles[0].PathHashPrefixes)
+}
+
+func TestTargetsFromSignedValidatesPathType(t *testing.T) {
+	targets := validTargetsTemplate()
+	delgRole, err := NewRole("targets/a", 1, []string{"key1"}, []string{"foo/[a"})
+	require.NoError(t, err)
+	targets.Signed.Delegations.Roles = []*Role{delgRole}
+
+	// malformed patterns are fine as path prefixes
+	s, err := targets.ToSigned()
+	require.NoError(t, err)
+	_, err = TargetsFromSigned(s, CanonicalTargetsRole)
+	require.NoError(t, err)
+
+	for _, pathType := range []PathType{"regexp", PathTypeGlob} {
+		delgRole.PathType = pathType
+		s, err := targets.ToSigned()
+		require.NoError(t, err)
+		_, err = TargetsFromSigned(s, CanonicalTargetsRole)
+		require.Error(t, err)
+		require.IsType(t, ErrInvalidMetadata{}, err)
+	}
+
+	delgRole.Paths = []string{"*/linux-amd64/*"}
+	s, err = targets.ToSigned()
+	require.NoError(t, err)
+	parsed, err := TargetsFromSigned(s, CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, PathTypeGlob, parsed.Signed.Delegations.Roles[0].PathType)
+
+	built, err := parsed.BuildDelegationRole("targets/a")
+	require.NoError(t, err)
+	require.True(t, built.CheckPaths("foo/linux-amd64/bar"))
+}
+
 // Type must be "Targets"
 func TestTargetsFromSignedValidatesRoleType(t *testing.T) {
 	for _, roleName := range []RoleName{CanonicalTargetsRole, RoleName(path.Join(CanonicalTargetsRole.String(), "a"))} {
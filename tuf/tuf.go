@@ -119,11 +119,30 @@ func (tr *Repo) ReplaceBaseKeys(role data.RoleName, keys ...data.PublicKey) erro
 	if err != nil {
 		return err
 	}
-	err = tr.RemoveBaseKeys(role, r.ListKeyIDs()...)
+	// Keys that the role keeps must not be removed, as that would also delete
+	// them from the cryptoservice.
+	keep := make(map[string]struct{})
+	var addKeys []data.PublicKey
+	for _, k := range keys {
+		if _, ok := keep[k.ID()]; ok {
+			continue
+		}
+		keep[k.ID()] = struct{}{}
+		if _, ok := r.Keys[k.ID()]; !ok {
+			addKeys = append(addKeys, k)
+		}
+	}
+	var removeKeyIDs []string
+	for _, keyID := range r.ListKeyIDs() {
+		if _, ok := keep[keyID]; !ok {
+			removeKeyIDs = append(removeKeyIDs, keyID)
+		}
+	}
+	err = tr.RemoveBaseKeys(role, removeKeyIDs...)
 	if err != nil {
 		return err
 	}
-	return tr.AddBaseKeys(role, keys...)
+	return tr.AddBaseKeys(role, addKeys...)
 }
 
 // RemoveBaseKeys is used to remove keys from the roles in root.json
@@ -182,6 +201,57 @@ func (tr *Repo) RemoveBaseKeys(role data.RoleName, keyIDs ...string) error {
 	return nil
 }
 
+// SetBaseRoleThreshold sets the number of signatures required for the given
+// role in root.json.  The threshold must be at least 1 and may not exceed the
+// number of keys currently assigned to the role.
+func (tr *Repo) SetBaseRoleThreshold(role data.RoleName, threshold int) error {
+	if tr.Root == nil {
+		return ErrNotLoaded{Role: data.CanonicalRootRole}
+	}
+	roleData, ok := tr.Root.Signed.Roles[role]
+	if !ok || !data.ValidRole(role) || data.IsDelegation(role) {
+		return data.ErrInvalidRole{Role: role, Reason: "not a base role in root.json"}
+	}
+	if threshold < 1 || threshold > len(roleData.KeyIDs) {
+		return errUnsatisfiableThreshold(role, threshold, len(roleData.KeyIDs))
+	}
+	if roleData.Threshold == threshold {
+		return nil
+	}
+	roleData.Threshold = threshold
+	tr.markRoleDirty(role)
+	tr.Root.Dirty = true
+	return nil
+}
+
+// ReplaceBaseKeysAndThreshold replaces all keys for the given role with the new
+// keys and sets the role's threshold.  A threshold of 0 keeps the role's current
+// threshold.  Nothing is changed if the new keys cannot satisfy the threshold.
+func (tr *Repo) ReplaceBaseKeysAndThreshold(role data.RoleName, threshold int, keys ...data.PublicKey) error {
+	r, err := tr.GetBaseRole(role)
+	if err != nil {
+		return err
+	}
+	if threshold == 0 {
+		threshold = r.Threshold
+	}
+	numKeys := len(data.NewBaseRole(role, threshold, keys...).Keys)
+	if threshold < 1 || threshold > numKeys {
+		return errUnsatisfiableThreshold(role, threshold, numKeys)
+	}
+	if err := tr.ReplaceBaseKeys(role, keys...); err != nil {
+		return err
+	}
+	return tr.SetBaseRoleThreshold(role, threshold)
+}
+
+func errUnsatisfiableThreshold(role data.RoleName, threshold, numKeys int) error {
+	return data.ErrInvalidRole{
+		Role:   role,
+		Reason: fmt.Sprintf("threshold of %d is not satisfiable with %d key(s)", threshold, numKeys),
+	}
+}
+
 func (tr *Repo) markRoleDirty(role data.RoleName) {
 	switch role {
 	case data.CanonicalSnapshotRole:
@@ -308,10 +378,6 @@ func (tr *Repo) GetAllLoadedRoles() []*data.Role {
 func delegationUpdateVisitor(roleName data.RoleName, addKeys data.KeyList, removeKeys, addPaths, removePaths []string, clearAllPaths bool, newThreshold int) walkVisitorFunc {
 	return func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
 		var err error
-		// Validate the changes underneath this restricted validRole for adding paths, reject invalid path additions
-		if len(addPaths) != len(data.RestrictDelegationPathPrefixes(validRole.Paths, addPaths)) {
-			return data.ErrInvalidRole{Role: roleName, Reason: "invalid paths to add to role"}
-		}
 		// Try to find the delegation and amend it using our changelist
 		var delgRole *data.Role
 		for _, role := range tgt.Signed.Delegations.Roles {
@@ -326,15 +392,23 @@ func delegationUpdateVisitor(roleName data.RoleName, addKeys data.KeyList, remov
 						KeyIDs:    keyIDCopy,
 						Threshold: role.Threshold,
 					},
-					Name:  role.Name,
-					Paths: pathsCopy,
+					Name:             role.Name,
+					Paths:            pathsCopy,
+					PathType:         role.PathType,
+					PathHashPrefixes: role.PathHashPrefixes,
+					Terminating:      role.Terminating,
 				}
 				delgRole.RemovePaths(removePaths)
 				if clearAllPaths {
 					delgRole.Paths = []string{}
 				}
-				delgRole.AddPaths(addPaths)
+				if err := delgRole.AddPaths(addPaths); err != nil {
+					return err
+				}
 				delgRole.RemoveKeys(removeKeys)
+				if newThreshold > 0 {
+					delgRole.Threshold = newThreshold
+				}
 				break
 			}
 		}
@@ -343,21 +417,35 @@ func delegationUpdateVisitor(roleName data.RoleName, addKeys data.KeyList, remov
 			addKeys = data.KeyList{} // initialize to empty list if necessary so calling .IDs() below won't panic
 		}
 		if delgRole == nil {
+			if newThreshold == 0 {
+				newThreshold = notary.MinThreshold
+			}
 			delgRole, err = data.NewRole(roleName, newThreshold, addKeys.IDs(), addPaths)
 			if err != nil {
 				return err
 			}
 
 		}
+		// Validate the changes underneath this restricted validRole for adding paths, reject invalid path additions
+		if len(addPaths) != len(data.RestrictDelegationPaths(validRole.Paths, validRole.PathType, addPaths, delgRole.PathType)) {
+			return data.ErrInvalidRole{Role: roleName, Reason: "invalid paths to add to role"}
+		}
 		// Add the key IDs to the role and the keys themselves to the parent
 		for _, k := range addKeys {
 			if !utils.StrSliceContains(delgRole.KeyIDs, k.ID()) {
 				delgRole.KeyIDs = append(delgRole.KeyIDs, k.ID())
 			}
 		}
-		// Make sure we have a valid role still
-		if len(delgRole.KeyIDs) < delgRole.Threshold {
-			logrus.Warnf("role %s has fewer keys than its threshold of %d; it will not be usable until keys are added to it", delgRole.Name, delgRole.Threshold)
+		// Make sure we have a valid role still.  A role whose keys have all been
+		// removed is kept, but one that still has keys must be able to meet its
+		// threshold with them.
+		if len(delgRole.KeyIDs) == 0 {
+			logrus.Warnf("role %s has no keys; it will not be usable until keys are added to it", delgRole.Name)
+		} else if len(delgRole.KeyIDs) < delgRole.Threshold {
+			return data.ErrInvalidRole{
+				Role:   roleName,
+				Reason: fmt.Sprintf("role has %d keys, fewer than its threshold of %d", len(delgRole.KeyIDs), delgRole.Threshold),
+			}
 		}
 		// NOTE: this closure CANNOT error after this point, as we've committed to editing the SignedTargets metadata in the repo object.
 		// Any errors related to updating this delegation must occur before this point.
@@ -381,6 +469,8 @@ func delegationUpdateVisitor(roleName data.RoleName, addKeys data.KeyList, remov
 // a new delegation or updating an existing one. If keys are
 // provided, the IDs will be added to the role (if they do not exist
 // there already), and the keys will be added to the targets file.
+// A newThreshold of 0 keeps the threshold of an existing delegation,
+// and creates a new delegation with a threshold of 1.
 func (tr *Repo) UpdateDelegationKeys(roleName data.RoleName, addKeys data.KeyList, removeKeys []string, newThreshold int) error {
 	if !data.IsDelegation(roleName) {
 		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
@@ -499,10 +589,213 @@ func (tr *Repo) UpdateDelegationPaths(roleName data.RoleName, addPaths, removePa
 	// Walk to the parent of this delegation, since that is where its role metadata exists
 	// We do not have to verify that the walker reached its desired role in this scenario
 	// since we've already done another walk to the parent role in VerifyCanSign
-	err := tr.WalkTargets("", parent, delegationUpdateVisitor(roleName, data.KeyList{}, []string{}, addPaths, removePaths, clearPaths, notary.MinThreshold))
+	err := tr.WalkTargets("", parent, delegationUpdateVisitor(roleName, data.KeyList{}, []string{}, addPaths, removePaths, clearPaths, 0))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateDelegationPathHashPrefixes updates the appropriate delegation's path
+// hash prefixes.  It is not allowed to create a new delegation.
+func (tr *Repo) UpdateDelegationPathHashPrefixes(roleName data.RoleName, addPrefixes, removePrefixes []string) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	found := false
+	err := tr.WalkTargets("", parent, func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		// Validate the changes underneath this restricted validRole, rejecting prefixes it cannot delegate
+		if len(addPrefixes) != len(data.RestrictDelegationPathHashPrefixes(validRole.Paths, validRole.PathType, validRole.PathHashPrefixes, addPrefixes)) {
+			return data.ErrInvalidRole{Role: roleName, Reason: "invalid path hash prefixes to add to role"}
+		}
+		for _, role := range tgt.Signed.Delegations.Roles {
+			if role.Name == roleName {
+				found = true
+				// Operate on a copy until the changes are validated
+				delgRole := *role
+				delgRole.PathHashPrefixes = make([]string, len(role.PathHashPrefixes))
+				copy(delgRole.PathHashPrefixes, role.PathHashPrefixes)
+				delgRole.RemovePathHashPrefixes(removePrefixes)
+				if err := delgRole.AddPathHashPrefixes(addPrefixes); err != nil {
+					return err
+				}
+				role.PathHashPrefixes = delgRole.PathHashPrefixes
+				tgt.Dirty = true
+				break
+			}
+		}
+		return StopWalk{}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+	return nil
+}
+
+// HashedBinFor returns the hashed bin delegation of the given role that the
+// target path belongs in, descending into any bins that the bin is itself
+// divided into.  If the role has no hashed bin delegation for the path, the
+// role itself is returned.
+func (tr *Repo) HashedBinFor(role data.RoleName, targetPath string) (data.RoleName, error) {
+	for {
+		bin := role
+		err := tr.WalkTargets("", role, func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+			for _, child := range tgt.GetValidDelegations(validRole) {
+				if len(child.PathHashPrefixes) > 0 && child.CheckPaths(targetPath) {
+					bin = child.Name
+					break
+				}
+			}
+			return StopWalk{}
+		})
+		if err != nil {
+			return "", err
+		}
+		if bin == role {
+			return role, nil
+		}
+		role = bin
+	}
+}
+
+// MoveTargetsToHashedBin moves the targets of a hashed bin delegation's parent
+// that belong in the bin into the bin.  Once the bin exists, targets with those
+// paths are added to and removed from the bin instead of the parent, so a copy
+// left in the parent would hide them.  Both roles must be signable.
+func (tr *Repo) MoveTargetsToHashedBin(bin data.RoleName) error {
+	delgRole, err := tr.GetDelegationRole(bin)
+	if err != nil {
+		return err
+	}
+	if len(delgRole.PathHashPrefixes) == 0 {
+		return data.ErrInvalidRole{Role: bin, Reason: "not a hashed bin delegation"}
+	}
+	parent, ok := tr.Targets[bin.Parent()]
+	if !ok {
+		return nil
+	}
+	moved := make(data.Files)
+	var paths []string
+	for targetPath, meta := range parent.Signed.Targets {
+		if delgRole.CheckPaths(targetPath) {
+			moved[targetPath] = meta
+			paths = append(paths, targetPath)
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	for _, role := range []data.RoleName{bin.Parent(), bin} {
+		if err := tr.VerifyCanSign(role); err != nil {
+			return err
+		}
+	}
+	if _, err := tr.AddTargets(bin, moved); err != nil {
+		return err
+	}
+	return tr.RemoveTargets(bin.Parent(), paths...)
+}
+
+// UpdateDelegationPathType changes how the appropriate delegation's paths are
+// matched against target paths.  Its existing paths must be valid for the new
+// path type.  It is not allowed to create a new delegation.
+func (tr *Repo) UpdateDelegationPathType(roleName data.RoleName, pathType data.PathType) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	found := false
+	err := tr.WalkTargets("", parent, func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		for _, role := range tgt.Signed.Delegations.Roles {
+			if role.Name == roleName {
+				found = true
+				// Operate on a copy until the change is validated
+				delgRole := *role
+				if err := delgRole.SetPathType(pathType); err != nil {
+					return err
+				}
+				if len(role.Paths) != len(data.RestrictDelegationPaths(validRole.Paths, validRole.PathType, role.Paths, delgRole.PathType)) {
+					return data.ErrInvalidRole{Role: roleName, Reason: "paths of role are invalid for path type " + string(pathType)}
+				}
+				if role.PathType != delgRole.PathType {
+					role.PathType = delgRole.PathType
+					tgt.Dirty = true
+				}
+				break
+			}
+		}
+		return StopWalk{}
+	})
 	if err != nil {
 		return err
 	}
+	if !found {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+	return nil
+}
+
+// UpdateDelegationTerminating sets whether the appropriate delegation is
+// terminating.  It is not allowed to create a new delegation.
+func (tr *Repo) UpdateDelegationTerminating(roleName data.RoleName, terminating bool) error {
+	if !data.IsDelegation(roleName) {
+		return data.ErrInvalidRole{Role: roleName, Reason: "not a valid delegated role"}
+	}
+	parent := roleName.Parent()
+
+	if err := tr.VerifyCanSign(parent); err != nil {
+		return err
+	}
+
+	// check the parent role's metadata
+	if _, ok := tr.Targets[parent]; !ok {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
+
+	found := false
+	err := tr.WalkTargets("", parent, func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		for _, role := range tgt.Signed.Delegations.Roles {
+			if role.Name == roleName {
+				found = true
+				if role.Terminating != terminating {
+					role.Terminating = terminating
+					tgt.Dirty = true
+				}
+				break
+			}
+		}
+		return StopWalk{}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return data.ErrInvalidRole{Role: roleName, Reason: "no valid delegated role exists"}
+	}
 	return nil
 }
 
@@ -700,7 +993,9 @@ type walkVisitorFunc func(*data.SignedTargets, data.DelegationRole) interface{}
 
 // WalkTargets will apply the specified visitor function to iteratively walk the targets/delegation metadata tree,
 // until receiving a StopWalk.  The walk starts from the base "targets" role, and searches for the correct targetPath and/or rolePath
-// to call the visitor function on.  Any roles passed into skipRoles will be excluded from the walk, as well as roles in those subtrees
+// to call the visitor function on.  Any roles passed into skipRoles will be excluded from the walk, as well as roles in those subtrees.
+// If a targetPath is given, visiting a terminating delegation for that path leaves out the roles that a pre-order walk would reach
+// after it, other than those in its own subtree: the delegations listed after it or after any of its ancestors
 func (tr *Repo) WalkTargets(targetPath string, rolePath data.RoleName, visitTargets walkVisitorFunc, skipRoles ...data.RoleName) error {
 	// Start with the base targets role, which implicitly has the "" targets path
 	targetsRole, err := tr.GetBaseRole(data.CanonicalTargetsRole)
@@ -708,43 +1003,56 @@ func (tr *Repo) WalkTargets(targetPath string, rolePath data.RoleName, visitTarg
 		return err
 	}
 	// Make the targets role have the empty path, when we treat it as a delegation role
-	roles := []data.DelegationRole{
+	roles := []walkRole{
 		{
-			BaseRole: targetsRole,
-			Paths:    []string{""},
+			DelegationRole: data.DelegationRole{
+				BaseRole: targetsRole,
+				Paths:    []string{""},
+			},
 		},
 	}
+	// the position of the last terminating delegation for the target path, if any
+	var terminated []int
 
 	for len(roles) > 0 {
 		role := roles[0]
 		roles = roles[1:]
+		if terminated != nil && preorderAfter(role.order, terminated) {
+			continue
+		}
+
+		// Determine whether to visit this role or not:
+		// If the paths validate against the specified targetPath and the role is empty or is a path in the subtree.
+		// Also check if we are choosing to skip visiting this role on this walk (see ListTargets and GetTargetByName priority)
+		visit := isValidPath(targetPath, role.DelegationRole) && isAncestorRole(role.Name, rolePath) && !utils.RoleNameSliceContains(skipRoles, role.Name)
+		if visit && targetPath != "" && role.Terminates(targetPath) {
+			terminated = role.order
+		}
 
 		// Check the role metadata
 		signedTgt, ok := tr.Targets[role.Name]
 		if !ok {
-			// The role meta doesn't exist in the repo so continue onward
+			// The role meta doesn't exist in the repo, either because it was never published or because it
+			// failed verification and so was never loaded, so continue onward
 			continue
 		}
 
 		// We're at a prefix of the desired role subtree, so add its delegation role children and continue walking
 		if strings.HasPrefix(rolePath.String(), role.Name.String()+"/") {
-			roles = append(roles, signedTgt.GetValidDelegations(role)...)
+			roles = append(roles, role.children(signedTgt)...)
 			continue
 		}
 
-		// Determine whether to visit this role or not:
-		// If the paths validate against the specified targetPath and the role is empty or is a path in the subtree.
-		// Also check if we are choosing to skip visiting this role on this walk (see ListTargets and GetTargetByName priority)
-		if isValidPath(targetPath, role) && isAncestorRole(role.Name, rolePath) && !utils.RoleNameSliceContains(skipRoles, role.Name) {
+		if visit {
 			// If we had matching path or role name, visit this target and determine whether or not to keep walking
-			res := visitTargets(signedTgt, role)
+			res := visitTargets(signedTgt, role.DelegationRole)
 			switch typedRes := res.(type) {
 			case StopWalk:
 				// If the visitor function signalled a stop, return nil to finish the walk
 				return nil
 			case nil:
 				// If the visitor function signalled to continue, add this role's delegation to the walk
-				roles = append(roles, signedTgt.GetValidDelegations(role)...)
+				roles = append(roles, role.children(signedTgt)...)
 			case error:
 				// Propagate any errors from the visitor
 				return typedRes
@@ -758,6 +1066,42 @@ func (tr *Repo) WalkTargets(targetPath string, rolePath data.RoleName, visitTarg
 	return nil
 }
 
+// walkRole is a delegation role being walked, along with its position in a
+// pre-order walk of the delegation tree: the index of the delegation at each
+// level on the way down to it from the targets role
+type walkRole struct {
+	data.DelegationRole
+	order []int
+}
+
+// children returns the valid delegations of the role, with their positions
+func (w walkRole) children(signedTgt *data.SignedTargets) []walkRole {
+	delegations := signedTgt.GetValidDelegations(w.DelegationRole)
+	children := make([]walkRole, 0, len(delegations))
+	for i, delegation := range delegations {
+		order := make([]int, len(w.order), len(w.order)+1)
+		copy(order, w.order)
+		children = append(children, walkRole{DelegationRole: delegation, order: append(order, i)})
+	}
+	return children
+}
+
+// preorderAfter returns whether a role at the given position comes after the
+// role at the other position in a pre-order walk, without being in its subtree
+func preorderAfter(order, other []int) bool {
+	for i := range other {
+		if i == len(order) {
+			// an ancestor of the other role
+			return false
+		}
+		if order[i] != other[i] {
+			return order[i] > other[i]
+		}
+	}
+	// the other role itself, or a role in its subtree
+	return false
+}
+
 // helper function that returns whether the candidateChild role name is an ancestor or equal to the candidateAncestor role name
 // Will return true if given an empty candidateAncestor role name
 // The HasPrefix check is for determining whether the role name for candidateChild is a child (direct or further down the chain)
@@ -896,6 +1240,18 @@ func (tr *Repo) UpdateTimestamp(s *data.Signed) error {
 // back to the way it was (so version won't be incremented, for instance).
 // Extra signing keys can be added to support older clients
 func (tr *Repo) SignRoot(expires time.Time, extraSigningKeys data.KeyList) (*data.Signed, error) {
+	return tr.signRoot(expires, extraSigningKeys, true)
+}
+
+// SignRootPartially signs the root in the same way as SignRoot, but does not
+// require that the locally available keys meet the thresholds of the roles
+// that have to sign it.  The resulting metadata may carry too few signatures
+// to be trusted, and is meant to be co-signed by the other key holders.
+func (tr *Repo) SignRootPartially(expires time.Time, extraSigningKeys data.KeyList) (*data.Signed, error) {
+	return tr.signRoot(expires, extraSigningKeys, false)
+}
+
+func (tr *Repo) signRoot(expires time.Time, extraSigningKeys data.KeyList, meetThreshold bool) (*data.Signed, error) {
 	logrus.Debug("signing root...")
 
 	// duplicate root and attempt to modify it rather than the existing root
@@ -930,7 +1286,7 @@ func (tr *Repo) SignRoot(expires time.Time, extraSigningKeys data.KeyList) (*dat
 		return nil, err
 	}
 
-	signed, err = tr.sign(signed, rolesToSignWith, extraSigningKeys)
+	signed, err = tr.sign(signed, rolesToSignWith, extraSigningKeys, meetThreshold)
 	if err != nil {
 		return nil, err
 	}
@@ -947,6 +1303,17 @@ func oldRootVersionName(version int) string {
 
 // SignTargets signs the targets file for the given top level or delegated targets role
 func (tr *Repo) SignTargets(role data.RoleName, expires time.Time) (*data.Signed, error) {
+	return tr.signTargets(role, expires, true)
+}
+
+// SignTargetsPartially signs the targets file for the given top level or
+// delegated targets role with whichever of the role's keys are available,
+// even if there are fewer of them than the role's threshold.
+func (tr *Repo) SignTargetsPartially(role data.RoleName, expires time.Time) (*data.Signed, error) {
+	return tr.signTargets(role, expires, false)
+}
+
+func (tr *Repo) signTargets(role data.RoleName, expires time.Time, meetThreshold bool) (*data.Signed, error) {
 	logrus.Debugf("sign targets called for role %s", role)
 	if _, ok := tr.Targets[role]; !ok {
 		return nil, data.ErrInvalidRole{
@@ -976,7 +1343,7 @@ func (tr *Repo) SignTargets(role data.RoleName, expires time.Time) (*data.Signed
 		return nil, err
 	}
 
-	signed, err = tr.sign(signed, []data.BaseRole{targets}, nil)
+	signed, err = tr.sign(signed, []data.BaseRole{targets}, nil, meetThreshold)
 	if err != nil {
 		logrus.Debug("errored signing ", role)
 		return nil, err
@@ -1018,7 +1385,7 @@ func (tr *Repo) SignSnapshot(expires time.Time) (*data.Signed, error) {
 	if err != nil {
 		return nil, err
 	}
-	signed, err = tr.sign(signed, []data.BaseRole{snapshot}, nil)
+	signed, err = tr.sign(signed, []data.BaseRole{snapshot}, nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1047,7 +1414,7 @@ func (tr *Repo) SignTimestamp(expires time.Time) (*data.Signed, error) {
 	if err != nil {
 		return nil, err
 	}
-	signed, err = tr.sign(signed, []data.BaseRole{timestamp}, nil)
+	signed, err = tr.sign(signed, []data.BaseRole{timestamp}, nil, true)
 	if err != nil {
 		return nil, err
 	}
@@ -1056,12 +1423,18 @@ func (tr *Repo) SignTimestamp(expires time.Time) (*data.Signed, error) {
 	return signed, nil
 }
 
-func (tr Repo) sign(signedData *data.Signed, roles []data.BaseRole, optionalKeys []data.PublicKey) (*data.Signed, error) {
+// sign signs the data with the keys of each of the given roles, failing if
+// meetThreshold is set and there are not enough keys to meet a role's threshold.
+func (tr Repo) sign(signedData *data.Signed, roles []data.BaseRole, optionalKeys []data.PublicKey, meetThreshold bool) (*data.Signed, error) {
 	validKeys := optionalKeys
 	for _, r := range roles {
 		roleKeys := r.ListKeys()
 		validKeys = append(roleKeys, validKeys...)
-		if err := signed.Sign(tr.cryptoService, signedData, roleKeys, r.Threshold, validKeys); err != nil {
+		minSignatures := r.Threshold
+		if !meetThreshold {
+			minSignatures = 0
+		}
+		if err := signed.Sign(tr.cryptoService, signedData, roleKeys, minSignatures, validKeys); err != nil {
 			return nil, err
 		}
 	}
@@ -3,6 +3,7 @@ package tuf
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -409,10 +410,30 @@ func TestUpdateDelegationsNotEnoughKeys(t *testing.T) {
 	require.NoError(t, err)
 
 	err = repo.UpdateDelegationKeys("targets/role", []data.PublicKey{roleKey}, []string{}, 2)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	// the delegation is not added to its parent
+	r, ok := repo.Targets[data.CanonicalTargetsRole]
+	require.True(t, ok)
+	require.Empty(t, r.Signed.Delegations.Roles)
+
+	// nor can a key be removed from a role once it is down to its threshold
+	otherKey, err := ed25519.Create("Invalid Role", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/role", []data.PublicKey{roleKey, otherKey}, []string{}, 2)
 	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/role", []data.PublicKey{}, []string{roleKey.ID()}, 0)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.Len(t, r.Signed.Delegations.Roles[0].KeyIDs, 2)
+
+	// unless all of them are removed
+	err = repo.UpdateDelegationKeys("targets/role", []data.PublicKey{}, []string{roleKey.ID(), otherKey.ID()}, 0)
+	require.NoError(t, err)
+	require.Empty(t, r.Signed.Delegations.Roles[0].KeyIDs)
 
 	// no delegation metadata created for failed delegation
-	_, ok := repo.Targets["targets/role"]
+	_, ok = repo.Targets["targets/role"]
 	require.False(t, ok, "no targets file should be created since delegation failed")
 }
 
@@ -453,6 +474,359 @@ func TestUpdateDelegationsAddKeyToRole(t *testing.T) {
 	require.True(t, r.Dirty)
 }
 
+func TestUpdateDelegationsThreshold(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	testKey, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	testKey2, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey, testKey2}, []string{}, 2)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/test", []string{"test"}, []string{}, false)
+	require.NoError(t, err)
+
+	// updating the paths did not reset the threshold
+	role, err := repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Equal(t, 2, role.Threshold)
+	require.Len(t, role.Keys, 2)
+
+	// a threshold of 0 leaves the existing threshold alone
+	testKey3, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey3}, []string{}, 0)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Equal(t, 2, role.Threshold)
+	require.Len(t, role.Keys, 3)
+
+	// but a positive one replaces it
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{}, []string{}, 3)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.Equal(t, 3, role.Threshold)
+
+	// a new delegation created with a threshold of 0 gets the minimum threshold
+	err = repo.UpdateDelegationKeys("targets/other", []data.PublicKey{testKey}, []string{}, 0)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/other", []string{""}, []string{}, false)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/other")
+	require.NoError(t, err)
+	require.Equal(t, 1, role.Threshold)
+}
+
+func TestUpdateDelegationTerminating(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	testKey, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+
+	// the delegation has to exist first
+	err = repo.UpdateDelegationTerminating("targets/test", true)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey}, []string{}, 1)
+	require.NoError(t, err)
+	role, err := repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.False(t, role.Terminating)
+
+	err = repo.UpdateDelegationTerminating("targets/test", true)
+	require.NoError(t, err)
+
+	// updating the keys and paths does not reset it
+	err = repo.UpdateDelegationPaths("targets/test", []string{"test"}, []string{}, false)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{}, []string{}, 0)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.True(t, role.Terminating)
+
+	err = repo.UpdateDelegationTerminating("targets/test", false)
+	require.NoError(t, err)
+	role, err = repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+	require.False(t, role.Terminating)
+
+	err = repo.UpdateDelegationTerminating("targets", true)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+// A walk for a target path does not go on to other delegations after a
+// terminating delegation for that path, apart from the delegation's own
+// delegations
+func TestWalkTargetsTerminating(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	delegations := []struct {
+		name  data.RoleName
+		paths []string
+	}{
+		{"targets/a", []string{"foo"}},
+		{"targets/b", []string{""}},
+		{"targets/a/c", []string{"foo/bar"}},
+	}
+	for _, d := range delegations {
+		key, err := ed25519.Create(d.name, testGUN, data.ED25519Key)
+		require.NoError(t, err)
+		require.NoError(t, repo.UpdateDelegationKeys(d.name, []data.PublicKey{key}, []string{}, 1))
+		require.NoError(t, repo.UpdateDelegationPaths(d.name, d.paths, []string{}, false))
+		_, err = repo.InitTargets(d.name)
+		require.NoError(t, err)
+	}
+
+	walked := func(targetPath string) []data.RoleName {
+		var visited []data.RoleName
+		err := repo.WalkTargets(targetPath, "", func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+			visited = append(visited, validRole.Name)
+			return nil
+		})
+		require.NoError(t, err)
+		return visited
+	}
+
+	require.Equal(t, []data.RoleName{"targets", "targets/a", "targets/b", "targets/a/c"}, walked("foo/bar"))
+
+	require.NoError(t, repo.UpdateDelegationTerminating("targets/a", true))
+	require.Equal(t, []data.RoleName{"targets", "targets/a", "targets/a/c"}, walked("foo/bar"))
+	// paths the terminating delegation doesn't match are unaffected
+	require.Equal(t, []data.RoleName{"targets", "targets/b"}, walked("baz"))
+	// as are walks that are not for a particular path
+	require.Equal(t, []data.RoleName{"targets", "targets/a", "targets/b", "targets/a/c"}, walked(""))
+
+	// a terminating delegation without metadata ends the walk straight away
+	delete(repo.Targets, "targets/a")
+	require.Equal(t, []data.RoleName{"targets"}, walked("foo/bar"))
+}
+
+// A terminating delegation only leaves out the roles after it in a pre-order
+// walk, so the delegations of a sibling listed before it are still walked
+func TestWalkTargetsTerminatingAfterSibling(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	for _, name := range []data.RoleName{"targets/a", "targets/b", "targets/c", "targets/a/x", "targets/b/y", "targets/c/z"} {
+		key, err := ed25519.Create(name, testGUN, data.ED25519Key)
+		require.NoError(t, err)
+		require.NoError(t, repo.UpdateDelegationKeys(name, []data.PublicKey{key}, []string{}, 1))
+		require.NoError(t, repo.UpdateDelegationPaths(name, []string{""}, []string{}, false))
+		_, err = repo.InitTargets(name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.UpdateDelegationTerminating("targets/b", true))
+
+	walked := func() []data.RoleName {
+		var visited []data.RoleName
+		err := repo.WalkTargets("foo", "", func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+			visited = append(visited, validRole.Name)
+			return nil
+		})
+		require.NoError(t, err)
+		return visited
+	}
+	require.Equal(t, []data.RoleName{"targets", "targets/a", "targets/b", "targets/a/x", "targets/b/y"}, walked())
+
+	// nor does a terminating delegation without metadata cut them off
+	delete(repo.Targets, "targets/b")
+	require.Equal(t, []data.RoleName{"targets", "targets/a", "targets/a/x"}, walked())
+}
+
+func TestHashedBinDelegations(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	key, err := ed25519.Create("targets/releases", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateDelegationKeys("targets/releases", []data.PublicKey{key}, []string{}, 1))
+	require.NoError(t, repo.UpdateDelegationPaths("targets/releases", []string{""}, []string{}, false))
+	_, err = repo.InitTargets("targets/releases")
+	require.NoError(t, err)
+
+	binFor := func(role data.RoleName, targetPath string) data.RoleName {
+		bin, err := repo.HashedBinFor(role, targetPath)
+		require.NoError(t, err)
+		return bin
+	}
+
+	// find a target path for each bin
+	var lowPath, highPath string
+	for i := 0; lowPath == "" || highPath == ""; i++ {
+		targetPath := fmt.Sprintf("target%d", i)
+		if data.PathHash(targetPath)[0] < '8' {
+			lowPath = targetPath
+		} else {
+			highPath = targetPath
+		}
+	}
+
+	// no bins yet
+	require.Equal(t, data.RoleName("targets/releases"), binFor("targets/releases", "a"))
+	existing := data.FileMeta{Length: 2, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = repo.AddTargets("targets/releases", data.Files{lowPath: existing, highPath: existing})
+	require.NoError(t, err)
+
+	bins := map[data.RoleName][]string{
+		"targets/releases/0-7": {"0", "1", "2", "3", "4", "5", "6", "7"},
+		"targets/releases/8-f": {"8", "9", "a", "b", "c", "d", "e", "f"},
+	}
+	for bin, prefixes := range bins {
+		require.NoError(t, repo.UpdateDelegationKeys(bin, []data.PublicKey{key}, []string{}, 1))
+		require.NoError(t, repo.UpdateDelegationPathHashPrefixes(bin, prefixes, nil))
+	}
+	err = repo.UpdateDelegationPathHashPrefixes("targets/releases/0-7", []string{"zz"}, nil)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	err = repo.UpdateDelegationPathHashPrefixes("targets/releases/missing", []string{"0"}, nil)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	require.Equal(t, data.RoleName("targets/releases/0-7"), binFor("targets/releases", lowPath))
+	require.Equal(t, data.RoleName("targets/releases/8-f"), binFor("targets/releases", highPath))
+	require.Equal(t, data.RoleName(data.CanonicalTargetsRole), binFor(data.CanonicalTargetsRole, lowPath))
+
+	// the targets that were already in the role are moved into their bins
+	err = repo.MoveTargetsToHashedBin("targets/releases")
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	for bin := range bins {
+		require.NoError(t, repo.MoveTargetsToHashedBin(bin))
+	}
+	require.Empty(t, repo.Targets["targets/releases"].Signed.Targets)
+	require.Equal(t, data.Files{lowPath: existing}, repo.Targets["targets/releases/0-7"].Signed.Targets)
+	require.Equal(t, data.Files{highPath: existing}, repo.Targets["targets/releases/8-f"].Signed.Targets)
+	require.NoError(t, repo.RemoveTargets("targets/releases/8-f", highPath))
+
+	meta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = repo.AddTargets("targets/releases/8-f", data.Files{lowPath: meta})
+	require.Error(t, err)
+	_, err = repo.AddTargets("targets/releases/0-7", data.Files{lowPath: meta})
+	require.NoError(t, err)
+
+	var found data.RoleName
+	err = repo.WalkTargets(lowPath, "", func(tgt *data.SignedTargets, validRole data.DelegationRole) interface{} {
+		if _, ok := tgt.Signed.Targets[lowPath]; ok {
+			found = validRole.Name
+			return StopWalk{}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, data.RoleName("targets/releases/0-7"), found)
+
+	// the walk for the bin fails if the repo has no targets role to start it from
+	_, err = NewRepo(ed25519).HashedBinFor("targets/releases", lowPath)
+	require.Error(t, err)
+
+	// bins can only be delegated by a role that can sign for all paths, or by another bin
+	require.NoError(t, repo.UpdateDelegationPaths("targets/releases", []string{"foo"}, []string{""}, false))
+	err = repo.UpdateDelegationPathHashPrefixes("targets/releases/0-7", []string{"0"}, nil)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+}
+
+func TestUpdateDelegationPathType(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	key, err := ed25519.Create("targets/platforms", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateDelegationKeys("targets/platforms", []data.PublicKey{key}, []string{}, 1))
+
+	require.Error(t, repo.UpdateDelegationPathType("targets/platforms", "regexp"))
+	require.Error(t, repo.UpdateDelegationPathType("targets/missing", data.PathTypeGlob))
+	require.NoError(t, repo.UpdateDelegationPathType("targets/platforms", data.PathTypeGlob))
+
+	// patterns have to be well formed
+	err = repo.UpdateDelegationPaths("targets/platforms", []string{"*/linux-amd64/[a"}, []string{}, false)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.NoError(t, repo.UpdateDelegationPaths("targets/platforms", []string{"*/linux-amd64/*"}, []string{}, false))
+
+	delgRole, err := repo.GetDelegationRole("targets/platforms")
+	require.NoError(t, err)
+	require.Equal(t, data.PathTypeGlob, delgRole.PathType)
+	require.Equal(t, []string{"*/linux-amd64/*"}, delgRole.Paths)
+
+	meta := data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": make([]byte, 32)}}
+	_, err = repo.AddTargets("targets/platforms", data.Files{"app/linux-amd64/app.tar.gz": meta})
+	require.NoError(t, err)
+	_, err = repo.AddTargets("targets/platforms", data.Files{"app/darwin-amd64/app.tar.gz": meta})
+	require.Error(t, err)
+
+	// a child of a role with patterns has to have patterns the parent's patterns cover
+	childKey, err := ed25519.Create("targets/platforms/app", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateDelegationKeys("targets/platforms/app", []data.PublicKey{childKey}, []string{}, 1))
+	err = repo.UpdateDelegationPaths("targets/platforms/app", []string{"app/linux-amd64/"}, []string{}, false)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.NoError(t, repo.UpdateDelegationPathType("targets/platforms/app", data.PathTypeGlob))
+	err = repo.UpdateDelegationPaths("targets/platforms/app", []string{"app/*/*"}, []string{}, false)
+	require.Error(t, err)
+	require.NoError(t, repo.UpdateDelegationPaths("targets/platforms/app", []string{"app/linux-amd64/*"}, []string{}, false))
+
+	// switching back to path prefixes is rejected while the role's paths are not valid prefixes
+	err = repo.UpdateDelegationPathType("targets/platforms/app", data.PathTypePrefix)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	// and switching the parent to prefixes is fine, since it may sign for all the paths with those prefixes
+	require.NoError(t, repo.UpdateDelegationPathType("targets/platforms", data.PathTypePrefix))
+	delgRole, err = repo.GetDelegationRole("targets/platforms")
+	require.NoError(t, err)
+	require.Equal(t, data.PathType(""), delgRole.PathType)
+	require.False(t, delgRole.CheckPaths("app/linux-amd64/app.tar.gz"))
+	require.True(t, delgRole.CheckPaths("*/linux-amd64/*"))
+}
+
+func TestSignDelegationWithThreshold(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	testKey, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	testKey2, err := ed25519.Create("targets/test", testGUN, data.ED25519Key)
+	require.NoError(t, err)
+
+	err = repo.UpdateDelegationKeys("targets/test", []data.PublicKey{testKey, testKey2}, []string{}, 2)
+	require.NoError(t, err)
+	err = repo.UpdateDelegationPaths("targets/test", []string{""}, []string{}, false)
+	require.NoError(t, err)
+	_, err = repo.InitTargets("targets/test")
+	require.NoError(t, err)
+
+	role, err := repo.GetDelegationRole("targets/test")
+	require.NoError(t, err)
+
+	// both delegation keys are needed to sign
+	signedTargets, err := repo.SignTargets("targets/test", data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	require.Len(t, signedTargets.Signatures, 2)
+	require.NoError(t, signed.VerifySignatures(signedTargets, role.BaseRole))
+
+	require.NoError(t, ed25519.RemoveKey(testKey2.ID()))
+	_, err = repo.SignTargets("targets/test", data.DefaultExpires(data.CanonicalTargetsRole))
+	require.Error(t, err)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+
+	// signing partially only uses the key that is still available
+	signedTargets, err = repo.SignTargetsPartially("targets/test", data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	require.Len(t, signedTargets.Signatures, 1)
+	require.Equal(t, testKey.ID(), signedTargets.Signatures[0].KeyID)
+	require.Error(t, signed.VerifySignatures(signedTargets, role.BaseRole))
+}
+
 func TestDeleteDelegations(t *testing.T) {
 	ed25519 := signed.NewEd25519()
 	repo := initRepo(t, ed25519)
@@ -1070,6 +1444,106 @@ func TestReplaceBaseKeysInRoot(t *testing.T) {
 	}
 }
 
+// Replacing the keys of a role with a set that overlaps the current keys keeps
+// the overlapping private keys available for signing.
+func TestReplaceBaseKeysKeepsRetainedKeys(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	origKeyIDs := ed25519.ListKeys(data.CanonicalTargetsRole)
+	require.Len(t, origKeyIDs, 1)
+	origKey := ed25519.GetKey(origKeyIDs[0])
+	key, err := ed25519.Create(data.CanonicalTargetsRole, testGUN, data.ED25519Key)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.ReplaceBaseKeys(data.CanonicalTargetsRole, origKey, key, key))
+	require.Len(t, repo.Root.Signed.Roles[data.CanonicalTargetsRole].KeyIDs, 2)
+	require.NotNil(t, ed25519.GetKey(origKey.ID()))
+
+	require.NoError(t, repo.ReplaceBaseKeys(data.CanonicalTargetsRole, key))
+	require.Equal(t, []string{key.ID()}, repo.Root.Signed.Roles[data.CanonicalTargetsRole].KeyIDs)
+	require.Nil(t, ed25519.GetKey(origKey.ID()))
+	require.NotNil(t, ed25519.GetKey(key.ID()))
+}
+
+func TestSetBaseRoleThreshold(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+	repo.Root.Dirty = false
+	repo.Targets[data.CanonicalTargetsRole].Dirty = false
+
+	// a threshold equal to the current one doesn't dirty anything
+	require.NoError(t, repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, 1))
+	require.False(t, repo.Root.Dirty)
+
+	for _, threshold := range []int{0, 2} {
+		err := repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, threshold)
+		require.Error(t, err)
+		require.IsType(t, data.ErrInvalidRole{}, err)
+	}
+	err := repo.SetBaseRoleThreshold("targets/a", 1)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+
+	key, err := ed25519.Create(data.CanonicalTargetsRole, testGUN, data.ED25519Key)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddBaseKeys(data.CanonicalTargetsRole, key))
+	require.NoError(t, repo.SetBaseRoleThreshold(data.CanonicalTargetsRole, 2))
+	require.True(t, repo.Root.Dirty)
+	require.True(t, repo.Targets[data.CanonicalTargetsRole].Dirty)
+
+	targetsRole, err := repo.GetBaseRole(data.CanonicalTargetsRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, targetsRole.Threshold)
+
+	// both keys are needed to sign the targets now
+	signedTargets, err := repo.SignTargets(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.NoError(t, err)
+	require.Len(t, signedTargets.Signatures, 2)
+	require.NoError(t, signed.VerifySignatures(signedTargets, targetsRole))
+
+	require.NoError(t, ed25519.RemoveKey(key.ID()))
+	_, err = repo.SignTargets(data.CanonicalTargetsRole, data.DefaultExpires(data.CanonicalTargetsRole))
+	require.Error(t, err)
+	require.IsType(t, signed.ErrInsufficientSignatures{}, err)
+}
+
+func TestReplaceBaseKeysAndThreshold(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	repo := initRepo(t, ed25519)
+
+	origKeyIDs := ed25519.ListKeys(data.CanonicalSnapshotRole)
+	require.Len(t, origKeyIDs, 1)
+	var keys []data.PublicKey
+	for i := 0; i < 2; i++ {
+		key, err := ed25519.Create(data.CanonicalSnapshotRole, testGUN, data.ED25519Key)
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	// a threshold that can't be met leaves the role untouched
+	err := repo.ReplaceBaseKeysAndThreshold(data.CanonicalSnapshotRole, 3, keys...)
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.Equal(t, origKeyIDs, repo.Root.Signed.Roles[data.CanonicalSnapshotRole].KeyIDs)
+	require.NotNil(t, ed25519.GetKey(origKeyIDs[0]))
+
+	require.NoError(t, repo.ReplaceBaseKeysAndThreshold(data.CanonicalSnapshotRole, 2, keys...))
+	snapshotRole, err := repo.GetBaseRole(data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, snapshotRole.Threshold)
+	require.Len(t, snapshotRole.Keys, 2)
+
+	// a threshold of 0 keeps the current threshold, which a single key can't meet
+	err = repo.ReplaceBaseKeysAndThreshold(data.CanonicalSnapshotRole, 0, keys[0])
+	require.Error(t, err)
+	require.IsType(t, data.ErrInvalidRole{}, err)
+	require.NoError(t, repo.ReplaceBaseKeysAndThreshold(data.CanonicalSnapshotRole, 0, keys[1], keys[0]))
+	snapshotRole, err = repo.GetBaseRole(data.CanonicalSnapshotRole)
+	require.NoError(t, err)
+	require.Equal(t, 2, snapshotRole.Threshold)
+}
+
 func TestGetAllRoles(t *testing.T) {
 	ed25519 := signed.NewEd25519()
 	repo := initRepo(t, ed25519)
@@ -1480,7 +1954,7 @@ func TestRootKeyRotation(t *testing.T) {
 	repo := initRepoWithRoot(t, cs, rootCertKeys[0])
 	signedObj, err := repo.Root.ToSigned()
 	require.NoError(t, err)
-	signedObj, err = repo.sign(signedObj, nil, []data.PublicKey{rootCertKeys[0]})
+	signedObj, err = repo.sign(signedObj, nil, []data.PublicKey{rootCertKeys[0]}, true)
 	require.NoError(t, err)
 	verifySignatureList(t, signedObj, rootCertKeys[0])
 	repo.Root.Signatures = signedObj.Signatures